@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/client"
+)
+
+func benchCommand(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	name := fs.String("name", "", "Name of the running virtual machine (required)")
+	_ = fs.Parse(args)
+
+	if *name == "" {
+		fmt.Println("name is required")
+		return 1
+	}
+
+	entries, err := liveNameEntries(path.Join(consts.RuntimeDir, "names", *name))
+	if err != nil {
+		fmt.Printf("list name registry error: %v\n", err)
+		return 1
+	}
+
+	if len(entries) == 0 || entries[0].BootedAt.IsZero() {
+		fmt.Printf("%s is not running or not ready yet\n", *name)
+		return 1
+	}
+
+	// the guest stops every step after 30s, this only guards against an unresponsive ovm
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	fmt.Fprintln(os.Stderr, "running an approximate disk and network benchmark in the guest, this takes a few seconds...")
+	c := client.New(path.Join(entries[0].SocketPath, *name+"-restful.sock"))
+	result, err := c.Bench(ctx)
+	if err != nil {
+		fmt.Printf("bench error: %v\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		fmt.Printf("encode error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
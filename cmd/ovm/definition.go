@@ -0,0 +1,571 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const definitionVersion = "1"
+
+// definitionFields maps the scalar fields of a machine definition to the flags of the config file.
+// Flags with host specific paths (log-path, socket-path, target-path, ...) and secrets (otlp-header) are never exported.
+var definitionFields = []struct {
+	section, key, flag string
+}{
+	{"resources", "cpus", "cpus"},
+	{"resources", "bootCpus", "boot-cpus"},
+	{"resources", "memory", "memory"},
+	{"network", "mtu", "mtu"},
+	{"network", "exposeDockerSocket", "expose-docker-socket"},
+	{"guest", "clockSource", "clock-source"},
+	{"guest", "tmpMount", "tmp-mount"},
+	{"guest", "powerSaveMode", "power-save-mode"},
+	{"guest", "rootfsOverlay", "rootfs-overlay"},
+	{"artifacts", "versions", "versions"},
+}
+
+// artifactFiles are the files whose digests are recorded, keyed like versions.json.
+var artifactFiles = []string{"kernel", "initrd", "rootfs"}
+
+// configEntry is a "flag=value" line of a config file.
+type configEntry struct {
+	key, value string
+}
+
+func (e configEntry) String() string {
+	return e.key + "=" + e.value
+}
+
+func definitionCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: ovm definition export|apply [flags]")
+		return 1
+	}
+
+	switch args[0] {
+	case "export":
+		return definitionExport(args[1:])
+	case "apply":
+		return definitionApply(args[1:])
+	default:
+		fmt.Printf("unknown definition command: %s\n", args[0])
+		return 1
+	}
+}
+
+func definitionExport(args []string) int {
+	fs := flag.NewFlagSet("definition export", flag.ExitOnError)
+	configPath := fs.String("config", "", "Config file of the instance (required)")
+	output := fs.String("output", "", "Write the definition to this file instead of stdout")
+	_ = fs.Parse(args)
+
+	if *configPath == "" {
+		fmt.Println("config is required")
+		return 1
+	}
+
+	entries, err := readConfigEntries(*configPath)
+	if err != nil {
+		fmt.Printf("read config error: %v\n", err)
+		return 1
+	}
+
+	doc, skipped, err := exportDefinition(entries)
+	if err != nil {
+		fmt.Printf("export definition error: %v\n", err)
+		return 1
+	}
+	// stdout may be the definition itself
+	if len(skipped) != 0 {
+		fmt.Fprintf(os.Stderr, "not exported (host specific, secret or not part of a definition): %s\n", strings.Join(skipped, ", "))
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("create output error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := fmt.Fprintln(w, "# ovm machine definition, apply with: ovm definition apply -config FILE DEFINITION"); err != nil {
+		fmt.Printf("write definition error: %v\n", err)
+		return 1
+	}
+	if err := writeYAML(w, doc, 0); err != nil {
+		fmt.Printf("write definition error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// exportDefinition returns the definition of the config entries, and the flags of the entries which are not exported, sorted.
+func exportDefinition(entries []configEntry) (yamlMap, []string, error) {
+	doc := yamlMap{"version": definitionVersion}
+
+	exported := map[string]bool{"mount": true}
+	for _, f := range definitionFields {
+		exported[f.flag] = true
+	}
+	var skipped []string
+	for _, e := range entries {
+		if !exported[e.key] && !slices.Contains(skipped, e.key) {
+			skipped = append(skipped, e.key)
+		}
+	}
+	slices.Sort(skipped)
+
+	section := func(name string) yamlMap {
+		if s, ok := doc[name].(yamlMap); ok {
+			return s
+		}
+		s := yamlMap{}
+		doc[name] = s
+		return s
+	}
+
+	for _, f := range definitionFields {
+		if v, ok := lastValue(entries, f.flag); ok {
+			section(f.section)[f.key] = v
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+
+	var mounts []yamlMap
+	for _, e := range entries {
+		if e.key != "mount" {
+			continue
+		}
+
+		m, err := mountToDefinition(e.value, home)
+		if err != nil {
+			return nil, nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	if len(mounts) != 0 {
+		doc["mounts"] = mounts
+	}
+
+	// digests let the receiver check that it boots the same artifacts, the local paths are not portable
+	if target, ok := lastValue(entries, "target-path"); ok {
+		v, err := cli.ReadVersions(path.Join(target, "versions.json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("read versions error: %w", err)
+		}
+
+		if v != nil {
+			for _, k := range artifactFiles {
+				if pv, ok := v.Provenance[k]; ok && pv.Digest != "" {
+					section("artifacts")[k+"Digest"] = pv.Digest
+				}
+			}
+		}
+	}
+
+	return doc, skipped, nil
+}
+
+// mountToDefinition converts "HOST_PATH[:GUEST_PATH][,ro][,uid=host]", paths below the home directory are written relative to "~".
+// Without GUEST_PATH the guest field is left out, the receiver mounts it at its own host path, like the mount flag does.
+func mountToDefinition(v, home string) (yamlMap, error) {
+	items := strings.Split(v, ",")
+	hostPath, guestPath, found := strings.Cut(items[0], ":")
+	hostPath = filepath.Clean(hostPath)
+
+	if home != "" && (hostPath == home || strings.HasPrefix(hostPath, home+"/")) {
+		hostPath = "~" + strings.TrimPrefix(hostPath, home)
+	}
+
+	m := yamlMap{
+		"host": hostPath,
+	}
+	if found {
+		m["guest"] = filepath.Clean(guestPath)
+	}
+
+	for _, opt := range items[1:] {
+		switch opt {
+		case "ro":
+			m["readOnly"] = "true"
+		case "uid=host":
+			m["uid"] = "host"
+		default:
+			return nil, fmt.Errorf("mount %s: unknown option %s", v, opt)
+		}
+	}
+
+	return m, nil
+}
+
+func mountFromDefinition(m yamlMap, home string) (string, error) {
+	host, _ := m["host"].(string)
+	guest, _ := m["guest"].(string)
+	if host == "" {
+		return "", errors.New("mount: host is required")
+	}
+
+	if host == "~" || strings.HasPrefix(host, "~/") {
+		if home == "" {
+			return "", fmt.Errorf("mount %s: home directory is unknown", host)
+		}
+		host = home + strings.TrimPrefix(host, "~")
+	}
+
+	v := host
+	if guest != "" && guest != host {
+		v += ":" + guest
+	}
+
+	// sorted, so applying the same definition always writes the same entry
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := m[k]
+		switch k {
+		case "host", "guest":
+		case "readOnly":
+			switch value {
+			case "true":
+				v += ",ro"
+			case "false":
+			default:
+				return "", fmt.Errorf("mount %s: readOnly must be true or false", host)
+			}
+		case "uid":
+			if value != "host" {
+				return "", fmt.Errorf("mount %s: only uid: host is supported", host)
+			}
+			v += ",uid=host"
+		default:
+			return "", fmt.Errorf("mount %s: unknown field %s", host, k)
+		}
+	}
+
+	return v, nil
+}
+
+// definitionEntries converts a definition into config entries, sorted like definitionFields with mounts last.
+func definitionEntries(doc yamlMap) ([]configEntry, map[string]string, error) {
+	if v, _ := doc["version"].(string); v != definitionVersion {
+		return nil, nil, fmt.Errorf("unsupported definition version %q, expected %s", doc["version"], definitionVersion)
+	}
+
+	known := map[string]map[string]string{}
+	for _, f := range definitionFields {
+		if known[f.section] == nil {
+			known[f.section] = map[string]string{}
+		}
+		known[f.section][f.key] = f.flag
+	}
+
+	var entries []configEntry
+	digests := map[string]string{}
+
+	for name, value := range doc {
+		switch name {
+		case "version", "mounts":
+			continue
+		}
+
+		fields, ok := known[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown section %s", name)
+		}
+
+		s, ok := value.(yamlMap)
+		if !ok {
+			return nil, nil, fmt.Errorf("section %s must be a map", name)
+		}
+
+		for k, v := range s {
+			str, ok := v.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("%s.%s must be a scalar", name, k)
+			}
+
+			if name == "artifacts" && strings.HasSuffix(k, "Digest") && slices.Contains(artifactFiles, strings.TrimSuffix(k, "Digest")) {
+				digests[strings.TrimSuffix(k, "Digest")] = str
+				continue
+			}
+
+			f, ok := fields[k]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown field %s.%s", name, k)
+			}
+			entries = append(entries, configEntry{key: f, value: str})
+		}
+	}
+
+	order := map[string]int{}
+	for i, f := range definitionFields {
+		order[f.flag] = i
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return order[entries[i].key] < order[entries[j].key]
+	})
+
+	if v, ok := doc["mounts"]; ok && v != nil {
+		list, ok := v.([]any)
+		if !ok {
+			return nil, nil, errors.New("mounts must be a list")
+		}
+
+		home, _ := os.UserHomeDir()
+		for _, item := range list {
+			m, ok := item.(yamlMap)
+			if !ok {
+				return nil, nil, errors.New("mounts must be a list of maps")
+			}
+
+			v, err := mountFromDefinition(m, home)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries = append(entries, configEntry{key: "mount", value: v})
+		}
+	}
+
+	return entries, digests, nil
+}
+
+func definitionApply(args []string) int {
+	fs := flag.NewFlagSet("definition apply", flag.ExitOnError)
+	configPath := fs.String("config", "", "Config file of the instance to create or update (required)")
+	yes := fs.Bool("yes", false, "Apply without asking for confirmation")
+	_ = fs.Parse(args)
+
+	if *configPath == "" || fs.NArg() != 1 {
+		fmt.Println("usage: ovm definition apply -config FILE [-yes] DEFINITION")
+		return 1
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("open definition error: %v\n", err)
+		return 1
+	}
+	doc, err := parseYAML(f)
+	_ = f.Close()
+	if err != nil {
+		fmt.Printf("parse definition error: %v\n", err)
+		return 1
+	}
+
+	wanted, digests, err := definitionEntries(doc)
+	if err != nil {
+		fmt.Printf("invalid definition: %v\n", err)
+		return 1
+	}
+
+	current, err := readConfigEntries(*configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("read config error: %v\n", err)
+		return 1
+	}
+
+	// everything the definition does not manage (host paths, secrets, ...) is kept
+	managed := map[string]bool{"mount": true}
+	for _, f := range definitionFields {
+		managed[f.flag] = true
+	}
+	var oldManaged, kept []configEntry
+	for _, e := range current {
+		if managed[e.key] {
+			oldManaged = append(oldManaged, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+
+	checkDigests(kept, digests)
+
+	removed, added := diffEntries(oldManaged, wanted)
+	if len(removed) == 0 && len(added) == 0 {
+		fmt.Printf("%s is up to date\n", *configPath)
+		return 0
+	}
+
+	fmt.Printf("changes to %s:\n", *configPath)
+	for _, e := range removed {
+		fmt.Printf("  - %s\n", e)
+	}
+	for _, e := range added {
+		fmt.Printf("  + %s\n", e)
+	}
+
+	if !*yes && !confirm("apply these changes?") {
+		fmt.Println("nothing changed")
+		return 1
+	}
+
+	if err := writeConfigEntries(*configPath, kept, wanted); err != nil {
+		fmt.Printf("write config error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s updated\n", *configPath)
+
+	// all managed flags are read at boot, so every change is picked up by a single restart
+	if name, ok := lastValue(kept, "name"); ok {
+		live, err := liveNameEntries(path.Join(consts.RuntimeDir, "names", name))
+		if err == nil && len(live) != 0 {
+			fmt.Printf("ovm %s is running (pid %d), restart it once to apply all changes\n", name, live[0].PID)
+		}
+	}
+
+	return 0
+}
+
+// checkDigests warns when the local artifacts differ from the ones the definition was exported with.
+func checkDigests(entries []configEntry, digests map[string]string) {
+	if len(digests) == 0 {
+		return
+	}
+
+	target, ok := lastValue(entries, "target-path")
+	if !ok {
+		return
+	}
+
+	v, err := cli.ReadVersions(path.Join(target, "versions.json"))
+	if err != nil {
+		return
+	}
+
+	for _, k := range artifactFiles {
+		want, ok := digests[k]
+		if !ok {
+			continue
+		}
+
+		if pv, ok := v.Provenance[k]; ok && pv.Digest != "" && pv.Digest != want {
+			fmt.Printf("warning: local %s is %s, the definition was exported with %s\n", k, pv.Digest, want)
+		}
+	}
+}
+
+// diffEntries compares entries as multisets, because mount may be repeated.
+func diffEntries(old, wanted []configEntry) (removed, added []configEntry) {
+	count := map[configEntry]int{}
+	for _, e := range old {
+		count[e]++
+	}
+
+	for _, e := range wanted {
+		if count[e] > 0 {
+			count[e]--
+			continue
+		}
+		added = append(added, e)
+	}
+
+	for _, e := range old {
+		if count[e] > 0 {
+			count[e]--
+			removed = append(removed, e)
+		}
+	}
+
+	return removed, added
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+func lastValue(entries []configEntry, key string) (string, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].key == key {
+			return entries[i].value, true
+		}
+	}
+
+	return "", false
+}
+
+// readConfigEntries reads a config file in the format of -config.
+func readConfigEntries(p string) ([]configEntry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []configEntry
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected flag=value", line)
+		}
+
+		entries = append(entries, configEntry{
+			key:   strings.TrimLeft(strings.TrimSpace(key), "-"),
+			value: strings.TrimSpace(value),
+		})
+	}
+
+	return entries, sc.Err()
+}
+
+// writeConfigEntries replaces the config file atomically, so a running instance never reads a partial file.
+func writeConfigEntries(p string, kept, managed []configEntry) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	sb := strings.Builder{}
+	for _, e := range kept {
+		sb.WriteString(e.String() + "\n")
+	}
+	sb.WriteString("# managed by ovm definition apply\n")
+	for _, e := range managed {
+		sb.WriteString(e.String() + "\n")
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMountToDefinition(t *testing.T) {
+	m, err := mountToDefinition("/Users/me/src,ro", "/Users/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["host"] != "~/src" {
+		t.Errorf("host = %v, want ~/src", m["host"])
+	}
+	if _, ok := m["guest"]; ok {
+		t.Errorf("guest of a mount without a guest path is exported: %v", m["guest"])
+	}
+
+	m, err = mountToDefinition("/opt/data:/data", "/Users/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["host"] != "/opt/data" || m["guest"] != "/data" {
+		t.Errorf("mount = %v", m)
+	}
+}
+
+func TestMountFromDefinitionOrder(t *testing.T) {
+	m := yamlMap{"host": "~/src", "guest": "/src", "uid": "host", "readOnly": "true"}
+
+	// map order is random, every conversion must produce the same entry
+	for i := 0; i < 20; i++ {
+		v, err := mountFromDefinition(m, "/home/me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "/home/me/src:/src,ro,uid=host" {
+			t.Fatalf("mount = %q", v)
+		}
+	}
+}
+
+func TestExportDefinitionSkipped(t *testing.T) {
+	entries := []configEntry{
+		{"cpus", "4"},
+		{"log-path", "/tmp/logs"},
+		{"forward", "8080:80"},
+		{"forward", "8443:443"},
+		{"mount", "/opt/data:/data"},
+	}
+
+	doc, skipped, err := exportDefinition(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(skipped, []string{"forward", "log-path"}) {
+		t.Errorf("skipped = %v", skipped)
+	}
+	if doc["resources"].(yamlMap)["cpus"] != "4" {
+		t.Errorf("cpus not exported: %v", doc)
+	}
+}
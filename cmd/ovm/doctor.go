@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func doctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	targetPath := fs.String("target-path", "", "Directory of the disk images and kernel/initrd/rootfs files (required)")
+	sshKeyPath := fs.String("ssh-key-path", "", "Directory of the ssh keys, to also check the files of the keys of -name")
+	name := fs.String("name", "", "Name of the virtual machine, used with -ssh-key-path")
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	_ = fs.Parse(args)
+
+	if *targetPath == "" {
+		fmt.Println("target-path is required")
+		return 1
+	}
+
+	statuses := cli.SchemaStatuses(*targetPath, *sshKeyPath, *name)
+
+	code := 0
+	for _, s := range statuses {
+		if s.TooNew() || s.Error != "" {
+			code = 1
+		}
+	}
+
+	if *asJSON {
+		type status struct {
+			*cli.SchemaStatus
+			Pending bool `json:"pending"`
+			TooNew  bool `json:"tooNew"`
+		}
+		out := make([]status, 0, len(statuses))
+		for _, s := range statuses {
+			out = append(out, status{SchemaStatus: s, Pending: s.Pending(), TooNew: s.TooNew()})
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Printf("encode schemas error: %v\n", err)
+			return 1
+		}
+		return code
+	}
+
+	for _, s := range statuses {
+		fmt.Printf("%s (%s): ", s.Name, s.Path)
+		switch {
+		case !s.Exists:
+			fmt.Printf("not written yet, schema %d\n", s.Current)
+		case s.Error != "":
+			fmt.Printf("unreadable: %s\n", s.Error)
+		case s.TooNew():
+			fmt.Printf("schema %d, written by a newer ovm which supports up to %d: downgrade not supported\n", s.Version, s.Current)
+		case s.Pending():
+			fmt.Printf("schema %d, migrated to %d on the next start\n", s.Version, s.Current)
+		default:
+			fmt.Printf("schema %d, up to date\n", s.Version)
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+var envShells = []string{"bash", "zsh", "fish", "json"}
+
+// envVars are all variables printed by `ovm env`, -unset clears all of them.
+var envVars = []string{"OVM_NAME", "CONTAINER_HOST", "DOCKER_HOST"}
+
+type envVar struct {
+	key, value string
+}
+
+func envCommand(args []string) int {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	name := fs.String("name", "", "Name of the virtual machine (required unless -cross-arch)")
+	shell := fs.String("shell", "bash", "Format of the output: bash, zsh, fish or json")
+	unset := fs.Bool("unset", false, "Print the commands unsetting the variables instead")
+	crossArch := fs.String("cross-arch", "", "Also print the environment building for this architecture (amd64 or arm64), for images of another machine")
+	_ = fs.Parse(args)
+
+	if !slices.Contains(envShells, *shell) {
+		fmt.Fprintf(os.Stderr, "shell must be one of %s\n", strings.Join(envShells, ", "))
+		return 1
+	}
+
+	var cross []envVar
+	if *crossArch != "" {
+		env, err := cli.GuestArch(*crossArch).CrossCompileEnvironment()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cross-arch %s: %v\n", *crossArch, err)
+			return 1
+		}
+		for _, kv := range env {
+			k, v, _ := strings.Cut(kv, "=")
+			cross = append(cross, envVar{k, v})
+		}
+	}
+
+	if *unset {
+		keys := slices.Clone(envVars)
+		for _, v := range cross {
+			keys = append(keys, v.key)
+		}
+		printUnsetEnv(*shell, keys)
+		return 0
+	}
+
+	if *name == "" && len(cross) == 0 {
+		fmt.Fprintln(os.Stderr, "name is required")
+		return 1
+	}
+
+	var vars []envVar
+	if *name != "" {
+		entry, running, err := envEntry(*name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !running {
+			fmt.Fprintf(os.Stderr, "%s is not running, the sockets of its last start are printed\n", *name)
+		}
+
+		vars = append(vars, envVar{"OVM_NAME", *name}, envVar{"CONTAINER_HOST", "unix://" + entry.PodmanSocketPath})
+		if entry.DockerSocketPath != "" {
+			vars = append(vars, envVar{"DOCKER_HOST", "unix://" + entry.DockerSocketPath})
+		}
+	}
+	vars = append(vars, cross...)
+
+	if *shell == "json" {
+		out := make(map[string]string, len(vars))
+		for _, v := range vars {
+			out[v.key] = v.value
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "encode env error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, v := range vars {
+		if *shell == "fish" {
+			fmt.Printf("set -gx %s %s;\n", v.key, cli.ShellQuote(v.value))
+		} else {
+			fmt.Printf("export %s=%s\n", v.key, cli.ShellQuote(v.value))
+		}
+	}
+	flags := strings.Join(args, " ")
+	if *shell == "fish" {
+		fmt.Printf("# ovm env %s | source\n", flags)
+	} else {
+		fmt.Printf("# eval \"$(ovm env %s)\"\n", flags)
+	}
+
+	return 0
+}
+
+// envEntry returns the registry entry of the running instance, or of its last start.
+// The registry is in RuntimeDir, which is cleared when the host restarts.
+func envEntry(name string) (entry nameEntry, running bool, err error) {
+	entries, err := liveNameEntries(path.Join(consts.RuntimeDir, "names", name))
+	if err != nil && !os.IsNotExist(err) {
+		return entry, false, fmt.Errorf("list name registry error: %w", err)
+	}
+	for _, e := range entries {
+		if e.PodmanSocketPath != "" {
+			return e, true, nil
+		}
+	}
+
+	data, err := os.ReadFile(lastStartPath(name))
+	if os.IsNotExist(err) {
+		return entry, false, fmt.Errorf("%s was never started (since the host started), start it once with -name %s first", name, name)
+	}
+	if err != nil {
+		return entry, false, fmt.Errorf("read last start error: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false, fmt.Errorf("decode last start error: %w", err)
+	}
+	if entry.PodmanSocketPath == "" {
+		return entry, false, fmt.Errorf("the last start of %s did not finish the setup, its sockets are unknown", name)
+	}
+
+	return entry, false, nil
+}
+
+func printUnsetEnv(shell string, keys []string) {
+	switch shell {
+	case "json":
+		data, _ := json.Marshal(keys)
+		fmt.Println(string(data))
+	case "fish":
+		for _, k := range keys {
+			fmt.Printf("set -e %s;\n", k)
+		}
+	default:
+		fmt.Printf("unset %s\n", strings.Join(keys, " "))
+	}
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func importDataCommand(args []string) int {
+	fs := flag.NewFlagSet("import-data", flag.ExitOnError)
+	from := fs.String("from", "", "Raw disk image to import, e.g. the disk of a podman machine (required)")
+	targetPath := fs.String("target-path", "", "Target path of the new instance, the image is placed there as data.img (required)")
+	_ = fs.Parse(args)
+
+	if *from == "" || *targetPath == "" {
+		fmt.Println("from and target-path are required")
+		return 1
+	}
+
+	imp, err := cli.ImportDataDisk(*targetPath, *from)
+	if err != nil {
+		fmt.Printf("import data error: %v\n", err)
+		return 1
+	}
+
+	method := "cloned"
+	if !imp.Cloned {
+		method = "copied"
+	}
+	fmt.Printf("%s %s (%s) to data.img, the container storage is provisioned on the first start\n", method, imp.Source, imp.Filesystem)
+
+	return 0
+}
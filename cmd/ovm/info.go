@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func infoCommand(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	targetPath := fs.String("target-path", "", "Directory of the disk images and kernel/initrd/rootfs files (required)")
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	_ = fs.Parse(args)
+
+	if *targetPath == "" {
+		fmt.Println("target-path is required")
+		return 1
+	}
+
+	v, err := cli.ReadVersions(path.Join(*targetPath, "versions.json"))
+	if err != nil {
+		fmt.Printf("read versions error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fmt.Printf("encode versions error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("generation: %d\n", v.Generation)
+	if history, err := cli.ReadShutdownHistory(cli.ShutdownHistoryPath(*targetPath)); err == nil && len(history) != 0 {
+		last := history[0]
+		fmt.Printf("last shutdown: %s at %s", last.Reason, last.Time.Format("2006-01-02 15:04:05"))
+		if last.Initiator != "" {
+			fmt.Printf(", by %s", last.Initiator)
+		}
+		if last.Detail != "" {
+			fmt.Printf(" (%s)", last.Detail)
+		}
+		fmt.Println()
+	}
+	if v.AssetVersion != "" {
+		fmt.Printf("asset version: %s\n", v.AssetVersion)
+	}
+	if v.HostKey != "" {
+		fmt.Printf("guest host key: %s\n", v.HostKey)
+	}
+	if len(v.Dirty) != 0 {
+		fmt.Printf("corrupted, copied again on the next start: %s\n", strings.Join(v.Dirty, ", "))
+	}
+
+	keys := make([]string, 0, len(v.Versions))
+	for k := range v.Versions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("\n%s: %s\n", k, v.Versions[k])
+
+		pv, ok := v.Provenance[k]
+		if !ok {
+			fmt.Println("  no provenance recorded")
+			continue
+		}
+
+		printProvenance("  ", pv)
+		for _, h := range pv.History {
+			fmt.Printf("  previous %s:\n", h.Version)
+			printProvenance("    ", &h)
+		}
+	}
+
+	return 0
+}
+
+func printProvenance(indent string, pv *cli.Provenance) {
+	if pv.Source != "" {
+		fmt.Printf("%ssource: %s\n", indent, pv.Source)
+	}
+	if pv.Digest != "" {
+		fmt.Printf("%sdigest: %s\n", indent, pv.Digest)
+	}
+	fmt.Printf("%supdated: %s (generation %d, delta: %t)\n", indent, pv.UpdatedAt.Format("2006-01-02 15:04:05"), pv.Generation, pv.DeltaUpdated)
+	if imp := pv.Import; imp != nil {
+		fmt.Printf("%simported: %s (%s, cloned: %t, provisioned: %t)\n", indent, imp.ImportedAt.Format("2006-01-02 15:04:05"), imp.Filesystem, imp.Cloned, imp.Provisioned)
+	}
+}
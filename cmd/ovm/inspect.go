@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+)
+
+type inspectResult struct {
+	nameEntry
+	// Uptime is in seconds, zero if the VM is not ready yet
+	Uptime int64 `json:"uptime"`
+}
+
+func inspectCommand(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	name := fs.String("name", "", "Name of the virtual machine (required)")
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	_ = fs.Parse(args)
+
+	if *name == "" {
+		fmt.Println("name is required")
+		return 1
+	}
+
+	entries, err := liveNameEntries(path.Join(consts.RuntimeDir, "names", *name))
+	if err != nil {
+		fmt.Printf("list name registry error: %v\n", err)
+		return 1
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("%s is not running\n", *name)
+		return 1
+	}
+
+	results := make([]inspectResult, 0, len(entries))
+	for _, e := range entries {
+		r := inspectResult{nameEntry: e}
+		if !e.BootedAt.IsZero() {
+			r.Uptime = int64(time.Since(e.BootedAt).Seconds())
+		}
+		results = append(results, r)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Printf("encode error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, r := range results {
+		fmt.Printf("pid: %d\n", r.PID)
+		fmt.Printf("executable: %s\n", r.ExecutablePath)
+		fmt.Printf("sockets: %s\n", r.SocketPath)
+		fmt.Printf("started: %s\n", r.StartedAt.Format(time.RFC3339))
+		if r.BootedAt.IsZero() {
+			fmt.Println("booted: not ready yet")
+		} else {
+			fmt.Printf("booted: %s (up %s)\n", r.BootedAt.Format(time.RFC3339), time.Duration(r.Uptime)*time.Second)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func knownHostsCommand(args []string) int {
+	fs := flag.NewFlagSet("known-hosts", flag.ExitOnError)
+	targetPath := fs.String("target-path", "", "Directory of the disk images and kernel/initrd/rootfs files (required)")
+	name := fs.String("name", "", "Name of the running virtual machine, to use its ssh port")
+	port := fs.Int("port", 0, "SSH port on the host, instead of the port of the running virtual machine")
+	_ = fs.Parse(args)
+
+	if *targetPath == "" {
+		fmt.Println("target-path is required")
+		return 1
+	}
+
+	if *port == 0 {
+		if *name == "" {
+			fmt.Println("name or port is required")
+			return 1
+		}
+
+		entries, err := liveNameEntries(path.Join(consts.RuntimeDir, "names", *name))
+		if err != nil {
+			fmt.Printf("list name registry error: %v\n", err)
+			return 1
+		}
+
+		if len(entries) == 0 || entries[0].SSHPort == 0 {
+			fmt.Printf("%s is not running or not ready yet\n", *name)
+			return 1
+		}
+		*port = entries[0].SSHPort
+	}
+
+	key, err := cli.ReadGuestHostKey(path.Join(*targetPath, "versions.json"))
+	if err != nil {
+		fmt.Printf("read guest host key error: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(cli.KnownHostsLine(key, *port))
+	return 0
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+// rotatedSuffix matches the rotation index of a log file, e.g. "myvm-ovm.2.log".
+var rotatedSuffix = regexp.MustCompile(`\.\d+$`)
+
+// logComponents are the loggers of an instance, its log files are named ${name}-${component}.log
+var logComponents = []string{"ovm", "vfkit", "gvproxy", "event", "guest"}
+
+type logRecord struct {
+	component string
+	entry     logger.Entry
+	lines     []string
+}
+
+type logFilter struct {
+	level string
+	since time.Time
+}
+
+func (f *logFilter) match(e *logger.Entry) bool {
+	return e.LevelAtLeast(f.level) && !e.Time.Before(f.since)
+}
+
+func logsCommand(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	logPath := fs.String("log-path", "", "Directory to store logs (required)")
+	name := fs.String("name", "", "Only show logs of this virtual machine")
+	follow := fs.Bool("follow", false, "Keep printing new log lines")
+	level := fs.String("level", "info", "Minimum level to show: info, warn or error")
+	since := fs.Duration("since", 0, "Only show logs newer than this, e.g. 5m")
+	_ = fs.Parse(args)
+
+	if *logPath == "" {
+		fmt.Println("log-path is required")
+		return 1
+	}
+
+	filter := &logFilter{level: *level}
+	if *since > 0 {
+		filter.since = time.Now().Add(-*since)
+	}
+
+	files, err := logFiles(*logPath, *name)
+	if err != nil {
+		fmt.Printf("list log files error: %v\n", err)
+		return 1
+	}
+
+	var records []*logRecord
+	offsets := map[string]int64{}
+	for _, p := range files {
+		f, err := os.Open(p)
+		if err != nil {
+			fmt.Printf("open log file error: %v\n", err)
+			return 1
+		}
+
+		rs, n := readRecords(f, component(p))
+		_ = f.Close()
+
+		records = append(records, rs...)
+		if !rotatedSuffix.MatchString(strings.TrimSuffix(p, ".log")) {
+			offsets[p] = n
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].entry.Time.Before(records[j].entry.Time)
+	})
+
+	out := bufio.NewWriter(os.Stdout)
+	for _, r := range records {
+		if filter.match(&r.entry) {
+			printRecord(out, r)
+		}
+	}
+	_ = out.Flush()
+
+	if !*follow {
+		return 0
+	}
+
+	followLogs(*logPath, *name, offsets, filter)
+	return 0
+}
+
+// logFiles lists the logs written by ovm, the serial console log of the guest (${name}-vm.log) has no log format and is skipped.
+func logFiles(logPath, name string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(logPath, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(files))
+	for _, p := range files {
+		c := component(p)
+		if strings.HasSuffix(c, "-vm") {
+			continue
+		}
+		// names may contain "-", a prefix of "vm-2-ovm" would also match the name vm
+		if n, ok := instanceName(c); name != "" && (!ok || n != name) {
+			continue
+		}
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// instanceName returns the name of the instance writing the component, e.g. "my-vm" for "my-vm-gvproxy".
+func instanceName(c string) (string, bool) {
+	for _, lc := range logComponents {
+		if n, ok := strings.CutSuffix(c, "-"+lc); ok && n != "" {
+			return n, true
+		}
+	}
+
+	return "", false
+}
+
+// component returns the logger name of the file, e.g. "myvm-ovm" for both "myvm-ovm.log" and "myvm-ovm.2.log".
+func component(p string) string {
+	return rotatedSuffix.ReplaceAllString(strings.TrimSuffix(filepath.Base(p), ".log"), "")
+}
+
+// readRecords reads complete lines from r and returns the records and the number of bytes consumed.
+// Lines without a timestamp belong to the previous record (e.g. multi-line messages).
+func readRecords(r io.Reader, c string) (records []*logRecord, n int64) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			// incomplete line, it will be read again when following
+			return records, n
+		}
+		n += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		if entry, ok := logger.ParseLine(line); ok {
+			records = append(records, &logRecord{component: c, entry: entry, lines: []string{line}})
+		} else if len(records) != 0 {
+			last := records[len(records)-1]
+			last.lines = append(last.lines, line)
+		}
+	}
+}
+
+func printRecord(w io.Writer, r *logRecord) {
+	for _, line := range r.lines {
+		_, _ = fmt.Fprintf(w, "%s | %s\n", r.component, line)
+	}
+}
+
+// followLogs polls the latest log files and prints newly appended records.
+// A file that shrinks has been recreated by a new ovm run, so it is read again from the beginning.
+func followLogs(logPath, name string, offsets map[string]int64, filter *logFilter) {
+	for {
+		time.Sleep(500 * time.Millisecond)
+
+		files, err := logFiles(logPath, name)
+		if err != nil {
+			continue
+		}
+
+		for _, p := range files {
+			if rotatedSuffix.MatchString(strings.TrimSuffix(p, ".log")) {
+				continue
+			}
+
+			stat, err := os.Stat(p)
+			if err != nil {
+				continue
+			}
+
+			offset := offsets[p]
+			if stat.Size() < offset {
+				offset = 0
+			}
+			if stat.Size() == offset {
+				continue
+			}
+
+			f, err := os.Open(p)
+			if err != nil {
+				continue
+			}
+
+			if _, err := f.Seek(offset, io.SeekStart); err == nil {
+				records, n := readRecords(f, component(p))
+				offsets[p] = offset + n
+
+				for _, r := range records {
+					if filter.match(&r.entry) {
+						printRecord(os.Stdout, r)
+					}
+				}
+			}
+			_ = f.Close()
+		}
+	}
+}
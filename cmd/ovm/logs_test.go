@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"vm-ovm.log", "vm-gvproxy.2.log", "vm-vm.log", "vm-2-ovm.log", "vm-2-event.log", "single-instance.log"} {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"vm", []string{"vm-gvproxy.2.log", "vm-ovm.log"}},
+		{"vm-2", []string{"vm-2-event.log", "vm-2-ovm.log"}},
+		{"v", nil},
+		{"", []string{"single-instance.log", "vm-2-event.log", "vm-2-ovm.log", "vm-gvproxy.2.log", "vm-ovm.log"}},
+	}
+
+	for _, tt := range tests {
+		files, err := logFiles(dir, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range files {
+			got = append(got, filepath.Base(f))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("logFiles(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -6,17 +6,23 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/oomol-lab/ovm/pkg/channel"
 	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/guestlog"
+	"github.com/oomol-lab/ovm/pkg/guestservice"
 	"github.com/oomol-lab/ovm/pkg/gvproxy"
+	"github.com/oomol-lab/ovm/pkg/handover"
 	"github.com/oomol-lab/ovm/pkg/ipc/event"
 	"github.com/oomol-lab/ovm/pkg/logger"
 	"github.com/oomol-lab/ovm/pkg/sshagentsock"
@@ -25,14 +31,39 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// exitDowngradeNotSupported is the exit code when a file of the target path was written by a newer ovm.
+const exitDowngradeNotSupported = 3
+
+// vmStopTimeout bounds how long the network is kept for stopping the VM, the stop is forced after a grace period of 10s
+const vmStopTimeout = 15 * time.Second
+
 var (
-	opt    *cli.Context
-	sigs   = make(chan os.Signal, 1)
-	cleans []func()
+	opt          *cli.Context
+	registration *nameRegistration
+	sigs         = make(chan os.Signal, 1)
+	cleans       []func()
+	// restarting is set by -watch-artifacts=auto-apply, main starts ovm again once everything stopped
+	restarting atomic.Bool
 )
 
-func init() {
-	cli.Parse()
+// prepare parses the flags and runs the subcommands, it is called by main and not in init, so the tests of this package do not start ovm.
+func prepare() {
+	runSubcommand()
+
+	if err := cli.Parse(); err != nil {
+		fmt.Printf("parse flags error: %v\n", err)
+		exit(1)
+	}
+
+	if cli.NeedWizard() {
+		if start, err := cli.RunWizard(os.Stdin, os.Stdout); err != nil {
+			fmt.Printf("setup wizard error: %v\n", err)
+			exit(1)
+		} else if !start {
+			exit(0)
+		}
+	}
+
 	if err := cli.Validate(); err != nil {
 		fmt.Printf("validate flags error: %v\n", err)
 		exit(1)
@@ -46,9 +77,16 @@ func init() {
 }
 
 func main() {
+	prepare()
+
 	// See: https://github.com/crc-org/vfkit/pull/13/commits/906916ab9b92af7a5662fd7fe9246d61d39da4ee
 	signal.Ignore(syscall.SIGPIPE)
 
+	// the running ovm keeps accepting on the passed listeners until it was stopped, so its clients are not refused while this ovm starts
+	if listeners, err := handover.Receive(opt.HandoverSocketPath, 2*time.Second); err == nil {
+		opt.Inherit(listeners)
+	}
+
 	{
 		if lock, err := makeSingleInstance(opt.LogPath, opt.LockFile, opt.ExecutablePath); err != nil {
 			fmt.Println("make single instance error:", err)
@@ -64,11 +102,40 @@ func main() {
 		exit(1)
 	}
 
-	if err := opt.Setup(); err != nil {
+	if r, err := registerName(opt, log); err != nil {
+		log.Errorf("register name error: %v", err)
+		exit(1)
+	} else {
+		registration = r
+		cleans = append(cleans, r.unregister)
+	}
+
+	if err := opt.Setup(log); err != nil {
 		log.Errorf("setup error: %v", err)
+		if errors.Is(err, cli.ErrDowngradeNotSupported) {
+			exit(exitDowngradeNotSupported)
+		}
 		exit(1)
 	}
 
+	registration.setup(opt)
+
+	if names := opt.Inherited(); len(names) != 0 {
+		log.Infof("took over listeners: %v", names)
+	}
+
+	for _, p := range opt.SchemaMigrations {
+		log.Infof("migrated %s to the schema of this ovm", p)
+	}
+
+	for _, fix := range opt.SSHKeyModeFixes {
+		log.Warnf("fixed ssh key permissions, %s", fix)
+	}
+
+	if p := opt.RootfsPrewarm; p != nil {
+		log.Infof("prewarmed %d of %d MiB of the rootfs in %dms", p.Bytes>>20, p.Size>>20, p.DurationMs)
+	}
+
 	{
 		if err := event.Init(opt); err != nil {
 			log.Errorf("event init error: %v", err)
@@ -82,10 +149,32 @@ func main() {
 		})
 	}
 
-	agent, err := sshagentsock.Start(opt.SSHAuthSocketPath, log)
-	if err != nil {
-		log.Errorf("start ssh agent sock error: %v", err)
-		exit(1)
+	if names := opt.Inherited(); len(names) != 0 {
+		event.NotifyWithMessage(event.TakeoverStarted, strings.Join(names, ","))
+	}
+
+	opt.AuditCLI(log, "start", nil)
+
+	for _, d := range opt.AssetDecisions {
+		if d.Copied {
+			log.Infof("copied %s in %dms, because: %s", d.Key, d.DurationMs, d.Reason)
+		} else {
+			log.Infof("kept %s, because: %s", d.Key, d.Reason)
+		}
+	}
+	if data, err := json.Marshal(opt.AssetDecisions); err == nil {
+		event.NotifyWithMessage(event.AssetsPrepared, string(data))
+	}
+
+	// not started with -disable-sockets ssh-auth
+	var closeAgent func() error
+	if opt.SSHAuthSocketPath != "" {
+		agent, err := sshagentsock.Start(opt.SSHAuthSocketPath, log)
+		if err != nil {
+			log.Errorf("start ssh agent sock error: %v", err)
+			exit(1)
+		}
+		closeAgent = agent.Close
 	}
 
 	event.Notify(event.Initializing)
@@ -99,31 +188,85 @@ func main() {
 		exit(1)
 	}
 
-	g.Go(func() error {
-		<-ctx.Done()
-		return agent.Close()
-	})
+	if opt.ForwardGuestLogs {
+		if err := guestlog.Run(ctx, g, opt, log); err != nil {
+			log.Errorf("forward guest logs failed: %v", err)
+			cancel()
+			exit(1)
+		}
+	}
+
+	guestservice.Run(ctx, g, opt, log)
+
+	if closeAgent != nil {
+		g.Go(func() error {
+			<-ctx.Done()
+			return closeAgent()
+		})
+	}
 
 	g.Go(func() error {
 		waitBindPID(ctx, log, opt.BindPID)
+		if ctx.Err() == nil {
+			recordShutdown(log, cli.ShutdownBindPIDExit, fmt.Sprintf("pid %d", opt.BindPID), "")
+		}
 		cancel()
 		return nil
 	})
 
+	// the network outlives ctx until the VM stopped, so -shutdown-command still reaches the guest over ssh
+	netCtx, cancelNet := context.WithCancel(context.Background())
 	g.Go(func() error {
-		return gvproxy.Run(ctx, g, opt)
+		<-ctx.Done()
+		select {
+		case <-opt.VMStopped():
+		case <-time.After(vmStopTimeout):
+		}
+		cancelNet()
+		return nil
+	})
+
+	g.Go(func() error {
+		return gvproxy.Run(netCtx, g, opt)
 	})
 
 	g.Go(func() error {
 		return vfkit.Run(ctx, g, opt)
 	})
 
+	if opt.ConfigPath != "" {
+		g.Go(func() error {
+			hups := make(chan os.Signal, 1)
+			signal.Notify(hups, syscall.SIGHUP)
+			defer signal.Stop(hups)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-hups:
+					reloadConfig(log)
+				}
+			}
+		})
+	}
+
+	if opt.WatchArtifacts != "" {
+		watchArtifacts(ctx, g, log, cancel)
+	}
+
+	if opt.LogTotalBudget != 0 {
+		enforceLogBudget(ctx, g, log)
+	}
+
 	g.Go(func() error {
 		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
 		select {
 		case sig := <-sigs:
 			log.Warnf("received %s signal, exiting...", sig)
+			recordShutdown(log, cli.ShutdownSignalPrefix+signalName(sig), "", "")
+			opt.AuditCLI(log, "stop: "+signalName(sig), nil)
 			cancel()
 			return errors.New("signal caught")
 		case <-ctx.Done():
@@ -131,35 +274,217 @@ func main() {
 		}
 	})
 
-	if err := g.Wait(); err != nil {
+	err = g.Wait()
+	if restarting.Load() {
+		restart(log)
+	}
+
+	if err != nil {
 		log.Errorf("main error: %v", err)
+		recordShutdown(log, cli.ShutdownCrashPrefix+"error", "", err.Error())
 		event.NotifyError(err)
 		exit(1)
 	} else {
 		log.Info("main exit")
+		recordShutdown(log, cli.ShutdownExit, "", "")
 		exit(0)
 	}
 }
 
+// reloadConfig reports what changed in the config file since the start, on SIGHUP.
+func reloadConfig(log *logger.Context) {
+	log.Infof("received SIGHUP, reloading %s", opt.ConfigPath)
+
+	r, err := opt.ReloadConfig()
+	if err != nil {
+		log.Warnf("reload config failed: %v", err)
+		return
+	}
+
+	for _, a := range r.Applied {
+		log.Infof("reload config: %s, applied", a)
+	}
+	for _, f := range r.Failed {
+		log.Warnf("reload config: %s", f)
+	}
+	for _, change := range r.RestartRequired {
+		log.Infof("reload config: %s, restart required", change)
+	}
+
+	if data, err := json.Marshal(r); err == nil {
+		event.NotifyWithMessage(event.ConfigReloaded, string(data))
+	}
+}
+
+// watchArtifacts reports changed kernel/initrd/rootfs sources, with auto-apply it restarts ovm to copy them.
+// Every change restarts the delay of the restart, so successive builds are applied by a single restart.
+func watchArtifacts(ctx context.Context, g *errgroup.Group, log *logger.Context, cancel context.CancelFunc) {
+	log.Warnf("watching the artifact sources, -watch-artifacts=%s is a development feature", opt.WatchArtifacts)
+
+	updates := make(chan struct{}, 1)
+	g.Go(func() error {
+		return opt.WatchSources(ctx, func(keys []string) {
+			log.Infof("artifact sources changed: %s", strings.Join(keys, ", "))
+			if data, err := json.Marshal(keys); err == nil {
+				event.NotifyWithMessage(event.UpdateAvailable, string(data))
+			}
+
+			select {
+			case updates <- struct{}{}:
+			default:
+			}
+		})
+	})
+
+	if opt.WatchArtifacts != cli.WatchAutoApply {
+		return
+	}
+
+	g.Go(func() error {
+		const delay = 5 * time.Second
+		var apply <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-updates:
+				log.Infof("restart in %s to apply the changed artifacts", delay)
+				apply = time.After(delay)
+			case <-apply:
+				log.Info("restart to apply the changed artifacts")
+				recordShutdown(log, cli.ShutdownArtifactUpdate, "", "")
+				restarting.Store(true)
+				cancel()
+				return nil
+			}
+		}
+	})
+}
+
+// enforceLogBudget keeps the log files within -log-total-budget, once at the start and then every minute.
+func enforceLogBudget(ctx context.Context, g *errgroup.Group, log *logger.Context) {
+	g.Go(func() error {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		warned := false
+		for {
+			r, err := opt.EnforceLogBudget()
+			if err != nil {
+				log.Warnf("enforce log budget failed: %v", err)
+			}
+			if r != nil {
+				if len(r.Removed) != 0 {
+					log.Infof("removed log files to stay within the log budget: %s", strings.Join(r.Removed, ", "))
+				}
+				// the current files only shrink on the next start, warn once instead of every minute
+				if r.Exceeded && !warned {
+					if err := opt.Warn(log, cli.WarnLogBudgetExceeded, "log files in use exceed the log budget of %d bytes: %d bytes", opt.LogTotalBudget, r.TotalBytes); err != nil {
+						return err
+					}
+				}
+				warned = r.Exceeded
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// restart stops everything like exit, and runs ovm again with the same arguments in this process.
+func restart(log *logger.Context) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Errorf("restart error: %v", err)
+		exit(1)
+	}
+
+	log.Info("main restart")
+	cleanup()
+	err = syscall.Exec(exe, os.Args, os.Environ())
+	// the loggers are closed already
+	fmt.Printf("restart error: %v\n", err)
+	os.Exit(1)
+}
+
+// recordShutdown records the reason, unless an earlier one of this process is recorded already.
+func recordShutdown(log *logger.Context, reason, initiator, detail string) {
+	if err := opt.RecordShutdown(reason, initiator, detail); err != nil {
+		log.Warnf("record shutdown failed: %v", err)
+	}
+}
+
+func signalName(sig os.Signal) string {
+	if s, ok := sig.(syscall.Signal); ok {
+		switch s {
+		case syscall.SIGTERM:
+			return "SIGTERM"
+		case syscall.SIGINT:
+			return "SIGINT"
+		}
+	}
+
+	return sig.String()
+}
+
 func ready(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) error {
+	// -disable-sockets ready needs -assume-ready, nothing can signal ready
+	if opt.SocketReadyPath == "" {
+		g.Go(func() error {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(opt.AssumeReadyAfter):
+			}
+
+			log.Infof("assume the VM is ready after %s, because the ready socket is disabled", opt.AssumeReadyAfter)
+			vmReady(g, opt, log, true)
+			return nil
+		})
+		return nil
+	}
+
 	nl, err := net.Listen("unix", opt.SocketReadyPath)
 	if err != nil {
 		return err
 	}
 
 	g.Go(func() error {
-		conn, err := utils.AcceptTimeout(ctx, nl, time.After(30*time.Second))
+		timeout := cli.DefaultReadyTimeout
+		if opt.AssumeReady {
+			timeout = opt.AssumeReadyAfter
+		}
+
+		conn, err := utils.AcceptTimeout(ctx, nl, time.After(timeout))
 		if err != nil {
+			// an image without the ready signal is ready once the time elapsed
+			if opt.AssumeReady && ctx.Err() == nil {
+				if err := opt.Warn(log, cli.WarnReadyAssumed, "no ready signal within %s, assume the VM is ready", timeout); err != nil {
+					return err
+				}
+				vmReady(g, opt, log, true)
+				return nil
+			}
+
 			log.Errorf("ready accept timeout: %v", err)
 			return err
 		}
 
-		if _, rerr := bufio.NewReader(conn).ReadString('\n'); rerr != nil {
+		line, rerr := bufio.NewReader(conn).ReadString('\n')
+		log.Tracef(logger.VsockAgent, "ready socket received: %q", line)
+		if rerr != nil {
 			log.Errorf("read ready failed: %v", rerr)
 			err = rerr
+		} else if msg := strings.TrimSpace(line); msg != "Ready" {
+			log.Errorf("guest reported: %s", msg)
+			err = fmt.Errorf("guest reported: %s", msg)
 		} else {
-			channel.NotifyVMReady()
-			event.Notify(event.VMReady)
+			vmReady(g, opt, log, false)
 		}
 
 		if cerr := conn.Close(); cerr != nil {
@@ -173,7 +498,87 @@ func ready(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger
 	return nil
 }
 
+// vmReady starts everything waiting for the VM to be ready, assumed is true when the guest never signalled it.
+func vmReady(g *errgroup.Group, opt *cli.Context, log *logger.Context, assumed bool) {
+	bootedAt := time.Now()
+	opt.SetBootedAt(bootedAt)
+	registration.booted(bootedAt, opt.SSHPort)
+
+	channel.NotifyVMReady()
+	event.Notify(event.VMReady)
+	if len(opt.Inherited()) != 0 {
+		event.Notify(event.TakeoverDone)
+	}
+
+	// the provisioning of an imported data disk is only confirmed by the ready signal
+	if opt.ProvisionDataImport && !assumed {
+		if err := cli.MarkDataImportProvisioned(opt.VersionsPath); err != nil {
+			log.Warnf("record provisioned data import failed: %v", err)
+		} else {
+			log.Info("imported data disk provisioned")
+		}
+	}
+
+	// the host key and the container storage are read via ssh
+	if !opt.SocketEnabled(cli.SocketNetwork) {
+		log.Info("skip recording the guest host key and checking the container storage, the guest has no network for ssh")
+		return
+	}
+
+	g.Go(func() error {
+		if r, err := opt.RecordGuestHostKey(); err != nil {
+			log.Warnf("record guest host key failed: %v", err)
+		} else if r.Previous != "" {
+			log.Infof("guest host key changed from %s to %s, run ovm known-hosts to update known_hosts", r.Previous, r.Fingerprint)
+		} else {
+			log.Infof("guest host key: %s", r.Fingerprint)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		return checkStorage(log)
+	})
+
+	if opt.NetworkEmulationEnabled() {
+		g.Go(func() error {
+			if err := opt.ApplyNetworkEmulation(); err != nil {
+				return opt.Warn(log, cli.WarnNetworkEmulation, "%v", err)
+			}
+			log.Infof("network emulation applied: latency %s, packet loss %g%%", opt.NetworkLatency, opt.NetworkPacketLoss)
+			return nil
+		})
+	}
+}
+
+// checkStorage warns when the container storage of the guest is not on the data disk, where it would fill the rootfs.
+func checkStorage(log *logger.Context) error {
+	s, err := opt.CheckStorage()
+	if err != nil {
+		log.Warnf("check container storage failed: %v", err)
+		return nil
+	}
+
+	if s.Interrupted == "" && s.OnDataDisk {
+		return nil
+	}
+
+	if data, err := json.Marshal(s); err == nil {
+		event.NotifyWithMessage(event.StorageMisconfigured, string(data))
+	}
+
+	if s.Interrupted != "" {
+		return opt.Warn(log, cli.WarnStorageMigrationPaused, "migrating the container storage from %s was interrupted, POST /storage/migrate resumes it", s.Interrupted)
+	}
+	return opt.Warn(log, cli.WarnStorageNotOnDataDisk, "the container storage %s is on %s instead of the data disk, POST /storage/migrate moves it", s.GraphRoot, s.Device)
+}
+
 func exit(exitCode int) {
+	cleanup()
+	os.Exit(exitCode)
+}
+
+func cleanup() {
 	event.Notify(event.Exit)
 	for _, clean := range cleans {
 		clean()
@@ -181,5 +586,4 @@ func exit(exitCode int) {
 	close(sigs)
 	channel.Close()
 	logger.CloseAll()
-	os.Exit(exitCode)
 }
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"github.com/oomol-lab/ovm/pkg/utils"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// nameEntry is written to RuntimeDir/names/NAME/PID.json by every running ovm.
+// The pid lock file only prevents the same executable from running twice with the same name,
+// the registry also catches other executables (or copies) using the same name.
+type nameEntry struct {
+	PID            int       `json:"pid"`
+	ExecutablePath string    `json:"executablePath"`
+	SocketPath     string    `json:"socketPath"`
+	StartedAt      time.Time `json:"startedAt"`
+	// BootedAt is zero until the VM is ready
+	BootedAt time.Time `json:"bootedAt"`
+	// SSHPort is the port on the host forwarded to ssh of the guest, set with BootedAt
+	SSHPort int `json:"sshPort,omitempty"`
+	// PodmanSocketPath and DockerSocketPath are set after the setup, see `ovm env`
+	PodmanSocketPath string `json:"podmanSocketPath,omitempty"`
+	DockerSocketPath string `json:"dockerSocketPath,omitempty"`
+}
+
+// lastStartPath is the entry of the last start of the name, kept after the process exited.
+// It has no .json suffix, so it is not read as the entry of a running process.
+func lastStartPath(name string) string {
+	return path.Join(consts.RuntimeDir, "names", name, "last-start")
+}
+
+type nameRegistration struct {
+	p     string
+	name  string
+	entry nameEntry
+	log   *logger.Context
+}
+
+func registerName(opt *cli.Context, log *logger.Context) (*nameRegistration, error) {
+	dir := path.Join(consts.RuntimeDir, "names", opt.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create name registry failed: %w", err)
+	}
+
+	entries, err := liveNameEntries(dir)
+	if err != nil {
+		log.Warnf("list name registry failed: %v", err)
+	}
+
+	for _, entry := range entries {
+		if err := opt.Warn(log, cli.WarnNameInUse, "name %s is already used by pid %d (%s, sockets in %s)", opt.Name, entry.PID, entry.ExecutablePath, entry.SocketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &nameRegistration{
+		p:    path.Join(dir, strconv.Itoa(os.Getpid())+".json"),
+		name: opt.Name,
+		entry: nameEntry{
+			PID:            os.Getpid(),
+			ExecutablePath: opt.ExecutablePath,
+			SocketPath:     opt.SocketPath,
+			StartedAt:      time.Now(),
+		},
+		log: log,
+	}
+	if err := r.write(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// setup records the sockets, which are only known after the setup.
+// The last start is only written here, a start failing before would replace it with an entry without sockets.
+func (r *nameRegistration) setup(opt *cli.Context) {
+	r.entry.SocketPath = opt.SocketPath
+	r.entry.PodmanSocketPath = opt.ForwardSocketPath
+	r.entry.DockerSocketPath = opt.DockerSocketPath
+	if err := r.write(); err != nil {
+		r.log.Warnf("update name registry failed: %v", err)
+	}
+
+	data, err := json.Marshal(&r.entry)
+	if err == nil {
+		err = utils.WriteFileAtomic(lastStartPath(r.name), data, 0644)
+	}
+	if err != nil {
+		r.log.Warnf("write last start failed: %v", err)
+	}
+}
+
+// booted records the boot time, it is reset on every boot.
+func (r *nameRegistration) booted(t time.Time, sshPort int) {
+	r.entry.BootedAt = t
+	r.entry.SSHPort = sshPort
+	if err := r.write(); err != nil {
+		r.log.Warnf("update name registry failed: %v", err)
+	}
+}
+
+func (r *nameRegistration) unregister() {
+	_ = os.Remove(r.p)
+}
+
+func (r *nameRegistration) write() error {
+	data, err := json.Marshal(&r.entry)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(r.p, data, 0644); err != nil {
+		return fmt.Errorf("write name registry failed: %w", err)
+	}
+
+	return nil
+}
+
+// liveNameEntries returns the entries of other processes which are still running, stale entries are removed.
+func liveNameEntries(dir string) (result []nameEntry, err error) {
+	files, err := filepath.Glob(path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		var entry nameEntry
+		if data, err := os.ReadFile(f); err != nil || json.Unmarshal(data, &entry) != nil || entry.PID == os.Getpid() {
+			continue
+		}
+
+		if !isSameProcess(entry) {
+			_ = os.Remove(f)
+			continue
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// isSameProcess also checks the executable, because the pid may have been reused.
+func isSameProcess(entry nameEntry) bool {
+	if !utils.ProcessExists(entry.PID) {
+		return false
+	}
+
+	proc, err := process.NewProcess(int32(entry.PID))
+	if err != nil {
+		return false
+	}
+
+	exe, err := proc.Exe()
+	if err != nil {
+		return true
+	}
+
+	if realExe, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = realExe
+	}
+
+	return strings.ToLower(exe) == entry.ExecutablePath
+}
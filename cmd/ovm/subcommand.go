@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"os"
+)
+
+// subcommands are helper commands that run instead of starting a virtual machine, e.g. `ovm logs`.
+var subcommands = map[string]func(args []string) int{
+	"logs":        logsCommand,
+	"info":        infoCommand,
+	"inspect":     inspectCommand,
+	"definition":  definitionCommand,
+	"import-data": importDataCommand,
+	"bench":       benchCommand,
+	"known-hosts": knownHostsCommand,
+	"doctor":      doctorCommand,
+	"env":         envCommand,
+}
+
+// runSubcommand runs the subcommand given as the first argument and exits, it returns if there is none.
+func runSubcommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	if cmd, ok := subcommands[os.Args[1]]; ok {
+		os.Exit(cmd(os.Args[2:]))
+	}
+}
@@ -0,0 +1,260 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A minimal YAML subset for machine definitions: nested maps, lists of scalars or maps, scalars and comments.
+// Anchors, flow collections and multi-line strings are not supported.
+
+type yamlMap = map[string]any
+
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+func parseYAML(r io.Reader) (yamlMap, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(trimmed, " ")
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{no: i + 1, indent: len(trimmed) - len(text), text: text})
+	}
+
+	p := &yamlParser{lines: lines}
+	if len(lines) == 0 {
+		return yamlMap{}, nil
+	}
+
+	v, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[p.pos].no)
+	}
+
+	m, ok := v.(yamlMap)
+	if !ok {
+		return nil, fmt.Errorf("the document must be a map")
+	}
+
+	return m, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if strings.HasPrefix(p.lines[p.pos].text, "- ") || p.lines[p.pos].text == "-" {
+		return p.parseList(indent)
+	}
+
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseMap(indent int) (yamlMap, error) {
+	m := yamlMap{}
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.no)
+		}
+
+		key, value, err := splitKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line.no, key)
+		}
+		p.pos++
+
+		if value != "" {
+			if m[key], err = parseScalar(value, line.no); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// the value is the following block, lists may have the same indentation as the key
+		if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent || (p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text, "-"))) {
+			if m[key], err = p.parseBlock(p.lines[p.pos].indent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		m[key] = nil
+	}
+
+	return m, nil
+}
+
+func (p *yamlParser) parseList(indent int) ([]any, error) {
+	var list []any
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !(strings.HasPrefix(line.text, "- ") || line.text == "-") {
+			if line.indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", line.no)
+			}
+			break
+		}
+
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if item == "" {
+			return nil, fmt.Errorf("line %d: empty list item", line.no)
+		}
+
+		// "- key: value" starts a map, its other keys are indented to the first key
+		if _, _, err := splitKey(yamlLine{no: line.no, text: item}); err == nil && !isQuoted(item) {
+			p.lines[p.pos] = yamlLine{no: line.no, indent: indent + 2, text: item}
+			m, err := p.parseMap(indent + 2)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+			continue
+		}
+
+		v, err := parseScalar(item, line.no)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.pos++
+	}
+
+	return list, nil
+}
+
+func splitKey(line yamlLine) (key, value string, err error) {
+	key, value, ok := strings.Cut(line.text, ":")
+	if !ok || (value != "" && value[0] != ' ') {
+		return "", "", fmt.Errorf("line %d: expected key: value", line.no)
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, `"' `) {
+		return "", "", fmt.Errorf("line %d: invalid key %q", line.no, key)
+	}
+
+	return key, stripComment(strings.TrimSpace(value)), nil
+}
+
+func isQuoted(s string) bool {
+	return strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `'`)
+}
+
+func stripComment(s string) string {
+	if isQuoted(s) {
+		return s
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+
+	return s
+}
+
+// parseScalar returns strings, quoted scalars are unquoted. Types are checked by the consumer.
+func parseScalar(s string, no int) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("line %d: invalid quoted string", no)
+		}
+		return v, nil
+	case strings.HasPrefix(s, `'`):
+		if len(s) < 2 || !strings.HasSuffix(s, `'`) {
+			return "", fmt.Errorf("line %d: invalid quoted string", no)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	default:
+		return s, nil
+	}
+}
+
+// writeYAML writes maps with sorted keys. Values are strings, yamlMap or []yamlMap.
+func writeYAML(w io.Writer, m yamlMap, indent int) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pad := strings.Repeat(" ", indent)
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case string:
+			if _, err := fmt.Fprintf(w, "%s%s: %s\n", pad, k, quoteScalar(v)); err != nil {
+				return err
+			}
+		case yamlMap:
+			if _, err := fmt.Fprintf(w, "%s%s:\n", pad, k); err != nil {
+				return err
+			}
+			if err := writeYAML(w, v, indent+2); err != nil {
+				return err
+			}
+		case []yamlMap:
+			if _, err := fmt.Fprintf(w, "%s%s:\n", pad, k); err != nil {
+				return err
+			}
+			for _, item := range v {
+				var sb strings.Builder
+				if err := writeYAML(&sb, item, indent+4); err != nil {
+					return err
+				}
+				// the first key of the item goes onto the "- " line
+				text := sb.String()
+				if _, err := fmt.Fprintf(w, "%s  - %s", pad, strings.TrimPrefix(text, strings.Repeat(" ", indent+4))); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported yaml value for %s: %T", k, v)
+		}
+	}
+
+	return nil
+}
+
+// quoteScalar quotes strings which would otherwise be parsed differently.
+func quoteScalar(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#'\"\n\\{}[],&*!|>%@`") || strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc := `# machine definition
+---
+name: dev   # trailing comment
+resources:
+  cpus: 4
+  memory: "8G"
+mounts:
+  - host: ~/src
+    guest: /src
+  - host: '/opt/it''s'
+    readOnly: true
+tags:
+- a
+- "b: c"
+empty:
+`
+
+	got, err := parseYAML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := yamlMap{
+		"name":      "dev",
+		"resources": yamlMap{"cpus": "4", "memory": "8G"},
+		"mounts": []any{
+			yamlMap{"host": "~/src", "guest": "/src"},
+			yamlMap{"host": "/opt/it's", "readOnly": "true"},
+		},
+		"tags":  []any{"a", "b: c"},
+		"empty": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed:\n%#v\nwant:\n%#v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"tab", "a:\n\tb: c\n", "tabs"},
+		{"duplicate", "a: 1\na: 2\n", "duplicate key a"},
+		{"indentation", "a: 1\n  b: 2\n", "unexpected indentation"},
+		{"no key", "just text\n", "expected key: value"},
+		{"empty item", "a:\n  -\n", "empty list item"},
+		{"bad quote", "a: \"open\n", "invalid quoted string"},
+		{"list document", "- a\n", "must be a map"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML(strings.NewReader(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	doc := yamlMap{
+		"name": "dev",
+		"resources": yamlMap{
+			"cpus":   "4",
+			"memory": "8G",
+		},
+		"mounts": []yamlMap{
+			{"host": "~/src", "guest": "/src"},
+			{"host": "/opt/data # not a comment", "readOnly": "true"},
+		},
+		"script": "echo 'hi': done",
+		"dash":   "-x",
+		"blank":  "",
+		"spaced": " padded ",
+	}
+
+	var sb strings.Builder
+	if err := writeYAML(&sb, doc, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parseYAML(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("parse the written document:\n%s\n%v", sb.String(), err)
+	}
+
+	// lists are read back as []any
+	want := yamlMap{}
+	for k, v := range doc {
+		want[k] = v
+	}
+	want["mounts"] = []any{doc["mounts"].([]yamlMap)[0], doc["mounts"].([]yamlMap)[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip of:\n%s\ngot:\n%#v", sb.String(), got)
+	}
+}
@@ -11,8 +11,12 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/prashantgupta24/mac-sleep-notifier v1.0.1
 	github.com/shirou/gopsutil/v3 v3.23.12
+	golang.org/x/crypto v0.18.0
+	golang.org/x/mod v0.13.0
 	golang.org/x/net v0.20.0
 	golang.org/x/sync v0.5.0
+	golang.org/x/sys v0.16.0
+	golang.org/x/time v0.5.0
 	inet.af/tcpproxy v0.0.0-20221017015627-91f861402626
 )
 
@@ -35,10 +39,6 @@ require (
 	github.com/tklauser/numcpus v0.7.0 // indirect
 	github.com/u-root/uio v0.0.0-20210528114334-82958018845c // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
-	golang.org/x/crypto v0.18.0 // indirect
-	golang.org/x/mod v0.13.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.13.0 // indirect
 	gvisor.dev/gvisor v0.0.0-20230715022000-fd277b20b8db // indirect
 )
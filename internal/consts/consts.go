@@ -0,0 +1,7 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package consts
+
+// RuntimeDir stores the pid lock files and the name registry, shared by all ovm processes.
+const RuntimeDir = "/tmp/ovm"
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+// DefaultAgentVsockPort is the vsock port of the guest agent, it is passed to the guest as ovm.agent_port when changed.
+const DefaultAgentVsockPort = 1029
+
+// GuestLogVsockPort is where the guest streams its logs with -forward-guest-logs, it is passed to the guest as ovm.guest_logs_port.
+const GuestLogVsockPort = 1030
+
+// reservedVsockPorts are the vsock devices attached by pkg/vfkit.
+var reservedVsockPorts = map[int]string{
+	1024: "network",
+	1025: "initrd",
+	1026: "ready notification",
+	1027: "time sync",
+	1028: "ssh authorized keys",
+	1030: "guest logs",
+}
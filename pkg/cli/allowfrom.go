@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultAllowFrom is used when -allow-from is not set, only the host itself can connect
+var defaultAllowFrom = []string{"127.0.0.0/8", "::1/128"}
+
+type allowFromFlags []string
+
+func (a *allowFromFlags) String() string {
+	return strings.Join(*a, ", ")
+}
+
+func (a *allowFromFlags) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+// parseAllowFrom parses the -allow-from CIDRs, the loopback networks without any.
+func parseAllowFrom() ([]*net.IPNet, error) {
+	values := []string(allowFrom)
+	if len(values) == 0 {
+		values = defaultAllowFrom
+	}
+
+	result := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("allow-from %q: must be a CIDR, e.g. 192.168.1.0/24", v)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// allowsAll reports whether the CIDRs cover every IPv4 or every IPv6 address.
+func allowsAll(nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if ones, _ := n.Mask.Size(); ones == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExposeAddress returns the host address a port forward requested by the guest is bound to.
+// The host listener is opened by gvproxy, its connections cannot be filtered one by one.
+// So unless -allow-from covers every address, the forward must be bound to an allowed loopback
+// address, all interfaces (an empty host, 0.0.0.0 or ::) are narrowed to loopback.
+func (c *Context) ExposeAddress(local string) (string, error) {
+	if allowsAll(c.AllowFrom) {
+		return local, nil
+	}
+
+	host, port, err := net.SplitHostPort(local)
+	if err != nil {
+		return "", fmt.Errorf("expose %q: %w", local, err)
+	}
+
+	var ip net.IP
+	switch {
+	case host == "" || host == "0.0.0.0" || host == "localhost":
+		ip = net.IPv4(127, 0, 0, 1)
+	case host == "::":
+		ip = net.IPv6loopback
+	default:
+		ip = net.ParseIP(host)
+	}
+
+	if ip == nil || !ip.IsLoopback() {
+		return "", fmt.Errorf("expose %q: only loopback addresses can be exposed unless -allow-from covers all addresses, e.g. 0.0.0.0/0", local)
+	}
+	if !allowedIP(c.AllowFrom, ip) {
+		return "", fmt.Errorf("expose %q: %s is not allowed by -allow-from", local, ip)
+	}
+
+	return net.JoinHostPort(ip.String(), port), nil
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"net"
+	"testing"
+)
+
+func mustCIDRs(t *testing.T, values ...string) []*net.IPNet {
+	t.Helper()
+	var result []*net.IPNet
+	for _, v := range values {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+func TestExposeAddress(t *testing.T) {
+	tests := []struct {
+		allowFrom []string
+		local     string
+		want      string
+		wantErr   bool
+	}{
+		{defaultAllowFrom, "127.0.0.1:8080", "127.0.0.1:8080", false},
+		{defaultAllowFrom, "0.0.0.0:8080", "127.0.0.1:8080", false},
+		{defaultAllowFrom, ":8080", "127.0.0.1:8080", false},
+		{defaultAllowFrom, "localhost:8080", "127.0.0.1:8080", false},
+		{defaultAllowFrom, "[::]:8080", "[::1]:8080", false},
+		{defaultAllowFrom, "[::1]:8080", "[::1]:8080", false},
+		{defaultAllowFrom, "192.168.1.5:8080", "", true},
+		{defaultAllowFrom, "example.com:8080", "", true},
+		{defaultAllowFrom, "8080", "", true},
+		{[]string{"127.0.0.1/32"}, "127.0.0.2:8080", "", true},
+		{[]string{"192.168.1.0/24"}, "0.0.0.0:8080", "", true},
+		{[]string{"0.0.0.0/0"}, "0.0.0.0:8080", "0.0.0.0:8080", false},
+		{[]string{"::/0"}, "192.168.1.5:8080", "192.168.1.5:8080", false},
+	}
+
+	for _, tt := range tests {
+		c := &Context{AllowFrom: mustCIDRs(t, tt.allowFrom...)}
+		got, err := c.ExposeAddress(tt.local)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ExposeAddress(%q) with %v: error %v, want error %v", tt.local, tt.allowFrom, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExposeAddress(%q) with %v = %q, want %q", tt.local, tt.allowFrom, got, tt.want)
+		}
+	}
+}
+
+func TestParseAllowFrom(t *testing.T) {
+	defer func(v allowFromFlags) { allowFrom = v }(allowFrom)
+
+	allowFrom = nil
+	nets, err := parseAllowFrom()
+	if err != nil || len(nets) != 2 || !allowedIP(nets, net.ParseIP("127.0.0.1")) || allowedIP(nets, net.ParseIP("10.0.0.1")) {
+		t.Fatalf("default allow-from: %v, %v", nets, err)
+	}
+
+	allowFrom = allowFromFlags{"10.0.0.0/8", "192.168.1.1"}
+	if _, err := parseAllowFrom(); err == nil {
+		t.Fatal("an address without a prefix length must be refused")
+	}
+}
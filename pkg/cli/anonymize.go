@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// SetNetworkDiagnosticsAnonymized switches the anonymization of GET /network/diagnostics, e.g. on a config reload.
+func (c *Context) SetNetworkDiagnosticsAnonymized(v bool) {
+	c.networkAnonymizeMu.Lock()
+	defer c.networkAnonymizeMu.Unlock()
+	c.networkAnonymize = v
+}
+
+// NetworkDiagnosticsAnonymized returns whether the addresses of the network diagnostics are truncated.
+func (c *Context) NetworkDiagnosticsAnonymized() bool {
+	c.networkAnonymizeMu.RLock()
+	defer c.networkAnonymizeMu.RUnlock()
+	return c.networkAnonymize
+}
+
+// AnonymizeIP truncates an IPv4 address to its /24 and an IPv6 address to its /48, other values are returned empty.
+func AnonymizeIP(v string) string {
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// reloadNetworkDiagnosticsAnonymize applies network-diagnostics-anonymize of the config file, the last value wins.
+func (c *Context) reloadNetworkDiagnosticsAnonymize(r *ConfigReload) {
+	const key = "network-diagnostics-anonymize"
+
+	// passed on the command line, it takes precedence over the config file
+	if explicitFlags[key] {
+		return
+	}
+
+	values, err := readConfigValues(c.ConfigPath, key)
+	if err != nil {
+		r.Failed = append(r.Failed, fmt.Sprintf("%s: %v", key, err))
+		return
+	}
+
+	v := false
+	if len(values) != 0 {
+		if v, err = strconv.ParseBool(values[len(values)-1]); err != nil {
+			r.Failed = append(r.Failed, fmt.Sprintf("%s: %q is not a boolean", key, values[len(values)-1]))
+			return
+		}
+	}
+
+	if v != c.NetworkDiagnosticsAnonymized() {
+		c.SetNetworkDiagnosticsAnonymized(v)
+		r.Applied = append(r.Applied, fmt.Sprintf("%s: %t", key, v))
+	}
+}
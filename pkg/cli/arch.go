@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var ErrNotCrossArch = errors.New("the guest has the same architecture as the host")
+
+// GuestArch is the architecture of the guest, in GOARCH notation.
+type GuestArch string
+
+const (
+	GuestArchAMD64 GuestArch = "amd64"
+	GuestArchARM64 GuestArch = "arm64"
+)
+
+// crossCompilers are the Debian/Ubuntu cross toolchain prefixes of the architectures.
+var crossCompilers = map[GuestArch]string{
+	GuestArchAMD64: "x86_64-linux-gnu",
+	GuestArchARM64: "aarch64-linux-gnu",
+}
+
+// CrossCompileEnvironment returns the environment for building for the guest on the host:
+// the Go toolchain, the C/C++ cross compilers and the platform build args of container builds.
+// The Virtualization.framework runs guests of the host architecture only, so this is for building images for another machine.
+func (a GuestArch) CrossCompileEnvironment() ([]string, error) {
+	prefix, ok := crossCompilers[a]
+	if !ok {
+		return nil, fmt.Errorf("unsupported guest architecture %q", a)
+	}
+
+	if string(a) == runtime.GOARCH {
+		return nil, ErrNotCrossArch
+	}
+
+	return []string{
+		"GOOS=linux",
+		"GOARCH=" + string(a),
+		"CGO_ENABLED=1",
+		"CC=" + prefix + "-gcc",
+		"CXX=" + prefix + "-g++",
+		"TARGETPLATFORM=linux/" + string(a),
+		"TARGETOS=linux",
+		"TARGETARCH=" + string(a),
+	}, nil
+}
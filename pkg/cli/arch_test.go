@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestCrossCompileEnvironment(t *testing.T) {
+	tests := []struct {
+		arch GuestArch
+		cc   string
+	}{
+		{GuestArchAMD64, "x86_64-linux-gnu-gcc"},
+		{GuestArchARM64, "aarch64-linux-gnu-gcc"},
+	}
+
+	for _, tt := range tests {
+		env, err := tt.arch.CrossCompileEnvironment()
+		if string(tt.arch) == runtime.GOARCH {
+			if !errors.Is(err, ErrNotCrossArch) {
+				t.Errorf("%s on a %s host: got %v, want ErrNotCrossArch", tt.arch, runtime.GOARCH, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.arch, err)
+		}
+
+		for _, want := range []string{"GOOS=linux", "GOARCH=" + string(tt.arch), "CC=" + tt.cc, "TARGETPLATFORM=linux/" + string(tt.arch), "TARGETARCH=" + string(tt.arch)} {
+			if !slices.Contains(env, want) {
+				t.Errorf("%s: %s is missing in %v", tt.arch, want, env)
+			}
+		}
+	}
+
+	if _, err := GuestArch("riscv64").CrossCompileEnvironment(); err == nil {
+		t.Error("riscv64 is not supported, got no error")
+	}
+}
@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+const (
+	AuditOK     = "ok"
+	AuditFailed = "failed"
+	// AuditPending is written before an operation after which ovm may be gone, e.g. /stop
+	AuditPending = "pending"
+)
+
+// maxAuditEntries caps GET /audit, the file itself is append-only and never trimmed by ovm
+const maxAuditEntries = 1000
+
+// AuditEntry is one mutating operation, a line of the audit log.
+type AuditEntry struct {
+	Time      time.Time         `json:"time"`
+	ID        string            `json:"id"`
+	Operation string            `json:"operation"`
+	Params    map[string]string `json:"params,omitempty"`
+	// PID and UID are the peer of the restful socket, UID is -1 when unknown
+	PID int `json:"pid,omitempty"`
+	UID int `json:"uid"`
+	// User is the user running ovm, for the actions of the CLI
+	User string `json:"user,omitempty"`
+	// Remote is the address of a peer which is not on the unix socket
+	Remote  string `json:"remote,omitempty"`
+	Outcome string `json:"outcome"`
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewAuditID returns the ID of a new operation.
+func NewAuditID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var secretParam = regexp.MustCompile(`(?i)authorization|token|password|secret|key`)
+
+// RedactAuditParams hides the values of secret parameters and secrets inside the other values.
+func RedactAuditParams(params map[string]string) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		if secretParam.MatchString(k) {
+			result[k] = "***"
+		} else {
+			result[k] = logger.Redact(v)
+		}
+	}
+
+	return result
+}
+
+// CLIAuditEntry is the operation of the user running ovm, e.g. an interrupt in the terminal.
+func CLIAuditEntry(operation string, err error) *AuditEntry {
+	e := &AuditEntry{
+		Operation: operation,
+		UID:       os.Getuid(),
+		Outcome:   AuditOK,
+	}
+	if u, uerr := user.Current(); uerr == nil {
+		e.User = u.Username
+	} else {
+		e.User = strconv.Itoa(e.UID)
+	}
+	if err != nil {
+		e.Outcome = AuditFailed
+		e.Error = err.Error()
+	}
+
+	return e
+}
+
+// Audit appends the entry to the audit log, the params are redacted here.
+// The caller only warns when it fails, the operation itself must not depend on the audit log.
+func (c *Context) Audit(e *AuditEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = NewAuditID()
+	}
+	e.Params = RedactAuditParams(e.Params)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	f, err := os.OpenFile(c.AuditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log failed: %w", err)
+	}
+	defer f.Close()
+
+	// a single write of the whole line, concurrent ovm processes of the same name do not interleave
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write audit log failed: %w", err)
+	}
+
+	return nil
+}
+
+// auditTailChunk is how much of the audit log is read at once, backwards from its end
+const auditTailChunk = 64 * 1024
+
+// OnAuditFailed sets what is done besides the warning when a write of the audit log fails, e.g. sending an event.
+func (c *Context) OnAuditFailed(fn func(e *AuditEntry, err error)) {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+	c.auditFailed = fn
+}
+
+// AuditOrWarn appends the entry to the audit log, a failed write is only warned about, the operation happened anyway.
+func (c *Context) AuditOrWarn(log *logger.Context, e *AuditEntry) {
+	err := c.Audit(e)
+	if err == nil {
+		return
+	}
+
+	log.Warnf("audit %s (%s) failed: %v", e.Operation, e.ID, err)
+	c.auditMu.Lock()
+	fn := c.auditFailed
+	c.auditMu.Unlock()
+	if fn != nil {
+		fn(e, err)
+	}
+}
+
+// AuditCLI records the action of the user running ovm, e.g. the start or the pause of -pause-on-suspend.
+func (c *Context) AuditCLI(log *logger.Context, operation string, err error) {
+	c.AuditOrWarn(log, CLIAuditEntry(operation, err))
+}
+
+// AuditEntries returns the last n entries of the audit log, latest last.
+// Only the end of the file is read, the log is never trimmed and may be large.
+func (c *Context) AuditEntries(n int) ([]AuditEntry, error) {
+	if n <= 0 || n > maxAuditEntries {
+		n = maxAuditEntries
+	}
+
+	f, err := os.Open(c.AuditPath)
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines, err := tailLines(f, n)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(lines))
+	for _, line := range lines {
+		var e AuditEntry
+		// a line cut by a crash is skipped, the log stays readable
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// tailLines returns the last n non-empty lines of f, reading it backwards in chunks.
+func tailLines(f *os.File, n int) ([][]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		end  = info.Size()
+		rest []byte
+		// lines are collected latest first
+		lines [][]byte
+	)
+	for end > 0 && len(lines) < n {
+		start := max(end-auditTailChunk, 0)
+		chunk := make([]byte, end-start, end-start+int64(len(rest)))
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return nil, err
+		}
+		rest = append(chunk, rest...)
+		end = start
+
+		// the part before the first newline may continue in the previous chunk
+		for len(lines) < n {
+			i := bytes.LastIndexByte(rest, '\n')
+			if i < 0 {
+				break
+			}
+			if line := rest[i+1:]; len(bytes.TrimSpace(line)) != 0 {
+				lines = append(lines, line)
+			}
+			rest = rest[:i]
+		}
+	}
+	if end == 0 && len(lines) < n && len(bytes.TrimSpace(rest)) != 0 {
+		lines = append(lines, rest)
+	}
+
+	slices.Reverse(lines)
+	return lines, nil
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func TestAuditEntries(t *testing.T) {
+	dir := t.TempDir()
+	c := &Context{AuditPath: filepath.Join(dir, "test-audit.jsonl")}
+
+	entries, err := c.AuditEntries(10)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("missing log: got %v, %v, want no entries", entries, err)
+	}
+
+	// the long params spread the entries over several chunks of auditTailChunk
+	const total = 300
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < total; i++ {
+		if err := c.Audit(&AuditEntry{Operation: fmt.Sprintf("op %d", i), Params: map[string]string{"v": long}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, n := range []int{1, 10, 100, total} {
+		entries, err := c.AuditEntries(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != n {
+			t.Fatalf("AuditEntries(%d) returned %d entries", n, len(entries))
+		}
+		for i, e := range entries {
+			if want := fmt.Sprintf("op %d", total-n+i); e.Operation != want {
+				t.Fatalf("AuditEntries(%d)[%d] = %q, want %q", n, i, e.Operation, want)
+			}
+		}
+	}
+
+	entries, err = c.AuditEntries(total + 10)
+	if err != nil || len(entries) != total {
+		t.Fatalf("AuditEntries(%d) returned %d entries, %v, want all %d", total+10, len(entries), err, total)
+	}
+}
+
+func TestAuditEntriesCutLine(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "test-audit.jsonl")
+	// the first line has no newline before it, the last one was cut by a crash
+	data := `{"operation":"first"}` + "\n" + `{"operation":"second"}` + "\n\n" + `{"operation":"cu`
+	if err := os.WriteFile(p, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := (&Context{AuditPath: p}).AuditEntries(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Operation != "first" || entries[1].Operation != "second" {
+		t.Fatalf("got %+v, want first and second", entries)
+	}
+}
+
+func TestAuditOrWarn(t *testing.T) {
+	dir := t.TempDir()
+	log, err := logger.NewWithoutManage(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Context{AuditPath: filepath.Join(dir, "missing", "test-audit.jsonl")}
+	var failed *AuditEntry
+	var failedErr error
+	c.OnAuditFailed(func(e *AuditEntry, err error) {
+		failed, failedErr = e, err
+	})
+
+	c.AuditCLI(log, "start", errors.New("boom"))
+	if failed == nil || failedErr == nil {
+		t.Fatal("the failed write was not reported")
+	}
+	if failed.Operation != "start" || failed.Outcome != AuditFailed || failed.Error != "boom" || failed.ID == "" {
+		t.Fatalf("reported entry %+v", failed)
+	}
+
+	failed = nil
+	c.AuditPath = filepath.Join(dir, "test-audit.jsonl")
+	c.AuditCLI(log, "start", nil)
+	if failed != nil {
+		t.Fatalf("a successful write was reported as failed: %+v", failed)
+	}
+}
@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The benchmark is kept small, every step is stopped after benchTimeout, so the whole run takes at most about 2 minutes.
+const (
+	benchDiskMiB    = 128
+	benchNetworkMiB = 64
+	benchTimeout    = 30 * time.Second
+	// benchDiskFile is on the data disk, where images and containers are stored
+	benchDiskFile = "/var/lib/containers/ovm-bench"
+	// benchHost is the host as seen from the guest, gvproxy maps it to 127.0.0.1
+	benchHost = "host.containers.internal"
+)
+
+// BenchResult are the throughputs in MiB/s measured inside the guest.
+type BenchResult struct {
+	// Approximate is always true, the numbers come from a few seconds of sequential IO and vary between runs
+	Approximate bool   `json:"approximate"`
+	CPUS        uint   `json:"cpus"`
+	MemoryMiB   uint64 `json:"memoryMiB"`
+
+	DiskWriteMiBs       float64 `json:"diskWriteMiBs"`
+	DiskReadMiBs        float64 `json:"diskReadMiBs"`
+	NetworkUploadMiBs   float64 `json:"networkUploadMiBs"`
+	NetworkDownloadMiBs float64 `json:"networkDownloadMiBs"`
+
+	// Seconds is how long the whole benchmark took
+	Seconds float64 `json:"seconds"`
+}
+
+// Bench measures the sequential disk throughput of the data disk and the network throughput between guest and host.
+// ctx is checked between the steps, a running step is bounded by benchTimeout.
+func (c *Context) Bench(ctx context.Context) (*BenchResult, error) {
+	start := time.Now()
+	r := &BenchResult{
+		Approximate: true,
+		CPUS:        c.CPUS,
+		MemoryMiB:   c.MemoryBytes / 1024 / 1024,
+	}
+
+	// conv=fsync and dropping the page cache keep the numbers about the disk, not the guest memory
+	steps := []struct {
+		name    string
+		command string
+		result  *float64
+	}{
+		{"disk write", fmt.Sprintf("%s dd if=/dev/zero of=%s bs=1M count=%d conv=fsync 2>/dev/null", benchGuestTimeout(), benchDiskFile, benchDiskMiB), &r.DiskWriteMiBs},
+		{"disk read", fmt.Sprintf("sync; echo 3 > /proc/sys/vm/drop_caches; %s dd if=%s of=/dev/null bs=1M 2>/dev/null; e=$?; rm -f %s; exit $e", benchGuestTimeout(), benchDiskFile, benchDiskFile), &r.DiskReadMiBs},
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		d, err := c.timeInGuest(step.command)
+		if err != nil {
+			_, _ = c.RunInGuest("rm -f " + benchDiskFile)
+			return nil, fmt.Errorf("%s benchmark failed: %w", step.name, err)
+		}
+		*step.result = throughput(benchDiskMiB, d)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	up, err := c.benchUpload()
+	if err != nil {
+		return nil, fmt.Errorf("network upload benchmark failed: %w", err)
+	}
+	r.NetworkUploadMiBs = up
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	down, err := c.benchDownload()
+	if err != nil {
+		return nil, fmt.Errorf("network download benchmark failed: %w", err)
+	}
+	r.NetworkDownloadMiBs = down
+
+	r.Seconds = float64(time.Since(start).Milliseconds()) / 1000
+	return r, nil
+}
+
+// timeInGuest runs the command and returns how long it took, measured by the guest clock.
+func (c *Context) timeInGuest(command string) (time.Duration, error) {
+	out, err := c.RunInGuest(fmt.Sprintf("s=$(date +%%s%%N); %s; e=$(date +%%s%%N); echo $((e-s))", command))
+	if err != nil {
+		return 0, err
+	}
+
+	ns, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output %q", out)
+	}
+
+	return time.Duration(ns), nil
+}
+
+// benchUpload sends data from the guest to a listener on the host, the time is taken on the host from the first to the last byte.
+func (c *Context) benchUpload() (float64, error) {
+	nl, port, err := benchListen()
+	if err != nil {
+		return 0, err
+	}
+	defer nl.Close()
+
+	type received struct {
+		d   time.Duration
+		n   int64
+		err error
+	}
+	done := make(chan received, 1)
+	go func() {
+		conn, err := nl.Accept()
+		if err != nil {
+			done <- received{err: err}
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(benchTimeout))
+
+		first := make([]byte, 1)
+		if _, err := io.ReadFull(conn, first); err != nil {
+			done <- received{err: err}
+			return
+		}
+		start := time.Now()
+		n, err := io.Copy(io.Discard, conn)
+		done <- received{d: time.Since(start), n: n + 1, err: err}
+	}()
+
+	if _, err := c.RunInGuest(fmt.Sprintf("dd if=/dev/zero bs=1M count=%d 2>/dev/null | %s socat -u - TCP:%s:%d", benchNetworkMiB, benchGuestTimeout(), benchHost, port)); err != nil {
+		return 0, err
+	}
+
+	r := <-done
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return throughput(float64(r.n)/1024/1024, r.d), nil
+}
+
+// benchDownload sends data from a listener on the host to the guest, the time is taken by the guest.
+func (c *Context) benchDownload() (float64, error) {
+	nl, port, err := benchListen()
+	if err != nil {
+		return 0, err
+	}
+	defer nl.Close()
+
+	go func() {
+		conn, err := nl.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(benchTimeout))
+
+		buf := make([]byte, 1024*1024)
+		for i := 0; i < benchNetworkMiB; i++ {
+			if _, err := conn.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	d, err := c.timeInGuest(fmt.Sprintf("%s socat -u TCP:%s:%d /dev/null", benchGuestTimeout(), benchHost, port))
+	if err != nil {
+		return 0, err
+	}
+
+	return throughput(benchNetworkMiB, d), nil
+}
+
+// benchGuestTimeout prefixes a guest command, so a slow disk or network stops it after benchTimeout.
+func benchGuestTimeout() string {
+	return fmt.Sprintf("timeout %d", int(benchTimeout.Seconds()))
+}
+
+func benchListen() (net.Listener, int, error) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return nl, nl.Addr().(*net.TCPAddr).Port, nil
+}
+
+func throughput(mib float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(int(mib/d.Seconds()*10)) / 10
+}
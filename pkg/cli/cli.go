@@ -4,8 +4,24 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/mod/semver"
 )
 
 var (
@@ -25,9 +41,80 @@ var (
 	bindPID         int
 	powerSaveMode   bool
 	kernelDebug     bool
+
+	statusSnapshotDir      string
+	statusSnapshotInterval time.Duration
+	healthEndpointPort     int
+	configPath             string
+	stateDir               string
+	nonInteractive         bool
+	clockSource            string
+	serialConsoleBaud      int
+	shutdownCommand        string
+	mounts                 mountFlags
+	ulimits                ulimitFlags
+	routes                 routeFlags
+	allowFrom              allowFromFlags
+	watchGuestUnits        guestUnitFlags
+	passthroughDevices     passthroughFlags
+	networkAnonymize       bool
+	watchArtifacts         watchFlag
+	exposeDockerSocket     bool
+	podmanAPIVersion       string
+	podmanMaxVersion       string
+	tmpMount               string
+	rootDevice             string
+	rootWait               bool
+	rootfsOverlay          string
+	prewarmRootfs          bool
+	guestWritableRoot      bool
+	noInitrd               bool
+	resetCmdline           bool
+	maxSSHSessions         int
+	socketBacklog          int
+	agentVsockPort         int
+	forwardGuestLogs       bool
+	assumeReady            bool
+	assumeReadyAfter       time.Duration
+	guestSwap              string
+	logTotalBudget         string
+	copyBufferSize         string
+	dataInitPolicy         string
+	dataInitYes            bool
+	assetVersion           string
+	networkLatency         time.Duration
+	networkPacketLoss      float64
+	verifyArtifactsDelay   time.Duration
+	verifyArtifactsRate    int
+	strict                 strictFlag
+	mtu                    int
+	pauseOnSuspend         bool
+	powerSaveOnBattery     bool
+	noPowerAwareness       bool
+	maxDrift               time.Duration
+	driftCheckInterval     time.Duration
+	virtioRNG              bool
+	trace                  string
+	bootCPUs               uint
+	otlpEndpoint           string
+	otlpServiceName        string
+	otlpHeaders            = headerFlags{values: map[string]string{}}
+	statsdAddress          string
+	statsdPrefix           string
+	jobRetention           time.Duration
+
+	restfulMaxBodySize    int64
+	restfulReadTimeout    time.Duration
+	restfulWriteTimeout   time.Duration
+	restfulRequestTimeout time.Duration
+	restfulMaxInFlight    int
+	restfulEnable         string
+	restfulDisable        string
+	enableSockets         string
+	disableSockets        string
 )
 
-func Parse() {
+func Parse() error {
 	flag.StringVar(&name, "name", "", "Name of the virtual machine")
 	flag.StringVar(&logPath, "log-path", "", "Directory to store logs")
 	flag.StringVar(&socketPath, "socket-path", "", "Store all socket files")
@@ -39,49 +126,460 @@ func Parse() {
 	flag.StringVar(&rootfsPath, "rootfs-path", "", "Path to rootfs image")
 	flag.StringVar(&targetPath, "target-path", "", "Store disk images and kernel/initrd/rootfs files")
 	flag.StringVar(&versions, "versions", "", "Set version")
+	flag.StringVar(&assetVersion, "asset-version", "", "Tag of the kernel/initrd/rootfs content, a new tag copies them again even if -versions is unchanged")
 	flag.StringVar(&eventSocketPath, "event-socket-path", "", "Send event to this socket")
 	flag.BoolVar(&cliMode, "cli", false, "Run in CLI mode")
 	flag.IntVar(&bindPID, "bind-pid", 0, "OVM will exit when the bound pid exited")
 	flag.BoolVar(&powerSaveMode, "power-save-mode", false, "Enable power save mode")
+	flag.BoolVar(&powerSaveOnBattery, "power-save-on-battery", false, "Enable power save mode only while the host is on battery")
+	flag.BoolVar(&noPowerAwareness, "no-power-awareness", false, "Ignore the power source and thermal pressure of the host")
 	flag.BoolVar(&kernelDebug, "kernel-debug", false, "Enable kernel debug")
+	flag.StringVar(&statusSnapshotDir, "status-snapshot-dir", "", "Periodically write status.json and metrics.prom to this directory")
+	flag.DurationVar(&statusSnapshotInterval, "status-snapshot-interval", 10*time.Second, "Interval between status snapshots")
+	flag.IntVar(&healthEndpointPort, "health-endpoint-port", 0, "Serve /healthz and /metrics on this localhost TCP port")
+	flag.StringVar(&stateDir, "state-dir", "", "Derive -socket-path, -ssh-key-path, -log-path and -target-path as subdirectories of this directory, unless they are set")
+	flag.StringVar(&configPath, "config", "", "Load flags from this file, flags passed on the command line take precedence")
+	flag.BoolVar(&nonInteractive, "non-interactive", false, "Never start the setup wizard in CLI mode")
+	flag.IntVar(&serialConsoleBaud, "serial-console-baud", DefaultSerialConsoleBaud, "Speed of the guest serial console: 9600, 19200, 38400, 57600 or 115200")
+	flag.StringVar(&shutdownCommand, "shutdown-command", "", "Command run as root in the guest via SSH to stop it gracefully, e.g. systemctl poweroff, instead of the ACPI power button")
+	flag.StringVar(&clockSource, "clock-source", "", "Guest clock source (tsc, hpet, kvm-clock, pit), only for amd64")
+	flag.BoolVar(&exposeDockerSocket, "expose-docker-socket", false, "Also forward the Docker compatible API to NAME-docker.sock in the socket path")
+	flag.StringVar(&podmanAPIVersion, "podman-api-version", "", "Minimum podman (libpod) API version expected in the guest, e.g. 4.0.0, an older one is reported")
+	flag.StringVar(&podmanMaxVersion, "podman-max-version", "", "Maximum podman (libpod) API version expected in the guest, e.g. 5.0.0, a newer one is reported")
+	flag.BoolVar(&noInitrd, "no-initrd", false, "Boot the kernel without an initrd, for rootfs images whose kernel has everything built in")
+	flag.IntVar(&socketBacklog, "socket-backlog", 512, "Listen backlog of the network and restful sockets, capped by kern.ipc.somaxconn")
+	flag.BoolVar(&assumeReady, "assume-ready", false, "Treat the VM as ready after assume-ready-after, for images that never send the ready signal")
+	flag.DurationVar(&assumeReadyAfter, "assume-ready-after", DefaultReadyTimeout, "How long to wait for the ready signal with assume-ready")
+	flag.StringVar(&guestSwap, "guest-swap", GuestSwapOff, "Swap file on the tmp disk of the guest: off, auto (memory, at most 4G) or a size like 512M or 2G")
+	flag.IntVar(&agentVsockPort, "agent-vsock-port", DefaultAgentVsockPort, "Vsock port of the guest agent, must not collide with the other vsock ports of ovm")
+	flag.BoolVar(&forwardGuestLogs, "forward-guest-logs", false, "Write the logs the guest streams over vsock port 1030 to NAME-guest.log in the log path")
+	flag.IntVar(&maxSSHSessions, "max-ssh-sessions", 0, "Maximum number of concurrent ssh connections of ovm to the guest, 0 is unlimited")
+	flag.BoolVar(&resetCmdline, "reset-cmdline", false, "Assemble the kernel cmdline again instead of using kernel-cmdline.txt of the target path")
+	flag.StringVar(&rootDevice, "root-device", "", "Override the root device of the initrd handoff, e.g. /dev/vda or UUID=...")
+	flag.BoolVar(&rootWait, "root-wait", false, "Wait for the root device to appear instead of failing, for slow block devices")
+	flag.BoolVar(&prewarmRootfs, "prewarm-rootfs", false, "Read the rootfs into the page cache of the host before the boot, at most a quarter of the host memory")
+	flag.StringVar(&rootfsOverlay, "rootfs-overlay", RootfsOverlayOff, "Attach the rootfs read-only with an overlay in the guest: tmpfs (discarded on every boot), disk (kept in the target path) or off")
+	flag.BoolVar(&guestWritableRoot, "guest-writable-root", false, "Mount the rootfs (an ext4 image) writable without the overlay of the initrd, changes are kept in the target path")
+	flag.DurationVar(&verifyArtifactsDelay, "verify-artifacts-delay", 10*time.Minute, "Verify the kernel/initrd/rootfs in the background this long after the VM is ready, 0 disables it")
+	flag.IntVar(&verifyArtifactsRate, "verify-artifacts-rate", 20, "Maximum read rate of the background verification in MiB/s")
+	flag.StringVar(&tmpMount, "tmp-mount", "", "Mount a scratch disk at this path in the guest, formatted fresh on every start")
+	flag.Var(&strict, "strict", "Turn the warnings of a degraded run into errors which stop ovm: without a value the name, ssh key and podman version warnings, -strict=all for every category, or a comma separated list, e.g. -strict=disk,network")
+	flag.BoolVar(&virtioRNG, "virtio-rng", true, "Attach a virtio-rng device fed by the host CSPRNG, so the guest has entropy early at boot")
+	flag.DurationVar(&maxDrift, "max-drift", 2*time.Second, "Send the ClockDrift event and sync the guest time when its clock drifts further from the host, 0 only measures")
+	flag.DurationVar(&driftCheckInterval, "drift-check-interval", time.Minute, "Interval between measurements of the guest clock drift, 0 disables it")
+	flag.BoolVar(&pauseOnSuspend, "pause-on-suspend", false, "Pause the VM while ovm is suspended (Ctrl-Z) in CLI mode")
+	flag.StringVar(&trace, "trace", "", "Enable debug tracing of components: network-forward, vsock-agent, ssh, target, restful, events, powersave, setup")
+	flag.UintVar(&bootCPUs, "boot-cpus", 0, "Number of CPUs online at boot, -cpus becomes the maximum that can be onlined via /resize")
+	flag.DurationVar(&networkLatency, "network-latency", 0, "Add this latency to the guest network via tc netem, e.g. 100ms")
+	flag.Float64Var(&networkPacketLoss, "network-packet-loss", 0, "Drop this percentage of the guest network packets via tc netem, e.g. 1.5")
+	flag.IntVar(&mtu, "mtu", 0, "MTU of the guest network interface (576-9000)")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export metrics to this OTLP/HTTP endpoint, e.g. http://localhost:4318")
+	flag.StringVar(&otlpServiceName, "otlp-service-name", "ovm", "service.name of the exported metrics")
+	flag.Var(&otlpHeaders, "otlp-header", "Header sent to the OTLP endpoint: KEY=VALUE, can be repeated")
+	flag.StringVar(&statsdAddress, "statsd", "", "Push metrics to this statsd server over UDP: HOST:PORT")
+	flag.DurationVar(&jobRetention, "job-retention", 24*time.Hour, "Keep the output and exit code of a finished job started with POST /jobs this long")
+	flag.StringVar(&statsdPrefix, "statsd-prefix", "ovm", "Prefix of the metric names pushed to statsd")
+	flag.Int64Var(&restfulMaxBodySize, "restful-max-body-size", 1<<20, "Maximum request body size of the restful socket in bytes")
+	flag.DurationVar(&restfulReadTimeout, "restful-read-timeout", 30*time.Second, "Maximum duration for reading a restful request")
+	flag.DurationVar(&restfulWriteTimeout, "restful-write-timeout", 60*time.Second, "Maximum duration for writing a restful response")
+	flag.DurationVar(&restfulRequestTimeout, "restful-request-timeout", 30*time.Second, "Deadline of the context passed to restful handlers")
+	flag.IntVar(&restfulMaxInFlight, "restful-max-in-flight", 16, "Maximum concurrent restful requests, more are rejected with 429")
+	flag.StringVar(&restfulEnable, "restful-enable", "", "Comma separated restful routes to serve besides the read-only ones, e.g. /stop,/pause, or all")
+	flag.StringVar(&restfulDisable, "restful-disable", "", "Comma separated restful routes not to serve, e.g. /logs")
+	flag.StringVar(&enableSockets, "enable-sockets", "", "Comma separated sockets to create, all others are not created: podman, restful, events, ready, timesync, ssh-auth, network")
+	flag.StringVar(&disableSockets, "disable-sockets", "", "Comma separated sockets not to create, e.g. restful,timesync,ssh-auth")
+	flag.Var(&mounts, "mount", "Share a host directory to the guest: HOST_PATH[:GUEST_PATH][,ro][,uid=host], can be repeated")
+	flag.Var(&passthroughDevices, "passthrough-device", "Host device attached to the guest: serial:PATH (e.g. serial:/dev/cu.usbserial-1410), appears as /dev/hvc1 and onwards in the guest, can be repeated")
+	flag.BoolVar(&networkAnonymize, "network-diagnostics-anonymize", false, "Truncate the IP addresses returned by GET /network/diagnostics, can be switched by reloading -config")
+	flag.Var(&watchGuestUnits, "watch-guest-unit", "Also report the state of this systemd unit in the guest: UNIT or UNIT:restart=N to restart it after N failures within 10 minutes, can be repeated")
+	flag.Var(&allowFrom, "allow-from", "Only accept connections to the host listeners of the guest port forwards from this CIDR, can be repeated, loopback (127.0.0.0/8, ::1/128) by default")
+	flag.Var(&routes, "route", "Route added in the guest at boot: \"CIDR via GATEWAY\", the gateway must be in the guest subnet, can be repeated")
+	flag.Var(&ulimits, "guest-ulimit", "Resource limit of all services in the guest: NAME=LIMIT or NAME=SOFT:HARD (nofile, nproc, memlock, stack, core), can be repeated")
+	flag.StringVar(&logTotalBudget, "log-total-budget", "", "Maximum total size of the log files in -log-path like 512M or 2G, the oldest rotated files are removed beyond it")
+	flag.StringVar(&copyBufferSize, "copy-buffer-size", "4M", "Buffer size used to copy the kernel/initrd/rootfs into -target-path like 4M, at most 64M")
+	flag.StringVar(&dataInitPolicy, "data-init-policy", DataInitAuto, "What to do with a data disk without a recognized filesystem: auto (a blank disk is formatted by the guest, others fail), never (fail unless formatted) or always (recreate it, destroys all data, needs -data-init-yes)")
+	flag.BoolVar(&dataInitYes, "data-init-yes", false, "Confirm that -data-init-policy=always destroys the data disk")
+	flag.Var(&watchArtifacts, "watch-artifacts", "Development feature: report changes of the kernel/initrd/rootfs source files, -watch-artifacts=auto-apply also restarts to use them")
 
 	flag.Parse()
 
+	if configPath != "" {
+		if err := loadConfig(configPath); err != nil {
+			return fmt.Errorf("load config %s error: %w", configPath, err)
+		}
+	}
+
+	if stateDir != "" {
+		applyStateDir()
+	}
+
+	return nil
+}
+
+// stateDirs are the subdirectories of -state-dir for the path flags
+var stateDirs = []struct {
+	flag string
+	dir  string
+}{
+	{"socket-path", "sockets"},
+	{"ssh-key-path", "keys"},
+	{"log-path", "logs"},
+	{"target-path", "assets"},
+}
+
+// applyStateDir derives the path flags which are neither passed nor in the config file from -state-dir.
+func applyStateDir() {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, d := range stateDirs {
+		if !set[d.flag] {
+			_ = flag.Set(d.flag, filepath.Join(stateDir, d.dir))
+		}
+	}
+}
+
+// explicitFlags are the flags passed on the command line, they take precedence over the config file
+var explicitFlags map[string]bool
+
+// loadConfig applies "flag=value" lines from the config file.
+// Empty lines and lines starting with "#" are ignored.
+func loadConfig(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	explicitFlags = explicit
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected flag=value", line)
+		}
+
+		key = strings.TrimLeft(strings.TrimSpace(key), "-")
+		if key == "config" || explicit[key] {
+			continue
+		}
+
+		if err := flag.Set(key, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return sc.Err()
+}
+
+type headerFlags struct {
+	values map[string]string
+}
+
+func (h *headerFlags) String() string {
+	if h == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(h.values))
+	for k := range h.values {
+		pairs = append(pairs, k+"=***")
+	}
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (h *headerFlags) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected KEY=VALUE")
+	}
+
+	h.values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	return nil
+}
+
+var errRequired = errors.New("is required")
+
+var clockSources = []string{"tsc", "hpet", "kvm-clock", "pit"}
+
+const DefaultSerialConsoleBaud = 115200
+
+// DefaultReadyTimeout is how long ovm waits for the ready signal, and the default of -assume-ready-after:
+// assuming ready earlier would treat an image which is still booting as ready.
+const DefaultReadyTimeout = 30 * time.Second
+
+var serialConsoleBauds = []int{9600, 19200, 38400, 57600, 115200}
+
+const (
+	RootfsOverlayTmpfs = "tmpfs"
+	RootfsOverlayDisk  = "disk"
+	RootfsOverlayOff   = "off"
+)
+
+var rootfsOverlays = []string{RootfsOverlayTmpfs, RootfsOverlayDisk, RootfsOverlayOff}
+
+// rootDeviceRegexp allows virtio block devices (with partitions) and the identifiers understood by root=
+var rootDeviceRegexp = regexp.MustCompile(`^(/dev/vd[a-z][0-9]*|(UUID|PARTUUID|LABEL)=[A-Za-z0-9._-]+)$`)
+
+type requiredFlag struct {
+	name     string
+	validate func() error
+}
+
+// requiredFlags are checked by Validate and asked for (in this order) by the setup wizard.
+var requiredFlags = []requiredFlag{
+	{"name", func() error {
+		if err := required("name", name == ""); err != nil {
+			return err
+		}
+		if strings.ContainsAny(name, "/ ") {
+			return fmt.Errorf("name must not contain '/' or spaces")
+		}
+		return nil
+	}},
+	{"cpus", func() error { return required("cpus", cpus == 0) }},
+	{"memory", func() error { return required("memory", memory == 0) }},
+	{"log-path", func() error { return required("log-path", logPath == "") }},
+	{"socket-path", func() error { return required("socket-path", socketPath == "") }},
+	{"ssh-key-path", func() error { return required("ssh-key-path", sshKeyPath == "") }},
+	{"target-path", func() error { return required("target-path", targetPath == "") }},
+	{"kernel-path", func() error { return requiredFile("kernel-path", kernelPath) }},
+	{"initrd-path", func() error {
+		if noInitrd {
+			if initrdPath != "" {
+				return fmt.Errorf("initrd-path cannot be used with no-initrd")
+			}
+			return nil
+		}
+		return requiredFile("initrd-path", initrdPath)
+	}},
+	{"rootfs-path", func() error { return requiredFile("rootfs-path", rootfsPath) }},
+	{"versions", func() error {
+		if err := required("versions", versions == ""); err != nil {
+			return err
+		}
+		return parseVersions()
+	}},
+}
+
+func required(flagName string, missing bool) error {
+	if missing {
+		return fmt.Errorf("%s %w", flagName, errRequired)
+	}
+
+	return nil
+}
+
+func requiredFile(flagName, p string) error {
+	if err := required(flagName, p == ""); err != nil {
+		return err
+	}
+
+	if stat, err := os.Stat(p); err != nil {
+		return fmt.Errorf("%s: %w", flagName, err)
+	} else if !stat.Mode().IsRegular() {
+		return fmt.Errorf("%s: %s is not a regular file", flagName, p)
+	}
+
+	return nil
+}
+
+func missingFlags() (result []requiredFlag) {
+	for _, f := range requiredFlags {
+		if errors.Is(f.validate(), errRequired) {
+			result = append(result, f)
+		}
+	}
+
+	return result
 }
 
 func Validate() error {
-	if name == "" {
-		return fmt.Errorf("name is required")
+	var errs []error
+	for _, f := range requiredFlags {
+		if err := f.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	if statusSnapshotDir != "" && statusSnapshotInterval <= 0 {
+		return fmt.Errorf("status-snapshot-interval must be greater than 0")
+	}
+	if healthEndpointPort < 0 || healthEndpointPort > 65535 {
+		return fmt.Errorf("health-endpoint-port must be between 0 and 65535")
+	}
+	if !slices.Contains(serialConsoleBauds, serialConsoleBaud) {
+		return fmt.Errorf("serial-console-baud %d is not supported, must be one of 9600, 19200, 38400, 57600 or 115200", serialConsoleBaud)
+	}
+	if clockSource != "" {
+		if !consts.IsAMD64 {
+			return fmt.Errorf("clock-source is only supported on amd64")
+		}
+		if !slices.Contains(clockSources, clockSource) {
+			return fmt.Errorf("clock-source must be one of %s", strings.Join(clockSources, ", "))
+		}
+	}
+	// applied by basic(), before any logger is created
+	if trace != "" {
+		if err := logger.CheckTrace(strings.Split(trace, ",")); err != nil {
+			return err
+		}
+	}
+	if bootCPUs != 0 {
+		if bootCPUs > cpus {
+			return fmt.Errorf("boot-cpus must not be greater than cpus")
+		}
+		if cpus > uint(runtime.NumCPU()) {
+			return fmt.Errorf("cpus must not be greater than the number of host cores (%d) when boot-cpus is set", runtime.NumCPU())
+		}
+	}
+	if podmanAPIVersion != "" && !semver.IsValid("v"+podmanAPIVersion) {
+		return fmt.Errorf("podman-api-version must be a version like 4.0 or 4.0.0")
+	}
+	if podmanMaxVersion != "" && !semver.IsValid("v"+podmanMaxVersion) {
+		return fmt.Errorf("podman-max-version must be a version like 5.0 or 5.0.0")
+	}
+	if podmanAPIVersion != "" && podmanMaxVersion != "" && semver.Compare("v"+podmanAPIVersion, "v"+podmanMaxVersion) > 0 {
+		return fmt.Errorf("podman-api-version must not be greater than podman-max-version")
+	}
+	if networkLatency < 0 || networkPacketLoss < 0 || networkPacketLoss > 100 {
+		return fmt.Errorf("network-latency must not be negative and network-packet-loss must be between 0 and 100")
+	}
+	if maxDrift < 0 || driftCheckInterval < 0 {
+		return fmt.Errorf("max-drift and drift-check-interval must not be negative")
+	}
+	if mtu != 0 && (mtu < 576 || mtu > 9000) {
+		return fmt.Errorf("mtu must be between 576 and 9000")
+	}
+	if otlpEndpoint != "" {
+		if u, err := url.Parse(otlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp-endpoint must be a http or https URL")
+		}
+	}
+	if jobRetention <= 0 {
+		return fmt.Errorf("job-retention must be greater than 0")
+	}
+	if statsdAddress != "" {
+		if host, port, err := net.SplitHostPort(statsdAddress); err != nil || host == "" || port == "" {
+			return fmt.Errorf("statsd must be HOST:PORT, e.g. localhost:8125")
+		}
+	}
+	if restfulMaxBodySize <= 0 || restfulReadTimeout <= 0 || restfulWriteTimeout <= 0 || restfulRequestTimeout <= 0 || restfulMaxInFlight <= 0 {
+		return fmt.Errorf("restful-max-body-size, restful-read-timeout, restful-write-timeout, restful-request-timeout and restful-max-in-flight must be greater than 0")
+	}
+	if _, err := restfulRoutes(); err != nil {
+		return err
+	}
+	if tmpMount != "" {
+		if !filepath.IsAbs(tmpMount) {
+			return fmt.Errorf("tmp-mount must be an absolute path")
+		}
+		if strings.ContainsAny(tmpMount, unsafeGuestPathChars) {
+			return fmt.Errorf("tmp-mount must not contain spaces, quotes, '\\', '$' or '`'")
+		}
+	}
+	if verifyArtifactsDelay < 0 || verifyArtifactsRate <= 0 {
+		return fmt.Errorf("verify-artifacts-delay must not be negative and verify-artifacts-rate must be greater than 0")
+	}
+	if !slices.Contains(rootfsOverlays, rootfsOverlay) {
+		return fmt.Errorf("rootfs-overlay must be one of %s", strings.Join(rootfsOverlays, ", "))
+	}
+	// the overlay is put over the rootfs by the initrd
+	if noInitrd && rootfsOverlay != RootfsOverlayOff {
+		return fmt.Errorf("rootfs-overlay cannot be used with no-initrd")
+	}
+	if socketBacklog <= 0 {
+		return fmt.Errorf("socket-backlog must be positive")
+	}
+	if maxSSHSessions < 0 {
+		return fmt.Errorf("max-ssh-sessions must not be negative")
+	}
+	if _, err := parseGuestSwap(guestSwap, memory*1024*1024); err != nil {
+		return err
+	}
+	// the swap file is set up by the ignition
+	if noInitrd && guestSwap != GuestSwapOff {
+		return fmt.Errorf("guest-swap cannot be used with no-initrd")
+	}
+	if _, err := parseLogTotalBudget(logTotalBudget); err != nil {
+		return err
+	}
+	if _, err := parseCopyBufferSize(copyBufferSize); err != nil {
+		return err
+	}
+	if !slices.Contains(dataInitPolicies, dataInitPolicy) {
+		return fmt.Errorf("data-init-policy must be one of %s", strings.Join(dataInitPolicies, ", "))
+	}
+	if dataInitPolicy == DataInitAlways && !dataInitYes {
+		return fmt.Errorf("data-init-policy=always destroys all data of the data disk, confirm it with -data-init-yes")
+	}
+	if assumeReadyAfter <= 0 {
+		return fmt.Errorf("assume-ready-after must be positive")
+	}
+	if agentVsockPort <= 0 || agentVsockPort > math.MaxUint32 {
+		return fmt.Errorf("agent-vsock-port must be between 1 and %d", uint32(math.MaxUint32))
 	}
-	if logPath == "" {
-		return fmt.Errorf("log-path is required")
+	if name, ok := reservedVsockPorts[agentVsockPort]; ok {
+		return fmt.Errorf("agent-vsock-port %d collides with the vsock port of the %s", agentVsockPort, name)
 	}
-	if socketPath == "" {
-		return fmt.Errorf("socket-path is required")
+	if guestWritableRoot {
+		if rootfsOverlay != RootfsOverlayOff {
+			return fmt.Errorf("guest-writable-root cannot be used with rootfs-overlay")
+		}
+		// the copy in the target path is mounted, it must not be the data disk
+		if filepath.Base(rootfsPath) == "data.img" {
+			return fmt.Errorf("guest-writable-root: the rootfs must not be named data.img, it would be the same file as the data disk")
+		}
+		if _, err := ext4BlockSize(rootfsPath); err != nil {
+			return fmt.Errorf("guest-writable-root requires an ext4 rootfs image (not squashfs): %w", err)
+		}
 	}
-	if sshKeyPath == "" {
-		return fmt.Errorf("ssh-key-path is required")
+	if rootDevice != "" && !rootDeviceRegexp.MatchString(rootDevice) {
+		return fmt.Errorf("root-device must be /dev/vdX, /dev/vdXN, UUID=..., PARTUUID=... or LABEL=...")
 	}
-	if cpus == 0 {
-		return fmt.Errorf("vcpu is required")
+	if u, err := parseUlimits(); err != nil {
+		return err
+	} else if len(u) != 0 && noInitrd {
+		// the limits are written by the ignition
+		return fmt.Errorf("guest-ulimit cannot be used with no-initrd")
 	}
-	if memory == 0 {
-		return fmt.Errorf("memory is required")
+	if _, err := parsePassthroughDevices(); err != nil {
+		return err
 	}
-	if kernelPath == "" {
-		return fmt.Errorf("kernel-path is required")
+	if _, err := parseGuestUnits(); err != nil {
+		return err
 	}
-	if initrdPath == "" {
-		return fmt.Errorf("initrd-path is required")
+	if err := validateSocketComponents(); err != nil {
+		return err
 	}
-	if rootfsPath == "" {
-		return fmt.Errorf("rootfs-path is required")
+	if r, err := parseRoutes(); err != nil {
+		return err
+	} else if len(r) != 0 && noInitrd {
+		// the routes are written by the ignition
+		return fmt.Errorf("route cannot be used with no-initrd")
 	}
-	if targetPath == "" {
-		return fmt.Errorf("disk-path is required")
+	if _, err := parseMounts(); err != nil {
+		return err
 	}
-	if versions == "" {
-		return fmt.Errorf("versions is required")
+	if _, err := parseAllowFrom(); err != nil {
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+// TestMain registers the flags like ovm does, so the flag variables hold their defaults.
+func TestMain(m *testing.M) {
+	if err := Parse(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	os.Exit(m.Run())
+}
+
+// setRequiredFlags sets the flags required by Validate, and resets them when the test ends.
+func setRequiredFlags(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]*string{"kernel": &kernelPath, "initrd": &initrdPath, "rootfs.img": &rootfsPath}
+	for n, p := range files {
+		*p = filepath.Join(dir, n)
+		if err := os.WriteFile(*p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := versionsParams
+	versionsParams = map[string]string{"kernel": "", "initrd": "", "rootfs": "", "data_img": ""}
+	t.Cleanup(func() {
+		versionsParams = saved
+		name, cpus, memory, logPath, socketPath, sshKeyPath, targetPath, versions = "", 0, 0, "", "", "", "", ""
+		kernelPath, initrdPath, rootfsPath = "", "", ""
+	})
+
+	name, cpus, memory = "test", 2, 1024
+	logPath, socketPath, sshKeyPath, targetPath = dir, dir, dir, dir
+	versions = "kernel=1,initrd=1,rootfs=1,data_img=1"
+}
+
+// validated reports whether Validate accepted the flags, or rejected them with an error about flagName, and returns its error.
+func validated(t *testing.T, flagName string, valid bool) (bool, error) {
+	t.Helper()
+
+	err := Validate()
+	if valid {
+		return err == nil, err
+	}
+	return err != nil && strings.Contains(err.Error(), flagName), err
+}
+
+func TestValidateSerialConsoleBaud(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(b int) { serialConsoleBaud = b }(serialConsoleBaud)
+
+	tests := []struct {
+		baud  int
+		valid bool
+	}{
+		{12345, false},
+		{0, false},
+		{9600, true},
+		{DefaultSerialConsoleBaud, true},
+	}
+
+	for _, tt := range tests {
+		serialConsoleBaud = tt.baud
+		ok, err := validated(t, "serial-console-baud", tt.valid)
+		if !ok {
+			t.Errorf("baud %d: got %v, want valid %v", tt.baud, err, tt.valid)
+		}
+		if !tt.valid && ok && !strings.Contains(err.Error(), "must be one of 9600, 19200, 38400, 57600 or 115200") {
+			t.Errorf("baud %d: the error %q does not list the supported speeds", tt.baud, err)
+		}
+	}
+}
+
+func TestValidateGuestWritableRoot(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(w bool, o, r string) { guestWritableRoot, rootfsOverlay, rootfsPath = w, o, r }(guestWritableRoot, rootfsOverlay, rootfsPath)
+
+	dir := t.TempDir()
+	ext4 := filepath.Join(dir, "rootfs.img")
+	writeExt4Superblock(t, ext4, 2)
+	dataImg := filepath.Join(dir, "data.img")
+	writeExt4Superblock(t, dataImg, 2)
+	squashfs := filepath.Join(dir, "rootfs.squashfs")
+	if err := os.WriteFile(squashfs, []byte("hsqs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		writable bool
+		overlay  string
+		rootfs   string
+		valid    bool
+	}{
+		{"ext4", true, RootfsOverlayOff, ext4, true},
+		{"not writable", false, RootfsOverlayOff, squashfs, true},
+		{"with rootfs-overlay", true, RootfsOverlayTmpfs, ext4, false},
+		{"rootfs named data.img", true, RootfsOverlayOff, dataImg, false},
+		{"squashfs", true, RootfsOverlayOff, squashfs, false},
+	}
+
+	for _, tt := range tests {
+		guestWritableRoot, rootfsOverlay, rootfsPath = tt.writable, tt.overlay, tt.rootfs
+		if ok, err := validated(t, "guest-writable-root", tt.valid); !ok {
+			t.Errorf("%s: got %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestTraceAppliedByBasic(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(v string) {
+		trace = v
+		_ = logger.SetTrace([]string{"setup"}, false)
+	}(trace)
+
+	trace = "unknown"
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "unknown trace component") {
+		t.Fatalf("got %v, want an unknown trace component", err)
+	}
+
+	trace = "setup"
+	_ = Validate()
+	if logger.Setup.Enabled() {
+		t.Fatal("Validate enabled the trace")
+	}
+
+	if err := (&Context{}).basic(); err != nil {
+		t.Fatal(err)
+	}
+	if !logger.Setup.Enabled() {
+		t.Fatal("basic did not enable the trace")
+	}
+}
+
+func TestValidateClockSource(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(v string) { clockSource = v }(clockSource)
+
+	for _, tt := range []struct {
+		source string
+		valid  bool
+	}{
+		{"", true},
+		{"hpet", consts.IsAMD64},
+		{"acpi_pm", false},
+	} {
+		clockSource = tt.source
+		if ok, err := validated(t, "clock-source", tt.valid); !ok {
+			t.Errorf("clock source %q: got %v, want valid %v", tt.source, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateSocketBacklog(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(v int) { socketBacklog = v }(socketBacklog)
+
+	for _, tt := range []struct {
+		backlog int
+		valid   bool
+	}{
+		{512, true},
+		{1, true},
+		{0, false},
+		{-1, false},
+	} {
+		socketBacklog = tt.backlog
+		if ok, err := validated(t, "socket-backlog", tt.valid); !ok {
+			t.Errorf("backlog %d: got %v, want valid %v", tt.backlog, err, tt.valid)
+		}
+	}
+}
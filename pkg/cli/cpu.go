@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetOnlineCPUs brings CPUs of the guest online or offline, so n CPUs are online.
+// CPU 0 cannot be taken offline, n must be between 1 and CPUS.
+func (c *Context) SetOnlineCPUs(n uint) error {
+	if n < 1 || n > c.CPUS {
+		return fmt.Errorf("cpus must be between 1 and %d", c.CPUS)
+	}
+
+	commands := make([]string, 0, c.CPUS-1)
+	for i := uint(1); i < c.CPUS; i++ {
+		online := 0
+		if i < n {
+			online = 1
+		}
+		commands = append(commands, fmt.Sprintf("echo %d > /sys/devices/system/cpu/cpu%d/online", online, i))
+	}
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	_, err := c.RunInGuest(strings.Join(commands, " && "))
+	return err
+}
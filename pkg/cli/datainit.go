@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+const (
+	// DataInitAuto leaves a blank data disk to be formatted by the guest, and refuses to start with an unrecognized one
+	DataInitAuto = "auto"
+	// DataInitNever refuses to start unless the data disk already has a filesystem
+	DataInitNever = "never"
+	// DataInitAlways recreates the data disk on this start, it destroys all data and needs -data-init-yes
+	DataInitAlways = "always"
+)
+
+var dataInitPolicies = []string{DataInitAuto, DataInitNever, DataInitAlways}
+
+const (
+	// dataDiskSize is the size of the sparse data disk, the guest only uses what it writes
+	dataDiskSize = 8 * 1024 * 1024 * 1024 * 1024
+
+	// dataDiskProbeSize covers the superblocks of the common filesystems, nothing there means the disk was never formatted
+	dataDiskProbeSize = 1024 * 1024
+)
+
+var (
+	ErrDataDiskUnformatted  = errors.New("the data disk has no filesystem")
+	ErrDataDiskUnrecognized = errors.New("the data disk is not blank and has no ext4 or xfs filesystem")
+)
+
+// dataDiskBlank returns whether the start of the disk is all zeros, as created by ovm.
+func dataDiskBlank(p string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, dataDiskProbeSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+
+	return bytes.Count(buf[:n], []byte{0}) == n, nil
+}
+
+// initDataDisk applies -data-init-policy to the data disk before the guest sees it, reset is true when it was recreated.
+// The guest formats a blank data disk, so ovm itself only decides whether to start and recreates the disk for always.
+func (c *Context) initDataDisk() (reset bool, err error) {
+	if c.DataInitPolicy == DataInitAlways {
+		if err := os.RemoveAll(c.DiskDataPath); err != nil {
+			return false, err
+		}
+		return true, utils.CreateSparseFile(c.DiskDataPath, dataDiskSize)
+	}
+
+	if _, err := DetectFilesystem(c.DiskDataPath); err == nil {
+		return false, nil
+	} else if !errors.Is(err, ErrUnsupportedFilesystem) {
+		return false, fmt.Errorf("probe data disk failed: %w", err)
+	}
+
+	blank, err := dataDiskBlank(c.DiskDataPath)
+	if err != nil {
+		return false, fmt.Errorf("probe data disk failed: %w", err)
+	}
+
+	if !blank {
+		return false, fmt.Errorf("%w: %s, it may be corrupted or use another filesystem, use -data-init-policy=always -data-init-yes to recreate it (all data is lost)", ErrDataDiskUnrecognized, c.DiskDataPath)
+	}
+	if c.DataInitPolicy == DataInitNever {
+		return false, fmt.Errorf("%w: %s, -data-init-policy=never does not let the guest format it", ErrDataDiskUnformatted, c.DiskDataPath)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/oomol-lab/ovm/pkg/pidlock"
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+var (
+	ErrVMRunning        = errors.New("the VM is running")
+	ErrDataWouldBeLost  = errors.New("the requested size is smaller than the data in the disk image")
+	ErrNotExt4Image     = errors.New("the disk image does not contain an ext4 filesystem")
+	ErrResize2fsMissing = errors.New("resize2fs not found in PATH, install e2fsprogs")
+	ErrE2fsckMissing    = errors.New("e2fsck not found in PATH, install e2fsprogs")
+)
+
+// FsckError is returned by DiskRepair when e2fsck could not repair the filesystem, see e2fsck(8) for the exit codes.
+type FsckError struct {
+	ExitCode int
+	Output   string
+}
+
+func (e *FsckError) Error() string {
+	return fmt.Sprintf("e2fsck exited with %d: %s", e.ExitCode, e.Output)
+}
+
+// ext4 superblock, see: https://www.kernel.org/doc/html/latest/filesystems/ext4/globals.html#super-block
+const (
+	ext4SuperblockOffset = 1024
+	ext4Magic            = 0xEF53
+)
+
+var minimumSizeRegexp = regexp.MustCompile(`Estimated minimum size of the filesystem: (\d+)`)
+
+// DiskShrink shrinks the data disk image (and its filesystem) to newSizeBytes. The VM must be stopped.
+func (c *Context) DiskShrink(newSizeBytes uint64) error {
+	if owner, err := pidlock.New(c.LockFile).Owner(); err == nil && utils.ProcessExists(owner) {
+		return fmt.Errorf("%w (pid %d)", ErrVMRunning, owner)
+	}
+
+	stat, err := os.Stat(c.DiskDataPath)
+	if err != nil {
+		return err
+	}
+	if newSizeBytes >= uint64(stat.Size()) {
+		return fmt.Errorf("new size %d must be smaller than the current size %d", newSizeBytes, stat.Size())
+	}
+
+	blockSize, err := ext4BlockSize(c.DiskDataPath)
+	if err != nil {
+		return err
+	}
+
+	resize2fs, err := exec.LookPath("resize2fs")
+	if err != nil {
+		return ErrResize2fsMissing
+	}
+
+	// resize2fs knows where the last used block is, the free block count of the superblock does not
+	out, err := exec.Command(resize2fs, "-P", c.DiskDataPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("resize2fs -P failed: %w: %s", err, out)
+	}
+	m := minimumSizeRegexp.FindSubmatch(out)
+	if m == nil {
+		return fmt.Errorf("unexpected output of resize2fs -P: %s", out)
+	}
+	minBlocks, _ := strconv.ParseUint(string(m[1]), 10, 64)
+
+	newBlocks := newSizeBytes / blockSize
+	if newBlocks < minBlocks {
+		return fmt.Errorf("%w: need at least %d bytes", ErrDataWouldBeLost, minBlocks*blockSize)
+	}
+
+	if out, err := exec.Command(resize2fs, c.DiskDataPath, strconv.FormatUint(newBlocks*blockSize/1024, 10)+"K").CombinedOutput(); err != nil {
+		return fmt.Errorf("resize2fs failed: %w: %s", err, out)
+	}
+
+	return os.Truncate(c.DiskDataPath, int64(newSizeBytes))
+}
+
+// DiskRepair checks and repairs the filesystem of the data disk image, e.g. after a kernel panic or power loss. The VM must be stopped.
+// Errors which were corrected (exit code 1) are not an error, all other failures of e2fsck return a *FsckError.
+func (c *Context) DiskRepair() error {
+	if owner, err := pidlock.New(c.LockFile).Owner(); err == nil && utils.ProcessExists(owner) {
+		return fmt.Errorf("%w (pid %d)", ErrVMRunning, owner)
+	}
+
+	if _, err := ext4BlockSize(c.DiskDataPath); err != nil {
+		return err
+	}
+
+	e2fsck, err := exec.LookPath("e2fsck")
+	if err != nil {
+		return ErrE2fsckMissing
+	}
+
+	out, err := exec.Command(e2fsck, "-y", "-f", c.DiskDataPath).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("run e2fsck failed: %w", err)
+	}
+	if exitErr.ExitCode() > 1 {
+		return &FsckError{ExitCode: exitErr.ExitCode(), Output: string(out)}
+	}
+
+	return nil
+}
+
+// ext4BlockSize reads the block size from the ext4 superblock of the image.
+func ext4BlockSize(p string) (uint64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sb := make([]byte, 1024)
+	if _, err := f.ReadAt(sb, ext4SuperblockOffset); err != nil {
+		return 0, fmt.Errorf("read superblock failed: %w", err)
+	}
+
+	if binary.LittleEndian.Uint16(sb[0x38:]) != ext4Magic {
+		return 0, ErrNotExt4Image
+	}
+
+	// s_log_block_size: block size = 2 ^ (10 + s_log_block_size)
+	return 1024 << binary.LittleEndian.Uint32(sb[0x18:]), nil
+}
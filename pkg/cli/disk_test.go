@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// writeExt4Superblock writes an image which only has the magic and the block size of an ext4 superblock.
+func writeExt4Superblock(t *testing.T, p string, logBlockSize uint32) {
+	t.Helper()
+
+	b := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(b[ext4SuperblockOffset+0x18:], logBlockSize)
+	binary.LittleEndian.PutUint16(b[ext4SuperblockOffset+0x38:], ext4Magic)
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExt4BlockSize(t *testing.T) {
+	dir := t.TempDir()
+
+	p := filepath.Join(dir, "ext4.img")
+	writeExt4Superblock(t, p, 2)
+	if size, err := ext4BlockSize(p); err != nil || size != 4096 {
+		t.Errorf("block size %d, %v, want 4096", size, err)
+	}
+
+	other := filepath.Join(dir, "other.img")
+	if err := os.WriteFile(other, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ext4BlockSize(other); !errors.Is(err, ErrNotExt4Image) {
+		t.Errorf("got %v, want ErrNotExt4Image", err)
+	}
+}
+
+// TestDiskRepairExitCodes runs DiskRepair with a fake e2fsck exiting with the given code.
+func TestDiskRepairExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	c := &Context{DiskDataPath: filepath.Join(dir, "data.img"), LockFile: filepath.Join(dir, "ovm.pid")}
+	writeExt4Superblock(t, c.DiskDataPath, 2)
+
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	if err := c.DiskRepair(); !errors.Is(err, ErrE2fsckMissing) {
+		t.Fatalf("without e2fsck: %v, want ErrE2fsckMissing", err)
+	}
+
+	sh, err := exec.LookPath("/bin/sh")
+	if err != nil {
+		t.Skip("no /bin/sh")
+	}
+	for _, tt := range []struct {
+		code    string
+		wantErr bool
+	}{
+		{"0", false},
+		{"1", false},
+		{"4", true},
+	} {
+		script := "#!" + sh + "\necho checked\nexit " + tt.code + "\n"
+		if err := os.WriteFile(filepath.Join(bin, "e2fsck"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		err := c.DiskRepair()
+		var fsckErr *FsckError
+		switch {
+		case !tt.wantErr && err != nil:
+			t.Errorf("exit code %s: %v, want no error", tt.code, err)
+		case tt.wantErr && (!errors.As(err, &fsckErr) || fsckErr.ExitCode != 4 || fsckErr.Output != "checked\n"):
+			t.Errorf("exit code %s: %#v, want a *FsckError with the output", tt.code, err)
+		}
+	}
+}
+
+func TestDiskRepair(t *testing.T) {
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		t.Skip("mkfs.ext4 not found")
+	}
+	if _, err := exec.LookPath("e2fsck"); err != nil {
+		t.Skip("e2fsck not found")
+	}
+
+	dir := t.TempDir()
+	c := &Context{DiskDataPath: filepath.Join(dir, "data.img"), LockFile: filepath.Join(dir, "ovm.pid")}
+	if err := os.WriteFile(c.DiskDataPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(c.DiskDataPath, 16*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(mkfs, "-q", "-F", c.DiskDataPath).CombinedOutput(); err != nil {
+		t.Fatalf("mkfs.ext4: %v: %s", err, out)
+	}
+
+	if err := c.DiskRepair(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+const redacted = "[redacted]"
+
+// redactedWords are the parts of field names whose values are not dumped.
+var redactedWords = []string{"key", "passphrase", "secret", "password", "token", "auth", "header"}
+
+// DumpConfig returns every exported field of c by its snake_case name, e.g. to find out why a VM started with unexpected settings.
+// Fields whose name contains key, passphrase, secret, password, token, auth or header are redacted, also in the nested
+// structs of this package (e.g. ObservabilityExport.Headers). The map can always be marshaled to JSON:
+// listeners are their address, values implementing fmt.Stringer (e.g. time.Duration) are their string,
+// nil pointers are null and values JSON cannot encode are their type.
+func (c *Context) DumpConfig() map[string]any {
+	return dumpStruct(reflect.ValueOf(c).Elem())
+}
+
+func dumpStruct(v reflect.Value) map[string]any {
+	t := v.Type()
+
+	config := make(map[string]any, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		key := snakeCase(f.Name)
+		if isRedacted(f.Name) {
+			config[key] = redacted
+			continue
+		}
+
+		config[key] = dumpValue(v.Field(i).Interface())
+	}
+
+	return config
+}
+
+func isRedacted(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range redactedWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func dumpValue(value any) any {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	if ln, ok := value.(net.Listener); ok {
+		return ln.Addr().String()
+	}
+
+	if s, ok := value.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	// the structs of this package are dumped field by field, so their secrets are redacted too
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct && rv.Type().PkgPath() == reflect.TypeOf(Context{}).PkgPath() {
+		return dumpStruct(rv)
+	}
+
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%T", value)
+	}
+
+	return value
+}
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms together, e.g. SSHPrivateKeyPath is ssh_private_key_path.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
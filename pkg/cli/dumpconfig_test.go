@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c := &Context{
+		Name:              "ovm",
+		SSHPrivateKeyPath: "/tmp/ovm/key",
+		SSHPortListener:   ln,
+		AssumeReadyAfter:  30 * time.Second,
+		ObservabilityExport: ObservabilityExport{
+			OTLPEndpoint: "http://localhost:4318",
+			Headers:      map[string]string{"Authorization": "Bearer secret"},
+		},
+	}
+	config := c.DumpConfig()
+
+	typ := reflect.TypeOf(Context{})
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.IsExported() {
+			if _, ok := config[snakeCase(f.Name)]; !ok {
+				t.Errorf("field %s is missing as %s", f.Name, snakeCase(f.Name))
+			}
+		}
+	}
+
+	if config["name"] != "ovm" {
+		t.Errorf("name = %v", config["name"])
+	}
+	if config["ssh_private_key_path"] != redacted {
+		t.Errorf("ssh_private_key_path = %v, want it redacted", config["ssh_private_key_path"])
+	}
+	if config["ssh_port_listener"] != ln.Addr().String() {
+		t.Errorf("ssh_port_listener = %v", config["ssh_port_listener"])
+	}
+	if config["assume_ready_after"] != "30s" {
+		t.Errorf("assume_ready_after = %v", config["assume_ready_after"])
+	}
+	if config["rootfs_prewarm"] != nil {
+		t.Errorf("rootfs_prewarm = %v, want nil", config["rootfs_prewarm"])
+	}
+
+	export, ok := config["observability_export"].(map[string]any)
+	if !ok {
+		t.Fatalf("observability_export = %#v, want a map", config["observability_export"])
+	}
+	if export["headers"] != redacted || export["otlp_endpoint"] != "http://localhost:4318" {
+		t.Errorf("observability_export = %v", export)
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Bearer") {
+		t.Errorf("the dump contains the OTLP header: %s", data)
+	}
+}
+
+func TestDumpConfigTypedNilListener(t *testing.T) {
+	var ln *net.TCPListener
+	c := &Context{SSHPortListener: ln}
+
+	if v := c.DumpConfig()["ssh_port_listener"]; v != nil {
+		t.Errorf("ssh_port_listener = %v, want nil", v)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":              "name",
+		"SSHPrivateKeyPath": "ssh_private_key_path",
+		"CPUS":              "cpus",
+		"MemoryBytes":       "memory_bytes",
+		"OTLPEndpoint":      "otlp_endpoint",
+	}
+
+	for in, want := range tests {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultGuestUnits are always watched, -watch-guest-unit adds more.
+var DefaultGuestUnits = []string{"podman.socket"}
+
+// GuestServiceFailureWindow is the window in which the failures of a unit are counted for its restart policy.
+const GuestServiceFailureWindow = 10 * time.Minute
+
+// GuestUnit is a systemd unit in the guest whose state is reported to the host.
+type GuestUnit struct {
+	Name string `json:"name"`
+	// RestartAfter restarts the unit once it failed this many times within GuestServiceFailureWindow, 0 never restarts it
+	RestartAfter int `json:"restartAfter,omitempty"`
+}
+
+// GuestServiceStatus is the last known state of a watched unit, returned by GET /guest/services.
+type GuestServiceStatus struct {
+	Unit string `json:"unit"`
+	// State is as printed by systemctl is-active (active, failed, activating, ...), unknown before the first check
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	// Failures within GuestServiceFailureWindow
+	Failures int `json:"failures"`
+	Restarts int `json:"restarts"`
+	// Journal are the last lines of the unit when it failed
+	Journal []string `json:"journal,omitempty"`
+}
+
+var guestUnitName = regexp.MustCompile(`^[A-Za-z0-9@_.-]+\.(service|socket|timer|mount|path|target)$`)
+
+type guestUnitFlags []string
+
+func (g *guestUnitFlags) String() string {
+	return strings.Join(*g, ", ")
+}
+
+func (g *guestUnitFlags) Set(v string) error {
+	*g = append(*g, v)
+	return nil
+}
+
+// parseGuestUnit parses "UNIT" or "UNIT:restart=N".
+func parseGuestUnit(v string) (*GuestUnit, error) {
+	name, policy, hasPolicy := strings.Cut(v, ":")
+	if !guestUnitName.MatchString(name) {
+		return nil, fmt.Errorf("watch-guest-unit %q: %s is not a systemd unit name, e.g. podman.service", v, name)
+	}
+
+	u := &GuestUnit{Name: name}
+	if !hasPolicy {
+		return u, nil
+	}
+
+	n, ok := strings.CutPrefix(policy, "restart=")
+	if !ok {
+		return nil, fmt.Errorf("watch-guest-unit %q: unknown policy %s, must be restart=N", v, policy)
+	}
+	count, err := strconv.Atoi(n)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("watch-guest-unit %q: restart=%s must be a positive number of failures", v, n)
+	}
+	u.RestartAfter = count
+
+	return u, nil
+}
+
+// parseGuestUnits returns the default units and -watch-guest-unit, a unit passed again only changes its policy.
+func parseGuestUnits() ([]GuestUnit, error) {
+	var result []GuestUnit
+	for _, name := range DefaultGuestUnits {
+		result = append(result, GuestUnit{Name: name})
+	}
+
+	for _, v := range watchGuestUnits {
+		u, err := parseGuestUnit(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if i := slices.IndexFunc(result, func(e GuestUnit) bool { return e.Name == u.Name }); i >= 0 {
+			result[i] = *u
+			continue
+		}
+		result = append(result, *u)
+	}
+
+	return result, nil
+}
+
+// SetGuestServices records the last checked state of the watched units.
+func (c *Context) SetGuestServices(s []GuestServiceStatus) {
+	c.guestServicesMu.Lock()
+	defer c.guestServicesMu.Unlock()
+	c.guestServices = s
+}
+
+// GuestServices returns the last checked state of the watched units.
+func (c *Context) GuestServices() []GuestServiceStatus {
+	c.guestServicesMu.RLock()
+	defer c.guestServicesMu.RUnlock()
+	return slices.Clone(c.guestServices)
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseGuestUnit(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    GuestUnit
+		wantErr string
+	}{
+		{"podman.service", GuestUnit{Name: "podman.service"}, ""},
+		{"getty@tty1.service:restart=3", GuestUnit{Name: "getty@tty1.service", RestartAfter: 3}, ""},
+		{"fstrim.timer", GuestUnit{Name: "fstrim.timer"}, ""},
+		{"podman", GuestUnit{}, "not a systemd unit name"},
+		{"pod man.service", GuestUnit{}, "not a systemd unit name"},
+		{"podman.service;reboot", GuestUnit{}, "not a systemd unit name"},
+		{"podman.service:always", GuestUnit{}, "unknown policy"},
+		{"podman.service:restart=0", GuestUnit{}, "positive number"},
+		{"podman.service:restart=many", GuestUnit{}, "positive number"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseGuestUnit(tt.v)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseGuestUnit(%q): %v, want an error about %q", tt.v, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGuestUnit(%q): %v", tt.v, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseGuestUnit(%q) = %+v, want %+v", tt.v, *got, tt.want)
+		}
+	}
+}
+
+func TestParseGuestUnits(t *testing.T) {
+	defer func(g guestUnitFlags) { watchGuestUnits = g }(watchGuestUnits)
+
+	// a default unit passed again only changes its policy
+	watchGuestUnits = guestUnitFlags{"sshd.service", "podman.socket:restart=2"}
+	got, err := parseGuestUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GuestUnit{{Name: "podman.socket", RestartAfter: 2}, {Name: "sshd.service"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseGuestUnits() = %+v, want %+v", got, want)
+	}
+
+	watchGuestUnits = guestUnitFlags{"not-a-unit"}
+	if _, err := parseGuestUnits(); err == nil {
+		t.Error("an invalid unit was accepted")
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"net"
+	"os"
+	"path"
+	"syscall"
+)
+
+// HandoverRestful is the name of the restful listener passed to the ovm replacing this one.
+// The podman and docker sockets are created by gvproxy's ssh forward, which cannot use a passed listener.
+const HandoverRestful = "restful"
+
+// Inherit keeps the listeners passed by the replaced ovm, they are used instead of creating new sockets.
+// The inodes of the socket files are kept, to notice when the replaced ovm removed them before it exited.
+func (c *Context) Inherit(listeners map[string]net.Listener) {
+	c.inherited = listeners
+	c.inheritedInodes = make(map[string]uint64, len(listeners))
+	for name, l := range listeners {
+		if ino, ok := socketInode(l.Addr().String()); ok {
+			c.inheritedInodes[name] = ino
+		}
+	}
+}
+
+// socketInode returns the inode of the socket file at p, false if there is none.
+func socketInode(p string) (uint64, bool) {
+	info, err := os.Stat(p)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return 0, false
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Ino), true
+}
+
+// Inherited returns the names of the listeners passed by the replaced ovm.
+func (c *Context) Inherited() []string {
+	names := make([]string, 0, len(c.inherited))
+	for name := range c.inherited {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// InheritedListener returns the listener passed by the replaced ovm, nil if there is none.
+func (c *Context) InheritedListener(name string) net.Listener {
+	return c.inherited[name]
+}
+
+// keepInherited drops the inherited listeners which are not bound to the socket of this ovm
+// (e.g. moved by PATCH /vm/socket-path) or whose socket file is gone, and returns the paths to keep while the socket path is cleaned.
+// A dropped listener is created again on the socket path.
+func (c *Context) keepInherited() map[string]bool {
+	sockets := map[string]string{
+		HandoverRestful: c.RestfulSocketPath,
+	}
+
+	keep := map[string]bool{}
+	for name, l := range c.inherited {
+		if p, ok := sockets[name]; ok && l.Addr().String() == p {
+			if ino, ok := socketInode(p); ok && ino == c.inheritedInodes[name] {
+				// like a listener created by this ovm, the socket file is removed when it is closed
+				if ul, ok := l.(*net.UnixListener); ok {
+					ul.SetUnlinkOnClose(true)
+				}
+				keep[path.Base(p)] = true
+				continue
+			}
+		}
+
+		_ = l.Close()
+		delete(c.inherited, name)
+	}
+
+	return keep
+}
+
+// cleanSocketPath removes the sockets of the previous start, except the inherited ones.
+func (c *Context) cleanSocketPath() error {
+	keep := c.keepInherited()
+	if len(keep) == 0 {
+		return os.RemoveAll(c.SocketPath)
+	}
+
+	entries, err := os.ReadDir(c.SocketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !keep[e.Name()] {
+			if err := os.RemoveAll(path.Join(c.SocketPath, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func inheritedRestful(t *testing.T) (*Context, string) {
+	d, err := os.MkdirTemp("", "ovm-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(d) })
+
+	p := path.Join(d, "restful.sock")
+	l, err := net.Listen("unix", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like a listener passed by the replaced ovm
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	t.Cleanup(func() { _ = l.Close() })
+
+	c := &Context{SocketPath: d, RestfulSocketPath: p}
+	c.Inherit(map[string]net.Listener{HandoverRestful: l})
+
+	return c, p
+}
+
+func TestCleanSocketPathKeepsInherited(t *testing.T) {
+	c, p := inheritedRestful(t)
+	if err := os.WriteFile(path.Join(c.SocketPath, "podman.sock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.cleanSocketPath(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.InheritedListener(HandoverRestful) == nil {
+		t.Fatal("inherited listener dropped")
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatalf("inherited socket removed: %v", err)
+	}
+	if _, err := os.Stat(path.Join(c.SocketPath, "podman.sock")); !os.IsNotExist(err) {
+		t.Fatalf("stale socket kept: %v", err)
+	}
+}
+
+func TestCleanSocketPathDropsUnlinked(t *testing.T) {
+	c, p := inheritedRestful(t)
+
+	// the replaced ovm removed the socket file before it exited
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.cleanSocketPath(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.InheritedListener(HandoverRestful) != nil {
+		t.Fatal("listener without a socket file kept, it can never be reached")
+	}
+}
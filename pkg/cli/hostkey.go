@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var ErrNoHostKey = errors.New("no guest host key recorded yet, start the VM once")
+
+// HostKeyRecord is the guest host key recorded by RecordGuestHostKey.
+type HostKeyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	// Previous is the fingerprint of the replaced key, empty if the key did not change
+	Previous string `json:"previous,omitempty"`
+}
+
+// RecordGuestHostKey records the host key of the guest in versions.json, it connects to the guest if there was no connection yet.
+// The guest generates a new host key when the rootfs is recreated, the record follows the new key and reports the replaced one.
+func (c *Context) RecordGuestHostKey() (*HostKeyRecord, error) {
+	c.hostKeyMu.Lock()
+	key := c.hostKey
+	c.hostKeyMu.Unlock()
+
+	if key == nil {
+		if _, err := c.RunInGuest("true"); err != nil {
+			return nil, err
+		}
+
+		c.hostKeyMu.Lock()
+		key = c.hostKey
+		c.hostKeyMu.Unlock()
+	}
+	if key == nil {
+		return nil, fmt.Errorf("the host key of the guest was not seen by the ssh connection")
+	}
+
+	record := &HostKeyRecord{
+		Fingerprint: ssh.FingerprintSHA256(key),
+	}
+
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	err := updateVersions(c.VersionsPath, func(v *versionsJSON) bool {
+		if v.HostKey == line {
+			return false
+		}
+
+		if prev, err := parseHostKey(v.HostKey); err == nil {
+			record.Previous = ssh.FingerprintSHA256(prev)
+		}
+		v.HostKey = line
+		return true
+	})
+
+	return record, err
+}
+
+// ReadGuestHostKey reads the guest host key recorded in versions.json.
+func ReadGuestHostKey(p string) (ssh.PublicKey, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &versionsJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	if v.HostKey == "" {
+		return nil, ErrNoHostKey
+	}
+
+	return parseHostKey(v.HostKey)
+}
+
+// KnownHostsLine returns the known_hosts entry of the guest for the ssh port on the host.
+func KnownHostsLine(key ssh.PublicKey, port int) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))}, key)
+}
+
+func parseHostKey(line string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	return key, err
+}
+
+// hostKeyFingerprint returns the fingerprint of the recorded key, empty if there is none.
+func hostKeyFingerprint(line string) string {
+	key, err := parseHostKey(line)
+	if err != nil {
+		return ""
+	}
+
+	return ssh.FingerprintSHA256(key)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+const guestHostsPath = "/etc/hosts"
+
+var domainRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// GuestDNSOverride adds "IP DOMAIN" to /etc/hosts in the guest, unless the entry already exists.
+func (c *Context) GuestDNSOverride(domain, ip string) error {
+	command, err := dnsOverrideCommand(guestHostsPath, domain, ip)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.RunInGuest(command)
+	return err
+}
+
+// GuestDNSRemoveOverride removes all lines of /etc/hosts in the guest containing the domain.
+func (c *Context) GuestDNSRemoveOverride(domain string) error {
+	command, err := dnsRemoveOverrideCommand(guestHostsPath, domain)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.RunInGuest(command)
+	return err
+}
+
+func dnsOverrideCommand(hosts, domain, ip string) (string, error) {
+	if !domainRegexp.MatchString(domain) {
+		return "", fmt.Errorf("invalid domain: %s", domain)
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid ip: %s", ip)
+	}
+
+	return fmt.Sprintf(
+		`awk -v ip=%s -v d=%s '$1 == ip { for (i = 2; i <= NF; i++) if ($i == d) f = 1 } END { exit !f }' %s || echo %s | tee -a %s > /dev/null`,
+		ShellQuote(addr.String()), ShellQuote(domain), ShellQuote(hosts), ShellQuote(addr.String()+" "+domain), ShellQuote(hosts),
+	), nil
+}
+
+func dnsRemoveOverrideCommand(hosts, domain string) (string, error) {
+	if !domainRegexp.MatchString(domain) {
+		return "", fmt.Errorf("invalid domain: %s", domain)
+	}
+
+	// /etc/hosts is rewritten in place (not renamed), it may be bind mounted into containers
+	h := ShellQuote(hosts)
+	tmp := ShellQuote(hosts + ".ovm")
+	return fmt.Sprintf(
+		`awk -v d=%s '{ for (i = 2; i <= NF; i++) if ($i == d) next; print }' %s > %s && cat %s > %s; rm -f %s`,
+		ShellQuote(domain), h, tmp, tmp, h, tmp,
+	), nil
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func runHostsCommand(t *testing.T, command string) {
+	t.Helper()
+
+	if out, err := exec.Command("sh", "-c", command).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v: %s", command, err, out)
+	}
+}
+
+func TestDNSOverrideCommands(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk not found")
+	}
+
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hosts, []byte("127.0.0.1 localhost\n10.0.0.1 old.test other.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	add, err := dnsOverrideCommand(hosts, "api.test", "10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// adding the same entry twice writes it once
+	runHostsCommand(t, add)
+	runHostsCommand(t, add)
+
+	remove, err := dnsRemoveOverrideCommand(hosts, "old.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runHostsCommand(t, remove)
+
+	data, err := os.ReadFile(hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "127.0.0.1 localhost\n10.0.0.2 api.test\n"; string(data) != want {
+		t.Errorf("hosts = %q, want %q", data, want)
+	}
+	if _, err := os.Stat(hosts + ".ovm"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
+
+func TestDNSOverrideInvalid(t *testing.T) {
+	tests := []struct {
+		domain, ip string
+	}{
+		{"api.test; reboot", "10.0.0.1"},
+		{"-api.test", "10.0.0.1"},
+		{"api..test", "10.0.0.1"},
+		{"api.test", "10.0.0"},
+		{"api.test", "$(reboot)"},
+	}
+
+	for _, tt := range tests {
+		if _, err := dnsOverrideCommand(guestHostsPath, tt.domain, tt.ip); err == nil {
+			t.Errorf("domain %q, ip %q accepted", tt.domain, tt.ip)
+		}
+	}
+	if _, err := dnsRemoveOverrideCommand(guestHostsPath, "a b"); err == nil {
+		t.Error("a domain with a space accepted")
+	}
+}
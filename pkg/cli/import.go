@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+var (
+	ErrDataDiskExists        = errors.New("the target path already has a data.img, import into a new target path")
+	ErrUnsupportedFilesystem = errors.New("the filesystem is not supported for the data disk")
+)
+
+// Filesystems accepted for an imported data disk.
+const (
+	FilesystemExt4 = "ext4"
+	FilesystemXFS  = "xfs"
+)
+
+// DataImport records that data.img was imported from an existing disk image instead of created empty.
+type DataImport struct {
+	Source     string `json:"source"`
+	Filesystem string `json:"filesystem"`
+	// Cloned is false if the image had to be copied, because clonefile is not supported
+	Cloned     bool      `json:"cloned"`
+	ImportedAt time.Time `json:"importedAt"`
+	// Provisioned is set after the first boot adjusted the container storage
+	Provisioned bool `json:"provisioned"`
+}
+
+// DetectFilesystem returns the filesystem of a raw disk image, images that cannot be used as the data disk are rejected with guidance.
+func DetectFilesystem(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// large enough for the btrfs superblock at 64KiB
+	buf := make([]byte, 0x10100)
+	// small images are read partially, the rest of the buffer stays zero
+	if _, err := f.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read %s failed: %w", p, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(buf, []byte("QFI\xfb")):
+		return "", fmt.Errorf("%w: %s is a qcow2 image, convert it first with: qemu-img convert -O raw %s data.raw", ErrUnsupportedFilesystem, p, p)
+	case bytes.Equal(buf[512:520], []byte("EFI PART")):
+		return "", fmt.Errorf("%w: %s is a partitioned disk (podman machine images are), extract the partition with the container storage first, e.g. with dd and the offset shown by fdisk -l", ErrUnsupportedFilesystem, p)
+	case bytes.Equal(buf[0x10040:0x10048], []byte("_BHRfS_M")):
+		return "", fmt.Errorf("%w: %s is btrfs, the guest uses the overlay storage driver on ext4 or xfs; export the images with podman save and load them into ovm instead", ErrUnsupportedFilesystem, p)
+	case bytes.HasPrefix(buf, []byte("XFSB")):
+		return FilesystemXFS, nil
+	case binary.LittleEndian.Uint16(buf[ext4SuperblockOffset+0x38:]) == ext4Magic:
+		return FilesystemExt4, nil
+	default:
+		return "", fmt.Errorf("%w: no ext4 or xfs filesystem found in %s", ErrUnsupportedFilesystem, p)
+	}
+}
+
+// ImportDataDisk places the disk image from as data.img of a new target path and records the import in versions.json.
+// The data_img version is taken over on the first start, instead of creating an empty disk.
+func ImportDataDisk(targetPath, from string) (*DataImport, error) {
+	src, err := filepath.Abs(from)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := DetectFilesystem(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		return nil, err
+	}
+
+	// versions.json may be left over from a removed instance, it is migrated like at start
+	versionsPath := path.Join(targetPath, "versions.json")
+	if _, err := versionsSchema.migrate(versionsPath); err != nil {
+		return nil, err
+	}
+
+	dataImgPath := path.Join(targetPath, "data.img")
+	if exists, _ := utils.PathExists(dataImgPath); exists {
+		return nil, ErrDataDiskExists
+	}
+
+	cloned, err := utils.Clone(src, dataImgPath)
+	if err != nil {
+		_ = os.Remove(dataImgPath)
+		return nil, fmt.Errorf("copy %s failed: %w", src, err)
+	}
+
+	imp := &DataImport{
+		Source:     src,
+		Filesystem: fs,
+		Cloned:     cloned,
+		ImportedAt: time.Now(),
+	}
+
+	// versions.json may be left over from a removed instance, it is read like at start
+	v := &versionsJSON{}
+	if data, err := os.ReadFile(versionsPath); err == nil {
+		_ = json.Unmarshal(data, v)
+	}
+	if v.Provenance == nil {
+		v.Provenance = map[string]*Provenance{}
+	}
+	v.DataImg = ""
+	v.Provenance["data_img"] = &Provenance{
+		Source:    src,
+		UpdatedAt: imp.ImportedAt,
+		Import:    imp,
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return imp, utils.WriteFileAtomic(versionsPath, data, 0644)
+}
+
+// MarkDataImportProvisioned records that the first boot provisioned the imported data disk.
+func MarkDataImportProvisioned(p string) error {
+	return updateVersions(p, func(v *versionsJSON) bool {
+		pv, ok := v.Provenance["data_img"]
+		if !ok || pv.Import == nil || pv.Import.Provisioned {
+			return false
+		}
+		pv.Import.Provisioned = true
+		return true
+	})
+}
+
+// pendingDataImport returns the import of data.img, if it was imported and not used by a start yet.
+func (v *versionsJSON) pendingDataImport() *DataImport {
+	if v.DataImg != "" {
+		return nil
+	}
+
+	if pv, ok := v.Provenance["data_img"]; ok {
+		return pv.Import
+	}
+
+	return nil
+}
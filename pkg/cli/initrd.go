@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+var ErrDecompressorMissing = errors.New("decompressor not found in PATH")
+
+const (
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+	// cpioMaxNameSize is PATH_MAX, the name size includes the NUL, a larger one is a corrupt header
+	cpioMaxNameSize = 4096
+)
+
+var (
+	cpioMagics = [][]byte{[]byte("070701"), []byte("070702")}
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// lz4 legacy frames are written by the kernel build, lz4 -l
+	lz4Magic       = []byte{0x04, 0x22, 0x4d, 0x18}
+	lz4LegacyMagic = []byte{0x02, 0x21, 0x4c, 0x18}
+)
+
+// cpioEntry is a file of a newc cpio archive.
+type cpioEntry struct {
+	name  string
+	mode  uint32
+	uid   uint32
+	gid   uint32
+	mtime int64
+	size  int64
+	// link is the target of a symlink
+	link string
+}
+
+// InspectInitrd writes the files of InitrdPath to w, like tar -tv.
+// gzip is decompressed directly, zstd and lz4 need the zstd and lz4 commands in PATH.
+// Multiple archives concatenated into one initrd (e.g. an uncompressed microcode archive before the compressed one) are listed one after the other.
+func (c *Context) InspectInitrd(w io.Writer) error {
+	if c.InitrdPath == "" {
+		return errors.New("started without initrd")
+	}
+
+	f, err := os.Open(c.InitrdPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(w)
+	if err := listInitrd(bufio.NewReader(f), bw); err != nil {
+		return fmt.Errorf("inspect %s failed: %w", c.InitrdPath, err)
+	}
+
+	return bw.Flush()
+}
+
+func listInitrd(r *bufio.Reader, w io.Writer) error {
+	for {
+		if err := skipPadding(r); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		magic, err := r.Peek(6)
+		if err != nil && len(magic) < 2 {
+			return fmt.Errorf("unknown data at the end of the initrd")
+		}
+
+		switch {
+		case hasMagic(magic, cpioMagics...):
+			if err := listCPIO(r, w); err != nil {
+				return err
+			}
+			// another archive may follow
+			continue
+		case hasMagic(magic, gzipMagic):
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			defer zr.Close()
+			return listInitrd(bufio.NewReader(zr), w)
+		case hasMagic(magic, zstdMagic):
+			return listDecompressed(r, w, "zstd")
+		case hasMagic(magic, lz4Magic, lz4LegacyMagic):
+			return listDecompressed(r, w, "lz4")
+		default:
+			return fmt.Errorf("unknown format, magic: %x", magic)
+		}
+	}
+}
+
+// listDecompressed lists the rest of r decompressed by the command, which must read stdin like zstd -dc.
+func listDecompressed(r io.Reader, w io.Writer, name string) error {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s is needed for %s compressed initrds", ErrDecompressorMissing, name, name)
+	}
+
+	cmd := exec.Command(p, "-dc")
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	lerr := listInitrd(bufio.NewReader(out), w)
+	// drain the output, the command blocks while it cannot write
+	_, _ = io.Copy(io.Discard, out)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s -dc failed: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return lerr
+}
+
+// listCPIO lists the entries of a newc cpio archive until its trailer.
+func listCPIO(r *bufio.Reader, w io.Writer) error {
+	for {
+		e, err := readCPIOEntry(r)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return nil
+		}
+
+		line := fmt.Sprintf("%s %d/%d %8d %s %s", cpioModeString(e.mode), e.uid, e.gid, e.size, time.Unix(e.mtime, 0).UTC().Format("2006-01-02 15:04"), e.name)
+		if e.link != "" {
+			line += " -> " + e.link
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+}
+
+// readCPIOEntry reads the next entry and skips its data, it returns nil at the trailer.
+func readCPIOEntry(r *bufio.Reader) (*cpioEntry, error) {
+	header := make([]byte, cpioHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read cpio header failed: %w", err)
+	}
+	if !hasMagic(header, cpioMagics...) {
+		return nil, fmt.Errorf("invalid cpio header magic: %q", header[:6])
+	}
+
+	// ino, mode, uid, gid, nlink, mtime, filesize, devmajor, devminor, rdevmajor, rdevminor, namesize, check
+	var fields [13]uint32
+	for i := range fields {
+		v, err := strconv.ParseUint(string(header[6+i*8:14+i*8]), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio header field %d: %w", i, err)
+		}
+		fields[i] = uint32(v)
+	}
+
+	nameSize := int(fields[11])
+	if nameSize == 0 || nameSize > cpioMaxNameSize {
+		return nil, fmt.Errorf("invalid cpio name size %d, must be between 1 and %d", nameSize, cpioMaxNameSize)
+	}
+	name := make([]byte, nameSize+pad4(cpioHeaderSize+nameSize))
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, fmt.Errorf("read cpio name failed: %w", err)
+	}
+	e := &cpioEntry{
+		name:  string(bytes.TrimRight(name[:nameSize], "\x00")),
+		mode:  fields[1],
+		uid:   fields[2],
+		gid:   fields[3],
+		mtime: int64(fields[5]),
+		size:  int64(fields[6]),
+	}
+
+	dataSize := e.size + int64(pad4(int(e.size)))
+	if e.name == cpioTrailer {
+		// the padding of the trailer is skipped by skipPadding
+		return nil, nil
+	}
+
+	if e.mode&0170000 == 0120000 && e.size < 4096 {
+		data := make([]byte, dataSize)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("read cpio data of %s failed: %w", e.name, err)
+		}
+		e.link = string(data[:e.size])
+		return e, nil
+	}
+
+	if _, err := r.Discard(int(dataSize)); err != nil {
+		return nil, fmt.Errorf("read cpio data of %s failed: %w", e.name, err)
+	}
+
+	return e, nil
+}
+
+// skipPadding skips the NUL bytes between archives, io.EOF means there is nothing after them.
+func skipPadding(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0 {
+			return r.UnreadByte()
+		}
+	}
+}
+
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+func hasMagic(data []byte, magics ...[]byte) bool {
+	for _, m := range magics {
+		if bytes.HasPrefix(data, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cpioModeString formats the mode like tar -tv, e.g. drwxr-xr-x.
+func cpioModeString(mode uint32) string {
+	t := "?"
+	switch mode & 0170000 {
+	case 0100000:
+		t = "-"
+	case 0040000:
+		t = "d"
+	case 0120000:
+		t = "l"
+	case 0020000:
+		t = "c"
+	case 0060000:
+		t = "b"
+	case 0010000:
+		t = "p"
+	case 0140000:
+		t = "s"
+	}
+
+	return t + os.FileMode(mode & 0777).String()[1:]
+}
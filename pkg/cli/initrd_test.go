@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testCPIOFile struct {
+	name string
+	mode uint32
+	data string
+}
+
+// writeCPIOEntry writes a newc entry with the name size in its header, a valid one is len(f.name)+1.
+func writeCPIOEntry(b *bytes.Buffer, f testCPIOFile, nameSize int) {
+	fmt.Fprintf(b, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		1, f.mode, 0, 0, 1, 1714521600, len(f.data), 0, 0, 0, 0, nameSize, 0)
+	b.WriteString(f.name + "\x00")
+	b.Write(make([]byte, pad4(cpioHeaderSize+len(f.name)+1)))
+	b.WriteString(f.data)
+	b.Write(make([]byte, pad4(len(f.data))))
+}
+
+func testCPIO(files ...testCPIOFile) []byte {
+	var b bytes.Buffer
+	for _, f := range append(files, testCPIOFile{name: cpioTrailer}) {
+		writeCPIOEntry(&b, f, len(f.name)+1)
+	}
+	// archives are padded to 512 bytes
+	b.Write(make([]byte, pad512(b.Len())))
+	return b.Bytes()
+}
+
+func pad512(n int) int {
+	return (512 - n%512) % 512
+}
+
+func TestListInitrd(t *testing.T) {
+	files := []testCPIOFile{
+		{name: "init", mode: 0100755, data: "#!/bin/sh\n"},
+		{name: "bin", mode: 0040755},
+		{name: "bin/sh", mode: 0120777, data: "busybox"},
+	}
+	want := strings.Join([]string{
+		"-rwxr-xr-x 0/0       10 2024-05-01 00:00 init",
+		"drwxr-xr-x 0/0        0 2024-05-01 00:00 bin",
+		"lrwxrwxrwx 0/0        7 2024-05-01 00:00 bin/sh -> busybox",
+	}, "\n") + "\n"
+
+	microcode := testCPIO(testCPIOFile{name: "kernel/x86/microcode/GenuineIntel.bin", mode: 0100644, data: "ucode"})
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(testCPIO(files...))
+	_ = zw.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"plain", testCPIO(files...), want},
+		{"gzip", gz.Bytes(), want},
+		{"microcode before gzip", append(append([]byte{}, microcode...), gz.Bytes()...), "-rw-r--r-- 0/0        5 2024-05-01 00:00 kernel/x86/microcode/GenuineIntel.bin\n" + want},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := listInitrd(bufio.NewReader(bytes.NewReader(tt.data)), &out); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestReadCPIOEntryNameSize(t *testing.T) {
+	for _, size := range []int{0, cpioMaxNameSize + 1, 0x7fffffff} {
+		var b bytes.Buffer
+		writeCPIOEntry(&b, testCPIOFile{name: "init", mode: 0100755}, size)
+
+		_, err := readCPIOEntry(bufio.NewReader(&b))
+		if err == nil || !strings.Contains(err.Error(), "invalid cpio name size") {
+			t.Errorf("name size %d: got %v, want an invalid name size", size, err)
+		}
+	}
+}
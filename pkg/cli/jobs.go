@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrJobNotRunning = errors.New("job is not running")
+)
+
+// guestJobsDir is on the data disk, a job keeps its command, output and exit code there until it is removed by gcJobs.
+const guestJobsDir = "/var/lib/containers/.ovm-jobs"
+
+// States of a Job.
+const (
+	JobRunning   = "running"
+	JobExited    = "exited"
+	JobCancelled = "cancelled"
+	// JobLost ran in a transient unit which is gone without an exit code, because the VM stopped while it ran.
+	// The VM stops with ovm, so a restart of ovm turns every running job into a lost one.
+	JobLost = "lost"
+)
+
+// maxJobOutputChunk is read from the output of a job at once.
+const maxJobOutputChunk = 1024 * 1024
+
+var jobID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Job is a command running detached in the guest, in the transient systemd unit ovm-job-ID.
+type Job struct {
+	ID      string `json:"id"`
+	Command string `json:"command,omitempty"`
+	State   string `json:"state"`
+	// ExitCode is only set once the job exited
+	ExitCode   *int       `json:"exitCode,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ValidJobID reports whether id can name a job, it is put into guest paths.
+func ValidJobID(id string) bool {
+	return jobID.MatchString(id)
+}
+
+func jobDir(id string) string {
+	return guestJobsDir + "/" + id
+}
+
+// StartJob starts the command detached in the guest and returns right away, the job runs as long as the VM.
+func (c *Context) StartJob(command string) (*Job, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command is empty")
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	d := jobDir(id)
+
+	// the exit code is renamed into place, a job is never seen with half of it
+	run := fmt.Sprintf(`sh %[1]s/command > %[1]s/output 2>&1; echo $? > %[1]s/exit.tmp; mv %[1]s/exit.tmp %[1]s/exit`, d)
+	script := fmt.Sprintf(`mkdir -p %[1]s && printf '%%s' %[2]s > %[1]s/command && date +%%s > %[1]s/started && `+
+		`systemd-run --unit=ovm-job-%[3]s --collect --quiet sh -c %[4]s`, d, ShellQuote(command), id, ShellQuote(run))
+	if _, err := c.RunInGuest(script); err != nil {
+		return nil, fmt.Errorf("start job failed: %w", err)
+	}
+
+	c.gcJobs()
+
+	return c.Job(id)
+}
+
+// Jobs lists the jobs in the guest, the finished jobs older than JobRetention are removed first.
+func (c *Context) Jobs() ([]*Job, error) {
+	c.gcJobs()
+	return c.listJobs()
+}
+
+// Job returns the job with its command.
+func (c *Context) Job(id string) (*Job, error) {
+	jobs, err := c.listJobs(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	command, err := c.RunInGuest(fmt.Sprintf("cat %s/command", jobDir(id)))
+	if err != nil {
+		return nil, err
+	}
+	jobs[0].Command = command
+
+	return jobs[0], nil
+}
+
+// CancelJob stops the unit of a running job.
+func (c *Context) CancelJob(id string) (*Job, error) {
+	job, err := c.Job(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.State != JobRunning {
+		return nil, fmt.Errorf("%w: %s is %s", ErrJobNotRunning, id, job.State)
+	}
+
+	if _, err := c.RunInGuest(fmt.Sprintf("touch %s/cancelled; systemctl stop ovm-job-%s", jobDir(id), id)); err != nil {
+		return nil, fmt.Errorf("cancel job failed: %w", err)
+	}
+
+	return c.Job(id)
+}
+
+// JobOutput returns the output of the job from offset on, at most maxJobOutputChunk bytes.
+func (c *Context) JobOutput(id string, offset int64) (string, error) {
+	return c.RunInGuest(fmt.Sprintf("tail -c +%d %s/output 2>/dev/null | head -c %d", offset+1, jobDir(id), maxJobOutputChunk))
+}
+
+// listJobs lists the given jobs, or all jobs. One line per job: id, started, exit code, finished, cancelled, unit state.
+func (c *Context) listJobs(ids ...string) ([]*Job, error) {
+	pattern := "*"
+	if len(ids) != 0 {
+		pattern = strings.Join(ids, " ")
+	}
+
+	script := fmt.Sprintf(`cd %s 2>/dev/null || exit 0; for id in %s; do [ -d "$id" ] || continue; `+
+		`f=; [ -e "$id/exit" ] && f=$(date -r "$id/exit" +%%s); [ -e "$id/cancelled" ] && f=$(date -r "$id/cancelled" +%%s); `+
+		`printf '%%s\t%%s\t%%s\t%%s\t%%s\t%%s\n' "$id" "$(cat "$id/started" 2>/dev/null)" "$(cat "$id/exit" 2>/dev/null)" "$f" `+
+		`"$([ -e "$id/cancelled" ] && echo 1)" "$(systemctl is-active "ovm-job-$id")"; done`, guestJobsDir, pattern)
+	out, err := c.RunInGuest(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 || !ValidJobID(fields[0]) {
+			continue
+		}
+		jobs = append(jobs, parseJob(fields))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+
+	return jobs, nil
+}
+
+func parseJob(fields []string) *Job {
+	job := &Job{ID: fields[0]}
+
+	if s, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+		job.StartedAt = time.Unix(s, 0)
+	}
+	if s, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+		t := time.Unix(s, 0)
+		job.FinishedAt = &t
+	}
+
+	switch {
+	case fields[2] != "":
+		job.State = JobExited
+		if code, err := strconv.Atoi(fields[2]); err == nil {
+			job.ExitCode = &code
+		}
+	case fields[4] != "":
+		job.State = JobCancelled
+	case fields[5] == "active" || fields[5] == "activating":
+		job.State = JobRunning
+	default:
+		job.State = JobLost
+	}
+
+	return job
+}
+
+// gcJobs removes the jobs which finished more than JobRetention ago, failures are retried with the next call.
+func (c *Context) gcJobs() {
+	jobs, err := c.listJobs()
+	if err != nil {
+		return
+	}
+
+	var expired []string
+	for _, job := range jobs {
+		if job.State == JobRunning {
+			continue
+		}
+
+		// a lost job has no finish time, it is as old as its start
+		finished := job.StartedAt
+		if job.FinishedAt != nil {
+			finished = *job.FinishedAt
+		}
+		if time.Since(finished) > c.JobRetention {
+			expired = append(expired, jobDir(job.ID))
+		}
+	}
+
+	if len(expired) != 0 {
+		_, _ = c.RunInGuest("rm -rf " + strings.Join(expired, " "))
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJob(t *testing.T) {
+	tests := []struct {
+		fields   []string
+		state    string
+		exitCode int
+		finished bool
+	}{
+		{[]string{"0123456789abcdef", "1700000000", "", "", "", "active"}, JobRunning, -1, false},
+		{[]string{"0123456789abcdef", "1700000000", "", "", "", "activating"}, JobRunning, -1, false},
+		{[]string{"0123456789abcdef", "1700000000", "3", "1700000060", "", "inactive"}, JobExited, 3, true},
+		{[]string{"0123456789abcdef", "1700000000", "", "1700000060", "1", "inactive"}, JobCancelled, -1, true},
+		{[]string{"0123456789abcdef", "1700000000", "", "", "", "inactive"}, JobLost, -1, false},
+	}
+
+	for _, tt := range tests {
+		job := parseJob(tt.fields)
+		if job.State != tt.state {
+			t.Errorf("%v: state %s, want %s", tt.fields, job.State, tt.state)
+		}
+		if !job.StartedAt.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("%v: started at %v", tt.fields, job.StartedAt)
+		}
+		if (job.FinishedAt != nil) != tt.finished {
+			t.Errorf("%v: finished at %v, want finished %v", tt.fields, job.FinishedAt, tt.finished)
+		}
+		switch {
+		case tt.exitCode < 0 && job.ExitCode != nil:
+			t.Errorf("%v: exit code %d, want none", tt.fields, *job.ExitCode)
+		case tt.exitCode >= 0 && (job.ExitCode == nil || *job.ExitCode != tt.exitCode):
+			t.Errorf("%v: exit code %v, want %d", tt.fields, job.ExitCode, tt.exitCode)
+		}
+	}
+}
+
+func TestValidJobID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"0123456789abcdef":  true,
+		"0123456789ABCDEF":  false,
+		"0123456789abcde":   false,
+		"../../etc/passwd":  false,
+		"0123456789abcdef ": false,
+	} {
+		if got := ValidJobID(id); got != want {
+			t.Errorf("ValidJobID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rotatedLogSuffix matches the rotation index of a log file, e.g. "myvm-ovm.2.log".
+var rotatedLogSuffix = regexp.MustCompile(`\.\d+\.log$`)
+
+// parseLogTotalBudget returns the budget in bytes, 0 is unlimited.
+func parseLogTotalBudget(v string) (uint64, error) {
+	if v == "" || v == "0" {
+		return 0, nil
+	}
+
+	if size, ok := parseSize(v); ok {
+		return size, nil
+	}
+
+	return 0, fmt.Errorf("log-total-budget must be a size like 512M or 2G")
+}
+
+// LogBudgetResult is what EnforceLogBudget did.
+type LogBudgetResult struct {
+	Removed []string
+	// TotalBytes is the size of all log files afterwards
+	TotalBytes uint64
+	// Exceeded is true when the files still in use exceed the budget on their own
+	Exceeded bool
+}
+
+// EnforceLogBudget removes the oldest rotated log files in LogPath (of all components, including the event and the serial
+// console logs) until all log files together fit into -log-total-budget.
+// The current log files are written by the running processes and are never removed.
+func (c *Context) EnforceLogBudget() (*LogBudgetResult, error) {
+	files, err := filepath.Glob(filepath.Join(c.LogPath, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	type logFile struct {
+		p    string
+		info os.FileInfo
+	}
+
+	result := &LogBudgetResult{}
+	var rotated []logFile
+	for _, p := range files {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+
+		result.TotalBytes += uint64(info.Size())
+		if rotatedLogSuffix.MatchString(filepath.Base(p)) {
+			rotated = append(rotated, logFile{p, info})
+		}
+	}
+
+	sort.Slice(rotated, func(i, j int) bool {
+		return rotated[i].info.ModTime().Before(rotated[j].info.ModTime())
+	})
+
+	var errs []string
+	for _, f := range rotated {
+		if result.TotalBytes <= c.LogTotalBudget {
+			break
+		}
+
+		if err := os.Remove(f.p); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		result.Removed = append(result.Removed, filepath.Base(f.p))
+		result.TotalBytes -= uint64(f.info.Size())
+	}
+
+	result.Exceeded = result.TotalBytes > c.LogTotalBudget
+	if len(errs) != 0 {
+		return result, fmt.Errorf("remove log files failed: %s", strings.Join(errs, "; "))
+	}
+
+	return result, nil
+}
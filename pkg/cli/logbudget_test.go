@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseLogTotalBudget(t *testing.T) {
+	tests := []struct {
+		v    string
+		want uint64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"0", 0, true},
+		{"512M", 512 << 20, true},
+		{"2G", 2 << 30, true},
+		{"512", 0, false},
+		{"-1G", 0, false},
+		{"0G", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLogTotalBudget(tt.v)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseLogTotalBudget(%q) = %d, %v, want %d, ok %v", tt.v, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestEnforceLogBudget(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"vm-ovm.log", 100, 0},
+		{"vm-ovm.2.log", 100, 2 * time.Hour},
+		{"vm-ovm.3.log", 100, 3 * time.Hour},
+		{"vm-vm.2.log", 100, time.Hour},
+		// the audit log is not a log file of the budget
+		{"vm-audit.jsonl", 1000, 4 * time.Hour},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := os.WriteFile(p, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now, now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Context{LogPath: dir, LogTotalBudget: 250}
+	result, err := c.EnforceLogBudget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the oldest rotated files go first, the current one is kept
+	if want := []string{"vm-ovm.3.log", "vm-ovm.2.log"}; !slices.Equal(result.Removed, want) {
+		t.Fatalf("removed %v, want %v", result.Removed, want)
+	}
+	if result.TotalBytes != 200 || result.Exceeded {
+		t.Fatalf("got total %d, exceeded %v, want 200 within the budget", result.TotalBytes, result.Exceeded)
+	}
+
+	c.LogTotalBudget = 50
+	result, err = c.EnforceLogBudget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Removed, []string{"vm-vm.2.log"}) || !result.Exceeded {
+		t.Fatalf("got %+v, want vm-vm.2.log removed and the budget exceeded by the current file", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vm-audit.jsonl")); err != nil {
+		t.Fatalf("the audit log was removed: %v", err)
+	}
+}
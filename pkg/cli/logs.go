@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+// LogRecord is a log entry of WalkLogs, Lines are its raw lines including the continuation lines.
+type LogRecord struct {
+	File  string
+	Entry logger.Entry
+	Lines []string
+}
+
+// ExportLogs writes the log lines of all files in LogPath since the given time to w, ordered by time.
+// Every line is prefixed with its file name, lines without a timestamp stay with the line before them.
+// The serial console log of the guest has no timestamps and is not included.
+func (c *Context) ExportLogs(ctx context.Context, w io.Writer, since time.Time) error {
+	bw := bufio.NewWriter(w)
+	err := c.WalkLogs(ctx, since, func(r *LogRecord) error {
+		for _, line := range r.Lines {
+			if _, err := fmt.Fprintf(bw, "%s | %s\n", r.File, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WalkLogs calls fn with the log records of ExportLogs one by one.
+func (c *Context) WalkLogs(ctx context.Context, since time.Time, fn func(r *LogRecord) error) error {
+	files, err := filepath.Glob(filepath.Join(c.LogPath, "*.log"))
+	if err != nil {
+		return err
+	}
+
+	var records []*LogRecord
+	for _, p := range files {
+		if strings.HasSuffix(filepath.Base(p), "-vm.log") {
+			continue
+		}
+
+		rs, err := readExportRecords(ctx, p, since)
+		if err != nil {
+			return fmt.Errorf("read %s error: %w", p, err)
+		}
+		records = append(records, rs...)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Entry.Time.Before(records[j].Entry.Time)
+	})
+
+	for i, r := range records {
+		if i%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readExportRecords(ctx context.Context, p string, since time.Time) ([]*LogRecord, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file := filepath.Base(p)
+
+	var records []*LogRecord
+	var last *LogRecord
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 0; sc.Scan(); n++ {
+		if n%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		line := sc.Text()
+		entry, ok := logger.ParseLine(line)
+		if !ok {
+			if last != nil {
+				last.Lines = append(last.Lines, line)
+			}
+			continue
+		}
+
+		last = nil
+		if entry.Time.Before(since) {
+			continue
+		}
+
+		last = &LogRecord{File: file, Entry: entry, Lines: []string{line}}
+		records = append(records, last)
+	}
+
+	return records, sc.Err()
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportLogs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"vm-ovm.log": "2024-05-01 10:00:00.000 [INFO]: too old\n" +
+			"continuation of too old\n" +
+			"2024-05-01 10:00:02.000 [INFO]: ovm second\n",
+		"vm-vfkit.log": "2024-05-01 10:00:01.000 [WARN]: vfkit first\n" +
+			"  stack line\n" +
+			"2024-05-01 10:00:03.000 [INFO]: vfkit third\n",
+		// the serial console has no timestamps
+		"vm-vm.log": "Linux version 6.6\n",
+	}
+	for n, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := time.Date(2024, 5, 1, 10, 0, 1, 0, time.Local)
+	var b strings.Builder
+	if err := (&Context{LogPath: dir}).ExportLogs(context.Background(), &b, since); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "vm-vfkit.log | 2024-05-01 10:00:01.000 [WARN]: vfkit first\n" +
+		"vm-vfkit.log |   stack line\n" +
+		"vm-ovm.log | 2024-05-01 10:00:02.000 [INFO]: ovm second\n" +
+		"vm-vfkit.log | 2024-05-01 10:00:03.000 [INFO]: vfkit third\n"
+	if got := b.String(); got != want {
+		t.Errorf("exported:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportLogsCanceled(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "vm-ovm.log"), []byte("2024-05-01 10:00:00.000 [INFO]: line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (&Context{LogPath: dir}).ExportLogs(ctx, &strings.Builder{}, time.Time{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UIDMapping maps root in the guest to the host user on a share,
+// so files created by containers are owned by the host user instead of root.
+type UIDMapping struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// Mount is a host directory shared to the guest via virtiofs.
+type Mount struct {
+	Tag        string      `json:"tag"`
+	HostPath   string      `json:"hostPath"`
+	GuestPath  string      `json:"guestPath"`
+	ReadOnly   bool        `json:"readOnly"`
+	UIDMapping *UIDMapping `json:"uidMapping,omitempty"`
+}
+
+var defaultMounts = []Mount{
+	{
+		Tag:       "vfkit-share-user",
+		HostPath:  "/Users",
+		GuestPath: "/Users",
+	},
+	{
+		Tag:       "vfkit-share-var-folders",
+		HostPath:  "/var/folders",
+		GuestPath: "/var/folders",
+	},
+	{
+		Tag:       "vfkit-share-private",
+		HostPath:  "/private",
+		GuestPath: "/private",
+	},
+}
+
+var ErrVolumeNotFound = errors.New("no mount at this guest path")
+
+// unsafeGuestPathChars must not appear in paths, because they are written into shell commands and fstab of the guest.
+const unsafeGuestPathChars = " '\"\\$`"
+
+type mountFlags []string
+
+func (m *mountFlags) String() string {
+	return strings.Join(*m, " ")
+}
+
+func (m *mountFlags) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// parseMount parses "HOST_PATH[:GUEST_PATH][,ro][,uid=host]".
+func parseMount(index int, v string) (*Mount, error) {
+	items := strings.Split(v, ",")
+	hostPath, guestPath, found := strings.Cut(items[0], ":")
+	if !found {
+		guestPath = hostPath
+	}
+
+	m := &Mount{
+		Tag:       "ovm-mount-" + strconv.Itoa(index),
+		HostPath:  filepath.Clean(hostPath),
+		GuestPath: filepath.Clean(guestPath),
+	}
+
+	for _, opt := range items[1:] {
+		switch opt {
+		case "ro":
+			m.ReadOnly = true
+		case "uid=host":
+			m.UIDMapping = &UIDMapping{
+				UID: os.Getuid(),
+				GID: os.Getgid(),
+			}
+		default:
+			if strings.HasPrefix(opt, "uid=") {
+				return nil, fmt.Errorf("mount %s: only uid=host is supported", v)
+			}
+			return nil, fmt.Errorf("mount %s: unknown option %s", v, opt)
+		}
+	}
+
+	if err := m.validate(v); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// validate checks the paths and options of the mount, v is how the mount was given in the error messages.
+func (m *Mount) validate(v string) error {
+	if !filepath.IsAbs(m.HostPath) || !filepath.IsAbs(m.GuestPath) {
+		return fmt.Errorf("mount %s: paths must be absolute", v)
+	}
+
+	if strings.ContainsAny(m.HostPath+m.GuestPath, unsafeGuestPathChars) {
+		return fmt.Errorf("mount %s: paths must not contain spaces, quotes, '\\', '$' or '`'", v)
+	}
+
+	if m.ReadOnly && m.UIDMapping != nil {
+		return fmt.Errorf("mount %s: uid=host cannot be used with ro, nothing can be created on a read-only share", v)
+	}
+
+	if stat, err := os.Stat(m.HostPath); err != nil {
+		return fmt.Errorf("mount %s: %w", v, err)
+	} else if !stat.IsDir() {
+		return fmt.Errorf("mount %s: %s is not a directory", v, m.HostPath)
+	}
+
+	return nil
+}
+
+func parseMounts() ([]Mount, error) {
+	result := make([]Mount, len(defaultMounts), len(defaultMounts)+len(mounts))
+	copy(result, defaultMounts)
+
+	for i, v := range mounts {
+		m, err := parseMount(i, v)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, exist := range result {
+			if exist.GuestPath == m.GuestPath {
+				return nil, fmt.Errorf("mount %s: guest path %s is already mounted", v, m.GuestPath)
+			}
+		}
+
+		result = append(result, *m)
+	}
+
+	return result, nil
+}
+
+// MountOption configures a mount added by VolumeMount.
+type MountOption func(m *Mount)
+
+// WithReadOnly shares the directory read-only, like ",ro" of -mount.
+func WithReadOnly() MountOption {
+	return func(m *Mount) {
+		m.ReadOnly = true
+	}
+}
+
+// WithHostUIDMapping maps root in the guest to the host user, like ",uid=host" of -mount.
+func WithHostUIDMapping() MountOption {
+	return func(m *Mount) {
+		m.UIDMapping = &UIDMapping{
+			UID: os.Getuid(),
+			GID: os.Getgid(),
+		}
+	}
+}
+
+// VolumeMount shares hostPath to guestPath of the guest, the same as passing -mount.
+// The virtiofs devices are fixed when the VM is created, so it has to be called before vfkit.Run.
+func (c *Context) VolumeMount(hostPath, guestPath string, options ...MountOption) error {
+	if !c.BootedAt().IsZero() {
+		return fmt.Errorf("%w, virtiofs devices cannot be added to a running VM", ErrVMRunning)
+	}
+
+	v := hostPath + ":" + guestPath
+	m := &Mount{
+		HostPath:  filepath.Clean(hostPath),
+		GuestPath: filepath.Clean(guestPath),
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+
+	if err := m.validate(v); err != nil {
+		return err
+	}
+
+	tags := make(map[string]bool, len(c.Mounts))
+	for _, exist := range c.Mounts {
+		if exist.GuestPath == m.GuestPath {
+			return fmt.Errorf("mount %s: guest path %s is already mounted", v, m.GuestPath)
+		}
+		tags[exist.Tag] = true
+	}
+
+	// the tags of -mount are numbered by their position, continue after them
+	for i := max(len(c.Mounts)-len(defaultMounts), 0); ; i++ {
+		if tag := "ovm-mount-" + strconv.Itoa(i); !tags[tag] {
+			m.Tag = tag
+			break
+		}
+	}
+
+	c.Mounts = append(c.Mounts, *m)
+	return nil
+}
+
+// VolumeUnmount removes the mount at guestPath, added by VolumeMount, -mount or one of the default shares.
+// Like VolumeMount, it has to be called before vfkit.Run.
+func (c *Context) VolumeUnmount(guestPath string) error {
+	if !c.BootedAt().IsZero() {
+		return fmt.Errorf("%w, virtiofs devices cannot be removed from a running VM", ErrVMRunning)
+	}
+
+	guestPath = filepath.Clean(guestPath)
+	i := slices.IndexFunc(c.Mounts, func(m Mount) bool {
+		return m.GuestPath == guestPath
+	})
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrVolumeNotFound, guestPath)
+	}
+
+	c.Mounts = slices.Delete(c.Mounts, i, i+1)
+	return nil
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMount(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := parseMount(2, dir+"/:/src,ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tag != "ovm-mount-2" || m.HostPath != dir || m.GuestPath != "/src" || !m.ReadOnly || m.UIDMapping != nil {
+		t.Errorf("mount = %+v", m)
+	}
+
+	m, err = parseMount(0, dir+",uid=host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.GuestPath != dir || m.UIDMapping == nil {
+		t.Errorf("mount without a guest path = %+v", m)
+	}
+
+	tests := []struct {
+		v, want string
+	}{
+		{dir + ",uid=1000", "only uid=host"},
+		{dir + ",rw", "unknown option rw"},
+		{dir + ",ro,uid=host", "cannot be used with ro"},
+		{"relative:/src", "absolute"},
+		{dir + ":/my src", "must not contain"},
+		{dir + "/missing:/src", "no such file"},
+	}
+	for _, tt := range tests {
+		if _, err := parseMount(0, tt.v); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseMount(%q): %v, want an error about %q", tt.v, err, tt.want)
+		}
+	}
+}
+
+func TestVolumeMount(t *testing.T) {
+	dir := t.TempDir()
+	c := &Context{Mounts: slices.Clone(defaultMounts)}
+
+	// the tag of -mount 0 is taken
+	first, err := parseMount(0, dir+":/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Mounts = append(c.Mounts, *first)
+
+	if err := c.VolumeMount(dir, "/src/", WithReadOnly()); err != nil {
+		t.Fatal(err)
+	}
+	m := c.Mounts[len(c.Mounts)-1]
+	if m.Tag != "ovm-mount-1" || m.GuestPath != "/src" || !m.ReadOnly {
+		t.Errorf("mount = %+v", m)
+	}
+
+	if err := c.VolumeMount(dir, "/src"); err == nil || !strings.Contains(err.Error(), "already mounted") {
+		t.Errorf("mount the same guest path twice: %v", err)
+	}
+	if err := c.VolumeMount(dir, "/uid", WithReadOnly(), WithHostUIDMapping()); err == nil {
+		t.Error("ro and uid=host were accepted together")
+	}
+
+	c.SetBootedAt(time.Now())
+	if err := c.VolumeMount(dir, "/late"); !errors.Is(err, ErrVMRunning) {
+		t.Errorf("mount in a running VM: %v, want ErrVMRunning", err)
+	}
+}
+
+func TestVolumeUnmount(t *testing.T) {
+	c := &Context{Mounts: slices.Clone(defaultMounts)}
+
+	if err := c.VolumeUnmount("/var/folders/"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Mounts) != 2 || c.Mounts[0].GuestPath != "/Users" || c.Mounts[1].GuestPath != "/private" {
+		t.Errorf("mounts %+v, want /var/folders removed and the order kept", c.Mounts)
+	}
+	if defaultMounts[1].GuestPath != "/var/folders" {
+		t.Error("the default mounts were changed")
+	}
+
+	if err := c.VolumeUnmount("/var/folders"); !errors.Is(err, ErrVolumeNotFound) {
+		t.Errorf("unmount twice: %v, want ErrVolumeNotFound", err)
+	}
+
+	c.SetBootedAt(time.Now())
+	if err := c.VolumeUnmount("/Users"); !errors.Is(err, ErrVMRunning) {
+		t.Errorf("unmount in a running VM: %v, want ErrVMRunning", err)
+	}
+	if len(c.Mounts) != 2 {
+		t.Errorf("mounts %+v, want nothing removed from a running VM", c.Mounts)
+	}
+}
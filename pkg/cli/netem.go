@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// guestInterface is the network interface of the guest connected to gvproxy
+const guestInterface = "eth0"
+
+// NetworkEmulationEnabled reports whether latency or packet loss is configured.
+func (c *Context) NetworkEmulationEnabled() bool {
+	return c.NetworkLatency > 0 || c.NetworkPacketLoss > 0
+}
+
+// netemCommand returns the tc command that emulates NetworkLatency and NetworkPacketLoss on the guest interface.
+func (c *Context) netemCommand() string {
+	args := []string{"tc", "qdisc", "replace", "dev", guestInterface, "root", "netem"}
+
+	if c.NetworkLatency > 0 {
+		args = append(args, "delay", strconv.FormatInt(c.NetworkLatency.Milliseconds(), 10)+"ms")
+	}
+
+	if c.NetworkPacketLoss > 0 {
+		args = append(args, "loss", strconv.FormatFloat(c.NetworkPacketLoss, 'f', -1, 64)+"%")
+	}
+
+	return strings.Join(args, " ")
+}
+
+// ApplyNetworkEmulation adds the configured latency and packet loss to the guest network via tc netem.
+// It replaces an existing emulation, so it can be applied again after the values changed.
+func (c *Context) ApplyNetworkEmulation() error {
+	if !c.NetworkEmulationEnabled() {
+		return fmt.Errorf("neither network latency nor packet loss is set")
+	}
+
+	if _, err := c.RunInGuest(c.netemCommand()); err != nil {
+		return fmt.Errorf("apply network emulation error: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveNetworkEmulation restores the default qdisc of the guest interface.
+func (c *Context) RemoveNetworkEmulation() error {
+	if _, err := c.RunInGuest("tc qdisc del dev " + guestInterface + " root"); err != nil {
+		return fmt.Errorf("remove network emulation error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetemCommand(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		loss    float64
+		want    string
+	}{
+		{100 * time.Millisecond, 0, "tc qdisc replace dev eth0 root netem delay 100ms"},
+		{0, 1.5, "tc qdisc replace dev eth0 root netem loss 1.5%"},
+		{1500 * time.Microsecond, 10, "tc qdisc replace dev eth0 root netem delay 1ms loss 10%"},
+	}
+
+	for _, tt := range tests {
+		c := &Context{NetworkLatency: tt.latency, NetworkPacketLoss: tt.loss}
+		if !c.NetworkEmulationEnabled() {
+			t.Errorf("latency %s, loss %v: emulation not enabled", tt.latency, tt.loss)
+		}
+		if got := c.netemCommand(); got != tt.want {
+			t.Errorf("latency %s, loss %v: %q, want %q", tt.latency, tt.loss, got, tt.want)
+		}
+	}
+
+	if err := (&Context{}).ApplyNetworkEmulation(); err == nil {
+		t.Error("applied an emulation without latency and packet loss")
+	}
+}
+
+func TestValidateNetworkEmulation(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(l time.Duration, p float64) { networkLatency, networkPacketLoss = l, p }(networkLatency, networkPacketLoss)
+
+	tests := []struct {
+		latency time.Duration
+		loss    float64
+		valid   bool
+	}{
+		{100 * time.Millisecond, 1.5, true},
+		{0, 100, true},
+		{-time.Millisecond, 0, false},
+		{0, -1, false},
+		{0, 100.5, false},
+	}
+
+	for _, tt := range tests {
+		networkLatency, networkPacketLoss = tt.latency, tt.loss
+		if ok, err := validated(t, "network-latency", tt.valid); !ok {
+			t.Errorf("latency %s, loss %v: got %v, want valid %v", tt.latency, tt.loss, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// GuestSubnet is the network of gvproxy the guest is attached to.
+const GuestSubnet = "192.168.127.0/24"
+
+// ValidateNetworkConfig checks the network settings resolved by Setup, unlike Validate it runs after the ports were taken.
+// The health endpoint is only bound when the VM starts, a port used by another process (or the ssh forward) would fail late.
+func (c *Context) ValidateNetworkConfig() error {
+	var errs []error
+
+	if _, subnet, err := net.ParseCIDR(GuestSubnet); err != nil {
+		errs = append(errs, fmt.Errorf("guest subnet %s is invalid: %w", GuestSubnet, err))
+	} else if !subnet.IP.IsPrivate() {
+		errs = append(errs, fmt.Errorf("guest subnet %s is not a private network", GuestSubnet))
+	}
+
+	if c.SSHPortListener == nil {
+		errs = append(errs, errors.New("the ssh port is not bound"))
+	} else if addr, ok := c.SSHPortListener.Addr().(*net.TCPAddr); !ok || addr.Port != c.SSHPort {
+		errs = append(errs, fmt.Errorf("ssh port %d is not the bound port %s", c.SSHPort, c.SSHPortListener.Addr()))
+	}
+
+	if c.HealthEndpointPort != 0 {
+		if c.HealthEndpointPort == c.SSHPort {
+			errs = append(errs, fmt.Errorf("health-endpoint-port %d is the ssh port forwarded to the guest", c.HealthEndpointPort))
+		} else if ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(c.HealthEndpointPort)); err != nil {
+			errs = append(errs, fmt.Errorf("health-endpoint-port %d is already in use: %w", c.HealthEndpointPort, err))
+		} else {
+			_ = ln.Close()
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func listenLocal(t *testing.T) (net.Listener, int) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestValidateNetworkConfig(t *testing.T) {
+	sshListener, sshPort := listenLocal(t)
+	_, usedPort := listenLocal(t)
+
+	// a free port: bound once and released
+	free, freePort := listenLocal(t)
+	_ = free.Close()
+
+	tests := []struct {
+		name string
+		c    *Context
+		want []string
+	}{
+		{"valid", &Context{SSHPortListener: sshListener, SSHPort: sshPort, HealthEndpointPort: freePort}, nil},
+		{"no health endpoint", &Context{SSHPortListener: sshListener, SSHPort: sshPort}, nil},
+		{"ssh port not bound", &Context{SSHPort: sshPort}, []string{"ssh port is not bound"}},
+		{"another ssh port", &Context{SSHPortListener: sshListener, SSHPort: sshPort + 1}, []string{"is not the bound port"}},
+		{"health on the ssh port", &Context{SSHPortListener: sshListener, SSHPort: sshPort, HealthEndpointPort: sshPort}, []string{"is the ssh port"}},
+		{"health port in use", &Context{SSHPort: sshPort, HealthEndpointPort: usedPort}, []string{"ssh port is not bound", "already in use"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.ValidateNetworkConfig()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %v", tt.want)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q misses %q", err, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Classes of -passthrough-device.
+const (
+	PassthroughSerial = "serial"
+	PassthroughUSB    = "usb"
+)
+
+// PassthroughDevice is a host device attached to the guest.
+type PassthroughDevice struct {
+	Class string `json:"class"`
+	Path  string `json:"path"`
+}
+
+type passthroughFlags []string
+
+func (p *passthroughFlags) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *passthroughFlags) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// parsePassthroughDevice parses CLASS:PATH, e.g. serial:/dev/cu.usbserial-1410.
+// Only serial devices can be attached, Virtualization.framework has no passthrough of host USB devices.
+func parsePassthroughDevice(v string) (*PassthroughDevice, error) {
+	class, p, ok := strings.Cut(v, ":")
+	if !ok || p == "" {
+		return nil, fmt.Errorf("passthrough-device %q: must be CLASS:PATH, e.g. serial:/dev/cu.usbserial-1410", v)
+	}
+
+	switch class {
+	case PassthroughSerial:
+	case PassthroughUSB:
+		return nil, fmt.Errorf("passthrough-device %q: usb devices cannot be passed through by Virtualization.framework, only serial devices (a USB serial adapter as its /dev/cu.* device)", v)
+	default:
+		return nil, fmt.Errorf("passthrough-device %q: unknown class %s, only serial is supported", v, class)
+	}
+
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("passthrough-device %q: %w", v, err)
+	}
+	if stat.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("passthrough-device %q: %s is not a character device", v, p)
+	}
+
+	// O_NONBLOCK: opening a tty waits for the carrier otherwise
+	f, err := os.OpenFile(p, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("passthrough-device %q: cannot open %s for reading and writing: %w", v, p, err)
+	}
+	_ = f.Close()
+
+	return &PassthroughDevice{Class: class, Path: p}, nil
+}
+
+func parsePassthroughDevices() ([]PassthroughDevice, error) {
+	var result []PassthroughDevice
+	seen := map[string]bool{}
+
+	for _, v := range passthroughDevices {
+		d, err := parsePassthroughDevice(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[d.Path] {
+			return nil, fmt.Errorf("passthrough-device %q: %s is already passed through", v, d.Path)
+		}
+		seen[d.Path] = true
+
+		result = append(result, *d)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// PodmanVersion is reported by the podman service in the guest.
+type PodmanVersion struct {
+	// Version is the podman version, which is also the version of its libpod API
+	Version string `json:"version"`
+	// APIVersion is the Docker compatible API version
+	APIVersion    string `json:"apiVersion"`
+	MinAPIVersion string `json:"minApiVersion"`
+	// Compatible is false when Version is older than -podman-api-version or newer than -podman-max-version
+	Compatible bool `json:"compatible"`
+}
+
+// ProbePodmanVersion asks the podman service via ForwardSocketPath whether it answers (/_ping) and for its version,
+// and checks it against -podman-api-version and -podman-max-version.
+func (c *Context) ProbePodmanVersion(ctx context.Context) (*PodmanVersion, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", c.ForwardSocketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	if err := pingPodman(ctx, client); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://podman/version", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("podman version: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Version       string
+		APIVersion    string `json:"ApiVersion"`
+		MinAPIVersion string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("podman version: %w", err)
+	}
+
+	v := &PodmanVersion{
+		Version:       body.Version,
+		APIVersion:    body.APIVersion,
+		MinAPIVersion: body.MinAPIVersion,
+		Compatible:    true,
+	}
+	if c.PodmanAPIVersion != "" && semver.Compare("v"+v.Version, "v"+c.PodmanAPIVersion) < 0 {
+		v.Compatible = false
+	}
+	if c.PodmanMaxVersion != "" && semver.Compare("v"+v.Version, "v"+c.PodmanMaxVersion) > 0 {
+		v.Compatible = false
+	}
+
+	c.podmanVersionMu.Lock()
+	c.podmanVersion = v
+	c.podmanVersionMu.Unlock()
+
+	return v, nil
+}
+
+// pingPodman checks that the podman service is up, /version may answer before the service is.
+func pingPodman(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://podman/_ping", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("podman ping: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// PodmanVersionRange describes -podman-api-version and -podman-max-version for messages.
+func (c *Context) PodmanVersionRange() string {
+	switch {
+	case c.PodmanAPIVersion != "" && c.PodmanMaxVersion != "":
+		return fmt.Sprintf("between %s and %s", c.PodmanAPIVersion, c.PodmanMaxVersion)
+	case c.PodmanMaxVersion != "":
+		return "at most " + c.PodmanMaxVersion
+	default:
+		return "at least " + c.PodmanAPIVersion
+	}
+}
+
+// PodmanVersion returns the last probed version, nil before the first probe succeeded.
+func (c *Context) PodmanVersion() *PodmanVersion {
+	c.podmanVersionMu.RLock()
+	defer c.podmanVersionMu.RUnlock()
+	return c.podmanVersion
+}
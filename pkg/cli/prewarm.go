@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// prewarmMemoryDivisor bounds the prewarmed bytes to a quarter of the host memory, so a small host keeps its other caches
+	prewarmMemoryDivisor = 4
+	prewarmBufferSize    = 1024 * 1024
+)
+
+// RootfsPrewarm is how much of the rootfs -prewarm-rootfs read into the page cache.
+type RootfsPrewarm struct {
+	Bytes      int64
+	Size       int64
+	DurationMs int64
+}
+
+// prewarmRootfs reads the start of the rootfs sequentially, so the first reads of the guest hit the page cache.
+func (c *Context) prewarmRootfs() (*RootfsPrewarm, error) {
+	f, err := os.Open(c.RootfsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := info.Size()
+	if mem, err := unix.SysctlUint64("hw.memsize"); err == nil && int64(mem/prewarmMemoryDivisor) < limit {
+		limit = int64(mem / prewarmMemoryDivisor)
+	}
+
+	// the file is read once from start to end, read ahead as far as the kernel wants
+	_, _ = unix.FcntlInt(f.Fd(), unix.F_RDAHEAD, 1)
+
+	start := time.Now()
+	buf := make([]byte, prewarmBufferSize)
+	var read int64
+	for read < limit {
+		n, err := f.Read(buf[:min(int64(len(buf)), limit-read)])
+		read += int64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prewarm rootfs failed: %w", err)
+		}
+	}
+
+	return &RootfsPrewarm{
+		Bytes:      read,
+		Size:       info.Size(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}, nil
+}
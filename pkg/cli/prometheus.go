@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WritePrometheusConfig writes a Prometheus scrape config (YAML) for the /metrics endpoint on HealthEndpointPort.
+func (c *Context) WritePrometheusConfig(w io.Writer) error {
+	if c.HealthEndpointPort == 0 {
+		return fmt.Errorf("health endpoint port is not set")
+	}
+
+	_, err := fmt.Fprintf(w, `scrape_configs:
+  - job_name: %s
+    static_configs:
+      - targets: [%s]
+    relabel_configs:
+      - target_label: vm_name
+        replacement: %s
+      - target_label: vm_socket
+        replacement: %s
+`,
+		strconv.Quote("ovm-"+c.Name),
+		strconv.Quote("localhost:"+strconv.Itoa(c.HealthEndpointPort)),
+		strconv.Quote(c.Name),
+		strconv.Quote(c.RestfulSocketPath),
+	)
+
+	return err
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheusConfig(t *testing.T) {
+	var b strings.Builder
+	if err := (&Context{Name: "vm"}).WritePrometheusConfig(&b); err == nil {
+		t.Fatal("a config without the health endpoint port must be refused")
+	}
+
+	c := &Context{Name: `my "vm"`, HealthEndpointPort: 9090, RestfulSocketPath: "/tmp/vm-restful.sock"}
+	if err := c.WritePrometheusConfig(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	got := b.String()
+	for _, want := range []string{
+		`job_name: "ovm-my \"vm\""`,
+		`targets: ["localhost:9090"]`,
+		`replacement: "my \"vm\""`,
+		`replacement: "/tmp/vm-restful.sock"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("config misses %s:\n%s", want, got)
+		}
+	}
+}
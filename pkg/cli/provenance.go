@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// maxProvenanceHistory is the number of replaced provenance records kept per artifact.
+const maxProvenanceHistory = 5
+
+// Provenance records where an artifact in the target path comes from.
+type Provenance struct {
+	Version string `json:"version"`
+	// Source is the path the artifact was copied from, empty for created disk images
+	Source string `json:"source,omitempty"`
+	// Digest of the copied file, empty for created disk images
+	Digest       string    `json:"digest,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	DeltaUpdated bool      `json:"deltaUpdated"`
+	Generation   int       `json:"generation"`
+	// Import is set if the data disk was imported with `ovm import-data`
+	Import *DataImport `json:"import,omitempty"`
+
+	// History are the previous records of this artifact, latest first
+	History []Provenance `json:"history,omitempty"`
+}
+
+// Versions is the content of versions.json.
+type Versions struct {
+	Versions   map[string]string      `json:"versions"`
+	Generation int                    `json:"generation"`
+	Provenance map[string]*Provenance `json:"provenance"`
+	Dirty      []string               `json:"dirty,omitempty"`
+	// AssetVersion is the -asset-version the artifacts were last copied with
+	AssetVersion string `json:"assetVersion,omitempty"`
+	// HostKey is the SHA256 fingerprint of the guest ssh host key
+	HostKey string `json:"hostKey,omitempty"`
+}
+
+// newProvenance replaces the provenance record of the artifact, the previous record is moved into the history.
+// It must be called before the copy starts, the digest is filled in when the copy is done.
+func (v *versionsJSON) newProvenance(src srcPath, generation int) *Provenance {
+	if v.Provenance == nil {
+		v.Provenance = map[string]*Provenance{}
+	}
+
+	pv := &Provenance{
+		Version:    versionsParams[src.key],
+		UpdatedAt:  time.Now(),
+		Generation: generation,
+	}
+	if src.key != "data_img" {
+		if p, err := filepath.Abs(src.p); err == nil {
+			pv.Source = p
+		} else {
+			pv.Source = src.p
+		}
+	}
+
+	if prev, ok := v.Provenance[src.key]; ok {
+		pv.History = append([]Provenance{*prev}, prev.History...)
+		pv.History[0].History = nil
+		if len(pv.History) > maxProvenanceHistory {
+			pv.History = pv.History[:maxProvenanceHistory]
+		}
+	}
+
+	v.Provenance[src.key] = pv
+	return pv
+}
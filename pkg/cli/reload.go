@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ConfigReload is the result of ReloadConfig, every entry describes one change.
+type ConfigReload struct {
+	Applied         []string `json:"applied"`
+	Failed          []string `json:"failed"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// ReloadConfig reads -config again, applies network-diagnostics-anonymize and compares its mounts with the mounts of the running VM.
+// The virtiofs devices cannot be changed while the VM runs, so every difference is restart required and
+// the applied mounts (GET /mounts) stay as they are. Invalid mounts are listed as failed, the others are still compared.
+func (c *Context) ReloadConfig() (*ConfigReload, error) {
+	if c.ConfigPath == "" {
+		return nil, errors.New("started without -config, nothing to reload")
+	}
+
+	r := &ConfigReload{
+		Applied:         []string{},
+		Failed:          []string{},
+		RestartRequired: []string{},
+	}
+
+	c.reloadNetworkDiagnosticsAnonymize(r)
+
+	// mounts passed on the command line take precedence over the config file
+	if explicitFlags["mount"] {
+		return r, nil
+	}
+
+	values, err := readConfigValues(c.ConfigPath, "mount")
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed []*Mount
+	desired := map[string]*Mount{}
+	for i, v := range values {
+		m, err := parseMount(i, v)
+		if err != nil {
+			r.Failed = append(r.Failed, err.Error())
+			continue
+		}
+		parsed = append(parsed, m)
+		desired[m.GuestPath] = m
+	}
+
+	current := map[string]bool{}
+	for _, m := range c.Mounts {
+		if isDefaultMount(m) {
+			continue
+		}
+		current[m.GuestPath] = true
+
+		d, ok := desired[m.GuestPath]
+		switch {
+		case !ok:
+			r.RestartRequired = append(r.RestartRequired, fmt.Sprintf("mount %s: removed", m.GuestPath))
+		case d.HostPath != m.HostPath || d.ReadOnly != m.ReadOnly || !reflect.DeepEqual(d.UIDMapping, m.UIDMapping):
+			r.RestartRequired = append(r.RestartRequired, fmt.Sprintf("mount %s: changed", m.GuestPath))
+		}
+	}
+
+	for _, m := range parsed {
+		if !current[m.GuestPath] {
+			r.RestartRequired = append(r.RestartRequired, fmt.Sprintf("mount %s: added", m.GuestPath))
+		}
+	}
+
+	return r, nil
+}
+
+func isDefaultMount(m Mount) bool {
+	for _, d := range defaultMounts {
+		if d.Tag == m.Tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readConfigValues returns the values of key in the config file, in the order of the file.
+func readConfigValues(p, key string) ([]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []string
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected flag=value", line)
+		}
+
+		if strings.TrimLeft(strings.TrimSpace(k), "-") == key {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+
+	return values, sc.Err()
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RestfulReadOnlyRoutes only read the state of ovm and the VM, they are served by default.
+var RestfulReadOnlyRoutes = []string{
+	"/info", "/state", "/status", "/mounts", "/versions", "/events", "/network/diagnostics",
+	"/logs", "/shutdown-history", "/stats", "/storage", "/warnings", "/guest/services", "/audit",
+}
+
+// RestfulControlRoutes change the VM or put load on it, they are only served with -restful-enable.
+var RestfulControlRoutes = []string{
+	"/bench", "/debug/trace", "/resize", "/pause", "/resume", "/requestStop", "/stop", "/storage/migrate",
+	"/vm/socket-path", "/jobs",
+}
+
+// parseRestfulRoutes parses a comma separated list of routes, the leading slash is optional. all is every route.
+func parseRestfulRoutes(name, v string) ([]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	known := append(slices.Clone(RestfulReadOnlyRoutes), RestfulControlRoutes...)
+
+	var routes []string
+	for _, r := range strings.Split(v, ",") {
+		r = strings.TrimSpace(r)
+		if r == "all" {
+			routes = append(routes, known...)
+			continue
+		}
+
+		r = "/" + strings.TrimPrefix(r, "/")
+		if !slices.Contains(known, r) {
+			return nil, fmt.Errorf("%s: unknown route %s, known routes: %s", name, r, strings.Join(known, ","))
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+// restfulRoutes returns the served routes: the read-only routes and -restful-enable, without -restful-disable.
+// -restful-disable wins, e.g. -restful-enable all -restful-disable /stop serves everything but /stop.
+func restfulRoutes() (map[string]bool, error) {
+	enable, err := parseRestfulRoutes("restful-enable", restfulEnable)
+	if err != nil {
+		return nil, err
+	}
+	disable, err := parseRestfulRoutes("restful-disable", restfulDisable)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := map[string]bool{}
+	for _, r := range append(slices.Clone(RestfulReadOnlyRoutes), enable...) {
+		routes[r] = true
+	}
+	for _, r := range disable {
+		delete(routes, r)
+	}
+
+	return routes, nil
+}
+
+// RestfulRouteEnabled reports whether the restful socket serves the route.
+func (c *Context) RestfulRouteEnabled(route string) bool {
+	if route == "/events" && !c.SocketEnabled(SocketEvents) {
+		return false
+	}
+	return c.RestfulRoutes[route]
+}
@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+var ErrMkfsMissing = errors.New("mkfs.ext4 not found in PATH, install e2fsprogs 1.47.1 or newer")
+
+// rootfsArchiveDecompressors are the commands decompressing the archives to stdout, gzip is decompressed directly.
+var rootfsArchiveDecompressors = map[string]string{
+	".tar.gz":  "",
+	".tar.xz":  "xz",
+	".tar.zst": "zstd",
+}
+
+const (
+	// rootfsImageMinSize is the smallest image created for an archive, the guest needs free space to boot
+	rootfsImageMinSize = 1024 * 1024 * 1024
+	// rootfsImageOverhead is the space of the journal and the other metadata of ext4 besides the inode tables
+	rootfsImageOverhead = 256 * 1024 * 1024
+	rootfsBlockSize     = 4096
+	rootfsInodeSize     = 256
+)
+
+// GuestRootFS is the rootfs of the guest: an image, or an archive which Decompress turns into an ext4 image.
+type GuestRootFS struct {
+	// Path is the image attached as vda, the decompressed image for an archive
+	Path string
+	// ArchivePath is the copy of the archive in the target path, empty for an image
+	ArchivePath string
+	// ArchiveDigest is the digest of the copy recorded in versions.json, the archive is hashed when it is empty
+	ArchiveDigest string
+}
+
+// rootfsImageSum is written next to a decompressed image.
+// It is up to date while the archive digest matches and the image has the size and the modification time it was created with.
+type rootfsImageSum struct {
+	Archive   string `json:"archive"`
+	ImageSize int64  `json:"imageSize"`
+	// ImageMtime is in nanoseconds since the epoch
+	ImageMtime int64 `json:"imageMtime"`
+}
+
+func rootfsArchiveExt(p string) string {
+	for ext := range rootfsArchiveDecompressors {
+		if strings.HasSuffix(p, ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// Artifact returns the file copied into the target path, which versions.json has the digest of.
+func (r *GuestRootFS) Artifact() string {
+	if r.ArchivePath != "" {
+		return r.ArchivePath
+	}
+
+	return r.Path
+}
+
+// Decompress turns a .tar.gz, .tar.xz or .tar.zst rootfs into a raw ext4 image next to it and points Path to the image.
+// The image is created by mkfs.ext4 -d, which populates the filesystem directly from the tarball, so nothing is mounted
+// and the owners of the files are kept (macOS cannot mount ext4 images).
+// It is a no-op for an image, and when the image was already created from the same archive and was not changed since.
+// Neither file is hashed then, the digest of the archive is the one recorded when it was copied.
+func (r *GuestRootFS) Decompress() error {
+	ext := rootfsArchiveExt(r.Path)
+	if ext == "" {
+		return nil
+	}
+
+	archive := r.Path
+	image := strings.TrimSuffix(archive, ext) + ".ext4"
+	sumPath := image + ".sha256"
+
+	archiveDigest := r.ArchiveDigest
+	if archiveDigest == "" {
+		d, err := utils.FileDigest(archive)
+		if err != nil {
+			return fmt.Errorf("digest %s failed: %w", archive, err)
+		}
+		archiveDigest = d
+	}
+
+	if rootfsImageUpToDate(image, sumPath, archiveDigest) {
+		r.Path, r.ArchivePath = image, archive
+		return nil
+	}
+
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		return ErrMkfsMissing
+	}
+
+	tarPath, err := decompressRootfsArchive(archive, ext)
+	if err != nil {
+		return fmt.Errorf("decompress %s failed: %w", archive, err)
+	}
+	defer os.Remove(tarPath)
+
+	layout, err := rootfsImageLayoutOf(tarPath)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %w", tarPath, err)
+	}
+
+	tmp := image + ".tmp"
+	if err := utils.CreateSparseFile(tmp, layout.size); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	inodes := strconv.FormatInt(layout.inodes, 10)
+	if out, err := exec.Command(mkfs, "-q", "-F", "-L", "rootfs", "-b", strconv.Itoa(rootfsBlockSize), "-I", strconv.Itoa(rootfsInodeSize), "-N", inodes, "-d", tarPath, tmp).CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.ext4 -d %s failed: %w: %s", tarPath, err, bytes.TrimSpace(out))
+	}
+
+	if err := os.Rename(tmp, image); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(image)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&rootfsImageSum{Archive: archiveDigest, ImageSize: info.Size(), ImageMtime: info.ModTime().UnixNano()})
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(sumPath, data, 0644); err != nil {
+		return err
+	}
+
+	r.Path, r.ArchivePath = image, archive
+	return nil
+}
+
+func rootfsImageUpToDate(image, sumPath, archiveDigest string) bool {
+	data, err := os.ReadFile(sumPath)
+	if err != nil {
+		return false
+	}
+
+	var sum rootfsImageSum
+	if err := json.Unmarshal(data, &sum); err != nil || sum.Archive != archiveDigest {
+		return false
+	}
+
+	info, err := os.Stat(image)
+	return err == nil && info.Size() == sum.ImageSize && info.ModTime().UnixNano() == sum.ImageMtime
+}
+
+// rootfsImageLayout is the size and the number of inodes of the image for a tarball.
+type rootfsImageLayout struct {
+	size   int64
+	inodes int64
+}
+
+// rootfsImageLayoutOf sizes the image from the entries of the tarball: every file takes whole blocks, every entry
+// an inode (and a block for a directory), and a quarter more of both is left free for the guest.
+func rootfsImageLayoutOf(tarPath string) (*rootfsImageLayout, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var blocks, entries int64
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries++
+		switch h.Typeflag {
+		case tar.TypeReg:
+			blocks += (h.Size + rootfsBlockSize - 1) / rootfsBlockSize
+		case tar.TypeDir:
+			blocks++
+		case tar.TypeSymlink:
+			// short targets are kept in the inode
+			if len(h.Linkname) >= 60 {
+				blocks++
+			}
+		}
+	}
+
+	return rootfsImageLayoutFor(blocks, entries), nil
+}
+
+func rootfsImageLayoutFor(blocks, entries int64) *rootfsImageLayout {
+	inodes := entries + entries/4 + 1024
+	size := (blocks+blocks/4)*rootfsBlockSize + inodes*rootfsInodeSize + rootfsImageOverhead
+	size = max(size, rootfsImageMinSize)
+	size = (size + 1024*1024 - 1) &^ (1024*1024 - 1)
+
+	return &rootfsImageLayout{size: size, inodes: inodes}
+}
+
+// decompressRootfsArchive writes the tarball of the archive to a temporary file next to it, mkfs.ext4 cannot read compressed ones.
+func decompressRootfsArchive(archive, ext string) (string, error) {
+	src, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(archive), "."+filepath.Base(archive)+".*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if err := decompressTo(dst, src, rootfsArchiveDecompressors[ext]); err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
+
+// decompressTo decompresses gzip directly, or with the command reading stdin like xz -dc.
+func decompressTo(w io.Writer, r io.Reader, name string) error {
+	if name == "" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		_, err = io.Copy(w, zr)
+		return err
+	}
+
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s is needed for %s compressed rootfs archives", ErrDecompressorMissing, name, name)
+	}
+
+	cmd := exec.Command(p, "-dc")
+	cmd.Stdin = r
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s -dc failed: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return nil
+}
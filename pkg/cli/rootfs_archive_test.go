@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRootfsImageLayoutOf(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "rootfs.tar")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// many small files take far more space as files than in the tarball
+	const dirs, files = 10, 2000
+	tw := tar.NewWriter(f)
+	for d := 0; d < dirs; d++ {
+		if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("d%d/", d), Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < files/dirs; i++ {
+			if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("d%d/f%d", d, i), Typeflag: tar.TypeReg, Mode: 0644, Size: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte("0123456789")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "big", Typeflag: tar.TypeReg, Mode: 0644, Size: 3 * rootfsBlockSize / 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(make([]byte, 3*rootfsBlockSize/2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := rootfsImageLayoutOf(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rootfsImageLayoutFor(files+dirs+2, dirs+files+1)
+	if *layout != *want {
+		t.Fatalf("got %+v, want %+v", layout, want)
+	}
+	if layout.inodes < dirs+files+1 {
+		t.Fatalf("%d inodes for %d entries", layout.inodes, dirs+files+1)
+	}
+}
+
+func TestRootfsImageLayoutFor(t *testing.T) {
+	tests := []struct {
+		name            string
+		blocks, entries int64
+		wantSize        int64
+		wantInodes      int64
+	}{
+		{"small tarball", 1000, 100, rootfsImageMinSize, 100 + 25 + 1024},
+		// 4 GiB of files in 2M entries: the files, the free quarter, the inode tables and the journal
+		{"large tarball", 1 << 20, 2_000_000, 5*(1<<30) + 2_501_024*rootfsInodeSize + rootfsImageOverhead, 2_501_024},
+	}
+
+	for _, tt := range tests {
+		got := rootfsImageLayoutFor(tt.blocks, tt.entries)
+		wantSize := (tt.wantSize + 1024*1024 - 1) &^ (1024*1024 - 1)
+		if got.size != wantSize || got.inodes != tt.wantInodes {
+			t.Errorf("%s: got %+v, want size %d and %d inodes", tt.name, got, wantSize, tt.wantInodes)
+		}
+		if got.size%(1024*1024) != 0 {
+			t.Errorf("%s: size %d is not in MiB", tt.name, got.size)
+		}
+	}
+}
+
+func TestDecompressUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&rootfsImageSum{Archive: "sha256:abc", ImageSize: info.Size(), ImageMtime: info.ModTime().UnixNano()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(image+".sha256", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive does not exist, it must not be read when the digest is known and the image is up to date
+	r := &GuestRootFS{Path: filepath.Join(dir, "rootfs.tar.xz"), ArchiveDigest: "sha256:abc"}
+	if err := r.Decompress(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != image || r.ArchivePath != filepath.Join(dir, "rootfs.tar.xz") {
+		t.Fatalf("got path %s and archive %s", r.Path, r.ArchivePath)
+	}
+
+	if !rootfsImageUpToDate(image, image+".sha256", "sha256:abc") {
+		t.Fatal("the image is not up to date")
+	}
+	if rootfsImageUpToDate(image, image+".sha256", "sha256:def") {
+		t.Fatal("the image is up to date for another archive")
+	}
+	// a write of the guest changes the modification time
+	if err := os.Chtimes(image, time.Now(), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rootfsImageUpToDate(image, image+".sha256", "sha256:abc") {
+		t.Fatal("the modified image is up to date")
+	}
+}
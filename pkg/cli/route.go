@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// GuestRoute is a route added in the guest at boot, e.g. to reach a host-only network.
+type GuestRoute struct {
+	// CIDR is the destination network, normalized to its network address
+	CIDR    string `json:"cidr"`
+	Gateway string `json:"gateway"`
+}
+
+type routeFlags []string
+
+func (r *routeFlags) String() string {
+	return strings.Join(*r, ", ")
+}
+
+func (r *routeFlags) Set(v string) error {
+	*r = append(*r, v)
+	return nil
+}
+
+// parseRoute parses "CIDR via GATEWAY", the gateway must be in the guest subnet so the guest can reach it.
+func parseRoute(v string) (*GuestRoute, error) {
+	fields := strings.Fields(v)
+	if len(fields) != 3 || fields[1] != "via" {
+		return nil, fmt.Errorf("route %q: must be CIDR via GATEWAY, e.g. 10.0.0.0/8 via 192.168.127.254", v)
+	}
+
+	ip, dst, err := net.ParseCIDR(fields[0])
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("route %q: %s is not an IPv4 CIDR", v, fields[0])
+	}
+
+	gateway := net.ParseIP(fields[2]).To4()
+	if gateway == nil {
+		return nil, fmt.Errorf("route %q: %s is not an IPv4 address", v, fields[2])
+	}
+
+	_, subnet, _ := net.ParseCIDR(GuestSubnet)
+	if !subnet.Contains(gateway) {
+		return nil, fmt.Errorf("route %q: the gateway must be in the guest subnet %s", v, GuestSubnet)
+	}
+	if dst.Contains(subnet.IP) || subnet.Contains(dst.IP) {
+		return nil, fmt.Errorf("route %q: %s overlaps the guest subnet %s", v, dst, GuestSubnet)
+	}
+
+	return &GuestRoute{CIDR: dst.String(), Gateway: gateway.String()}, nil
+}
+
+func parseRoutes() ([]GuestRoute, error) {
+	var result []GuestRoute
+	seen := map[string]bool{}
+
+	for _, v := range routes {
+		r, err := parseRoute(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[r.CIDR] {
+			return nil, fmt.Errorf("route %q: a route to %s is already set", v, r.CIDR)
+		}
+		seen[r.CIDR] = true
+
+		result = append(result, *r)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    GuestRoute
+		wantErr string
+	}{
+		{"10.0.0.0/8 via 192.168.127.254", GuestRoute{"10.0.0.0/8", "192.168.127.254"}, ""},
+		{"  172.16.5.9/16   via 192.168.127.1 ", GuestRoute{"172.16.0.0/16", "192.168.127.1"}, ""},
+		{"10.0.0.0/8 192.168.127.254", GuestRoute{}, "must be CIDR via GATEWAY"},
+		{"10.0.0.0/8 dev 192.168.127.254", GuestRoute{}, "must be CIDR via GATEWAY"},
+		{"10.0.0.0 via 192.168.127.254", GuestRoute{}, "not an IPv4 CIDR"},
+		{"fd00::/8 via 192.168.127.254", GuestRoute{}, "not an IPv4 CIDR"},
+		{"10.0.0.0/8 via gateway", GuestRoute{}, "not an IPv4 address"},
+		{"10.0.0.0/8 via 10.0.0.1", GuestRoute{}, "must be in the guest subnet"},
+		{"192.168.127.128/25 via 192.168.127.254", GuestRoute{}, "overlaps the guest subnet"},
+		{"192.168.0.0/16 via 192.168.127.254", GuestRoute{}, "overlaps the guest subnet"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRoute(tt.v)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseRoute(%q): %v, want an error about %q", tt.v, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRoute(%q): %v", tt.v, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseRoute(%q) = %+v, want %+v", tt.v, *got, tt.want)
+		}
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	defer func(r routeFlags) { routes = r }(routes)
+
+	routes = routeFlags{"10.0.0.0/8 via 192.168.127.254", "172.16.0.0/12 via 192.168.127.254"}
+	got, err := parseRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].CIDR != "10.0.0.0/8" || got[1].CIDR != "172.16.0.0/12" {
+		t.Errorf("parseRoutes() = %+v", got)
+	}
+
+	// the same network written with a host address
+	routes = routeFlags{"10.0.0.0/8 via 192.168.127.254", "10.1.2.3/8 via 192.168.127.1"}
+	if _, err := parseRoutes(); err == nil || !strings.Contains(err.Error(), "already set") {
+		t.Errorf("a route to 10.0.0.0/8 set twice: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+// ErrDowngradeNotSupported is returned for files written by a newer ovm, their format is unknown to this one.
+var ErrDowngradeNotSupported = errors.New("downgrade not supported")
+
+// SchemaError is returned for a file whose schema is newer than this ovm supports.
+type SchemaError struct {
+	Path      string
+	Version   int
+	Supported int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s was written by a newer ovm (schema %d, this ovm supports up to %d): %v", e.Path, e.Version, e.Supported, ErrDowngradeNotSupported)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrDowngradeNotSupported
+}
+
+// schemaFile is a persisted file with a schema version. Files written before the version was introduced are schema 0.
+type schemaFile struct {
+	name string
+	// migrations[i] migrates schema i to i+1, so the current schema is len(migrations)
+	migrations []func(data []byte) ([]byte, error)
+	// version reads the schema of the data
+	version func(data []byte) (int, error)
+}
+
+func (f *schemaFile) current() int {
+	return len(f.migrations)
+}
+
+// Current schemas of the persisted files, a change of the format appends a migration.
+var (
+	versionsSchema = &schemaFile{
+		name:       "versions.json",
+		migrations: []func([]byte) ([]byte, error){stampSchema(1)},
+		version:    objectSchema,
+	}
+	shutdownHistorySchema = &schemaFile{
+		name: "shutdown-history.json",
+		migrations: []func([]byte) ([]byte, error){
+			// schema 0 is the bare list of records
+			func(data []byte) ([]byte, error) {
+				var history []ShutdownRecord
+				if err := json.Unmarshal(data, &history); err != nil {
+					return nil, err
+				}
+				return json.Marshal(&shutdownHistoryJSON{Schema: 1, History: history})
+			},
+		},
+		version: func(data []byte) (int, error) {
+			if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+				return 0, nil
+			}
+			return objectSchema(data)
+		},
+	}
+	sshKeyOwnerSchema = &schemaFile{
+		name:       "ssh key owner",
+		migrations: []func([]byte) ([]byte, error){stampSchema(1)},
+		version:    objectSchema,
+	}
+)
+
+// objectSchema reads the schema field of a JSON object, it is 0 without the field.
+func objectSchema(data []byte) (int, error) {
+	v := struct {
+		Schema int `json:"schema"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, err
+	}
+
+	return v.Schema, nil
+}
+
+// stampSchema returns the migration of a JSON object which only sets the schema field, the other fields are kept as is.
+func stampSchema(version int) func(data []byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		v := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		v["schema"] = json.RawMessage(fmt.Sprint(version))
+
+		return json.Marshal(v)
+	}
+}
+
+// SchemaStatus is the schema of a persisted file, see `ovm doctor`.
+type SchemaStatus struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Exists is false when the file was not written yet, it is created with the current schema
+	Exists  bool `json:"exists"`
+	Version int  `json:"version"`
+	Current int  `json:"current"`
+	// Error is why the schema could not be read, e.g. a corrupted file
+	Error string `json:"error,omitempty"`
+}
+
+// Pending reports whether the next start migrates the file.
+func (s *SchemaStatus) Pending() bool {
+	return s.Exists && s.Error == "" && s.Version < s.Current
+}
+
+// TooNew reports whether the file was written by a newer ovm.
+func (s *SchemaStatus) TooNew() bool {
+	return s.Exists && s.Version > s.Current
+}
+
+func (f *schemaFile) status(p string) *SchemaStatus {
+	s := &SchemaStatus{
+		Name:    f.name,
+		Path:    p,
+		Current: f.current(),
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return s
+	} else if err != nil {
+		s.Exists = true
+		s.Error = err.Error()
+		return s
+	}
+
+	s.Exists = true
+	if s.Version, err = f.version(data); err != nil {
+		s.Error = err.Error()
+	}
+
+	return s
+}
+
+// migrate migrates the file to the current schema, the original is kept as p.schemaN.bak beforehand.
+// A missing file is left alone, and a file written by a newer ovm returns a *SchemaError.
+func (f *schemaFile) migrate(p string) (migrated bool, err error) {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	version, err := f.version(data)
+	if err != nil {
+		// corrupted files are handled by their readers, e.g. versions.json is recreated
+		return false, nil
+	}
+
+	if version > f.current() {
+		return false, &SchemaError{Path: p, Version: version, Supported: f.current()}
+	}
+	if version == f.current() {
+		return false, nil
+	}
+
+	// the first backup of a schema is the original, a repeated migration must not replace it
+	backup := fmt.Sprintf("%s.schema%d.bak", p, version)
+	if _, err := os.Stat(backup); errors.Is(err, os.ErrNotExist) {
+		if err := utils.WriteFileAtomic(backup, data, 0644); err != nil {
+			return false, fmt.Errorf("back up %s failed: %w", p, err)
+		}
+	}
+
+	for v := version; v < f.current(); v++ {
+		if data, err = f.migrations[v](data); err != nil {
+			return false, fmt.Errorf("migrate %s from schema %d failed: %w", p, v, err)
+		}
+	}
+
+	if err := utils.WriteFileAtomic(p, data, 0644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// schemaFiles are the persisted files of a target path and of the ssh keys of a name, by path.
+// sshKeyPath may be empty, e.g. for `ovm doctor` without -ssh-key-path.
+func schemaFiles(targetPath, sshKeyPath, name string) map[string]*schemaFile {
+	files := map[string]*schemaFile{
+		path.Join(targetPath, "versions.json"): versionsSchema,
+		ShutdownHistoryPath(targetPath):        shutdownHistorySchema,
+	}
+	if sshKeyPath != "" && name != "" {
+		files[sshKeyOwnerPath(sshKeyPath, name)] = sshKeyOwnerSchema
+	}
+
+	return files
+}
+
+// MigrateSchemas migrates the persisted files to the schemas of this ovm, it is idempotent. The migrated files are returned.
+func MigrateSchemas(targetPath, sshKeyPath, name string) ([]string, error) {
+	var migrated []string
+	for p, f := range schemaFiles(targetPath, sshKeyPath, name) {
+		ok, err := f.migrate(p)
+		if err != nil {
+			return migrated, err
+		}
+		if ok {
+			migrated = append(migrated, p)
+		}
+	}
+
+	return migrated, nil
+}
+
+// SchemaStatuses returns the schema of every persisted file, without migrating them.
+func SchemaStatuses(targetPath, sshKeyPath, name string) []*SchemaStatus {
+	var statuses []*SchemaStatus
+	for p, f := range schemaFiles(targetPath, sshKeyPath, name) {
+		statuses = append(statuses, f.status(p))
+	}
+	slices.SortFunc(statuses, func(a, b *SchemaStatus) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return statuses
+}
+
+// withSchema marshals v with the schema field added, v must marshal to a JSON object.
+func withSchema(version int, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return stampSchema(version)(data)
+}
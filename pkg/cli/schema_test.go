@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMigrateSchemas(t *testing.T) {
+	dir := t.TempDir()
+	versions := path.Join(dir, "versions.json")
+	history := ShutdownHistoryPath(dir)
+
+	original := []byte(`{"kernel":"1"}`)
+	if err := os.WriteFile(versions, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(history, []byte(`[{"reason":"stop","pid":1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := MigrateSchemas(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 2 {
+		t.Errorf("migrated %v, want both files", migrated)
+	}
+
+	v := map[string]any{}
+	data, err := os.ReadFile(versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["schema"] != float64(1) || v["kernel"] != "1" {
+		t.Errorf("versions.json = %s, want schema 1 with the fields kept", data)
+	}
+
+	h := shutdownHistoryJSON{}
+	data, err = os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Schema != 1 || len(h.History) != 1 || h.History[0].Reason != "stop" {
+		t.Errorf("shutdown history = %s, want schema 1 with the record", data)
+	}
+
+	backup, err := os.ReadFile(versions + ".schema0.bak")
+	if err != nil || string(backup) != string(original) {
+		t.Errorf("backup = %q, %v, want the original", backup, err)
+	}
+
+	// a repeated migration changes nothing
+	if migrated, err := MigrateSchemas(dir, "", ""); err != nil || len(migrated) != 0 {
+		t.Errorf("second migration: %v, %v, want nothing migrated", migrated, err)
+	}
+}
+
+func TestMigrateKeepsFirstBackup(t *testing.T) {
+	p := path.Join(t.TempDir(), "versions.json")
+	if err := os.WriteFile(p+".schema0.bak", []byte(`{"kernel":"first"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(`{"kernel":"second"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := versionsSchema.migrate(p); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := os.ReadFile(p + ".schema0.bak"); string(backup) != `{"kernel":"first"}` {
+		t.Errorf("backup replaced: %s", backup)
+	}
+}
+
+func TestMigrateDowngrade(t *testing.T) {
+	p := path.Join(t.TempDir(), "versions.json")
+	newer := []byte(`{"schema":2}`)
+	if err := os.WriteFile(p, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := versionsSchema.migrate(p)
+	if !errors.Is(err, ErrDowngradeNotSupported) {
+		t.Fatalf("newer schema: %v, want ErrDowngradeNotSupported", err)
+	}
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Version != 2 || schemaErr.Supported != 1 {
+		t.Errorf("error = %#v", err)
+	}
+	if data, _ := os.ReadFile(p); string(data) != string(newer) {
+		t.Errorf("newer file changed: %s", data)
+	}
+}
+
+func TestSchemaStatus(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		data    string
+		exists  bool
+		pending bool
+		tooNew  bool
+	}{
+		{name: "missing"},
+		{name: "old", data: `{}`, exists: true, pending: true},
+		{name: "current", data: `{"schema":1}`, exists: true},
+		{name: "newer", data: `{"schema":2}`, exists: true, tooNew: true},
+		{name: "corrupted", data: `{`, exists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := path.Join(dir, tt.name+".json")
+			if tt.data != "" {
+				if err := os.WriteFile(p, []byte(tt.data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := versionsSchema.status(p)
+			if s.Exists != tt.exists || s.Pending() != tt.pending || s.TooNew() != tt.tooNew {
+				t.Errorf("status = %+v, pending %v, too new %v", s, s.Pending(), s.TooNew())
+			}
+		})
+	}
+}
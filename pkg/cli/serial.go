@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// serialRingSize is how much recent output a late listener receives first
+	serialRingSize = 64 * 1024
+
+	// serialListenerQueue is how many chunks may be pending for a listener before it is dropped as too slow
+	serialListenerQueue = 256
+)
+
+// serialMux fans the output of the console socket out to many listeners.
+type serialMux struct {
+	mu        sync.Mutex
+	ring      []byte
+	listeners map[*serialListener]struct{}
+	done      chan struct{}
+	err       error
+}
+
+type serialListener struct {
+	conn net.Conn
+	ch   chan []byte
+	gone chan struct{}
+	once sync.Once
+}
+
+func (l *serialListener) close() {
+	l.once.Do(func() {
+		close(l.gone)
+		_ = l.conn.Close()
+	})
+}
+
+// SerialMultiplexer copies the serial console of the guest into all listeners until ctx is done or they disconnected.
+// The console socket is only dialed once, later calls add their listeners to the same stream,
+// and every listener first receives the last 64 KiB of output, so late listeners see the recent boot messages.
+// A listener that disconnects or cannot keep up is removed without affecting the others.
+func (c *Context) SerialMultiplexer(ctx context.Context, listeners ...net.Conn) error {
+	m, err := c.serialMux()
+	if err != nil {
+		return err
+	}
+
+	added := make([]*serialListener, 0, len(listeners))
+	for _, conn := range listeners {
+		if l := m.add(conn); l != nil {
+			added = append(added, l)
+		}
+	}
+
+	for _, l := range added {
+		select {
+		case <-l.gone:
+		case <-ctx.Done():
+			for _, l := range added {
+				m.remove(l)
+			}
+			return nil
+		case <-m.done:
+			return m.err
+		}
+	}
+
+	return nil
+}
+
+func (c *Context) serialMux() (*serialMux, error) {
+	c.serialMu.Lock()
+	defer c.serialMu.Unlock()
+
+	if c.serial != nil {
+		select {
+		case <-c.serial.done:
+			// the console was closed (e.g. the VM restarted), dial again
+		default:
+			return c.serial, nil
+		}
+	}
+
+	conn, err := net.Dial("unix", c.ConsoleSocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &serialMux{
+		listeners: map[*serialListener]struct{}{},
+		done:      make(chan struct{}),
+	}
+	go m.read(conn)
+
+	c.serial = m
+	return m, nil
+}
+
+func (m *serialMux) read(conn net.Conn) {
+	defer conn.Close()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			m.broadcast(buf[:n])
+		}
+		if err != nil {
+			m.mu.Lock()
+			if err != io.EOF {
+				m.err = err
+			}
+			for l := range m.listeners {
+				delete(m.listeners, l)
+				l.close()
+			}
+			close(m.done)
+			m.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (m *serialMux) broadcast(p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ring = append(m.ring, p...)
+	if len(m.ring) > serialRingSize {
+		m.ring = append(m.ring[:0], m.ring[len(m.ring)-serialRingSize:]...)
+	}
+
+	for l := range m.listeners {
+		chunk := make([]byte, len(p))
+		copy(chunk, p)
+
+		select {
+		case l.ch <- chunk:
+		default:
+			delete(m.listeners, l)
+			l.close()
+		}
+	}
+}
+
+// add registers the listener with the buffered output queued first, it returns nil if the console is closed.
+func (m *serialMux) add(conn net.Conn) *serialListener {
+	l := &serialListener{
+		conn: conn,
+		ch:   make(chan []byte, serialListenerQueue),
+		gone: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	select {
+	case <-m.done:
+		m.mu.Unlock()
+		_ = conn.Close()
+		return nil
+	default:
+	}
+
+	if len(m.ring) != 0 {
+		l.ch <- append([]byte(nil), m.ring...)
+	}
+	m.listeners[l] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-l.gone:
+				return
+			case p := <-l.ch:
+				if _, err := conn.Write(p); err != nil {
+					m.remove(l)
+					return
+				}
+			}
+		}
+	}()
+
+	// listeners never send anything, a read returns when they disconnect
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		m.remove(l)
+	}()
+
+	return l
+}
+
+func (m *serialMux) remove(l *serialListener) {
+	m.mu.Lock()
+	delete(m.listeners, l)
+	m.mu.Unlock()
+
+	l.close()
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSerialMux() *serialMux {
+	return &serialMux{
+		listeners: map[*serialListener]struct{}{},
+		done:      make(chan struct{}),
+	}
+}
+
+func readN(t *testing.T, conn net.Conn, n int) []byte {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read %d bytes: %v", n, err)
+	}
+	return buf
+}
+
+func TestSerialMuxRing(t *testing.T) {
+	m := newSerialMux()
+
+	m.broadcast(bytes.Repeat([]byte("a"), serialRingSize))
+	m.broadcast([]byte("boot"))
+	if len(m.ring) != serialRingSize || !bytes.HasSuffix(m.ring, []byte("aboot")) {
+		t.Fatalf("ring is %d bytes, want the last %d", len(m.ring), serialRingSize)
+	}
+
+	// a late listener receives the recent output first, then the new one
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	if m.add(conn) == nil {
+		t.Fatal("listener not added")
+	}
+	if got := readN(t, peer, serialRingSize); !bytes.Equal(got, m.ring) {
+		t.Error("the late listener did not receive the ring")
+	}
+	m.broadcast([]byte("login:"))
+	if got := readN(t, peer, 6); string(got) != "login:" {
+		t.Errorf("got %q, want the new output", got)
+	}
+}
+
+func TestSerialMuxSlowListener(t *testing.T) {
+	m := newSerialMux()
+
+	// nobody reads the slow one, its writes block and its queue fills up
+	slow, slowPeer := net.Pipe()
+	defer slowPeer.Close()
+	fast, fastPeer := net.Pipe()
+	defer fastPeer.Close()
+	slowListener := m.add(slow)
+	m.add(fast)
+
+	for i := 0; i < serialListenerQueue+2; i++ {
+		m.broadcast([]byte("x"))
+		readN(t, fastPeer, 1)
+	}
+
+	select {
+	case <-slowListener.gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow listener was not dropped")
+	}
+	m.mu.Lock()
+	n := len(m.listeners)
+	m.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d listeners, want only the fast one", n)
+	}
+}
+
+func TestSerialMultiplexer(t *testing.T) {
+	c := &Context{ConsoleSocketPath: filepath.Join(t.TempDir(), "console.sock")}
+	ln, err := net.Listen("unix", c.ConsoleSocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	consoles := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			consoles <- conn
+		}
+	}()
+
+	a, aPeer := net.Pipe()
+	b, bPeer := net.Pipe()
+	errs := make(chan error, 2)
+	go func() { errs <- c.SerialMultiplexer(context.Background(), a) }()
+	console := <-consoles
+
+	if _, err := console.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readN(t, aPeer, 5); string(got) != "hello" {
+		t.Errorf("first listener got %q", got)
+	}
+
+	// the second call shares the connection, the console socket is dialed once
+	go func() { errs <- c.SerialMultiplexer(context.Background(), b) }()
+	if got := readN(t, bPeer, 5); string(got) != "hello" {
+		t.Errorf("second listener got %q, want the buffered output", got)
+	}
+	select {
+	case <-consoles:
+		t.Fatal("the console socket was dialed again")
+	default:
+	}
+
+	// a disconnected listener does not affect the other one
+	_ = aPeer.Close()
+	if err := <-errs; err != nil {
+		t.Errorf("first listener: %v", err)
+	}
+	if _, err := console.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readN(t, bPeer, 1); string(got) != "!" {
+		t.Errorf("second listener got %q", got)
+	}
+
+	_ = console.Close()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("second listener after the console closed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SerialMultiplexer did not return after the console closed")
+	}
+}
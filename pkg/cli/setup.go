@@ -8,12 +8,19 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/logger"
 	"github.com/oomol-lab/ovm/pkg/utils"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -21,6 +28,7 @@ type Context struct {
 	Name            string
 	VersionsPath    string
 	LogPath         string
+	AuditPath       string
 	SocketPath      string
 	IsCliMode       bool
 	LockFile        string
@@ -30,29 +38,245 @@ type Context struct {
 	PowerSaveMode   bool
 	KernelDebug     bool
 
+	StatusSnapshotDir      string
+	StatusSnapshotInterval time.Duration
+	HealthEndpointPort     int
+	ClockSource            string
+	SerialConsoleBaud      int
+	ShutdownCommand        string
+	Mounts                 []Mount
+	ExposeDockerSocket     bool
+	PodmanAPIVersion       string
+	PodmanMaxVersion       string
+	Strict                 []string
+	MTU                    int
+	NetworkLatency         time.Duration
+	NetworkPacketLoss      float64
+	PauseOnSuspend         bool
+	PowerSaveOnBattery     bool
+	NoPowerAwareness       bool
+	MaxDrift               time.Duration
+	DriftCheckInterval     time.Duration
+	VirtioRNG              bool
+	BootCPUs               uint
+	ObservabilityExport    ObservabilityExport
+	TmpMount               string
+	RootDevice             string
+	RootWait               bool
+	RootfsOverlay          string
+	GuestWritableRoot      bool
+	NoInitrd               bool
+	MaxSSHSessions         int
+	SocketBacklog          int
+	AgentVsockPort         int
+	ForwardGuestLogs       bool
+	AssumeReady            bool
+	AssumeReadyAfter       time.Duration
+	ConfigPath             string
+	GuestSwapBytes         uint64
+	LogTotalBudget         uint64
+	CopyBufferSize         int
+	MaxConcurrentSetups    int
+	DataInitPolicy         string
+	GuestUlimits           []GuestUlimit
+	GuestRoutes            []GuestRoute
+	AllowFrom              []*net.IPNet
+	GuestUnits             []GuestUnit
+	PassthroughDevices     []PassthroughDevice
+	WatchArtifacts         string
+	GuestArch              GuestArch
+	VerifyArtifactsDelay   time.Duration
+	VerifyArtifactsRate    int
+
+	RestfulMaxBodySize    int64
+	RestfulReadTimeout    time.Duration
+	RestfulWriteTimeout   time.Duration
+	RestfulRequestTimeout time.Duration
+	RestfulMaxInFlight    int
+	RestfulRoutes         map[string]bool
+	JobRetention          time.Duration
+	// Sockets are the enabled components of -enable-sockets / -disable-sockets, the paths of the others are empty
+	Sockets map[string]bool
+
 	Endpoint          string
 	SSHPort           int
+	SSHPortListener   net.Listener
 	SSHKeyPath        string
 	SSHPrivateKeyPath string
 	SSHPublicKeyPath  string
 	SSHPublicKey      string
 
+	// SchemaMigrations are the files Setup migrated to the schemas of this ovm, to be logged by the caller
+	SchemaMigrations []string
+	// SSHKeyModeFixes lists the keys whose permissions were fixed by Setup, to be logged by the caller
+	SSHKeyModeFixes []string
+	// AssetDecisions are whether Setup copied the artifacts and why, to be logged by the caller
+	AssetDecisions []AssetDecision
+	// RootfsPrewarm is set by Setup with -prewarm-rootfs, to be logged by the caller
+	RootfsPrewarm *RootfsPrewarm
+
 	ForwardSocketPath     string
+	DockerSocketPath      string
 	SocketNetworkPath     string
 	SocketInitrdVSockPath string
 	SocketReadyPath       string
 	RestfulSocketPath     string
 	TimeSyncSocketPath    string
 	SSHAuthSocketPath     string
+	ConsoleSocketPath     string
+	AgentSocketPath       string
+	GuestLogSocketPath    string
+	HandoverSocketPath    string
 
 	CPUS         uint
 	MemoryBytes  uint64
 	KernelPath   string
 	InitrdPath   string
 	RootfsPath   string
+	GuestRootFS  *GuestRootFS
 	TargetPath   string
 	DiskDataPath string
 	DiskTmpPath  string
+
+	// DiskScratchPath is only set when TmpMount is set
+	DiskScratchPath string
+	// DiskRootfsOverlayPath is only set when RootfsOverlay is disk
+	DiskRootfsOverlayPath string
+
+	// SSHConfig replaces the config of the ssh connections to the guest, e.g. to restrict ciphers, key exchanges and MACs.
+	// It is used as is, only Auth is filled with the private key of SSHPrivateKeyPath when empty, and a zero Timeout is 10s. The Timeout covers the dial and the handshake.
+	// A HostKeyCallback replaces the check that the guest keeps its host key; when nil, that check is used.
+	SSHConfig *ssh.ClientConfig
+
+	// ShutdownHistoryPath keeps why the VM of this target path was stopped
+	ShutdownHistoryPath string
+
+	// KernelCmdline is read from KernelCmdlinePath, it is empty when the cmdline has to be assembled
+	KernelCmdline     string
+	KernelCmdlinePath string
+	// ProvisionDataImport is set on the first start after `ovm import-data`
+	ProvisionDataImport bool
+	// StorageMigrated is set once the container storage was moved to the data disk
+	StorageMigrated bool
+
+	hostKeyMu sync.Mutex
+	hostKey   ssh.PublicKey
+	sshPool   *SSHSessionPool
+
+	storageMu        sync.Mutex
+	storageMigration *StorageMigration
+
+	warningsMu sync.Mutex
+	warnings   []Warning
+
+	socketMoveMu sync.Mutex
+	movedSockets map[string]string
+
+	serialMu sync.Mutex
+	serial   *serialMux
+
+	bootedAtMu sync.RWMutex
+	bootedAt   time.Time
+
+	networkAnonymizeMu sync.RWMutex
+	networkAnonymize   bool
+
+	inherited       map[string]net.Listener
+	inheritedInodes map[string]uint64
+
+	shutdownMu     sync.Mutex
+	shutdownReason string
+
+	vmStoppedMu   sync.Mutex
+	vmStoppedOnce sync.Once
+	vmStopped     chan struct{}
+
+	trace setupTrace
+
+	auditMu     sync.Mutex
+	auditFailed func(e *AuditEntry, err error)
+
+	podmanVersionMu sync.RWMutex
+	podmanVersion   *PodmanVersion
+
+	hostPowerMu sync.RWMutex
+	hostPower   HostPower
+
+	clockDriftMu  sync.RWMutex
+	clockDrift    time.Duration
+	clockDriftSet bool
+
+	guestServicesMu sync.RWMutex
+	guestServices   []GuestServiceStatus
+}
+
+// SetBootedAt records when the VM became ready.
+func (c *Context) SetBootedAt(t time.Time) {
+	c.bootedAtMu.Lock()
+	defer c.bootedAtMu.Unlock()
+	c.bootedAt = t
+}
+
+// BootedAt returns when the VM became ready, zero if it is not ready yet.
+func (c *Context) BootedAt() time.Time {
+	c.bootedAtMu.RLock()
+	defer c.bootedAtMu.RUnlock()
+	return c.bootedAt
+}
+
+const (
+	PowerSourceAC      = "ac"
+	PowerSourceBattery = "battery"
+
+	ThermalUnknown  = "unknown"
+	ThermalNominal  = "nominal"
+	ThermalFair     = "fair"
+	ThermalSerious  = "serious"
+	ThermalCritical = "critical"
+)
+
+// HostPower is the power source and the thermal pressure of the host.
+type HostPower struct {
+	Source  string `json:"source"`
+	Thermal string `json:"thermal"`
+}
+
+func (c *Context) SetHostPower(p HostPower) {
+	c.hostPowerMu.Lock()
+	defer c.hostPowerMu.Unlock()
+	c.hostPower = p
+}
+
+// HostPower returns the last read power state, it is empty with NoPowerAwareness.
+func (c *Context) HostPower() HostPower {
+	c.hostPowerMu.RLock()
+	defer c.hostPowerMu.RUnlock()
+	return c.hostPower
+}
+
+// SetClockDrift records the last measured difference of the guest clock to the host clock, positive if the guest is ahead.
+func (c *Context) SetClockDrift(d time.Duration) {
+	c.clockDriftMu.Lock()
+	defer c.clockDriftMu.Unlock()
+	c.clockDrift = d
+	c.clockDriftSet = true
+}
+
+// ClockDrift returns the last measured clock drift, ok is false if it was not measured yet.
+func (c *Context) ClockDrift() (d time.Duration, ok bool) {
+	c.clockDriftMu.RLock()
+	defer c.clockDriftMu.RUnlock()
+	return c.clockDrift, c.clockDriftSet
+}
+
+// ObservabilityExport configures exporting metrics to an OpenTelemetry collector via OTLP/HTTP.
+type ObservabilityExport struct {
+	OTLPEndpoint string
+	ServiceName  string
+	Headers      map[string]string
+	// StatsdAddress is the HOST:PORT of the statsd server, the same metrics are pushed there
+	StatsdAddress string
+	StatsdPrefix  string
 }
 
 func Init() *Context {
@@ -60,26 +284,45 @@ func Init() *Context {
 }
 
 func (c *Context) PreSetup() error {
-	g := errgroup.Group{}
-
-	g.Go(c.basic)
-	g.Go(c.logPath)
+	// basic enables -trace, so it runs first and all steps after it are traced
+	if err := c.traced("basic", c.basic, "name", name, "cpus", cpus, "memory", memory)(); err != nil {
+		return err
+	}
 
-	return g.Wait()
+	return c.traced("logPath", c.logPath, "log-path", logPath)()
 }
 
-func (c *Context) Setup() error {
+// Setup runs the rest of the setup once the logger exists, the steps traced by PreSetup are logged first.
+func (c *Context) Setup(log *logger.Context) error {
+	c.setTraceLog(log)
+
+	// the files must be in the format of this ovm before anything reads them
+	if err := c.traced("schemas", c.schemas, "target-path", targetPath, "ssh-key-path", sshKeyPath)(); err != nil {
+		return err
+	}
+
 	g := errgroup.Group{}
 
-	g.Go(c.socketPath)
-	g.Go(c.ssh)
-	g.Go(c.sshPort)
-	g.Go(c.target)
+	g.Go(c.traced("socketPath", c.socketPath, "socket-path", socketPath))
+	g.Go(c.traced("ssh", c.ssh, "ssh-key-path", sshKeyPath))
+	g.Go(c.traced("sshPort", c.sshPort))
+	g.Go(c.traced("target", c.target, "target-path", targetPath, "kernel-path", kernelPath, "initrd-path", initrdPath, "rootfs-path", rootfsPath))
+	g.Go(c.traced("statusSnapshot", c.statusSnapshot, "status-snapshot-dir", statusSnapshotDir))
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
 
-	return g.Wait()
+	return c.traced("validateNetworkConfig", c.ValidateNetworkConfig)()
 }
 
 func (c *Context) basic() error {
+	if trace != "" {
+		if err := logger.SetTrace(strings.Split(trace, ","), true); err != nil {
+			return err
+		}
+	}
+
 	c.Name = name
 	c.CPUS = cpus
 	c.MemoryBytes = memory * 1024 * 1024
@@ -87,12 +330,88 @@ func (c *Context) basic() error {
 	c.BindPID = bindPID
 	c.EventSocketPath = eventSocketPath
 	c.PowerSaveMode = powerSaveMode
+	c.PowerSaveOnBattery = powerSaveOnBattery
+	c.NoPowerAwareness = noPowerAwareness
 	c.KernelDebug = kernelDebug
+	c.HealthEndpointPort = healthEndpointPort
+	c.ClockSource = clockSource
+	c.SerialConsoleBaud = serialConsoleBaud
+	c.ShutdownCommand = strings.TrimSpace(shutdownCommand)
+	c.ExposeDockerSocket = exposeDockerSocket
+	c.PodmanAPIVersion = podmanAPIVersion
+	c.PodmanMaxVersion = podmanMaxVersion
+	c.TmpMount = tmpMount
+	c.RootDevice = rootDevice
+	c.RootWait = rootWait
+	c.RootfsOverlay = rootfsOverlay
+	c.GuestWritableRoot = guestWritableRoot
+	c.NoInitrd = noInitrd
+	c.MaxSSHSessions = maxSSHSessions
+	c.SocketBacklog = socketBacklog
+	c.AgentVsockPort = agentVsockPort
+	c.ForwardGuestLogs = forwardGuestLogs
+	c.AssumeReady = assumeReady
+	c.AssumeReadyAfter = assumeReadyAfter
+	c.ConfigPath = configPath
+	c.GuestSwapBytes, _ = parseGuestSwap(guestSwap, c.MemoryBytes)
+	c.LogTotalBudget, _ = parseLogTotalBudget(logTotalBudget)
+	c.CopyBufferSize, _ = parseCopyBufferSize(copyBufferSize)
+	c.MaxConcurrentSetups = MaxConcurrentSetups()
+	c.DataInitPolicy = dataInitPolicy
+	c.GuestUlimits, _ = parseUlimits()
+	c.GuestRoutes, _ = parseRoutes()
+	c.AllowFrom, _ = parseAllowFrom()
+	c.GuestUnits, _ = parseGuestUnits()
+	c.PassthroughDevices, _ = parsePassthroughDevices()
+	c.SetNetworkDiagnosticsAnonymized(networkAnonymize)
+	c.WatchArtifacts = string(watchArtifacts)
+	c.GuestArch = GuestArch(runtime.GOARCH)
+	c.sshPool = NewSSHSessionPool(maxSSHSessions, c.dialGuest)
+	c.VerifyArtifactsDelay = verifyArtifactsDelay
+	c.VerifyArtifactsRate = verifyArtifactsRate
+	c.Strict = strict
+	c.MTU = mtu
+	c.NetworkLatency = networkLatency
+	c.NetworkPacketLoss = networkPacketLoss
+	c.PauseOnSuspend = pauseOnSuspend
+	c.MaxDrift = maxDrift
+	c.DriftCheckInterval = driftCheckInterval
+	c.VirtioRNG = virtioRNG
+	c.BootCPUs = bootCPUs
+	c.ObservabilityExport = ObservabilityExport{
+		OTLPEndpoint: otlpEndpoint,
+		ServiceName:  otlpServiceName,
+		Headers:      otlpHeaders.values,
+
+		StatsdAddress: statsdAddress,
+		StatsdPrefix:  statsdPrefix,
+	}
+	c.RestfulMaxBodySize = restfulMaxBodySize
+	c.RestfulReadTimeout = restfulReadTimeout
+	c.RestfulWriteTimeout = restfulWriteTimeout
+	c.RestfulRequestTimeout = restfulRequestTimeout
+	c.RestfulMaxInFlight = restfulMaxInFlight
+	c.JobRetention = jobRetention
+	c.RestfulRoutes, _ = restfulRoutes()
+	c.Sockets, _ = socketComponents()
+
+	if m, err := parseMounts(); err != nil {
+		return err
+	} else {
+		c.Mounts = m
+	}
 
-	if err := os.MkdirAll("/tmp/ovm", 0755); err != nil {
+	if err := os.MkdirAll(consts.RuntimeDir, 0755); err != nil {
 		return err
 	}
 
+	// known before the setup, the replacing ovm asks the running one for its listeners before stopping it
+	if p, err := filepath.Abs(socketPath); err != nil {
+		return err
+	} else {
+		c.HandoverSocketPath = path.Join(p, name+"-handover.sock")
+	}
+
 	if p, err := os.Executable(); err != nil {
 		return fmt.Errorf("get executable path error: %w", err)
 	} else {
@@ -105,12 +424,26 @@ func (c *Context) basic() error {
 
 		sum := md5.Sum([]byte(c.ExecutablePath))
 		hash := hex.EncodeToString(sum[:])
-		c.LockFile = "/tmp/ovm/" + hash + "-" + name + ".pid"
+		c.LockFile = path.Join(consts.RuntimeDir, hash+"-"+name+".pid")
 	}
 
 	return nil
 }
 
+func (c *Context) schemas() error {
+	tp, err := filepath.Abs(targetPath)
+	if err != nil {
+		return err
+	}
+	kp, err := filepath.Abs(sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	c.SchemaMigrations, err = MigrateSchemas(tp, kp, name)
+	return err
+}
+
 func (c *Context) socketPath() error {
 	p, err := filepath.Abs(socketPath)
 	if err != nil {
@@ -119,16 +452,38 @@ func (c *Context) socketPath() error {
 
 	c.SocketPath = p
 	c.ForwardSocketPath = path.Join(p, name+"-podman.sock")
+	if exposeDockerSocket {
+		c.DockerSocketPath = path.Join(p, name+"-docker.sock")
+	}
 	c.SocketNetworkPath = path.Join(p, name+"-vfkit-network.sock")
 	c.SocketInitrdVSockPath = path.Join(p, name+"-initrd-vsock.sock")
 	c.SocketReadyPath = path.Join(p, name+"-ready.sock")
 	c.RestfulSocketPath = path.Join(p, name+"-restful.sock")
 	c.TimeSyncSocketPath = path.Join(p, name+"-sync-time.sock")
 	c.SSHAuthSocketPath = path.Join(p, name+"-ssh-auth.sock")
+	c.ConsoleSocketPath = path.Join(p, name+"-console.sock")
+	c.AgentSocketPath = path.Join(p, name+"-agent.sock")
+	c.GuestLogSocketPath = path.Join(p, name+"-guest-logs.sock")
 
 	c.Endpoint = "unix://" + c.SocketNetworkPath
 
-	if err := os.RemoveAll(c.SocketPath); err != nil {
+	for component, p := range map[string]*string{
+		SocketPodman:   &c.ForwardSocketPath,
+		SocketRestful:  &c.RestfulSocketPath,
+		SocketReady:    &c.SocketReadyPath,
+		SocketTimeSync: &c.TimeSyncSocketPath,
+		SocketSSHAuth:  &c.SSHAuthSocketPath,
+		SocketNetwork:  &c.SocketNetworkPath,
+	} {
+		if !c.SocketEnabled(component) {
+			*p = ""
+		}
+	}
+	if !c.SocketEnabled(SocketNetwork) {
+		c.Endpoint = ""
+	}
+
+	if err := c.cleanSocketPath(); err != nil {
 		return err
 	}
 
@@ -140,11 +495,23 @@ func (c *Context) socketPath() error {
 }
 
 func (c *Context) ssh() error {
+	defer acquireSetupSlot()()
+
 	p, err := filepath.Abs(sshKeyPath)
 	if err != nil {
 		return err
 	}
 
+	tp, err := filepath.Abs(targetPath)
+	if err != nil {
+		return err
+	}
+
+	return c.sshKeys(p, tp)
+}
+
+// sshKeys generates the keys of this name in the ssh key path p, or checks the existing ones, for the instance of target path tp.
+func (c *Context) sshKeys(p, tp string) error {
 	c.SSHKeyPath = p
 	c.SSHPrivateKeyPath = path.Join(p, name)
 	c.SSHPublicKeyPath = path.Join(p, name+".pub")
@@ -153,6 +520,16 @@ func (c *Context) ssh() error {
 		return err
 	}
 
+	unlock, err := c.lockSSHKeys()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := c.checkSSHKeyOwner(tp); err != nil {
+		return err
+	}
+
 	{
 		g := errgroup.Group{}
 		g.Go(func() error {
@@ -172,6 +549,10 @@ func (c *Context) ssh() error {
 		}
 	}
 
+	if err := c.checkSSHKeyModes(); err != nil {
+		return err
+	}
+
 	{
 		f, err := os.Open(c.SSHPublicKeyPath)
 		if err != nil {
@@ -190,13 +571,60 @@ func (c *Context) ssh() error {
 	return nil
 }
 
+// checkSSHKeyModes makes sure the private key is only accessible by its owner and the public key is not writable by others,
+// otherwise ssh refuses a private key which is readable by others (e.g. after an import or with a bad umask).
+// Stricter modes like 0400 are kept.
+func (c *Context) checkSSHKeyModes() error {
+	for _, k := range []struct {
+		path    string
+		private bool
+	}{
+		{c.SSHPrivateKeyPath, true},
+		{c.SSHPublicKeyPath, false},
+	} {
+		stat, err := os.Stat(k.path)
+		if err != nil {
+			return err
+		}
+
+		mode, ok := sshKeyMode(stat.Mode().Perm(), k.private)
+		if ok {
+			continue
+		}
+
+		if err := c.Warn(nil, WarnSSHKeyMode, "ssh key %s has mode %#o, expected %#o", k.path, stat.Mode().Perm(), mode); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(k.path, mode); err != nil {
+			return fmt.Errorf("fix mode of ssh key %s error: %w", k.path, err)
+		}
+
+		c.SSHKeyModeFixes = append(c.SSHKeyModeFixes, fmt.Sprintf("%s: %#o -> %#o", k.path, stat.Mode().Perm(), mode))
+	}
+
+	return nil
+}
+
+// sshKeyMode reports whether perm is safe for the key, and otherwise the mode it is fixed to:
+// a private key loses the permissions of group and others, a public key their write permission.
+func sshKeyMode(perm os.FileMode, private bool) (os.FileMode, bool) {
+	unsafe := os.FileMode(0022)
+	if private {
+		unsafe = 0077
+	}
+
+	return perm &^ unsafe, perm&unsafe == 0
+}
+
 func (c *Context) sshPort() error {
-	port, err := utils.FindUsablePort(2233)
+	ln, err := utils.FindUsablePort(2233)
 	if err != nil {
 		return err
 	}
 
-	c.SSHPort = port
+	c.SSHPortListener = ln
+	c.SSHPort = ln.Addr().(*net.TCPAddr).Port
 
 	return nil
 }
@@ -208,11 +636,31 @@ func (c *Context) logPath() error {
 	}
 
 	c.LogPath = p
+	c.AuditPath = path.Join(c.LogPath, name+"-audit.jsonl")
 
 	return os.MkdirAll(c.LogPath, 0755)
 }
 
+func (c *Context) statusSnapshot() error {
+	c.StatusSnapshotInterval = statusSnapshotInterval
+
+	if statusSnapshotDir == "" {
+		return nil
+	}
+
+	p, err := filepath.Abs(statusSnapshotDir)
+	if err != nil {
+		return err
+	}
+
+	c.StatusSnapshotDir = p
+
+	return os.MkdirAll(c.StatusSnapshotDir, 0755)
+}
+
 func (c *Context) target() error {
+	defer acquireSetupSlot()()
+
 	p, err := filepath.Abs(targetPath)
 	if err != nil {
 		return err
@@ -225,19 +673,78 @@ func (c *Context) target() error {
 
 	c.VersionsPath = path.Join(c.TargetPath, "versions.json")
 	c.KernelPath = path.Join(c.TargetPath, filepath.Base(kernelPath))
-	c.InitrdPath = path.Join(c.TargetPath, filepath.Base(initrdPath))
+	if !noInitrd {
+		c.InitrdPath = path.Join(c.TargetPath, filepath.Base(initrdPath))
+	}
 	c.RootfsPath = path.Join(c.TargetPath, filepath.Base(rootfsPath))
 	c.DiskDataPath = path.Join(c.TargetPath, "data.img")
 	c.DiskTmpPath = path.Join(c.TargetPath, "tmp.img")
+	c.ShutdownHistoryPath = ShutdownHistoryPath(c.TargetPath)
+
+	// the cmdline of the first start is kept, so flag or code changes do not change how the guest boots
+	c.KernelCmdlinePath = path.Join(c.TargetPath, "kernel-cmdline.txt")
+	if resetCmdline {
+		if err := os.RemoveAll(c.KernelCmdlinePath); err != nil {
+			return err
+		}
+	} else if data, err := os.ReadFile(c.KernelCmdlinePath); err == nil {
+		c.KernelCmdline = strings.TrimSpace(string(data))
+	}
 
-	target, err := newTarget(c.TargetPath, kernelPath, initrdPath, rootfsPath, c.DiskDataPath, c.VersionsPath)
+	target, err := newTarget(c.TargetPath, kernelPath, initrdPath, rootfsPath, c.DiskDataPath, c.VersionsPath, c.CopyBufferSize)
 	if err != nil {
 		return err
 	}
 
-	if err := target.handle(); err != nil {
+	if err := c.traced("target/handle", target.handle, "target-path", c.TargetPath, "asset-version", assetVersion)(); err != nil {
+		return err
+	}
+	for _, d := range target.decisions {
+		c.AssetDecisions = append(c.AssetDecisions, *d)
+	}
+
+	var reset bool
+	if err := c.traced("target/initDataDisk", func() (err error) {
+		reset, err = c.initDataDisk()
+		return err
+	}, "data-init-policy", c.DataInitPolicy)(); err != nil {
+		return err
+	} else if reset {
+		for i := range c.AssetDecisions {
+			if c.AssetDecisions[i].Key == "data_img" {
+				c.AssetDecisions[i].Copied = true
+				c.AssetDecisions[i].Reason = "recreated by -data-init-policy=always"
+			}
+		}
+	}
+
+	// an archived rootfs is attached as the ext4 image decompressed from it
+	c.GuestRootFS = &GuestRootFS{Path: c.RootfsPath}
+	if pv, ok := target.versionsJSON.Provenance["rootfs"]; ok {
+		c.GuestRootFS.ArchiveDigest = pv.Digest
+	}
+	if err := c.traced("target/decompress", c.GuestRootFS.Decompress, "rootfs", c.RootfsPath)(); err != nil {
 		return err
 	}
+	c.RootfsPath = c.GuestRootFS.Path
+
+	if prewarmRootfs {
+		if err := c.traced("target/prewarmRootfs", func() (err error) {
+			c.RootfsPrewarm, err = c.prewarmRootfs()
+			return err
+		}, "rootfs", c.RootfsPath)(); err != nil {
+			return err
+		}
+	}
+
+	// the first boot after `ovm import-data` adjusts the container storage of the imported disk
+	if pv, ok := target.versionsJSON.Provenance["data_img"]; ok && pv.Import != nil && !pv.Import.Provisioned {
+		if c.NoInitrd {
+			return fmt.Errorf("the imported data disk is provisioned by the ignition, the first start cannot use no-initrd")
+		}
+		c.ProvisionDataImport = true
+	}
+	c.StorageMigrated = target.versionsJSON.StorageMigrated
 
 	if _, err := os.Stat(c.DiskTmpPath); err != nil {
 		if err := utils.CreateSparseFile(c.DiskTmpPath, 1*1024*1024*1024*1024); err != nil {
@@ -245,5 +752,32 @@ func (c *Context) target() error {
 		}
 	}
 
+	// kept between starts, it holds the changes to the rootfs
+	if rootfsOverlay == RootfsOverlayDisk {
+		c.DiskRootfsOverlayPath = path.Join(c.TargetPath, "rootfs-overlay.img")
+		if _, err := os.Stat(c.DiskRootfsOverlayPath); err != nil {
+			if err := utils.CreateSparseFile(c.DiskRootfsOverlayPath, 16*1024*1024*1024); err != nil {
+				return err
+			}
+		}
+	}
+
+	// always recreated, so the guest formats it on every start
+	if tmpMount != "" {
+		c.DiskScratchPath = path.Join(c.TargetPath, "scratch.img")
+		if err := utils.CreateSparseFile(c.DiskScratchPath, 1*1024*1024*1024*1024); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// PersistentKernelCmdline writes the kernel cmdline to KernelCmdlinePath, it is used instead of assembling it on the next starts.
+func (c *Context) PersistentKernelCmdline() error {
+	if c.KernelCmdline == "" {
+		return fmt.Errorf("kernel cmdline is not assembled yet")
+	}
+
+	return utils.WriteFileAtomic(c.KernelCmdlinePath, []byte(c.KernelCmdline+"\n"), 0644)
+}
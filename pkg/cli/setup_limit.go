@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"runtime"
+	"sync"
+)
+
+// setupSlots limits the Setup calls of a process doing file I/O at the same time (e.g. a manager starting many VMs),
+// so their rootfs copies do not saturate the disk and the memory of the host.
+var setupSlots = newSlots(runtime.NumCPU())
+
+// slots is a counting semaphore whose limit can change while slots are held.
+type slots struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	used  int
+}
+
+func newSlots(limit int) *slots {
+	s := &slots{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *slots) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.used >= s.limit {
+		s.cond.Wait()
+	}
+	s.used++
+}
+
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used--
+	s.cond.Broadcast()
+}
+
+// setLimit applies to the held slots too, with a lower limit no slot is handed out until enough are released.
+func (s *slots) setLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limit = n
+	s.cond.Broadcast()
+}
+
+func (s *slots) getLimit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// SetMaxConcurrentSetups sets how many Setup calls may copy files at the same time, n <= 0 is runtime.NumCPU().
+// It also applies to the Setup calls already waiting or running.
+func SetMaxConcurrentSetups(n int) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	setupSlots.setLimit(n)
+}
+
+// MaxConcurrentSetups returns the limit set by SetMaxConcurrentSetups.
+func MaxConcurrentSetups() int {
+	return setupSlots.getLimit()
+}
+
+// acquireSetupSlot blocks until a slot is free, the returned function releases it.
+func acquireSetupSlot() func() {
+	setupSlots.acquire()
+	return setupSlots.release
+}
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runSetups runs n goroutines holding a setup slot for a moment each and returns the most held at once.
+func runSetups(n int, during func()) int32 {
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := acquireSetupSlot()
+			defer release()
+
+			v := running.Add(1)
+			for {
+				p := peak.Load()
+				if v <= p || peak.CompareAndSwap(p, v) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+
+	if during != nil {
+		during()
+	}
+	wg.Wait()
+	return peak.Load()
+}
+
+func TestSetupSlots(t *testing.T) {
+	defer SetMaxConcurrentSetups(runtime.NumCPU())
+
+	SetMaxConcurrentSetups(3)
+	if got := MaxConcurrentSetups(); got != 3 {
+		t.Fatalf("MaxConcurrentSetups() = %d, want 3", got)
+	}
+	if peak := runSetups(10, nil); peak > 3 {
+		t.Errorf("%d setups ran at once, the limit is 3", peak)
+	}
+}
+
+func TestSetupSlotsLimitChangedWhileHeld(t *testing.T) {
+	defer SetMaxConcurrentSetups(runtime.NumCPU())
+
+	SetMaxConcurrentSetups(2)
+	release := acquireSetupSlot()
+
+	// the held slot counts against the lowered limit, nothing else may start until it is released
+	SetMaxConcurrentSetups(1)
+	acquired := make(chan func())
+	go func() {
+		acquired <- acquireSetupSlot()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("a slot was handed out while the held one already reaches the new limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("the released slot was lost after the limit changed")
+	}
+
+	if peak := runSetups(10, nil); peak > 1 {
+		t.Errorf("%d setups ran at once, the limit is 1", peak)
+	}
+}
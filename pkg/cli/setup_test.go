@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSSHKeyMode(t *testing.T) {
+	tests := []struct {
+		perm    os.FileMode
+		private bool
+		want    os.FileMode
+		ok      bool
+	}{
+		{0600, true, 0600, true},
+		{0400, true, 0400, true},
+		{0700, true, 0700, true},
+		{0644, true, 0600, false},
+		{0640, true, 0600, false},
+		{0604, true, 0600, false},
+		{0644, false, 0644, true},
+		{0600, false, 0600, true},
+		{0444, false, 0444, true},
+		{0664, false, 0644, false},
+		{0666, false, 0644, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := sshKeyMode(tt.perm, tt.private)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("sshKeyMode(%#o, private %v) = %#o, %v, want %#o, %v", tt.perm, tt.private, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTargetKernelCmdline(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(r bool) { resetCmdline = r }(resetCmdline)
+
+	// the first start finds no cmdline and persists the assembled one
+	first := &Context{}
+	if err := first.target(); err != nil {
+		t.Fatal(err)
+	}
+	if first.KernelCmdline != "" {
+		t.Fatalf("first start read the cmdline %q", first.KernelCmdline)
+	}
+	first.KernelCmdline = "console=hvc0 fb_tunnels=none"
+	if err := first.PersistentKernelCmdline(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &Context{}
+	if err := second.target(); err != nil {
+		t.Fatal(err)
+	}
+	if second.KernelCmdlinePath != first.KernelCmdlinePath || second.KernelCmdline != first.KernelCmdline {
+		t.Errorf("second start read %q from %s, want %q from %s", second.KernelCmdline, second.KernelCmdlinePath, first.KernelCmdline, first.KernelCmdlinePath)
+	}
+
+	resetCmdline = true
+	reset := &Context{}
+	if err := reset.target(); err != nil {
+		t.Fatal(err)
+	}
+	if reset.KernelCmdline != "" {
+		t.Errorf("-reset-cmdline read the cmdline %q", reset.KernelCmdline)
+	}
+	if _, err := os.Stat(reset.KernelCmdlinePath); !os.IsNotExist(err) {
+		t.Errorf("-reset-cmdline kept %s: %v", reset.KernelCmdlinePath, err)
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+// setupStep is a setup function run with -trace setup.
+type setupStep struct {
+	Name string
+	// Args are the flags the step reads, as key=value
+	Args string
+	// StartMs is the offset to the first step, the steps of PreSetup and Setup run concurrently
+	StartMs    int64
+	DurationMs int64
+	Err        error
+}
+
+type setupTrace struct {
+	sync.Mutex
+	start time.Time
+	// log is set by Setup, the steps of PreSetup run before the logger exists and are kept in steps until then
+	log   *logger.Context
+	steps []setupStep
+}
+
+// traced wraps the setup step fn, with -trace setup its arguments, duration and error are recorded.
+// The steps of Setup are logged when they start and when they finish, so a step which hangs shows up in the log.
+// Tracing is checked when the step finished, basic() enables it.
+func (c *Context) traced(name string, fn func() error, args ...any) func() error {
+	return func() error {
+		c.trace.Lock()
+		if c.trace.start.IsZero() {
+			c.trace.start = time.Now()
+		}
+		offset := time.Since(c.trace.start)
+		log := c.trace.log
+		c.trace.Unlock()
+
+		step := setupStep{
+			Name:    name,
+			Args:    formatStepArgs(args),
+			StartMs: offset.Milliseconds(),
+		}
+		if log != nil {
+			log.Tracef(logger.Setup, "setup step %s(%s) started at +%dms", step.Name, step.Args, step.StartMs)
+		}
+
+		start := time.Now()
+		step.Err = fn()
+		step.DurationMs = time.Since(start).Milliseconds()
+
+		if !logger.Setup.Enabled() {
+			return step.Err
+		}
+
+		if log != nil {
+			logStep(log, step)
+			return step.Err
+		}
+
+		c.trace.Lock()
+		c.trace.steps = append(c.trace.steps, step)
+		c.trace.Unlock()
+
+		return step.Err
+	}
+}
+
+// setTraceLog logs the steps recorded before the logger existed, the following steps are logged directly.
+func (c *Context) setTraceLog(log *logger.Context) {
+	c.trace.Lock()
+	defer c.trace.Unlock()
+
+	c.trace.log = log
+	for _, s := range c.trace.steps {
+		logStep(log, s)
+	}
+	c.trace.steps = nil
+}
+
+func logStep(log *logger.Context, s setupStep) {
+	log.Tracef(logger.Setup, "setup step %s(%s) at +%dms took %dms, error: %v", s.Name, s.Args, s.StartMs, s.DurationMs, s.Err)
+}
+
+// formatStepArgs formats the key value pairs, strings are quoted so empty values are visible.
+func formatStepArgs(args []any) string {
+	parts := make([]string, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		if s, ok := args[i+1].(string); ok {
+			parts = append(parts, fmt.Sprintf("%v=%q", args[i], s))
+		} else {
+			parts = append(parts, fmt.Sprintf("%v=%v", args[i], args[i+1]))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func TestTracedSteps(t *testing.T) {
+	if err := logger.SetTrace([]string{"setup"}, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = logger.SetTrace([]string{"setup"}, false) })
+
+	dir := t.TempDir()
+	log, err := logger.NewWithoutManage(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() string {
+		data, err := os.ReadFile(filepath.Join(dir, "test.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	c := &Context{}
+	// a step of PreSetup, before the logger exists
+	if err := c.traced("pre", func() error { return nil }, "name", "a")(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.trace.steps) != 1 {
+		t.Fatalf("got %d buffered steps, want 1", len(c.trace.steps))
+	}
+
+	c.setTraceLog(log)
+	if out := read(); !strings.Contains(out, `setup step pre(name="a")`) {
+		t.Fatalf("the buffered step was not logged:\n%s", out)
+	}
+
+	var during string
+	err = c.traced("hang", func() error {
+		during = read()
+		return errors.New("boom")
+	})()
+	if err == nil || err.Error() != "boom" {
+		t.Fatalf("got error %v, want boom", err)
+	}
+	if !strings.Contains(during, "setup step hang() started") {
+		t.Fatalf("the step was not logged when it started:\n%s", during)
+	}
+	if out := read(); !strings.Contains(out, "setup step hang() at ") || !strings.Contains(out, "error: boom") {
+		t.Fatalf("the finished step was not logged:\n%s", out)
+	}
+	if len(c.trace.steps) != 0 {
+		t.Fatalf("steps are still buffered after the logger exists: %v", c.trace.steps)
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Reasons of a shutdown, signals and crashes are followed by the signal name or the error.
+const (
+	ShutdownUserAPI        = "user-api"
+	ShutdownBindPIDExit    = "bound-pid-exit"
+	ShutdownGuest          = "guest"
+	ShutdownExit           = "exit"
+	ShutdownArtifactUpdate = "artifact-update"
+	ShutdownSignalPrefix   = "signal:"
+	ShutdownCrashPrefix    = "crash:"
+)
+
+// maxShutdownHistory is the number of shutdowns kept in the history file.
+const maxShutdownHistory = 10
+
+// ShutdownRecord is why an ovm process stopped the VM.
+type ShutdownRecord struct {
+	Reason string `json:"reason"`
+	// Initiator is who asked for it, e.g. the pid of the restful client, if known
+	Initiator string    `json:"initiator,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Time      time.Time `json:"time"`
+	// PID is the ovm process which recorded it
+	PID int `json:"pid"`
+}
+
+// shutdownHistoryJSON is the history file, latest first. Schema 0 was the bare list.
+type shutdownHistoryJSON struct {
+	Schema  int              `json:"schema"`
+	History []ShutdownRecord `json:"history"`
+}
+
+// RecordShutdown records the reason of the shutdown in the history of the target path.
+// Only the first reason of a process is recorded, e.g. the stop request and not the stopped VM it causes.
+// The restful API records a stop once it succeeded, so it replaces the stopped guest if the VM stopped first.
+func (c *Context) RecordShutdown(reason, initiator, detail string) error {
+	c.shutdownMu.Lock()
+	defer c.shutdownMu.Unlock()
+
+	if c.ShutdownHistoryPath == "" {
+		return nil
+	}
+	replace := c.shutdownReason == ShutdownGuest && reason == ShutdownUserAPI
+	if c.shutdownReason != "" && !replace {
+		return nil
+	}
+	c.shutdownReason = reason
+
+	history, err := ReadShutdownHistory(c.ShutdownHistoryPath)
+	if err != nil {
+		history = nil
+	}
+	if replace && len(history) != 0 && history[0].PID == os.Getpid() {
+		history = history[1:]
+	}
+
+	history = append([]ShutdownRecord{{
+		Reason:    reason,
+		Initiator: initiator,
+		Detail:    detail,
+		Time:      time.Now(),
+		PID:       os.Getpid(),
+	}}, history...)
+	if len(history) > maxShutdownHistory {
+		history = history[:maxShutdownHistory]
+	}
+
+	data, err := json.Marshal(&shutdownHistoryJSON{Schema: shutdownHistorySchema.current(), History: history})
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(c.ShutdownHistoryPath, data, 0644)
+}
+
+// ReadShutdownHistory reads the recorded shutdowns, latest first. A missing file is an empty history.
+func ReadShutdownHistory(p string) ([]ShutdownRecord, error) {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ShutdownRecord{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	version, err := shutdownHistorySchema.version(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case version > shutdownHistorySchema.current():
+		return nil, &SchemaError{Path: p, Version: version, Supported: shutdownHistorySchema.current()}
+	case version == 0:
+		history := []ShutdownRecord{}
+		if err := json.Unmarshal(data, &history); err != nil {
+			return nil, err
+		}
+		return history, nil
+	}
+
+	v := &shutdownHistoryJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	if v.History == nil {
+		v.History = []ShutdownRecord{}
+	}
+
+	return v.History, nil
+}
+
+// ShutdownHistoryPath returns the history file of the target path.
+func ShutdownHistoryPath(targetPath string) string {
+	return path.Join(targetPath, "shutdown-history.json")
+}
+
+// RunShutdownCommand runs -shutdown-command in the guest.
+// The guest may stop sshd before the command exits, the closed session then counts as success.
+func (c *Context) RunShutdownCommand() error {
+	_, err := c.RunInGuest(c.ShutdownCommand)
+
+	var missing *ssh.ExitMissingError
+	if errors.As(err, &missing) || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *Context) vmStoppedChan() chan struct{} {
+	c.vmStoppedOnce.Do(func() {
+		c.vmStopped = make(chan struct{})
+	})
+
+	return c.vmStopped
+}
+
+// MarkVMStopped tells VMStopped that the VM was stopped, or was never started.
+func (c *Context) MarkVMStopped() {
+	c.vmStoppedMu.Lock()
+	defer c.vmStoppedMu.Unlock()
+
+	ch := c.vmStoppedChan()
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// VMStopped is closed once the VM stopped, the virtual network is kept until then so -shutdown-command reaches the guest.
+func (c *Context) VMStopped() <-chan struct{} {
+	return c.vmStoppedChan()
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordShutdown(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		reasons []string
+		want    []string
+	}{
+		{"first reason wins", []string{ShutdownSignalPrefix + "SIGTERM", ShutdownGuest}, []string{ShutdownSignalPrefix + "SIGTERM"}},
+		{"user api after the guest stopped", []string{ShutdownGuest, ShutdownUserAPI}, []string{ShutdownUserAPI}},
+		{"guest after the user api", []string{ShutdownUserAPI, ShutdownGuest}, []string{ShutdownUserAPI}},
+		{"user api does not replace other reasons", []string{ShutdownExit, ShutdownUserAPI}, []string{ShutdownExit}},
+	}
+
+	for _, tt := range tests {
+		p := filepath.Join(dir, tt.name+".json")
+		// a record of an earlier process is kept
+		data, err := json.Marshal(&shutdownHistoryJSON{
+			Schema:  shutdownHistorySchema.current(),
+			History: []ShutdownRecord{{Reason: ShutdownExit, PID: os.Getpid() + 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		c := &Context{ShutdownHistoryPath: p}
+		for _, r := range tt.reasons {
+			if err := c.RecordShutdown(r, "", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		history, err := ReadShutdownHistory(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != len(tt.want)+1 {
+			t.Fatalf("%s: %d records, want %d", tt.name, len(history), len(tt.want)+1)
+		}
+		for i, want := range tt.want {
+			if history[i].Reason != want {
+				t.Errorf("%s: record %d is %s, want %s", tt.name, i, history[i].Reason, want)
+			}
+		}
+		if last := history[len(history)-1]; last.Reason != ShutdownExit || last.PID == os.Getpid() {
+			t.Errorf("%s: the record of the earlier process was changed: %+v", tt.name, last)
+		}
+	}
+}
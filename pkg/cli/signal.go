@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+// ErrProcessNotFound is returned by SignalGuest when kill in the guest exits with 1, e.g. because no process has the pid.
+var ErrProcessNotFound = errors.New("process not found in the guest")
+
+// linuxSignals are the signal numbers in the guest, several differ from the numbers of the darwin host (e.g. SIGUSR1).
+var linuxSignals = map[string]int{
+	"SIGHUP": 1, "SIGINT": 2, "SIGQUIT": 3, "SIGILL": 4, "SIGTRAP": 5, "SIGABRT": 6, "SIGBUS": 7, "SIGFPE": 8,
+	"SIGKILL": 9, "SIGUSR1": 10, "SIGSEGV": 11, "SIGUSR2": 12, "SIGPIPE": 13, "SIGALRM": 14, "SIGTERM": 15,
+	"SIGCHLD": 17, "SIGCONT": 18, "SIGSTOP": 19, "SIGTSTP": 20, "SIGTTIN": 21, "SIGTTOU": 22, "SIGURG": 23,
+	"SIGXCPU": 24, "SIGXFSZ": 25, "SIGVTALRM": 26, "SIGPROF": 27, "SIGWINCH": 28, "SIGIO": 29, "SIGSYS": 31,
+}
+
+// SignalGuest sends sig to the process pid in the guest with kill, e.g. SIGHUP to reload a service.
+// The command runs as root, so pid -1 (and process groups) are refused: kill would signal sshd, podman and the agent as well.
+func (c *Context) SignalGuest(pid int, sig syscall.Signal) error {
+	if pid == -1 {
+		return fmt.Errorf("invalid guest pid -1, it signals every process of the guest")
+	}
+	if pid <= 0 {
+		return fmt.Errorf("invalid guest pid %d", pid)
+	}
+
+	command, err := signalCommand(pid, sig)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.RunInGuest(command)
+
+	var exit *ssh.ExitError
+	if errors.As(err, &exit) && exit.ExitStatus() == 1 {
+		return fmt.Errorf("%w: pid %d", ErrProcessNotFound, pid)
+	}
+
+	return err
+}
+
+// signalCommand returns the kill command with the number of sig in the guest, e.g. kill -15 1234 for SIGTERM.
+func signalCommand(pid int, sig syscall.Signal) (string, error) {
+	name := unix.SignalName(sig)
+	n, ok := linuxSignals[name]
+	if !ok {
+		return "", fmt.Errorf("signal %s does not exist in the guest", sig)
+	}
+
+	return fmt.Sprintf("kill -%d %d", n, pid), nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSignalCommand(t *testing.T) {
+	tests := []struct {
+		sig  syscall.Signal
+		want string
+	}{
+		{syscall.SIGTERM, "kill -15 1234"},
+		{syscall.SIGKILL, "kill -9 1234"},
+		{syscall.SIGHUP, "kill -1 1234"},
+		// the number differs from the darwin host
+		{syscall.SIGUSR1, "kill -10 1234"},
+	}
+
+	for _, tt := range tests {
+		got, err := signalCommand(1234, tt.sig)
+		if err != nil {
+			t.Errorf("signalCommand(%s): %v", tt.sig, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("signalCommand(%s) = %q, want %q", tt.sig, got, tt.want)
+		}
+	}
+
+	if _, err := signalCommand(1234, syscall.Signal(200)); err == nil {
+		t.Error("unknown signal accepted")
+	}
+}
+
+func TestSignalGuestRefusesAll(t *testing.T) {
+	c := &Context{}
+	for _, pid := range []int{-1, 0, -20} {
+		if err := c.SignalGuest(pid, syscall.SIGKILL); err == nil {
+			t.Errorf("pid %d accepted", pid)
+		}
+	}
+}
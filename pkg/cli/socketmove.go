@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// SocketMove is the body of PATCH /vm/socket-path, Sockets are the new paths by name in the response.
+type SocketMove struct {
+	SocketPath string            `json:"socketPath"`
+	Sockets    map[string]string `json:"sockets,omitempty"`
+}
+
+// movableSockets are the sockets used by clients, by name. The sockets between ovm and the VM
+// (network, initrd, ready, time sync, ssh auth) stay in the original directory.
+func (c *Context) movableSockets() map[string]*string {
+	sockets := map[string]*string{
+		"podman":  &c.ForwardSocketPath,
+		"restful": &c.RestfulSocketPath,
+		"console": &c.ConsoleSocketPath,
+		"agent":   &c.AgentSocketPath,
+	}
+	if c.DockerSocketPath != "" {
+		sockets["docker"] = &c.DockerSocketPath
+	}
+	for name, p := range sockets {
+		// disabled with -disable-sockets
+		if *p == "" {
+			delete(sockets, name)
+		}
+	}
+
+	return sockets
+}
+
+// MigrateSocketPath asks the running ovm to move its sockets into newBase, without stopping the VM.
+// The original paths become symlinks to the new ones, so clients which know only the old paths keep working.
+// SocketPath and the paths of the moved sockets of c are updated afterwards.
+func (c *Context) MigrateSocketPath(newBase string) error {
+	newBase, err := filepath.Abs(newBase)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(newBase, 0755); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(&SocketMove{SocketPath: newBase})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", c.RestfulSocketPath)
+			},
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, "http://ovm/vm/socket-path", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request ovm to move the sockets failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("move sockets failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var moved SocketMove
+	if err := json.NewDecoder(resp.Body).Decode(&moved); err != nil {
+		return fmt.Errorf("decode the moved sockets failed: %w", err)
+	}
+
+	sockets := c.movableSockets()
+	for name, p := range moved.Sockets {
+		old, ok := sockets[name]
+		if !ok || *old == p {
+			continue
+		}
+
+		if err := ensureSymlink(*old, p); err != nil {
+			return err
+		}
+		*old = p
+	}
+	c.SocketPath = newBase
+
+	return nil
+}
+
+// MoveSockets moves the sockets of clients into newBase, it is the server side of MigrateSocketPath.
+// The listeners keep working after a rename, so newBase must be on the same volume as the sockets.
+// The paths of c are not changed, they are read without locking, the original paths are symlinks to the moved sockets.
+func (c *Context) MoveSockets(newBase string) (map[string]string, error) {
+	c.socketMoveMu.Lock()
+	defer c.socketMoveMu.Unlock()
+
+	if !filepath.IsAbs(newBase) {
+		return nil, fmt.Errorf("socket path must be absolute: %s", newBase)
+	}
+	if err := os.MkdirAll(newBase, 0755); err != nil {
+		return nil, err
+	}
+
+	if c.movedSockets == nil {
+		c.movedSockets = map[string]string{}
+	}
+
+	result := map[string]string{}
+	for name, p := range c.movableSockets() {
+		original := *p
+		current := original
+		if moved, ok := c.movedSockets[name]; ok {
+			current = moved
+		}
+
+		// sockets which are not listening (e.g. docker before gvproxy started it) are not moved
+		if _, err := os.Lstat(current); err != nil {
+			continue
+		}
+
+		dst := path.Join(newBase, filepath.Base(original))
+		if dst == current {
+			result[name] = dst
+			continue
+		}
+
+		if err := os.Rename(current, dst); err != nil {
+			return nil, fmt.Errorf("move %s socket failed, the new path must be on the same volume: %w", name, err)
+		}
+		c.movedSockets[name] = dst
+		result[name] = dst
+
+		// clients of the original path and of an earlier move follow the socket
+		if dst != original {
+			if err := ensureSymlink(original, dst); err != nil {
+				return nil, err
+			}
+		}
+		if current != original {
+			if err := ensureSymlink(current, dst); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// ensureSymlink makes p a symlink to target, replacing what is at p.
+func ensureSymlink(p, target string) error {
+	if t, err := os.Readlink(p); err == nil && t == target {
+		return nil
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Symlink(target, p); err != nil {
+		return fmt.Errorf("create symlink %s failed: %w", p, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func socketContext(dir string) *Context {
+	return &Context{
+		SocketPath:        dir,
+		ForwardSocketPath: filepath.Join(dir, "vm-podman.sock"),
+		RestfulSocketPath: filepath.Join(dir, "vm-restful.sock"),
+		ConsoleSocketPath: filepath.Join(dir, "vm-console.sock"),
+		AgentSocketPath:   filepath.Join(dir, "vm-agent.sock"),
+	}
+}
+
+func mustDial(t *testing.T, p string) {
+	t.Helper()
+
+	conn, err := net.Dial("unix", p)
+	if err != nil {
+		t.Errorf("dial %s: %v", p, err)
+		return
+	}
+	_ = conn.Close()
+}
+
+func TestMigrateSocketPath(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ovm serving the sockets, the console and the agent sockets are not listening
+	server := socketContext(dir)
+	podman, err := net.Listen("unix", server.ForwardSocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer podman.Close()
+	go func() {
+		for {
+			conn, err := podman.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	restful, err := net.Listen("unix", server.RestfulSocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vm/socket-path", func(w http.ResponseWriter, r *http.Request) {
+		var move SocketMove
+		if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sockets, err := server.MoveSockets(move.SocketPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		move.Sockets = sockets
+		_ = json.NewEncoder(w).Encode(&move)
+	})
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(restful) }()
+	defer srv.Close()
+
+	client := socketContext(dir)
+	for _, next := range []string{"b", "c"} {
+		previous := client.ForwardSocketPath
+		if err := client.MigrateSocketPath(filepath.Join(root, next)); err != nil {
+			t.Fatalf("move to %s: %v", next, err)
+		}
+
+		want := filepath.Join(root, next, "vm-podman.sock")
+		if client.ForwardSocketPath != want || client.SocketPath != filepath.Join(root, next) {
+			t.Errorf("client paths %s, %s after the move to %s", client.SocketPath, client.ForwardSocketPath, next)
+		}
+		if _, err := os.Stat(filepath.Join(root, next, "vm-console.sock")); !os.IsNotExist(err) {
+			t.Errorf("a socket which is not listening was moved: %v", err)
+		}
+
+		// the original path and the one before the move follow the socket
+		for _, p := range []string{want, filepath.Join(dir, "vm-podman.sock"), previous} {
+			mustDial(t, p)
+			mustDial(t, filepath.Join(filepath.Dir(p), "vm-restful.sock"))
+		}
+	}
+
+	// the server keeps the original paths, they are symlinks now
+	if server.ForwardSocketPath != filepath.Join(dir, "vm-podman.sock") {
+		t.Errorf("server path changed to %s", server.ForwardSocketPath)
+	}
+	if _, err := server.MoveSockets("relative"); err == nil {
+		t.Error("moved the sockets to a relative path")
+	}
+}
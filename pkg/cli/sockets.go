@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The components whose sockets can be switched off with -disable-sockets.
+const (
+	SocketPodman   = "podman"
+	SocketRestful  = "restful"
+	SocketEvents   = "events"
+	SocketReady    = "ready"
+	SocketTimeSync = "timesync"
+	SocketSSHAuth  = "ssh-auth"
+	SocketNetwork  = "network"
+)
+
+// sshRestfulRoutes are the control routes which run commands in the guest via SSH.
+var sshRestfulRoutes = []string{"/bench", "/resize", "/storage/migrate", "/jobs"}
+
+// SocketComponents are all components, they are enabled by default.
+var SocketComponents = []string{SocketPodman, SocketRestful, SocketEvents, SocketReady, SocketTimeSync, SocketSSHAuth, SocketNetwork}
+
+func parseSocketComponents(name, v string) ([]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var result []string
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if !slices.Contains(SocketComponents, s) {
+			return nil, fmt.Errorf("%s: unknown socket %s, known sockets: %s", name, s, strings.Join(SocketComponents, ","))
+		}
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+// socketComponents returns the enabled components. -enable-sockets only enables the listed components,
+// -disable-sockets wins, e.g. -enable-sockets podman,network,ready serves nothing else.
+func socketComponents() (map[string]bool, error) {
+	enable, err := parseSocketComponents("enable-sockets", enableSockets)
+	if err != nil {
+		return nil, err
+	}
+	disable, err := parseSocketComponents("disable-sockets", disableSockets)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(enable) == 0 {
+		enable = SocketComponents
+	}
+
+	result := map[string]bool{}
+	for _, s := range enable {
+		result[s] = true
+	}
+	for _, s := range disable {
+		delete(result, s)
+	}
+
+	return result, nil
+}
+
+// validateSocketComponents rejects flags which need a disabled component.
+func validateSocketComponents() error {
+	enabled, err := socketComponents()
+	if err != nil {
+		return err
+	}
+
+	if exposeDockerSocket && !enabled[SocketPodman] {
+		return fmt.Errorf("expose-docker-socket needs the podman socket, it is disabled")
+	}
+	if enabled[SocketPodman] && !enabled[SocketNetwork] {
+		return fmt.Errorf("the podman socket is forwarded through the guest network, it needs the network socket, disable podman as well")
+	}
+	if !enabled[SocketReady] && !assumeReady {
+		return fmt.Errorf("without the ready socket the guest cannot report ready, pass -assume-ready as well")
+	}
+	if !enabled[SocketTimeSync] && maxDrift != 0 && driftCheckInterval != 0 {
+		return fmt.Errorf("-max-drift syncs the guest clock through the timesync socket, pass -max-drift=0 to only measure the drift")
+	}
+	if !enabled[SocketEvents] && eventSocketPath != "" {
+		return fmt.Errorf("event-socket-path cannot be used with the events socket disabled")
+	}
+	if !enabled[SocketRestful] && (restfulEnable != "" || restfulDisable != "") {
+		return fmt.Errorf("restful-enable and restful-disable cannot be used with the restful socket disabled")
+	}
+	if !enabled[SocketNetwork] {
+		return validateNoGuestNetwork()
+	}
+
+	return nil
+}
+
+// validateNoGuestNetwork rejects flags which need SSH to the guest or its network, SSH goes through the guest network.
+func validateNoGuestNetwork() error {
+	switch {
+	case shutdownCommand != "":
+		return fmt.Errorf("shutdown-command is run via ssh, it needs the network socket")
+	case len(watchGuestUnits) != 0:
+		return fmt.Errorf("watch-guest-unit reads the units via ssh, it needs the network socket")
+	case len(routes) != 0:
+		return fmt.Errorf("route cannot be used with the network socket disabled, the guest has no network")
+	case networkLatency != 0 || networkPacketLoss != 0:
+		return fmt.Errorf("network-latency and network-packet-loss cannot be used with the network socket disabled, the guest has no network")
+	}
+
+	served, _ := restfulRoutes()
+	for _, r := range sshRestfulRoutes {
+		if served[r] {
+			return fmt.Errorf("restful route %s runs commands in the guest via ssh, it needs the network socket, pass -restful-disable %s", r, r)
+		}
+	}
+
+	return nil
+}
+
+// SocketEnabled reports whether the socket of the component is created and its service started.
+// The events component has no socket of ovm, it is the client of -event-socket-path and GET /events.
+func (c *Context) SocketEnabled(component string) bool {
+	return c.Sockets[component]
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateNoGuestNetwork(t *testing.T) {
+	defer func(d string, a bool, s string, u guestUnitFlags, r routeFlags, l time.Duration, e string) {
+		disableSockets, assumeReady, shutdownCommand, watchGuestUnits, routes, networkLatency, restfulEnable = d, a, s, u, r, l, e
+	}(disableSockets, assumeReady, shutdownCommand, watchGuestUnits, routes, networkLatency, restfulEnable)
+
+	tests := []struct {
+		set  func()
+		want string
+	}{
+		{func() {}, ""},
+		{func() { shutdownCommand = "systemctl poweroff" }, "shutdown-command"},
+		{func() { watchGuestUnits = guestUnitFlags{"sshd.service"} }, "watch-guest-unit"},
+		{func() { routes = routeFlags{"10.0.0.0/8 via 192.168.127.254"} }, "route"},
+		{func() { networkLatency = 100 * time.Millisecond }, "network-latency"},
+		{func() { restfulEnable = "/jobs" }, "/jobs"},
+		{func() { restfulEnable = "all" }, "/bench"},
+		{func() { restfulEnable = "/stop,/pause" }, ""},
+	}
+
+	for _, tt := range tests {
+		disableSockets, assumeReady = "podman,network", true
+		shutdownCommand, watchGuestUnits, routes, networkLatency, restfulEnable = "", nil, nil, 0, ""
+		tt.set()
+
+		err := validateSocketComponents()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("want no error, got %v", err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("want an error about %s, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestRunInGuestWithoutNetwork(t *testing.T) {
+	c := &Context{Sockets: map[string]bool{SocketPodman: true}}
+	if _, err := c.RunInGuest("true"); !errors.Is(err, ErrNoGuestNetwork) {
+		t.Fatalf("RunInGuest: %v, want ErrNoGuestNetwork", err)
+	}
+}
+
+func TestEventsRouteNeedsEventsSocket(t *testing.T) {
+	c := &Context{
+		Sockets:       map[string]bool{SocketRestful: true},
+		RestfulRoutes: map[string]bool{"/events": true, "/info": true},
+	}
+	if c.RestfulRouteEnabled("/events") {
+		t.Error("/events is served with the events socket disabled")
+	}
+	if !c.RestfulRouteEnabled("/info") {
+		t.Error("/info is not served")
+	}
+}
+
+func TestExposeDockerSocket(t *testing.T) {
+	defer func(e bool, d, s, n string, a bool) {
+		exposeDockerSocket, disableSockets, socketPath, name, assumeReady = e, d, s, n, a
+	}(exposeDockerSocket, disableSockets, socketPath, name, assumeReady)
+
+	exposeDockerSocket, assumeReady = true, true
+	disableSockets = "podman"
+	if err := validateSocketComponents(); err == nil || !strings.Contains(err.Error(), "expose-docker-socket") {
+		t.Errorf("with the podman socket disabled: %v, want an error about expose-docker-socket", err)
+	}
+	disableSockets = ""
+	if err := validateSocketComponents(); err != nil {
+		t.Errorf("with the podman socket: %v", err)
+	}
+
+	socketPath, name = t.TempDir(), "vm"
+	c := &Context{Sockets: map[string]bool{SocketPodman: true, SocketNetwork: true}}
+	if err := c.socketPath(); err != nil {
+		t.Fatal(err)
+	}
+	if c.DockerSocketPath != filepath.Join(socketPath, "vm-docker.sock") {
+		t.Errorf("docker socket path = %q", c.DockerSocketPath)
+	}
+
+	exposeDockerSocket = false
+	c = &Context{Sockets: map[string]bool{SocketPodman: true, SocketNetwork: true}}
+	if err := c.socketPath(); err != nil {
+		t.Fatal(err)
+	}
+	if c.DockerSocketPath != "" {
+		t.Errorf("docker socket path %q without -expose-docker-socket", c.DockerSocketPath)
+	}
+}
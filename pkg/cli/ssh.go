@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshAcquireTimeout is how long RunInGuest waits for a connection while -max-ssh-sessions are in use.
+const sshAcquireTimeout = 30 * time.Second
+
+// sshDialTimeout bounds the dial and handshake of a connection when SSHConfig has no Timeout, it is not covered by sshAcquireTimeout.
+// It is a variable so tests do not wait for it.
+var sshDialTimeout = 10 * time.Second
+
+// ErrNoGuestNetwork is returned by RunInGuest with -disable-sockets network, the guest has no network to reach its sshd.
+var ErrNoGuestNetwork = errors.New("ssh to the guest needs the network socket, it is disabled")
+
+// RunInGuest runs the command as root in the guest via SSH and returns its stdout.
+// The connection is taken from the pool, so at most MaxSSHSessions commands run at the same time.
+func (c *Context) RunInGuest(command string) (string, error) {
+	if !c.SocketEnabled(SocketNetwork) {
+		return "", ErrNoGuestNetwork
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sshAcquireTimeout)
+	defer cancel()
+
+	client, err := c.sshPool.Acquire(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", fmt.Errorf("no ssh connection to the guest was free within %s, all -max-ssh-sessions are in use", sshAcquireTimeout)
+	} else if err != nil {
+		return "", err
+	}
+	defer c.sshPool.Release(client)
+
+	session, err := client.NewSession()
+	if err != nil {
+		// most likely the connection is gone, the pool dials again next time
+		_ = client.Close()
+		return "", fmt.Errorf("create ssh session failed: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(command); err != nil {
+		return stdout.String(), fmt.Errorf("run %q in guest failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// dialGuest opens a new ssh connection to the guest, as root unless SSHConfig says otherwise.
+func (c *Context) dialGuest() (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            "root",
+		HostKeyCallback: c.guestHostKey,
+		Timeout:         sshDialTimeout,
+	}
+	if c.SSHConfig != nil {
+		// copy it, the loaded key must not end up in the caller's config
+		v := *c.SSHConfig
+		config = &v
+		// an unresponsive guest must not block the pool slot forever
+		if config.Timeout == 0 {
+			config.Timeout = sshDialTimeout
+		}
+		if config.HostKeyCallback == nil {
+			config.HostKeyCallback = c.guestHostKey
+		} else {
+			// the key is still recorded by RecordGuestHostKey, after the caller's check accepted it
+			callback := config.HostKeyCallback
+			config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				if err := callback(hostname, remote, key); err != nil {
+					return err
+				}
+
+				c.hostKeyMu.Lock()
+				defer c.hostKeyMu.Unlock()
+				if c.hostKey == nil {
+					c.hostKey = key
+				}
+				return nil
+			}
+		}
+	}
+
+	if len(config.Auth) == 0 {
+		key, err := os.ReadFile(c.SSHPrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read ssh private key failed: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh private key failed: %w", err)
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(c.SSHPort))
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("ssh to guest failed: %w", err)
+	}
+
+	// gvproxy accepts the connection even if the sshd of the guest hangs, so the Timeout also covers the handshake,
+	// which ssh.Dial does not bound
+	_ = conn.SetDeadline(time.Now().Add(config.Timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh to guest failed: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// guestHostKey trusts the host key of the first connection, and requires the same key for all later connections of this process.
+// The guest generates its host key on first boot, so there is nothing to compare with before that.
+func (c *Context) guestHostKey(_ string, _ net.Addr, key ssh.PublicKey) error {
+	c.hostKeyMu.Lock()
+	defer c.hostKeyMu.Unlock()
+
+	if c.hostKey == nil {
+		c.hostKey = key
+		return nil
+	}
+
+	if !bytes.Equal(c.hostKey.Marshal(), key.Marshal()) {
+		return fmt.Errorf("guest host key changed")
+	}
+
+	return nil
+}
+
+// ShellQuote quotes s in single quotes, which sh, bash, zsh and fish take literally, e.g. for the guest shell.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
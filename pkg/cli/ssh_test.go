@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestShellQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh in PATH")
+	}
+
+	for _, v := range []string{"", "plain", "with space", "it's", `"double" and \back`, "$HOME `id` $(id) ;|&*?", "new\nline"} {
+		out, err := exec.Command(sh, "-c", "printf %s "+ShellQuote(v)).Output()
+		if err != nil {
+			t.Fatalf("%q: %v", v, err)
+		}
+		if string(out) != v {
+			t.Errorf("ShellQuote(%q) is read by the shell as %q", v, out)
+		}
+	}
+}
+
+func (d *sshTestServer) port() int {
+	return d.ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestDialGuestSSHConfig(t *testing.T) {
+	users := make(chan string, 4)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, _ []byte) (*ssh.Permissions, error) {
+			users <- conn.User()
+			return nil, nil
+		},
+	}
+	hostKey := testSigner(t)
+	config.AddHostKey(hostKey)
+	d := listenSSH(t, config)
+
+	checked := 0
+	reject := false
+	c := &Context{
+		SSHPort: d.port(),
+		SSHConfig: &ssh.ClientConfig{
+			User: "admin",
+			Auth: []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: func(_ string, _ net.Addr, _ ssh.PublicKey) error {
+				checked++
+				if reject {
+					return errors.New("rejected")
+				}
+				return nil
+			},
+		},
+	}
+
+	reject = true
+	if _, err := c.dialGuest(); err == nil {
+		t.Fatal("connected although the host key check of SSHConfig failed")
+	}
+	if c.hostKey != nil {
+		t.Error("a rejected host key was recorded")
+	}
+
+	reject = false
+	client, err := c.dialGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+
+	if checked != 2 {
+		t.Errorf("the host key check of SSHConfig ran %d times, want 2", checked)
+	}
+	if u := <-users; u != "admin" {
+		t.Errorf("user %q, want the user of SSHConfig", u)
+	}
+	if c.hostKey == nil || !bytes.Equal(c.hostKey.Marshal(), hostKey.PublicKey().Marshal()) {
+		t.Error("the accepted host key was not recorded")
+	}
+	if len(c.SSHConfig.Auth) != 1 || c.SSHConfig.User != "admin" {
+		t.Errorf("SSHConfig was changed: %+v", c.SSHConfig)
+	}
+}
+
+func TestDialGuestSSHConfigCiphers(t *testing.T) {
+	// the only cipher of the server is not one of the default ciphers of the client
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.Ciphers = []string{"aes128-cbc"}
+	config.AddHostKey(testSigner(t))
+	d := listenSSH(t, config)
+
+	newContext := func(ciphers []string) *Context {
+		clientConfig := &ssh.ClientConfig{
+			User:            "root",
+			Auth:            []ssh.AuthMethod{ssh.Password("")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}
+		clientConfig.Ciphers = ciphers
+		return &Context{SSHPort: d.port(), SSHConfig: clientConfig}
+	}
+
+	if _, err := newContext(nil).dialGuest(); err == nil {
+		t.Fatal("connected with the default ciphers, the server only accepts aes128-cbc")
+	}
+
+	client, err := newContext([]string{"aes256-gcm@openssh.com", "aes128-cbc"}).dialGuest()
+	if err != nil {
+		t.Fatalf("dial with the ciphers of SSHConfig: %v", err)
+	}
+	_ = client.Close()
+}
+
+func TestDialGuestSSHConfigTimeout(t *testing.T) {
+	defer func(d time.Duration) { sshDialTimeout = d }(sshDialTimeout)
+	sshDialTimeout = 100 * time.Millisecond
+
+	// accepts connections but never answers the handshake, like a guest which hangs
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	// only the ciphers are set, the Timeout of SSHConfig is zero
+	clientConfig := &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password("")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	clientConfig.Ciphers = []string{"aes128-ctr"}
+	c := &Context{SSHPort: ln.Addr().(*net.TCPAddr).Port, SSHConfig: clientConfig}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.dialGuest()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("connected to a server which never answered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dial did not time out")
+	}
+	if c.SSHConfig.Timeout != 0 {
+		t.Errorf("SSHConfig was changed: Timeout %s", c.SSHConfig.Timeout)
+	}
+}
+
+func TestDialGuestHostKeyChanged(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "ovm")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(mustMarshalPrivateKey(t)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	first := newSSHTestServer(t)
+	c := &Context{SSHPort: first.port(), SSHPrivateKeyPath: keyPath}
+	client, err := c.dialGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+
+	// another server on the port, e.g. the guest was replaced
+	c.SSHPort = newSSHTestServer(t).port()
+	if _, err := c.dialGuest(); err == nil || !strings.Contains(err.Error(), "guest host key changed") {
+		t.Errorf("got %v, want the changed host key refused", err)
+	}
+}
+
+func mustMarshalPrivateKey(t *testing.T) *pem.Block {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
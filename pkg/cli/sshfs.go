@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+var ErrSSHFSNotFound = errors.New("sshfs not found in PATH, install macFUSE and sshfs")
+
+// lookPath finds the sshfs binary, tests replace it
+var lookPath = exec.LookPath
+
+// MountGuestDir mounts guestPath of the guest on localMountPoint via sshfs.
+func (c *Context) MountGuestDir(guestPath, localMountPoint string) error {
+	sshfs, err := lookPath("sshfs")
+	if err != nil {
+		return ErrSSHFSNotFound
+	}
+
+	if err := os.MkdirAll(localMountPoint, 0755); err != nil {
+		return err
+	}
+
+	knownHosts, err := c.writeKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	// the port is shared by all VMs over time, so the key is checked against this VM's own file and not ~/.ssh/known_hosts
+	out, err := exec.Command(sshfs,
+		"-o", "IdentityFile="+c.SSHPrivateKeyPath,
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile="+knownHosts,
+		"-p", strconv.Itoa(c.SSHPort),
+		"root@127.0.0.1:"+guestPath,
+		localMountPoint,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sshfs failed: %w: %s", err, out)
+	}
+
+	return nil
+}
+
+// writeKnownHosts writes the known_hosts file of the guest next to the ssh private key and returns its path.
+// The key seen by the ssh connection of this process is preferred, then the one recorded in versions.json.
+// The file is kept, sshfs reads it again when it reconnects.
+func (c *Context) writeKnownHosts() (string, error) {
+	c.hostKeyMu.Lock()
+	key := c.hostKey
+	c.hostKeyMu.Unlock()
+
+	if key == nil {
+		k, err := ReadGuestHostKey(c.VersionsPath)
+		if err != nil {
+			return "", fmt.Errorf("read guest host key failed: %w", err)
+		}
+		key = k
+	}
+
+	p := c.SSHPrivateKeyPath + ".known_hosts"
+	if err := utils.WriteFileAtomic(p, []byte(KnownHostsLine(key, c.SSHPort)+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("write known_hosts failed: %w", err)
+	}
+
+	return p, nil
+}
+
+// UnmountGuestDir unmounts a directory mounted by MountGuestDir.
+func (c *Context) UnmountGuestDir(localMountPoint string) error {
+	if out, err := exec.Command("diskutil", "unmount", localMountPoint).CombinedOutput(); err != nil {
+		return fmt.Errorf("unmount %s failed: %w: %s", localMountPoint, err, out)
+	}
+
+	return nil
+}
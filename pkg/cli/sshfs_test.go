@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestWriteKnownHosts(t *testing.T) {
+	dir := t.TempDir()
+	c := &Context{
+		SSHPort:           2222,
+		SSHPrivateKeyPath: filepath.Join(dir, "ovm"),
+		VersionsPath:      filepath.Join(dir, "versions.json"),
+	}
+
+	if err := os.WriteFile(c.VersionsPath, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.writeKnownHosts(); !errors.Is(err, ErrNoHostKey) {
+		t.Fatalf("no recorded key: %v, want ErrNoHostKey", err)
+	}
+
+	recorded := testHostKey(t)
+	data, err := json.Marshal(&versionsJSON{HostKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(recorded)))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.VersionsPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want, other ssh.PublicKey) {
+		t.Helper()
+
+		p, err := c.writeKnownHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback, err := knownhosts.New(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: c.SSHPort}
+		if err := callback("127.0.0.1:2222", addr, want); err != nil {
+			t.Errorf("expected key rejected: %v", err)
+		}
+		if err := callback("127.0.0.1:2222", addr, other); err == nil {
+			t.Errorf("another key accepted")
+		}
+	}
+
+	seen := testHostKey(t)
+	check(recorded, seen)
+
+	// the key of the running connection wins over the recorded one
+	c.hostKey = seen
+	check(seen, recorded)
+}
+
+func TestMountGuestDirSSHFSNotFound(t *testing.T) {
+	defer func(f func(string) (string, error)) { lookPath = f }(lookPath)
+	lookPath = func(string) (string, error) {
+		return "", exec.ErrNotFound
+	}
+
+	dir := t.TempDir()
+	c := &Context{SSHPrivateKeyPath: filepath.Join(dir, "ovm"), SSHPort: 2222}
+	mountPoint := filepath.Join(dir, "mnt")
+	if err := c.MountGuestDir("/root", mountPoint); !errors.Is(err, ErrSSHFSNotFound) {
+		t.Fatalf("MountGuestDir() = %v, want ErrSSHFSNotFound", err)
+	}
+
+	// nothing is left behind for a mount which never ran
+	if _, err := os.Stat(mountPoint); !os.IsNotExist(err) {
+		t.Errorf("the mount point was created: %v", err)
+	}
+	if _, err := os.Stat(c.SSHPrivateKeyPath + ".known_hosts"); !os.IsNotExist(err) {
+		t.Errorf("known_hosts was written: %v", err)
+	}
+}
+
+func TestMountGuestDir(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	sshfs := filepath.Join(dir, "sshfs")
+	if err := os.WriteFile(sshfs, []byte("#!/bin/sh\necho \"$@\" > "+args+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(f func(string) (string, error)) { lookPath = f }(lookPath)
+	lookPath = func(file string) (string, error) {
+		if file != "sshfs" {
+			return "", exec.ErrNotFound
+		}
+		return sshfs, nil
+	}
+
+	c := &Context{SSHPrivateKeyPath: filepath.Join(dir, "ovm"), SSHPort: 2222, hostKey: testHostKey(t)}
+	mountPoint := filepath.Join(dir, "mnt")
+	if err := c.MountGuestDir("/root", mountPoint); err != nil {
+		t.Fatal(err)
+	}
+
+	if stat, err := os.Stat(mountPoint); err != nil || !stat.IsDir() {
+		t.Errorf("the mount point was not created: %v", err)
+	}
+
+	data, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-o IdentityFile=" + c.SSHPrivateKeyPath + " -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + c.SSHPrivateKeyPath + ".known_hosts -p 2222 root@127.0.0.1:/root " + mountPoint
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("sshfs %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/oomol-lab/ovm/pkg/utils"
+)
+
+var ErrSSHKeyAliased = errors.New("the ssh key is used by another instance with the same name")
+
+// sshKeyOwner records which instance generated the keys of a name in the ssh key path.
+type sshKeyOwner struct {
+	TargetPath     string `json:"targetPath"`
+	ExecutablePath string `json:"executablePath"`
+}
+
+// MarshalJSON writes the current schema of the owner file, see sshKeyOwnerSchema.
+func (o sshKeyOwner) MarshalJSON() ([]byte, error) {
+	type plain sshKeyOwner
+	return withSchema(sshKeyOwnerSchema.current(), plain(o))
+}
+
+func sshKeyOwnerPath(sshKeyPath, name string) string {
+	return path.Join(sshKeyPath, name+".owner")
+}
+
+// lockSSHKeys serializes the generation and validation of the keys of a name between processes sharing the ssh key path.
+// The lock file is kept, removing it would let a waiting process lock a file nobody else sees.
+func (c *Context) lockSSHKeys() (unlock func(), err error) {
+	fh, err := os.OpenFile(path.Join(c.SSHKeyPath, "."+name+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create ssh key lock failed: %w", err)
+	}
+
+	if err := syscall.Flock(int(fh.Fd()), syscall.LOCK_EX); err != nil {
+		_ = fh.Close()
+		return nil, fmt.Errorf("lock ssh keys failed: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+		_ = fh.Close()
+	}, nil
+}
+
+// checkSSHKeyOwner fails if the keys of this name were generated for a target path other than tp,
+// the instances would use (and on regeneration replace) each other's keys.
+// Keys without an owner, e.g. generated by older versions, are taken over.
+func (c *Context) checkSSHKeyOwner(tp string) error {
+	return claimSSHKeys(sshKeyOwnerPath(c.SSHKeyPath, name), c.SSHPrivateKeyPath, sshKeyOwner{
+		TargetPath:     tp,
+		ExecutablePath: c.ExecutablePath,
+	})
+}
+
+// claimSSHKeys records self as the owner in p, unless the keys belong to another target path.
+// The executable is only informational: an upgraded or moved ovm binary keeps the keys of its target path.
+func claimSSHKeys(p, keyPath string, self sshKeyOwner) error {
+	if data, err := os.ReadFile(p); err == nil {
+		owner := sshKeyOwner{}
+		if err := json.Unmarshal(data, &owner); err == nil {
+			if owner == self {
+				return nil
+			}
+			if owner.TargetPath != self.TargetPath {
+				return fmt.Errorf("%w: %s belongs to target path %s (executable %s), this instance has %s (%s); use another -name or -ssh-key-path, or remove %s if the instance was moved",
+					ErrSSHKeyAliased, keyPath, owner.TargetPath, owner.ExecutablePath, self.TargetPath, self.ExecutablePath, p)
+			}
+		}
+	}
+
+	data, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(p, data, 0644)
+}
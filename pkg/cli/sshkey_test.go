@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestClaimSSHKeys(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "ovm.owner")
+	first := sshKeyOwner{TargetPath: "/data/a", ExecutablePath: "/Applications/A.app/ovm"}
+
+	if err := claimSSHKeys(p, "key", first); err != nil {
+		t.Fatalf("claim keys without an owner: %v", err)
+	}
+	if err := claimSSHKeys(p, "key", first); err != nil {
+		t.Fatalf("claim own keys again: %v", err)
+	}
+
+	upgraded := sshKeyOwner{TargetPath: "/data/a", ExecutablePath: "/usr/local/bin/ovm"}
+	if err := claimSSHKeys(p, "key", upgraded); err != nil {
+		t.Fatalf("another executable of the same target path: %v", err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := sshKeyOwner{}
+	if err := json.Unmarshal(data, &owner); err != nil || owner != upgraded {
+		t.Errorf("owner %+v, %v, want the new executable recorded", owner, err)
+	}
+
+	other := sshKeyOwner{TargetPath: "/data/b", ExecutablePath: "/usr/local/bin/ovm"}
+	if err := claimSSHKeys(p, "key", other); !errors.Is(err, ErrSSHKeyAliased) {
+		t.Errorf("another target path: %v, want ErrSSHKeyAliased", err)
+	}
+}
+
+// runSSHKeys runs the ssh key step of two instances at the same time on one ssh key path.
+func runSSHKeys(t *testing.T, keyPath string, targetPaths [2]string) (contexts [2]*Context, errs [2]error) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := range contexts {
+		contexts[i] = &Context{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = contexts[i].sshKeys(keyPath, targetPaths[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return contexts, errs
+}
+
+func TestSSHKeysConcurrent(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	defer func(n string) { name = n }(name)
+	name = "ovm"
+
+	// a few rounds, the calls race for the generation of the keys
+	for round := 0; round < 5; round++ {
+		keyPath := t.TempDir()
+		contexts, errs := runSSHKeys(t, keyPath, [2]string{"/data/a", "/data/a"})
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("round %d, call %d: %v", round, i, err)
+			}
+		}
+
+		if contexts[0].SSHPublicKey != contexts[1].SSHPublicKey {
+			t.Fatalf("round %d: the calls see different public keys:\n%s\n%s", round, contexts[0].SSHPublicKey, contexts[1].SSHPublicKey)
+		}
+
+		// the public key is complete and belongs to the private key on disk
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(contexts[0].SSHPublicKey))
+		if err != nil {
+			t.Fatalf("round %d: parse public key %q: %v", round, contexts[0].SSHPublicKey, err)
+		}
+		data, err := os.ReadFile(contexts[0].SSHPrivateKeyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			t.Fatalf("round %d: parse private key: %v", round, err)
+		}
+		if string(signer.PublicKey().Marshal()) != string(pub.Marshal()) {
+			t.Errorf("round %d: the public key does not belong to the private key", round)
+		}
+	}
+}
+
+func TestSSHKeysConcurrentAliased(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	defer func(n string) { name = n }(name)
+	name = "ovm"
+
+	for round := 0; round < 5; round++ {
+		_, errs := runSSHKeys(t, t.TempDir(), [2]string{"/data/a", "/data/b"})
+
+		aliased := 0
+		for _, err := range errs {
+			switch {
+			case errors.Is(err, ErrSSHKeyAliased):
+				aliased++
+			case err != nil:
+				t.Fatalf("round %d: %v", round, err)
+			}
+		}
+		if aliased != 1 {
+			t.Errorf("round %d: %d calls failed with ErrSSHKeyAliased, want 1: %v", round, aliased, errs)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxIdleSSHConnections are kept open for reuse, more released connections are closed.
+const maxIdleSSHConnections = 4
+
+// SSHSessionPool reuses the ssh connections to the guest, and keeps at most max of them in use at the same time.
+type SSHSessionPool struct {
+	dial func() (*ssh.Client, error)
+	// slots is nil when the number of connections is unlimited
+	slots chan struct{}
+
+	mu   sync.Mutex
+	idle []*ssh.Client
+}
+
+// NewSSHSessionPool creates a pool which connects with dial, max 0 is unlimited.
+func NewSSHSessionPool(max int, dial func() (*ssh.Client, error)) *SSHSessionPool {
+	p := &SSHSessionPool{
+		dial: dial,
+	}
+	if max > 0 {
+		p.slots = make(chan struct{}, max)
+	}
+
+	return p
+}
+
+// Acquire returns an idle connection or dials a new one, it blocks while max connections are in use.
+// The connection must be given back with Release.
+func (p *SSHSessionPool) Acquire(ctx context.Context) (*ssh.Client, error) {
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		p.mu.Lock()
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		client := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		// the guest may have closed the connection (e.g. it rebooted) since it was released
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+			return client, nil
+		}
+		_ = client.Close()
+	}
+
+	client, err := p.dial()
+	if err != nil {
+		p.releaseSlot()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Release gives the connection back to the pool and unblocks a waiting Acquire.
+// Broken connections can be released as well, they are closed on the next Acquire.
+// Beyond maxIdleSSHConnections idle connections, the connection is closed instead.
+func (p *SSHSessionPool) Release(client *ssh.Client) {
+	p.mu.Lock()
+	keep := len(p.idle) < maxIdleSSHConnections
+	if keep {
+		p.idle = append(p.idle, client)
+	}
+	p.mu.Unlock()
+
+	if !keep {
+		_ = client.Close()
+	}
+
+	p.releaseSlot()
+}
+
+func (p *SSHSessionPool) releaseSlot() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
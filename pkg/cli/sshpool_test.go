@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTestServer is a local ssh server counting its open connections.
+type sshTestServer struct {
+	ln   net.Listener
+	open atomic.Int32
+}
+
+func newSSHTestServer(t *testing.T) *sshTestServer {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(testSigner(t))
+
+	return listenSSH(t, config)
+}
+
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// listenSSH serves the config on a local port.
+func listenSSH(t *testing.T, config *ssh.ServerConfig) *sshTestServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	d := &sshTestServer{ln: ln}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(nc, config)
+		}
+	}()
+	return d
+}
+
+func (d *sshTestServer) serve(nc net.Conn, config *ssh.ServerConfig) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		return
+	}
+	d.open.Add(1)
+	defer d.open.Add(-1)
+
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		for ch := range chans {
+			_ = ch.Reject(ssh.Prohibited, "no channels")
+		}
+	}()
+	_ = conn.Wait()
+}
+
+func (d *sshTestServer) dial() (*ssh.Client, error) {
+	return ssh.Dial("tcp", d.ln.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+func (d *sshTestServer) waitOpen(want int32) int32 {
+	deadline := time.Now().Add(time.Second)
+	for d.open.Load() != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return d.open.Load()
+}
+
+func TestSSHSessionPoolIdleCap(t *testing.T) {
+	d := newSSHTestServer(t)
+	p := NewSSHSessionPool(0, d.dial)
+
+	var clients []*ssh.Client
+	for i := 0; i < 10; i++ {
+		c, err := p.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+	}
+	if n := d.waitOpen(10); n != 10 {
+		t.Fatalf("%d connections open, want 10", n)
+	}
+
+	for _, c := range clients {
+		p.Release(c)
+	}
+	if len(p.idle) != maxIdleSSHConnections {
+		t.Errorf("%d idle connections, want %d", len(p.idle), maxIdleSSHConnections)
+	}
+	if n := d.waitOpen(maxIdleSSHConnections); n != maxIdleSSHConnections {
+		t.Errorf("%d connections open, want the %d idle ones", n, maxIdleSSHConnections)
+	}
+
+	// the idle connections are reused
+	c, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(c)
+	if n := d.waitOpen(maxIdleSSHConnections); n != maxIdleSSHConnections {
+		t.Errorf("%d connections open after reuse, want %d", n, maxIdleSSHConnections)
+	}
+}
+
+func TestSSHSessionPoolAcquireDeadline(t *testing.T) {
+	d := newSSHTestServer(t)
+	p := NewSSHSessionPool(1, d.dial)
+
+	held, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire with all slots in use: %v, want a deadline error", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c, err := p.Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		p.Release(c)
+	}()
+	p.Release(held)
+	wg.Wait()
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SwapStats is the swap of the guest, including swap the image set up itself.
+type SwapStats struct {
+	// ConfiguredBytes is the size of the -guest-swap file, 0 when off
+	ConfiguredBytes uint64 `json:"configuredBytes"`
+	TotalBytes      uint64 `json:"totalBytes"`
+	UsedBytes       uint64 `json:"usedBytes"`
+}
+
+// GuestStats is measured in the guest on request.
+type GuestStats struct {
+	Swap SwapStats `json:"swap"`
+	// Ulimits are the effective default limits of the services in the guest, not set when the guest has no systemd
+	Ulimits []GuestUlimit `json:"ulimits,omitempty"`
+}
+
+// GuestStats reads the stats of the guest via SSH.
+func (c *Context) GuestStats() (*GuestStats, error) {
+	out, err := c.RunInGuest("cat /proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	info := parseMeminfo(out)
+	total, ok := info["SwapTotal"]
+	if !ok {
+		return nil, fmt.Errorf("no SwapTotal in /proc/meminfo")
+	}
+
+	return &GuestStats{
+		Swap: SwapStats{
+			ConfiguredBytes: c.GuestSwapBytes,
+			TotalBytes:      total,
+			UsedBytes:       total - min(info["SwapFree"], total),
+		},
+		Ulimits: c.guestUlimits(),
+	}, nil
+}
+
+// guestUlimits asks systemd for the default limits of all resources of -guest-ulimit.
+func (c *Context) guestUlimits() []GuestUlimit {
+	names := make([]string, 0, len(ulimitResources))
+	for name := range ulimitResources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	command := "systemctl show"
+	for _, name := range names {
+		key := ulimitResources[name]
+		command += fmt.Sprintf(" -p DefaultLimit%[1]s -p DefaultLimit%[1]sSoft", key)
+	}
+
+	out, err := c.RunInGuest(command)
+	if err != nil {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if k, v, found := strings.Cut(strings.TrimSpace(line), "="); found {
+			values[k] = v
+		}
+	}
+
+	var result []GuestUlimit
+	for _, name := range names {
+		key := ulimitResources[name]
+		hard, ok := values["DefaultLimit"+key]
+		if !ok {
+			continue
+		}
+		result = append(result, GuestUlimit{
+			Name: name,
+			Soft: values["DefaultLimit"+key+"Soft"],
+			Hard: hard,
+		})
+	}
+
+	return result
+}
+
+// parseMeminfo returns the values of /proc/meminfo in bytes.
+func parseMeminfo(s string) map[string]uint64 {
+	result := map[string]uint64{}
+	for _, line := range strings.Split(s, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		result[key] = n
+	}
+
+	return result
+}
@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStorageMigrationRunning = errors.New("a storage migration is running")
+	ErrStorageOnDataDisk       = errors.New("the container storage is on the data disk already")
+	ErrInsufficientSpace       = errors.New("not enough free space on the data disk")
+)
+
+const (
+	// guestStoragePath is the default graphroot, on the data disk
+	guestStoragePath = "/var/lib/containers/storage"
+	guestStorageConf = "/etc/containers/storage.conf"
+	guestDataDisk    = "/dev/vdc"
+	guestDataMount   = "/var/lib/containers"
+	// storageMigrationState is on the data disk and holds the source of a migration until it is done, so it can be resumed
+	storageMigrationState = "/var/lib/containers/.ovm-storage-migration"
+
+	storageProgressInterval = 2 * time.Second
+)
+
+// States of a StorageMigration.
+const (
+	StorageMigrationRunning = "running"
+	StorageMigrationDone    = "done"
+	StorageMigrationFailed  = "failed"
+)
+
+// StorageStatus is where podman in the guest keeps its images and containers.
+type StorageStatus struct {
+	GraphRoot string `json:"graphRoot"`
+	// Device is the block device the graphroot is on, the data disk is /dev/vdc
+	Device     string `json:"device"`
+	OnDataDisk bool   `json:"onDataDisk"`
+	// Interrupted is the source of a migration which did not finish, migrating again resumes it
+	Interrupted string `json:"interrupted,omitempty"`
+	// Migration is the last migration of this process
+	Migration *StorageMigration `json:"migration,omitempty"`
+}
+
+// StorageMigration is the progress of moving the container storage to the data disk.
+type StorageMigration struct {
+	State string `json:"state"`
+	// Step is one of stop-podman, copy, rewrite-config, cleanup or start-podman
+	Step        string `json:"step"`
+	Source      string `json:"source"`
+	CopiedBytes uint64 `json:"copiedBytes"`
+	TotalBytes  uint64 `json:"totalBytes"`
+	Error       string `json:"error,omitempty"`
+}
+
+// CheckStorage reads the graphroot of storage.conf in the guest, and whether it is on the data disk.
+func (c *Context) CheckStorage() (*StorageStatus, error) {
+	script := fmt.Sprintf(`gr=$(sed -n -E 's/^graphroot *= *"(.*)"/\1/p' %[1]s 2>/dev/null | head -n1); gr=${gr:-%[2]s}; echo "$gr"; `+
+		`p=$gr; while [ ! -e "$p" ]; do p=$(dirname "$p"); done; df -P "$p" | awk 'NR==2 {print $1}'; `+
+		`cat %[3]s 2>/dev/null; true`, guestStorageConf, guestStoragePath, storageMigrationState)
+	out, err := c.RunInGuest(script)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected output of the storage check: %q", out)
+	}
+
+	s := &StorageStatus{
+		GraphRoot:  strings.TrimSpace(lines[0]),
+		Device:     strings.TrimSpace(lines[1]),
+		OnDataDisk: strings.TrimSpace(lines[1]) == guestDataDisk,
+	}
+	if len(lines) > 2 {
+		s.Interrupted = strings.TrimSpace(lines[2])
+	}
+
+	c.storageMu.Lock()
+	if c.storageMigration != nil {
+		m := *c.storageMigration
+		s.Migration = &m
+	}
+	c.storageMu.Unlock()
+
+	return s, nil
+}
+
+// StartStorageMigration moves the container storage to the data disk in the background, progress is called after every change.
+// podman is stopped while its storage is copied, storage.conf is pointed at the copy and podman is started again.
+// An interrupted migration is resumed, the files copied before are kept.
+func (c *Context) StartStorageMigration(progress func(m StorageMigration)) error {
+	c.storageMu.Lock()
+	if c.storageMigration != nil && c.storageMigration.State == StorageMigrationRunning {
+		c.storageMu.Unlock()
+		return ErrStorageMigrationRunning
+	}
+	m := &StorageMigration{State: StorageMigrationRunning, Step: "check"}
+	c.storageMigration = m
+	c.storageMu.Unlock()
+
+	if err := c.checkStorageMigration(m); err != nil {
+		c.updateStorageMigration(m, progress, func() {
+			m.State = StorageMigrationFailed
+			m.Error = err.Error()
+		})
+		return err
+	}
+
+	go c.migrateStorage(m, progress)
+	return nil
+}
+
+// checkStorageMigration finds the source and verifies the data disk can hold what is not copied yet.
+func (c *Context) checkStorageMigration(m *StorageMigration) error {
+	s, err := c.CheckStorage()
+	if err != nil {
+		return err
+	}
+
+	source := s.Interrupted
+	if source == "" {
+		if s.OnDataDisk {
+			return ErrStorageOnDataDisk
+		}
+		source = s.GraphRoot
+		if !strings.HasPrefix(source, "/") || source == "/" {
+			return fmt.Errorf("unexpected graphroot %q", source)
+		}
+
+		if out, err := c.RunInGuest(fmt.Sprintf("ls -A %s 2>/dev/null; true", guestStoragePath)); err != nil {
+			return err
+		} else if strings.TrimSpace(out) != "" {
+			return fmt.Errorf("%s on the data disk is not empty, move it away before migrating %s", guestStoragePath, source)
+		}
+	}
+
+	total, err := c.guestDiskUsage(source)
+	if err != nil {
+		return err
+	}
+	copied, err := c.guestDiskUsage(guestStoragePath)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.RunInGuest(fmt.Sprintf(`df -Pk %s | awk 'NR==2 {print $4}'`, guestDataMount))
+	if err != nil {
+		return err
+	}
+	avail, err := strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected output of df: %q", out)
+	}
+	avail *= 1024
+
+	// keep some room, the filesystem needs space for its own metadata
+	need := uint64(0)
+	if total > copied {
+		need = (total - copied) + (total-copied)/10
+	}
+	if avail < need {
+		return fmt.Errorf("%w: %d bytes needed, %d bytes free", ErrInsufficientSpace, need, avail)
+	}
+
+	c.storageMu.Lock()
+	m.Source = source
+	m.TotalBytes = total
+	m.CopiedBytes = copied
+	c.storageMu.Unlock()
+
+	return nil
+}
+
+func (c *Context) migrateStorage(m *StorageMigration, progress func(m StorageMigration)) {
+	steps := []struct {
+		name    string
+		command string
+	}{
+		{"stop-podman", fmt.Sprintf("echo %s > %s && systemctl stop podman.socket podman.service", ShellQuote(m.Source), storageMigrationState)},
+		// the source is gone if cleanup was interrupted
+		{"copy", fmt.Sprintf(`test -d %[1]s || exit 0; mkdir -p %[2]s && if command -v rsync >/dev/null; then rsync -aHAX %[1]s/ %[2]s/; else cp -a %[1]s/. %[2]s/; fi`, ShellQuote(m.Source), guestStoragePath)},
+		{"rewrite-config", fmt.Sprintf(`sed -i -E 's|^graphroot *=.*|graphroot = "%s"|' %s`, guestStoragePath, guestStorageConf)},
+		{"cleanup", fmt.Sprintf("rm -rf %s && rm -f %s", ShellQuote(m.Source), storageMigrationState)},
+		{"start-podman", "systemctl start podman.socket"},
+	}
+
+	for _, step := range steps {
+		c.updateStorageMigration(m, progress, func() {
+			m.Step = step.name
+		})
+
+		var err error
+		if step.name == "copy" {
+			err = c.copyStorage(m, progress, step.command)
+		} else {
+			_, err = c.RunInGuest(step.command)
+		}
+
+		// storage.conf is rewritten by every ignition, the rootfs may discard the change on reboot
+		if err == nil && step.name == "rewrite-config" {
+			err = MarkStorageMigrated(c.VersionsPath)
+		}
+
+		if err != nil {
+			// storage.conf is only rewritten after the copy, so podman runs with a complete storage either way
+			if step.name != "start-podman" {
+				_, _ = c.RunInGuest("systemctl start podman.socket")
+			}
+			c.updateStorageMigration(m, progress, func() {
+				m.State = StorageMigrationFailed
+				m.Error = err.Error()
+			})
+			return
+		}
+	}
+
+	c.updateStorageMigration(m, progress, func() {
+		m.State = StorageMigrationDone
+		m.CopiedBytes = m.TotalBytes
+	})
+}
+
+// copyStorage runs the copy, and reports the size of the copy every storageProgressInterval until it is done.
+func (c *Context) copyStorage(m *StorageMigration, progress func(m StorageMigration), command string) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(storageProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if copied, err := c.guestDiskUsage(guestStoragePath); err == nil {
+				c.updateStorageMigration(m, progress, func() {
+					m.CopiedBytes = copied
+				})
+			}
+		}
+	}()
+
+	_, err := c.RunInGuest(command)
+	return err
+}
+
+func (c *Context) updateStorageMigration(m *StorageMigration, progress func(m StorageMigration), update func()) {
+	c.storageMu.Lock()
+	update()
+	v := *m
+	c.storageMu.Unlock()
+
+	if progress != nil {
+		progress(v)
+	}
+}
+
+// guestDiskUsage returns the bytes used by the directory in the guest, 0 if it does not exist.
+func (c *Context) guestDiskUsage(p string) (uint64, error) {
+	out, err := c.RunInGuest(fmt.Sprintf(`test -e %[1]s || { echo 0; exit 0; }; du -sxk %[1]s | cut -f1`, ShellQuote(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	kib, err := strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of du: %q", out)
+	}
+
+	return kib * 1024, nil
+}
+
+// MarkStorageMigrated records that the container storage was moved to the data disk, the ignition configures it on every boot.
+func MarkStorageMigrated(p string) error {
+	return updateVersions(p, func(v *versionsJSON) bool {
+		if v.StorageMigrated {
+			return false
+		}
+		v.StorageMigrated = true
+		return true
+	})
+}
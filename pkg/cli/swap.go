@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	GuestSwapOff  = "off"
+	GuestSwapAuto = "auto"
+
+	// maxAutoGuestSwap caps the size of -guest-swap auto
+	maxAutoGuestSwap = 4 * 1024 * 1024 * 1024
+)
+
+var sizeUnits = map[string]uint64{
+	"M":   1024 * 1024,
+	"MiB": 1024 * 1024,
+	"G":   1024 * 1024 * 1024,
+	"GiB": 1024 * 1024 * 1024,
+}
+
+// parseGuestSwap returns the size of the swap file in bytes, 0 is off.
+// auto is the memory of the VM, at most 4 GiB.
+func parseGuestSwap(v string, memoryBytes uint64) (uint64, error) {
+	switch v {
+	case GuestSwapOff:
+		return 0, nil
+	case GuestSwapAuto:
+		return min(memoryBytes, maxAutoGuestSwap), nil
+	}
+
+	if size, ok := parseSize(v); ok {
+		return size, nil
+	}
+
+	return 0, fmt.Errorf("guest-swap must be off, auto or a size like 512M or 2G")
+}
+
+// parseSize parses a size like 512M or 2G into bytes, sizes must not be zero.
+func parseSize(v string) (uint64, bool) {
+	for unit, factor := range sizeUnits {
+		n, found := strings.CutSuffix(v, unit)
+		if !found {
+			continue
+		}
+
+		size, err := strconv.ParseUint(n, 10, 64)
+		if err != nil || size == 0 {
+			return 0, false
+		}
+		return size * factor, true
+	}
+
+	return 0, false
+}
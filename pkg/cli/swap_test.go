@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import "testing"
+
+func TestParseGuestSwap(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		v       string
+		memory  uint64
+		want    uint64
+		wantErr bool
+	}{
+		{GuestSwapOff, 2048 * mib, 0, false},
+		{GuestSwapAuto, 2048 * mib, 2048 * mib, false},
+		{GuestSwapAuto, 16 * 1024 * mib, maxAutoGuestSwap, false},
+		{"512M", 0, 512 * mib, false},
+		{"512MiB", 0, 512 * mib, false},
+		{"2G", 0, 2048 * mib, false},
+		{"2GiB", 0, 2048 * mib, false},
+		{"0G", 0, 0, true},
+		{"512", 0, 0, true},
+		{"512K", 0, 0, true},
+		{"-1G", 0, 0, true},
+		{"on", 0, 0, true},
+		{"", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseGuestSwap(tt.v, tt.memory)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseGuestSwap(%q, %d) = %d, %v, want %d, error %t", tt.v, tt.memory, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateGuestSwap(t *testing.T) {
+	setRequiredFlags(t)
+	defer func(s string, n bool) { guestSwap, noInitrd = s, n }(guestSwap, noInitrd)
+	initrd := initrdPath
+
+	tests := []struct {
+		swap     string
+		noInitrd bool
+		valid    bool
+	}{
+		{GuestSwapOff, true, true},
+		{"1G", false, true},
+		{"1T", false, false},
+		{GuestSwapAuto, true, false},
+	}
+
+	for _, tt := range tests {
+		guestSwap, noInitrd, initrdPath = tt.swap, tt.noInitrd, initrd
+		if tt.noInitrd {
+			initrdPath = ""
+		}
+		if ok, err := validated(t, "guest-swap", tt.valid); !ok {
+			t.Errorf("guest-swap %q, no-initrd %t: %v, want valid %t", tt.swap, tt.noInitrd, err, tt.valid)
+		}
+	}
+}
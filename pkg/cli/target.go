@@ -9,7 +9,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/oomol-lab/ovm/pkg/utils"
 	"golang.org/x/sync/errgroup"
@@ -21,10 +24,28 @@ type versionsJSON struct {
 	Rootfs  string `json:"rootfs"`
 	DataImg string `json:"data_img"`
 
+	// Generation is increased every time any of the artifacts is replaced
+	Generation int                    `json:"generation"`
+	Provenance map[string]*Provenance `json:"provenance,omitempty"`
+	// Dirty are the artifacts found corrupted, they are copied again on the next start
+	Dirty []string `json:"dirty,omitempty"`
+	// AssetVersion is the -asset-version of the last copy, a new tag copies kernel/initrd/rootfs again
+	AssetVersion string `json:"asset_version,omitempty"`
+	// HostKey is the ssh host key of the guest in the authorized_keys format, recorded after boot
+	HostKey string `json:"host_key,omitempty"`
+	// StorageMigrated is set once the container storage was moved to the data disk by POST /storage/migrate
+	StorageMigrated bool `json:"storage_migrated,omitempty"`
+
 	path           string
 	needUpdateJSON bool
 }
 
+// MarshalJSON writes the current schema of versions.json, see versionsSchema.
+func (v versionsJSON) MarshalJSON() ([]byte, error) {
+	type plain versionsJSON
+	return withSchema(versionsSchema.current(), plain(v))
+}
+
 func newVersionsJSON(path string) (*versionsJSON, error) {
 	v := &versionsJSON{
 		path: path,
@@ -56,6 +77,73 @@ func (v *versionsJSON) read() error {
 	return nil
 }
 
+// ReadVersions reads versions.json, including the provenance of the artifacts.
+func ReadVersions(p string) (*Versions, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &versionsJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	return &Versions{
+		Versions: map[string]string{
+			"kernel":   v.Kernel,
+			"initrd":   v.Initrd,
+			"rootfs":   v.Rootfs,
+			"data_img": v.DataImg,
+		},
+		Generation:   v.Generation,
+		Provenance:   v.Provenance,
+		Dirty:        v.Dirty,
+		AssetVersion: v.AssetVersion,
+		HostKey:      hostKeyFingerprint(v.HostKey),
+	}, nil
+}
+
+// versionsMu serializes the updates of versions.json while ovm runs, they come from the boot, the restful socket and the verification.
+var versionsMu sync.Mutex
+
+// updateVersions reads versions.json, applies update and writes it back atomically if update changed it.
+func updateVersions(p string, update func(v *versionsJSON) bool) error {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	v := &versionsJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	if !update(v) {
+		return nil
+	}
+
+	if data, err = json.Marshal(v); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(p, data, 0644)
+}
+
+// MarkArtifactDirty records that the artifact is corrupted, so the next start copies it again from the source.
+func MarkArtifactDirty(p, key string) error {
+	return updateVersions(p, func(v *versionsJSON) bool {
+		if slices.Contains(v.Dirty, key) {
+			return false
+		}
+		v.Dirty = append(v.Dirty, key)
+		return true
+	})
+}
+
 func (v *versionsJSON) saveToDisk() error {
 	if !v.needUpdateJSON {
 		return nil
@@ -66,7 +154,10 @@ func (v *versionsJSON) saveToDisk() error {
 		return err
 	}
 
-	return os.WriteFile(v.path, data, 0644)
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+
+	return utils.WriteFileAtomic(v.path, data, 0644)
 }
 
 func (v *versionsJSON) get(key string) string {
@@ -108,28 +199,48 @@ type srcPath struct {
 	p   string
 }
 
+// AssetDecision is whether Setup copied an artifact into the target path, and why.
+type AssetDecision struct {
+	Key    string `json:"key"`
+	Copied bool   `json:"copied"`
+	Reason string `json:"reason"`
+	// DurationMs is how long the copy took
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
 type targetContext struct {
-	targetPath string
+	targetPath     string
+	copyBufferSize int
 
-	srcPaths []srcPath
+	srcPaths  []srcPath
+	decisions []*AssetDecision
 
 	versionsJSON *versionsJSON
 }
 
-func newTarget(targetPath, kernelPath, initrdPath, rootfsPath, dataImgPath, versionsPath string) (*targetContext, error) {
+func newTarget(targetPath, kernelPath, initrdPath, rootfsPath, dataImgPath, versionsPath string, copyBufferSize int) (*targetContext, error) {
 	versionsJSON, err := newVersionsJSON(versionsPath)
 	if err != nil {
 		return nil, err
 	}
 
+	srcPaths := []srcPath{
+		{"kernel", kernelPath},
+		{"initrd", initrdPath},
+		{"rootfs", rootfsPath},
+		{"data_img", dataImgPath},
+	}
+	// without an initrd there is nothing to copy
+	if initrdPath == "" {
+		srcPaths = slices.DeleteFunc(srcPaths, func(src srcPath) bool {
+			return src.key == "initrd"
+		})
+	}
+
 	return &targetContext{
-		targetPath: targetPath,
-		srcPaths: []srcPath{
-			{"kernel", kernelPath},
-			{"initrd", initrdPath},
-			{"rootfs", rootfsPath},
-			{"data_img", dataImgPath},
-		},
+		targetPath:     targetPath,
+		copyBufferSize: copyBufferSize,
+		srcPaths:       srcPaths,
 
 		versionsJSON: versionsJSON,
 	}, nil
@@ -137,45 +248,125 @@ func newTarget(targetPath, kernelPath, initrdPath, rootfsPath, dataImgPath, vers
 
 func (t *targetContext) handle() error {
 	g := errgroup.Group{}
+	generation := t.versionsJSON.Generation + 1
 
-	for _, src := range t.srcPaths {
-		distPath := path.Join(t.targetPath, filepath.Base(src.p))
+	// the content behind the source paths may change without the versions, the tag forces a copy
+	assetVersionChanged := assetVersion != "" && assetVersion != t.versionsJSON.AssetVersion
 
-		if exists, _ := utils.PathExists(distPath); !exists {
-			t.copyOrCreate(src, &g)
-			continue
+	for _, src := range t.srcPaths {
+		d := &AssetDecision{Key: src.key}
+		t.decisions = append(t.decisions, d)
+
+		// an imported data disk is kept, it takes over the version of the first start
+		if src.key == "data_img" && t.versionsJSON.pendingDataImport() != nil {
+			if exists, _ := utils.PathExists(path.Join(t.targetPath, filepath.Base(src.p))); exists {
+				t.versionsJSON.set(src.key, versionsParams[src.key])
+				pv := t.versionsJSON.Provenance[src.key]
+				pv.Version = versionsParams[src.key]
+				pv.Generation = generation
+				d.Reason = "imported"
+				continue
+			}
 		}
 
-		if v := t.versionsJSON.get(src.key); v != versionsParams[src.key] {
-			t.copyOrCreate(src, &g)
+		d.Reason = t.copyReason(src, assetVersionChanged)
+		if d.Reason == "" {
+			d.Reason = "up to date"
 			continue
 		}
+
+		d.Copied = true
+		t.copyOrCreate(src, generation, d, &g)
 	}
 
 	if err := g.Wait(); err != nil {
 		return err
 	}
 
+	if len(t.versionsJSON.Dirty) != 0 {
+		t.versionsJSON.Dirty = nil
+		t.versionsJSON.needUpdateJSON = true
+	}
+
+	if assetVersionChanged {
+		t.versionsJSON.AssetVersion = assetVersion
+		t.versionsJSON.needUpdateJSON = true
+	}
+
+	if t.versionsJSON.needUpdateJSON {
+		t.versionsJSON.Generation = generation
+	}
+
 	return t.versionsJSON.saveToDisk()
 }
 
-func (t *targetContext) copyOrCreate(src srcPath, g *errgroup.Group) {
+// copyReason returns why the artifact has to be copied (or created) again, empty if the copy in the target path is kept.
+func (t *targetContext) copyReason(src srcPath, assetVersionChanged bool) string {
+	if assetVersionChanged && src.key != "data_img" {
+		return fmt.Sprintf("asset version changed from %q to %q", t.versionsJSON.AssetVersion, assetVersion)
+	}
+
+	if exists, _ := utils.PathExists(path.Join(t.targetPath, filepath.Base(src.p))); !exists {
+		return "missing"
+	}
+
+	if v := t.versionsJSON.get(src.key); v != versionsParams[src.key] {
+		return fmt.Sprintf("version changed from %q to %q", v, versionsParams[src.key])
+	}
+
+	if slices.Contains(t.versionsJSON.Dirty, src.key) {
+		return "corrupted"
+	}
+
+	if t.sourceChanged(src) {
+		return "source changed"
+	}
+
+	return ""
+}
+
+func (t *targetContext) copyOrCreate(src srcPath, generation int, d *AssetDecision, g *errgroup.Group) {
 	t.versionsJSON.set(src.key, versionsParams[src.key])
 	distPath := path.Join(t.targetPath, filepath.Base(src.p))
+	pv := t.versionsJSON.newProvenance(src, generation)
 
 	g.Go(func() error {
+		start := time.Now()
+		defer func() {
+			d.DurationMs = time.Since(start).Milliseconds()
+		}()
+
 		if src.key == "data_img" {
 			if err := os.RemoveAll(distPath); err != nil {
 				return err
 			}
 
-			return utils.CreateSparseFile(distPath, 8*1024*1024*1024*1024)
+			return utils.CreateSparseFile(distPath, dataDiskSize)
+		}
+
+		// hash the data while copying, the copy is the file actually opened at boot
+		digest, err := utils.CopyFile(src.p, distPath, utils.CopyOptions{BufferSize: t.copyBufferSize, Digest: true})
+		if err != nil {
+			return err
 		}
+		pv.Digest = digest
 
-		return utils.Copy(src.p, distPath)
+		return nil
 	})
 }
 
+// maxCopyBufferSize caps -copy-buffer-size, larger buffers gain nothing and every parallel copy holds one
+const maxCopyBufferSize = 64 * 1024 * 1024
+
+// parseCopyBufferSize returns the buffer size in bytes of the copies into the target path.
+func parseCopyBufferSize(v string) (int, error) {
+	if size, ok := parseSize(v); ok && size <= maxCopyBufferSize {
+		return int(size), nil
+	}
+
+	return 0, fmt.Errorf("copy-buffer-size must be a size like 4M, at most 64M")
+}
+
 var versionsParams = map[string]string{
 	"kernel":   "",
 	"initrd":   "",
@@ -202,7 +393,7 @@ func parseVersions() error {
 	}
 
 	for name, v := range versionsParams {
-		if v == "" {
+		if v == "" && !(name == "initrd" && noInitrd) {
 			return fmt.Errorf("need %s in versions", name)
 		}
 	}
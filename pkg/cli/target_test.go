@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestUpdateVersionsConcurrent(t *testing.T) {
+	p := path.Join(t.TempDir(), "versions.json")
+	if err := os.WriteFile(p, []byte(`{"kernel":"1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if err := updateVersions(p, func(v *versionsJSON) bool {
+				v.Dirty = append(v.Dirty, key)
+				return true
+			}); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("key%d", i))
+	}
+	wg.Wait()
+
+	v := &versionsJSON{path: p}
+	if err := v.read(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if !slices.Contains(v.Dirty, fmt.Sprintf("key%d", i)) {
+			t.Errorf("update of key%d lost: %v", i, v.Dirty)
+		}
+	}
+	if v.Kernel != "1" {
+		t.Errorf("kernel = %q, want 1", v.Kernel)
+	}
+}
+
+// TestVersionsMarks runs the marks concurrently with other updates, none of them may be lost.
+func TestVersionsMarks(t *testing.T) {
+	p := path.Join(t.TempDir(), "versions.json")
+	if err := os.WriteFile(p, []byte(`{"kernel":"1","provenance":{"data_img":{"version":"1","import":{"source":"/a.img"}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func(key string) {
+			defer wg.Done()
+			if err := MarkArtifactDirty(p, key); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("key%d", i))
+		go func() {
+			defer wg.Done()
+			if err := MarkDataImportProvisioned(p); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if err := updateVersions(p, func(v *versionsJSON) bool {
+				v.Generation++
+				return true
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// marking twice changes nothing
+	if err := MarkArtifactDirty(p, "key0"); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &versionsJSON{path: p}
+	if err := v.read(); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Dirty) != 10 || v.Generation != 10 {
+		t.Fatalf("got dirty %v and generation %d, want 10 keys and 10", v.Dirty, v.Generation)
+	}
+	if pv := v.Provenance["data_img"]; pv == nil || pv.Import == nil || !pv.Import.Provisioned {
+		t.Fatalf("the import is not provisioned: %+v", pv)
+	}
+}
+
+func TestParseCopyBufferSize(t *testing.T) {
+	tests := []struct {
+		v    string
+		want int
+		ok   bool
+	}{
+		{"4M", 4 * 1024 * 1024, true},
+		{"64M", maxCopyBufferSize, true},
+		{"1M", 1024 * 1024, true},
+		{"0M", 0, false},
+		{"65M", 0, false},
+		{"1G", 0, false},
+		{"big", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCopyBufferSize(tt.v)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseCopyBufferSize(%q) = %d, %v, want %d", tt.v, got, err, tt.want)
+		}
+	}
+}
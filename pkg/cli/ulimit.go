@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ulimitResources are the resources of -guest-ulimit, mapped to the DefaultLimit of systemd.
+var ulimitResources = map[string]string{
+	"nofile":  "NOFILE",
+	"nproc":   "NPROC",
+	"memlock": "MEMLOCK",
+	"stack":   "STACK",
+	"core":    "CORE",
+}
+
+// GuestUlimit is a resource limit applied to all services of the guest.
+type GuestUlimit struct {
+	Name string `json:"name"`
+	// Soft and Hard are a number or infinity
+	Soft string `json:"soft"`
+	Hard string `json:"hard"`
+}
+
+// SystemdKey is the name of the limit in systemd, e.g. NOFILE.
+func (u *GuestUlimit) SystemdKey() string {
+	return ulimitResources[u.Name]
+}
+
+type ulimitFlags []string
+
+func (u *ulimitFlags) String() string {
+	return strings.Join(*u, " ")
+}
+
+func (u *ulimitFlags) Set(v string) error {
+	*u = append(*u, v)
+	return nil
+}
+
+// parseUlimit parses "NAME=LIMIT" or "NAME=SOFT:HARD".
+func parseUlimit(v string) (*GuestUlimit, error) {
+	name, value, found := strings.Cut(v, "=")
+	if !found {
+		return nil, fmt.Errorf("guest-ulimit %s: must be NAME=LIMIT or NAME=SOFT:HARD", v)
+	}
+
+	if _, ok := ulimitResources[name]; !ok {
+		names := make([]string, 0, len(ulimitResources))
+		for n := range ulimitResources {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("guest-ulimit %s: unknown resource %s, must be one of %s", v, name, strings.Join(names, ", "))
+	}
+
+	soft, hard, found := strings.Cut(value, ":")
+	if !found {
+		hard = soft
+	}
+
+	for _, l := range []string{soft, hard} {
+		if l == "infinity" {
+			continue
+		}
+		if _, err := strconv.ParseUint(l, 10, 64); err != nil {
+			return nil, fmt.Errorf("guest-ulimit %s: %q must be a number or infinity", v, l)
+		}
+	}
+
+	if hard != "infinity" && (soft == "infinity" || ulimitValue(soft) > ulimitValue(hard)) {
+		return nil, fmt.Errorf("guest-ulimit %s: the soft limit must not be greater than the hard limit", v)
+	}
+
+	return &GuestUlimit{Name: name, Soft: soft, Hard: hard}, nil
+}
+
+func ulimitValue(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
+
+func parseUlimits() ([]GuestUlimit, error) {
+	var result []GuestUlimit
+	seen := map[string]bool{}
+
+	for _, v := range ulimits {
+		u, err := parseUlimit(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[u.Name] {
+			return nil, fmt.Errorf("guest-ulimit %s: %s is already set", v, u.Name)
+		}
+		seen[u.Name] = true
+
+		result = append(result, *u)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUlimit(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    GuestUlimit
+		wantErr string
+	}{
+		{"nofile=65536", GuestUlimit{"nofile", "65536", "65536"}, ""},
+		{"nofile=1024:65536", GuestUlimit{"nofile", "1024", "65536"}, ""},
+		{"memlock=infinity", GuestUlimit{"memlock", "infinity", "infinity"}, ""},
+		{"core=0:infinity", GuestUlimit{"core", "0", "infinity"}, ""},
+		{"nofile", GuestUlimit{}, "must be NAME=LIMIT"},
+		{"cpu=10", GuestUlimit{}, "must be one of core, memlock, nofile, nproc, stack"},
+		{"nofile=many", GuestUlimit{}, "must be a number or infinity"},
+		{"nofile=1024:", GuestUlimit{}, "must be a number or infinity"},
+		{"nofile=-1", GuestUlimit{}, "must be a number or infinity"},
+		{"nofile=65536:1024", GuestUlimit{}, "must not be greater"},
+		{"nofile=infinity:1024", GuestUlimit{}, "must not be greater"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseUlimit(tt.v)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseUlimit(%q): %v, want an error about %q", tt.v, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUlimit(%q): %v", tt.v, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseUlimit(%q) = %+v, want %+v", tt.v, *got, tt.want)
+		}
+	}
+
+	u := GuestUlimit{Name: "nofile"}
+	if k := u.SystemdKey(); k != "NOFILE" {
+		t.Errorf("SystemdKey() = %q, want NOFILE", k)
+	}
+}
+
+func TestParseUlimits(t *testing.T) {
+	defer func(u ulimitFlags) { ulimits = u }(ulimits)
+
+	ulimits = ulimitFlags{"nofile=1024", "nproc=4096"}
+	got, err := parseUlimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "nofile" || got[1].Name != "nproc" {
+		t.Errorf("parseUlimits() = %+v", got)
+	}
+
+	ulimits = ulimitFlags{"nofile=1024", "nofile=2048"}
+	if _, err := parseUlimits(); err == nil || !strings.Contains(err.Error(), "already set") {
+		t.Errorf("nofile set twice: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+// Categories of -strict, every warning belongs to one.
+const (
+	WarnCategoryName    = "name"
+	WarnCategorySSH     = "ssh"
+	WarnCategoryPodman  = "podman"
+	WarnCategoryStorage = "storage"
+	WarnCategoryDisk    = "disk"
+	WarnCategoryBoot    = "boot"
+	WarnCategoryClock   = "clock"
+	WarnCategoryNetwork = "network"
+)
+
+// Codes of the warnings raised by Context.Warn.
+const (
+	WarnNameInUse              = "name-in-use"
+	WarnSSHKeyMode             = "ssh-key-mode"
+	WarnPodmanIncompatible     = "podman-incompatible"
+	WarnPodmanProbeFailed      = "podman-probe-failed"
+	WarnStorageNotOnDataDisk   = "storage-not-on-data-disk"
+	WarnStorageMigrationPaused = "storage-migration-interrupted"
+	WarnArtifactModified       = "artifact-modified"
+	WarnLogBudgetExceeded      = "log-budget-exceeded"
+	WarnReadyAssumed           = "ready-assumed"
+	WarnKernelCmdlineDiffers   = "kernel-cmdline-differs"
+	WarnClockDrift             = "clock-drift"
+	WarnResolvConf             = "resolv-conf-unreadable"
+	WarnNetworkEmulation       = "network-emulation-failed"
+)
+
+// warningCategories is the category of every warning code, Warn refuses a code which is not listed here.
+var warningCategories = map[string]string{
+	WarnNameInUse:              WarnCategoryName,
+	WarnSSHKeyMode:             WarnCategorySSH,
+	WarnPodmanIncompatible:     WarnCategoryPodman,
+	WarnPodmanProbeFailed:      WarnCategoryPodman,
+	WarnStorageNotOnDataDisk:   WarnCategoryStorage,
+	WarnStorageMigrationPaused: WarnCategoryStorage,
+	WarnArtifactModified:       WarnCategoryDisk,
+	WarnLogBudgetExceeded:      WarnCategoryDisk,
+	WarnReadyAssumed:           WarnCategoryBoot,
+	WarnKernelCmdlineDiffers:   WarnCategoryBoot,
+	WarnClockDrift:             WarnCategoryClock,
+	WarnResolvConf:             WarnCategoryNetwork,
+	WarnNetworkEmulation:       WarnCategoryNetwork,
+}
+
+// StrictDefault is -strict without a value, only the warnings of defaultStrictCodes stop ovm.
+const StrictDefault = "default"
+
+// defaultStrictCodes are the warnings stopping ovm with a bare -strict, as before the categories existed.
+// Warnings which are routine or fix themselves (clock drift after sleep, a failed podman probe, ...) are left out.
+var defaultStrictCodes = []string{WarnNameInUse, WarnSSHKeyMode, WarnPodmanIncompatible}
+
+// WarningCategories returns the categories accepted by -strict, sorted.
+func WarningCategories() []string {
+	var categories []string
+	for _, category := range warningCategories {
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	slices.Sort(categories)
+
+	return categories
+}
+
+// Warning is a degraded condition of the current run, see GET /warnings.
+type Warning struct {
+	Code     string `json:"code"`
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	// Fatal is set when -strict stopped ovm because of the warning
+	Fatal bool      `json:"fatal"`
+	Time  time.Time `json:"time"`
+}
+
+// WarningError is returned by Warn when the category of the warning is strict.
+type WarningError struct {
+	Code    string
+	Message string
+}
+
+func (e *WarningError) Error() string {
+	return fmt.Sprintf("%s (%s, refused by -strict)", e.Message, e.Code)
+}
+
+// strictFlag is -strict, without a value only defaultStrictCodes are strict, all makes every category strict.
+type strictFlag []string
+
+func (s *strictFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *strictFlag) Set(v string) error {
+	switch v {
+	case "true", StrictDefault:
+		*s = []string{StrictDefault}
+		return nil
+	case "all":
+		*s = WarningCategories()
+		return nil
+	case "false", "":
+		*s = nil
+		return nil
+	}
+
+	known := WarningCategories()
+	var categories []string
+	for _, category := range strings.Split(v, ",") {
+		category = strings.TrimSpace(category)
+		if !slices.Contains(known, category) {
+			return fmt.Errorf("unknown category %q, must be one of: %s", category, strings.Join(known, ", "))
+		}
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	*s = categories
+
+	return nil
+}
+
+func (s *strictFlag) IsBoolFlag() bool {
+	return true
+}
+
+// strictFor reports whether the warning stops ovm.
+func (c *Context) strictFor(code, category string) bool {
+	if slices.Contains(c.Strict, category) {
+		return true
+	}
+
+	return slices.Contains(c.Strict, StrictDefault) && slices.Contains(defaultStrictCodes, code)
+}
+
+// Warn records a warning of the current run and logs it, log may be nil when the caller reports it itself.
+// When the category of code is strict the warning is logged as an error and a *WarningError is returned,
+// the caller must fail with it. Every warning about a degraded run goes through Warn, so GET /warnings is complete.
+func (c *Context) Warn(log *logger.Context, code, format string, args ...any) error {
+	category, ok := warningCategories[code]
+	if !ok {
+		return fmt.Errorf("unregistered warning code %s: %s", code, fmt.Sprintf(format, args...))
+	}
+
+	w := Warning{
+		Code:     code,
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+		Fatal:    c.strictFor(code, category),
+		Time:     time.Now(),
+	}
+
+	c.warningsMu.Lock()
+	c.warnings = append(c.warnings, w)
+	c.warningsMu.Unlock()
+
+	if !w.Fatal {
+		if log != nil {
+			log.Warnf("%s (%s)", w.Message, code)
+		}
+		return nil
+	}
+
+	err := &WarningError{Code: code, Message: w.Message}
+	if log != nil {
+		log.Error(err.Error())
+	}
+
+	return err
+}
+
+// Warnings returns the warnings raised during the current run, oldest first.
+func (c *Context) Warnings() []Warning {
+	c.warningsMu.Lock()
+	defer c.warningsMu.Unlock()
+
+	return slices.Clone(c.warnings)
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"testing"
+)
+
+func strictContext(t *testing.T, v string) *Context {
+	var s strictFlag
+	if err := s.Set(v); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Context{Strict: s}
+}
+
+func TestStrictDefault(t *testing.T) {
+	c := strictContext(t, "true")
+
+	for _, code := range defaultStrictCodes {
+		var werr *WarningError
+		if err := c.Warn(nil, code, "test"); !errors.As(err, &werr) {
+			t.Errorf("bare -strict: %s is not fatal", code)
+		}
+	}
+
+	for _, code := range []string{WarnClockDrift, WarnPodmanProbeFailed, WarnResolvConf, WarnLogBudgetExceeded, WarnReadyAssumed} {
+		if err := c.Warn(nil, code, "test"); err != nil {
+			t.Errorf("bare -strict: %s is fatal: %v", code, err)
+		}
+	}
+}
+
+func TestStrictCategories(t *testing.T) {
+	c := strictContext(t, "clock")
+	if err := c.Warn(nil, WarnClockDrift, "test"); err == nil {
+		t.Error("-strict=clock: clock-drift is not fatal")
+	}
+	if err := c.Warn(nil, WarnNameInUse, "test"); err != nil {
+		t.Errorf("-strict=clock: name-in-use is fatal: %v", err)
+	}
+
+	c = strictContext(t, "all")
+	if err := c.Warn(nil, WarnReadyAssumed, "test"); err == nil {
+		t.Error("-strict=all: ready-assumed is not fatal")
+	}
+
+	var s strictFlag
+	if err := s.Set("clock,nope"); err == nil {
+		t.Error("unknown category accepted")
+	}
+}
+
+func TestWarnUnregisteredCode(t *testing.T) {
+	c := &Context{}
+	if err := c.Warn(nil, "no-such-code", "test"); err == nil {
+		t.Error("unregistered code accepted")
+	}
+	if len(c.Warnings()) != 0 {
+		t.Error("unregistered code recorded")
+	}
+}
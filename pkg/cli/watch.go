@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Modes of -watch-artifacts, a development feature for rebuilding the kernel/initrd/rootfs.
+const (
+	WatchNotify    = "notify"
+	WatchAutoApply = "auto-apply"
+)
+
+const (
+	watchPollInterval = 500 * time.Millisecond
+	// watchStableAfter is how long the sources must be unchanged before a change is reported, a build still writing is not
+	watchStableAfter = 2 * time.Second
+)
+
+// watchFlag is -watch-artifacts, it can be passed without a value for notify.
+type watchFlag string
+
+func (w *watchFlag) String() string {
+	return string(*w)
+}
+
+func (w *watchFlag) Set(v string) error {
+	switch v {
+	case "true", WatchNotify:
+		*w = WatchNotify
+	case "false", "":
+		*w = ""
+	case WatchAutoApply:
+		*w = WatchAutoApply
+	default:
+		return fmt.Errorf("must be %s or %s", WatchNotify, WatchAutoApply)
+	}
+
+	return nil
+}
+
+func (w *watchFlag) IsBoolFlag() bool {
+	return true
+}
+
+type sourceStat struct {
+	size int64
+	// modTime is in unix nanoseconds, zero if the source is missing
+	modTime int64
+}
+
+func statSource(p string) sourceStat {
+	info, err := os.Stat(p)
+	if err != nil {
+		// a source replaced by a build may be missing for a moment, that is a change as well
+		return sourceStat{}
+	}
+
+	return sourceStat{size: info.Size(), modTime: info.ModTime().UnixNano()}
+}
+
+// WatchSources polls the source paths of kernel/initrd/rootfs (before the copy into the target path) until ctx is done.
+// changed is called with the keys of the changed artifacts once none of them was written for 2s, so the artifacts of
+// one build are reported together.
+func (c *Context) WatchSources(ctx context.Context, changed func(keys []string)) error {
+	sources := []srcPath{
+		{"kernel", kernelPath},
+		{"initrd", initrdPath},
+		{"rootfs", rootfsPath},
+	}
+	if initrdPath == "" {
+		sources = slices.DeleteFunc(sources, func(src srcPath) bool {
+			return src.key == "initrd"
+		})
+	}
+
+	last := make(map[string]sourceStat, len(sources))
+	for _, src := range sources {
+		last[src.key] = statSource(src.p)
+	}
+
+	var (
+		pending    []string
+		lastChange time.Time
+	)
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, src := range sources {
+			s := statSource(src.p)
+			if s == last[src.key] {
+				continue
+			}
+
+			last[src.key] = s
+			lastChange = time.Now()
+			if !slices.Contains(pending, src.key) {
+				pending = append(pending, src.key)
+			}
+		}
+
+		if len(pending) != 0 && time.Since(lastChange) >= watchStableAfter {
+			changed(pending)
+			pending = nil
+		}
+	}
+}
+
+// sourceChanged reports whether the source was written after the copy in the target path, only checked with -watch-artifacts.
+func (t *targetContext) sourceChanged(src srcPath) bool {
+	if watchArtifacts == "" || src.key == "data_img" {
+		return false
+	}
+
+	pv, ok := t.versionsJSON.Provenance[src.key]
+	if !ok {
+		return false
+	}
+
+	s := statSource(src.p)
+	return s.modTime != 0 && s.modTime > pv.UpdatedAt.UnixNano()
+}
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// workdirFlags are derived from the workdir asked for by the wizard.
+var workdirFlags = map[string]string{
+	"log-path":     "logs",
+	"socket-path":  "sockets",
+	"ssh-key-path": "keys",
+	"target-path":  "assets",
+}
+
+// NeedWizard reports whether the interactive setup wizard should be started.
+// It only happens in CLI mode, when stdin is a terminal and some required flags are missing.
+func NeedWizard() bool {
+	if !cliMode || nonInteractive {
+		return false
+	}
+
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	return len(missingFlags()) != 0
+}
+
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// RunWizard asks for the missing required flags, saves them to a config file and
+// reports whether the user wants to start the VM immediately.
+func RunWizard(in io.Reader, out io.Writer) (start bool, err error) {
+	w := &wizard{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+
+	_, _ = fmt.Fprintln(out, "Some required flags are missing, let's set them up (pass -non-interactive to skip this).")
+
+	saved := map[string]string{}
+	workdirAsked := false
+
+	for _, f := range missingFlags() {
+		if _, ok := workdirFlags[f.name]; ok {
+			if workdirAsked {
+				continue
+			}
+			workdirAsked = true
+
+			if err := w.askWorkdir(saved); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		answer, err := w.ask(f, defaultValue(f.name))
+		if err != nil {
+			return false, err
+		}
+		saved[f.name] = answer
+	}
+
+	p := configPath
+	if p == "" {
+		p = filepath.Join(filepath.Dir(targetPath), "ovm.conf")
+	}
+	if err := saveConfig(p, saved); err != nil {
+		return false, fmt.Errorf("save config failed: %w", err)
+	}
+	_, _ = fmt.Fprintf(out, "Config saved to %s, next time run with: -cli -config %s\n", p, p)
+
+	answer, err := w.prompt("Start the virtual machine now?", "Y")
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+// ask keeps asking until the answer passes the same validation as the flag.
+func (w *wizard) ask(f requiredFlag, def string) (string, error) {
+	usage := flag.Lookup(f.name).Usage
+
+	for {
+		answer, err := w.prompt(usage, def)
+		if err != nil {
+			return "", err
+		}
+
+		if err := flag.Set(f.name, answer); err != nil {
+			_, _ = fmt.Fprintf(w.out, "  invalid value: %v\n", err)
+			continue
+		}
+
+		if err := f.validate(); err != nil {
+			_, _ = fmt.Fprintf(w.out, "  invalid value: %v\n", err)
+			continue
+		}
+
+		return answer, nil
+	}
+}
+
+func (w *wizard) askWorkdir(saved map[string]string) error {
+	def := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		def = filepath.Join(home, ".ovm", name)
+	}
+
+	answer, err := w.prompt("Directory to store logs, sockets, keys and disk images", def)
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(answer)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range missingFlags() {
+		sub, ok := workdirFlags[f.name]
+		if !ok {
+			continue
+		}
+
+		p := filepath.Join(dir, sub)
+		if err := flag.Set(f.name, p); err != nil {
+			return err
+		}
+		saved[f.name] = p
+	}
+
+	return nil
+}
+
+func (w *wizard) prompt(question, def string) (string, error) {
+	if def != "" {
+		_, _ = fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		_, _ = fmt.Fprintf(w.out, "%s: ", question)
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("read answer failed: %w", err)
+	}
+
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+
+	return def, nil
+}
+
+// defaultValue returns a host-aware default for the flag.
+func defaultValue(flagName string) string {
+	switch flagName {
+	case "cpus":
+		return strconv.Itoa(max(runtime.NumCPU()/2, 1))
+	case "memory":
+		v, err := mem.VirtualMemory()
+		if err != nil {
+			return "2048"
+		}
+		return strconv.FormatUint(min(max(v.Total/1024/1024/4, 1024), 8192), 10)
+	case "versions":
+		return "kernel=1,initrd=1,rootfs=1,data_img=1"
+	default:
+		return ""
+	}
+}
+
+// saveConfig appends the values to the config file, so existing entries of a passed -config are kept.
+func saveConfig(p string, values map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sb := strings.Builder{}
+	sb.WriteString("# generated by the ovm setup wizard\n")
+
+	for _, rf := range requiredFlags {
+		if v, ok := values[rf.name]; ok {
+			sb.WriteString(rf.name + "=" + v + "\n")
+		}
+	}
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
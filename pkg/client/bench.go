@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// Bench runs the disk and network benchmark in the guest, it takes a few seconds.
+func (c *Client) Bench(ctx context.Context) (*cli.BenchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://ovm/bench", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("bench failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	r := &cli.BenchResult{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package client talks to the restful socket of a running ovm.
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type Client struct {
+	http *http.Client
+}
+
+// New returns a client for the restful socket, e.g. ${socket-path}/${name}-restful.sock.
+func New(socketPath string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+)
+
+type EventsOptions struct {
+	// Types only streams these events, all if empty. The filter is applied by ovm.
+	Types []event.Name
+	// Since resumes after this sequence number, 0 starts with all recorded events
+	Since uint64
+}
+
+// Events streams the events of ovm until ctx is done, then both channels are closed.
+// Dropped connections are reconnected, and the stream resumes after the last received sequence number,
+// so no event is delivered twice. Connection errors are sent to the error channel without blocking, the stream keeps retrying.
+func (c *Client) Events(ctx context.Context, opts EventsOptions) (<-chan event.Event, <-chan error) {
+	events := make(chan event.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		s := &eventStream{
+			client: c,
+			opts:   opts,
+			last:   opts.Since,
+			out:    events,
+		}
+
+		delay := minReconnectDelay
+		for {
+			received, err := s.run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if received {
+				delay = minReconnectDelay
+			}
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, maxReconnectDelay)
+		}
+	}()
+
+	return events, errs
+}
+
+type eventStream struct {
+	client   *Client
+	opts     EventsOptions
+	last     uint64
+	streamID string
+	out      chan<- event.Event
+}
+
+// run reads one connection until it is closed, received is true if any event was delivered.
+func (s *eventStream) run(ctx context.Context) (received bool, err error) {
+	q := url.Values{}
+	q.Set("since", strconv.FormatUint(s.last, 10))
+	if len(s.opts.Types) != 0 {
+		types := make([]string, 0, len(s.opts.Types))
+		for _, t := range s.opts.Types {
+			types = append(types, string(t))
+		}
+		q.Set("types", strings.Join(types, ","))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://ovm/events?"+q.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	if s.streamID != "" {
+		req.Header.Set(event.StreamIDHeader, s.streamID)
+	}
+
+	resp, err := s.client.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("events: unexpected status %s", resp.Status)
+	}
+
+	// a restarted ovm counts from 1 again, everything it replays is new
+	if id := resp.Header.Get(event.StreamIDHeader); id != s.streamID {
+		if s.streamID != "" {
+			s.last = 0
+		}
+		s.streamID = id
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data strings.Builder
+	for sc.Scan() {
+		line := sc.Text()
+
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			var ev event.Event
+			if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+				return received, fmt.Errorf("events: decode event failed: %w", err)
+			}
+			data.Reset()
+
+			// replays after a reconnect may overlap with what was already delivered
+			if ev.Seq <= s.last {
+				continue
+			}
+
+			select {
+			case s.out <- ev:
+			case <-ctx.Done():
+				return received, nil
+			}
+			s.last = ev.Seq
+			received = true
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			// id, event and keep-alive comments, the data carries everything
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return received, err
+	}
+
+	return received, fmt.Errorf("events: stream closed")
+}
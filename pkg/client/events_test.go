@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+)
+
+func writeEvents(w http.ResponseWriter, events ...event.Event) {
+	for _, ev := range events {
+		data, _ := json.Marshal(ev)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Name, data)
+	}
+}
+
+func TestEventsReconnect(t *testing.T) {
+	type request struct {
+		since, types, streamID string
+	}
+	requests := make(chan request, 4)
+
+	conn := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- request{r.URL.Query().Get("since"), r.URL.Query().Get("types"), r.Header.Get(event.StreamIDHeader)}
+
+		conn++
+		switch conn {
+		case 1:
+			w.Header().Set(event.StreamIDHeader, "a")
+			writeEvents(w, event.Event{Seq: 1, Name: event.VMReady}, event.Event{Seq: 2, Name: event.VMReady})
+		case 2:
+			// the replay overlaps with what was already delivered
+			w.Header().Set(event.StreamIDHeader, "a")
+			writeEvents(w, event.Event{Seq: 2, Name: event.VMReady}, event.Event{Seq: 3, Name: event.VMReady})
+		case 3:
+			// ovm restarted, it counts from 1 again
+			w.Header().Set(event.StreamIDHeader, "b")
+			writeEvents(w, event.Event{Seq: 1, Name: event.VMReady, Message: "restarted"})
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+		},
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, _ := c.Events(ctx, EventsOptions{Types: []event.Name{event.VMReady, event.IgnitionDone}})
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case ev := <-events:
+			got = append(got, fmt.Sprintf("%d%s", ev.Seq, ev.Message))
+		case <-ctx.Done():
+			t.Fatalf("got %v before the timeout", got)
+		}
+	}
+	if fmt.Sprint(got) != "[1 2 3 1restarted]" {
+		t.Errorf("events %v, want every event once, and the events of the restarted ovm", got)
+	}
+
+	want := []request{
+		{"0", "VMReady,IgnitionDone", ""},
+		{"2", "VMReady,IgnitionDone", "a"},
+		{"3", "VMReady,IgnitionDone", "a"},
+		{"1", "VMReady,IgnitionDone", "b"},
+	}
+	for i, w := range want {
+		if r := <-requests; r != w {
+			t.Errorf("request %d: %+v, want %+v", i+1, r, w)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package guestlog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxFileBytes is the size of NAME-guest.log before it is rotated, the guest logs much more than ovm
+	maxFileBytes = 16 * 1024 * 1024
+	// maxLineBytes is the longest line kept, longer lines are split
+	maxLineBytes = 64 * 1024
+)
+
+// writer writes the lines of the guest into NAME-guest.log and rotates it after maxFileBytes.
+type writer struct {
+	mu      sync.Mutex
+	opt     *cli.Context
+	file    *logger.Context
+	written int
+}
+
+func (w *writer) rotate() error {
+	f, err := logger.NewWithoutManage(w.opt.LogPath, w.opt.Name+"-guest")
+	if err != nil {
+		return fmt.Errorf("create guest logger error: %w", err)
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = f
+	w.written = 0
+
+	return nil
+}
+
+func (w *writer) line(line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.written >= maxFileBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	w.file.Info(line)
+	w.written += len(line)
+
+	return nil
+}
+
+func (w *writer) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.file.Close()
+}
+
+// Run accepts the connections of the guest on the guest log socket with -forward-guest-logs, the guest writes one log line
+// after another (e.g. from journalctl -f). The guest may reconnect, e.g. after its log service restarted.
+func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) error {
+	w := &writer{opt: opt}
+	if err := w.rotate(); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("unix", opt.GuestLogSocketPath)
+	if err != nil {
+		w.close()
+		return fmt.Errorf("listen guest log socket file error: %w", err)
+	}
+
+	var (
+		connsMu sync.Mutex
+		conns   = map[net.Conn]struct{}{}
+	)
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		connsMu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMu.Unlock()
+
+		return ln.Close()
+	})
+
+	g.Go(func() error {
+		defer w.close()
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
+				return fmt.Errorf("accept guest log connection error: %w", err)
+			}
+
+			log.Info("guest log connected")
+
+			connsMu.Lock()
+			conns[conn] = struct{}{}
+			connsMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					connsMu.Lock()
+					delete(conns, conn)
+					connsMu.Unlock()
+					_ = conn.Close()
+				}()
+
+				if err := forward(conn, w); err != nil && ctx.Err() == nil {
+					log.Warnf("forward guest logs failed: %v", err)
+					return
+				}
+				log.Info("guest log disconnected")
+			}()
+		}
+	})
+
+	return nil
+}
+
+func forward(conn net.Conn, w *writer) error {
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 4096), maxLineBytes)
+	sc.Split(scanLines)
+
+	for sc.Scan() {
+		if err := w.line(sc.Text()); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+// scanLines is bufio.ScanLines, but a line longer than the buffer is returned in parts instead of failing the scan.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= maxLineBytes {
+		return len(data), data, nil
+	}
+
+	return advance, token, err
+}
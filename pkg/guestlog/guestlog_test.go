@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package guestlog
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func TestScanLines(t *testing.T) {
+	long := strings.Repeat("a", maxLineBytes+10)
+
+	sc := bufio.NewScanner(strings.NewReader("one\ntwo\r\n" + long + "\nlast"))
+	sc.Buffer(make([]byte, 4096), maxLineBytes)
+	sc.Split(scanLines)
+
+	var got []string
+	for sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	want := []string{"one", "two", long[:maxLineBytes], long[maxLineBytes:], "last"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got %d bytes, want %d", i, len(got[i]), len(want[i]))
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	dir := t.TempDir()
+	w := &writer{opt: &cli.Context{LogPath: dir, Name: "vm"}}
+	if err := w.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a full file is rotated before the next line
+	w.written = maxFileBytes
+
+	guest, host := net.Pipe()
+	go func() {
+		_, _ = guest.Write([]byte("boot\nready\n"))
+		_ = guest.Close()
+	}()
+
+	if err := forward(host, w); err != nil {
+		t.Fatalf("forward failed: %v", err)
+	}
+	w.close()
+
+	data, err := os.ReadFile(path.Join(dir, "vm-guest.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "[INFO]: boot") || !strings.HasSuffix(lines[1], "[INFO]: ready") {
+		t.Errorf("guest log = %q", data)
+	}
+	if _, err := os.Stat(path.Join(dir, "vm-guest.2.log")); err != nil {
+		t.Errorf("full file not rotated: %v", err)
+	}
+	if w.written != len("boot")+len("ready") {
+		t.Errorf("written = %d after the rotation", w.written)
+	}
+}
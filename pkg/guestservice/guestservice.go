@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package guestservice watches systemd units in the guest, so a crashing podman is visible on the host although the VM is ready.
+package guestservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// checkInterval is how often the states are read, one ssh command checks all units
+	checkInterval = 10 * time.Second
+	// journalLines are sent with GuestServiceFailed
+	journalLines = 10
+)
+
+const (
+	stateUnknown = "unknown"
+	stateFailed  = "failed"
+	stateActive  = "active"
+)
+
+// serviceEvent is the message of GuestServiceFailed and GuestServiceRecovered.
+type serviceEvent struct {
+	Unit    string   `json:"unit"`
+	State   string   `json:"state"`
+	Journal []string `json:"journal,omitempty"`
+}
+
+type unit struct {
+	cli.GuestUnit
+	status   cli.GuestServiceStatus
+	failures []time.Time
+	// nRestarts is the NRestarts of systemd at the last check, -1 before the first one
+	nRestarts int
+}
+
+// observation is the state of a unit read by one check.
+type observation struct {
+	state string
+	// nRestarts counts the automatic restarts of systemd (Restart=), -1 if unknown
+	nRestarts int
+}
+
+// Run checks the watched units every checkInterval after the VM is ready, until ctx is done.
+// The states are read via SSH, the guest agent does not report them.
+func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) {
+	if !opt.SocketEnabled(cli.SocketNetwork) {
+		log.Info("skip watching the guest units, the guest has no network for ssh")
+		return
+	}
+
+	units := make([]*unit, 0, len(opt.GuestUnits))
+	for _, u := range opt.GuestUnits {
+		units = append(units, &unit{
+			GuestUnit: u,
+			status:    cli.GuestServiceStatus{Unit: u.Name, State: stateUnknown},
+			nRestarts: -1,
+		})
+	}
+	publish(opt, units)
+
+	g.Go(func() error {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		checkFailed := false
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			if opt.BootedAt().IsZero() {
+				continue
+			}
+
+			states, err := readStates(opt, units)
+			if err != nil {
+				// e.g. the VM is paused, only the first failure in a row is logged
+				if !checkFailed {
+					log.Warnf("check guest services failed: %v", err)
+				}
+				checkFailed = true
+				continue
+			}
+			checkFailed = false
+
+			now := time.Now()
+			for _, u := range units {
+				update(opt, log, u, states[u.Name], now)
+			}
+			publish(opt, units)
+		}
+	})
+}
+
+func publish(opt *cli.Context, units []*unit) {
+	s := make([]cli.GuestServiceStatus, 0, len(units))
+	for _, u := range units {
+		s = append(s, u.status)
+	}
+	opt.SetGuestServices(s)
+}
+
+// readStates returns the state of every unit, as printed by systemctl is-active, and its NRestarts.
+func readStates(opt *cli.Context, units []*unit) (map[string]observation, error) {
+	names := make([]string, 0, len(units))
+	for _, u := range units {
+		names = append(names, u.Name)
+	}
+
+	// is-active exits non-zero for every state but active, so it is run per unit
+	out, err := opt.RunInGuest(fmt.Sprintf(`for u in %s; do echo "$u $(systemctl is-active "$u") $(systemctl show -p NRestarts --value "$u")"; done`, strings.Join(names, " ")))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseStates(out), nil
+}
+
+func parseStates(out string) map[string]observation {
+	states := map[string]observation{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		o := observation{state: fields[1], nRestarts: -1}
+		// only services have NRestarts, it is empty for sockets, timers, ...
+		if len(fields) > 2 {
+			if n, err := strconv.Atoi(fields[2]); err == nil {
+				o.nRestarts = n
+			}
+		}
+		states[fields[0]] = o
+	}
+
+	return states
+}
+
+func update(opt *cli.Context, log *logger.Context, u *unit, o observation, now time.Time) {
+	previous := u.status.State
+	if u.observe(o, now) == 0 && o.state == previous {
+		return
+	}
+
+	state := u.status.State
+	switch {
+	case state == stateFailed && previous != stateFailed:
+		journal, err := readJournal(opt, u.Name)
+		if err != nil {
+			log.Warnf("read journal of %s failed: %v", u.Name, err)
+		}
+		u.status.Journal = journal
+
+		log.Warnf("guest service %s failed (%d times within %s)", u.Name, u.status.Failures, cli.GuestServiceFailureWindow)
+		notify(event.GuestServiceFailed, serviceEvent{Unit: u.Name, State: state, Journal: journal})
+
+	case state == stateActive && previous == stateFailed:
+		log.Infof("guest service %s recovered", u.Name)
+		notify(event.GuestServiceRecovered, serviceEvent{Unit: u.Name, State: state})
+	}
+
+	if u.RestartAfter != 0 && u.status.Failures >= u.RestartAfter {
+		restart(opt, log, u)
+	}
+}
+
+// observe applies a check to the status and returns the new failures: every check finding the unit failed counts,
+// so does every automatic restart of systemd since the last check, which may hide a failure between two checks.
+func (u *unit) observe(o observation, now time.Time) int {
+	if o.state == "" {
+		o.state = stateUnknown
+	}
+
+	n := 0
+	if o.state == stateFailed {
+		n++
+	}
+	if o.nRestarts > u.nRestarts && u.nRestarts >= 0 {
+		n += o.nRestarts - u.nRestarts
+	}
+	u.nRestarts = o.nRestarts
+
+	for i := 0; i < n; i++ {
+		u.failures = append(u.failures, now)
+	}
+	u.failures = recent(u.failures, now)
+	u.status.Failures = len(u.failures)
+
+	if o.state != u.status.State {
+		u.status.State = o.state
+		u.status.Since = now
+	}
+
+	return n
+}
+
+// restart applies the restart policy of the unit, its failures are counted again afterwards.
+func restart(opt *cli.Context, log *logger.Context, u *unit) {
+	log.Infof("restart guest service %s, it failed %d times within %s", u.Name, u.status.Failures, cli.GuestServiceFailureWindow)
+
+	// reset-failed lifts the start limit of systemd, which keeps a unit failing too often stopped
+	if _, err := opt.RunInGuest(fmt.Sprintf("systemctl reset-failed %[1]s; systemctl restart %[1]s", u.Name)); err != nil {
+		log.Warnf("restart guest service %s failed: %v", u.Name, err)
+		return
+	}
+
+	u.restarted()
+}
+
+// restarted starts counting the failures again, reset-failed also resets NRestarts.
+func (u *unit) restarted() {
+	u.status.Restarts++
+	u.failures = nil
+	u.status.Failures = 0
+	u.nRestarts = -1
+}
+
+func readJournal(opt *cli.Context, name string) ([]string, error) {
+	out, err := opt.RunInGuest(fmt.Sprintf("journalctl -u %s -n %d --no-pager -o cat", name, journalLines))
+	if err != nil {
+		return nil, err
+	}
+
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, nil
+	}
+
+	return strings.Split(out, "\n"), nil
+}
+
+// recent drops the failures older than GuestServiceFailureWindow.
+func recent(failures []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) > cli.GuestServiceFailureWindow {
+		i++
+	}
+
+	return failures[i:]
+}
+
+func notify(name event.Name, e serviceEvent) {
+	if data, err := json.Marshal(e); err == nil {
+		event.NotifyWithMessage(name, string(data))
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package guestservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func TestParseStates(t *testing.T) {
+	states := parseStates("podman.socket active \nmy-agent.service failed 3\nbroken\nother.service activating x\n")
+
+	want := map[string]observation{
+		"podman.socket":    {state: "active", nRestarts: -1},
+		"my-agent.service": {state: "failed", nRestarts: 3},
+		"other.service":    {state: "activating", nRestarts: -1},
+	}
+	if len(states) != len(want) {
+		t.Fatalf("states %v, want %v", states, want)
+	}
+	for name, o := range want {
+		if states[name] != o {
+			t.Errorf("%s: %+v, want %+v", name, states[name], o)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	u := &unit{
+		GuestUnit: cli.GuestUnit{Name: "my-agent.service", RestartAfter: 3},
+		status:    cli.GuestServiceStatus{Unit: "my-agent.service", State: stateUnknown},
+		nRestarts: -1,
+	}
+	now := time.Now()
+
+	steps := []struct {
+		o        observation
+		new      int
+		failures int
+	}{
+		// the first NRestarts is only the baseline
+		{observation{stateActive, 5}, 0, 0},
+		// systemd restarted it twice between the checks, it looks active again
+		{observation{stateActive, 7}, 2, 2},
+		// every check finding it failed counts, not only the transition
+		{observation{stateFailed, 7}, 1, 3},
+		{observation{stateFailed, 7}, 1, 4},
+	}
+	for i, step := range steps {
+		now = now.Add(checkInterval)
+		if n := u.observe(step.o, now); n != step.new {
+			t.Errorf("step %d: %d new failures, want %d", i, n, step.new)
+		}
+		if u.status.Failures != step.failures || u.status.State != step.o.state {
+			t.Errorf("step %d: status %+v, want %d failures and state %s", i, u.status, step.failures, step.o.state)
+		}
+	}
+
+	u.restarted()
+	if u.status.Failures != 0 || len(u.failures) != 0 || u.status.Restarts != 1 {
+		t.Errorf("after a restart: %+v, want the failures reset", u.status)
+	}
+
+	// reset-failed resets NRestarts, a lower value is a new baseline
+	if n := u.observe(observation{stateActive, 0}, now.Add(checkInterval)); n != 0 {
+		t.Errorf("%d new failures after the restart, want 0", n)
+	}
+
+	// failures older than the window are dropped
+	u.observe(observation{stateFailed, 0}, now)
+	if u.observe(observation{stateActive, 0}, now.Add(cli.GuestServiceFailureWindow+time.Second)); u.status.Failures != 0 {
+		t.Errorf("%d failures after the window, want 0", u.status.Failures)
+	}
+}
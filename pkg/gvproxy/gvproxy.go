@@ -5,8 +5,11 @@ package gvproxy
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -15,21 +18,23 @@ import (
 	"time"
 
 	"github.com/containers/gvisor-tap-vsock/pkg/sshclient"
-	"github.com/containers/gvisor-tap-vsock/pkg/transport"
 	"github.com/containers/gvisor-tap-vsock/pkg/types"
 	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
 	"github.com/oomol-lab/ovm/pkg/channel"
 	"github.com/oomol-lab/ovm/pkg/cli"
 	"github.com/oomol-lab/ovm/pkg/ipc/event"
 	"github.com/oomol-lab/ovm/pkg/logger"
+	"github.com/oomol-lab/ovm/pkg/utils"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
+	"inet.af/tcpproxy"
 )
 
 const (
 	gatewayIP   = "192.168.127.1"
 	sshHostPort = "192.168.127.2:22"
 	hostIP      = "192.168.127.254"
+	defaultMTU  = 5000
 	host        = "host"
 	gateway     = "gateway"
 )
@@ -40,11 +45,23 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		return fmt.Errorf("create gvproxy logger error: %v", err)
 	}
 
+	// the MTU is also sent to the guest by the DHCP server
+	mtu := defaultMTU
+	if opt.MTU != 0 {
+		mtu = opt.MTU
+	}
+	log.Infof("MTU: %d", mtu)
+
+	domains, err := searchDomains(opt, log)
+	if err != nil {
+		return err
+	}
+
 	config := types.Configuration{
 		Debug:             false,
 		CaptureFile:       "",
-		MTU:               5000,
-		Subnet:            "192.168.127.0/24",
+		MTU:               mtu,
+		Subnet:            cli.GuestSubnet,
 		GatewayIP:         gatewayIP,
 		GatewayMacAddress: "5a:94:ef:e4:0c:dd",
 		DHCPStaticLeases: map[string]string{
@@ -78,10 +95,7 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 				},
 			},
 		},
-		DNSSearchDomains: searchDomains(log),
-		Forwards: map[string]string{
-			fmt.Sprintf("127.0.0.1:%d", opt.SSHPort): sshHostPort,
-		},
+		DNSSearchDomains: domains,
 		NAT: map[string]string{
 			hostIP: "127.0.0.1",
 		},
@@ -96,9 +110,15 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		return err
 	}
 
-	{
+	log.Infof("forward ssh port %d to %s", opt.SSHPort, sshHostPort)
+	if err := sshForward(ctx, g, log, opt.SSHPortListener, vn); err != nil {
+		return fmt.Errorf("forward ssh port failed: %w", err)
+	}
+
+	// with -disable-sockets network the guest has no network device, the virtual network stays unused
+	if opt.SocketNetworkPath != "" {
 		log.Infof("listening %s", opt.Endpoint)
-		ln, err := transport.Listen(opt.Endpoint)
+		ln, err := utils.ListenUnix(opt.SocketNetworkPath, opt.SocketBacklog)
 		if err != nil {
 			return errors.Wrap(err, "cannot listen")
 		}
@@ -111,26 +131,134 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/services/forwarder/all", vn.Mux())
-	mux.Handle("/services/forwarder/expose", vn.Mux())
-	mux.Handle("/services/forwarder/unexpose", vn.Mux())
+	mux.Handle("/services/forwarder/expose", exposeFilter(log, opt, false, vn.Mux()))
+	mux.Handle("/services/forwarder/unexpose", exposeFilter(log, opt, true, vn.Mux()))
 	httpServe(ctx, g, ln, mux)
 
 	channel.NotifyGVProxyReady()
 	event.Notify(event.GVProxyReady)
 
+	if opt.ForwardSocketPath == "" {
+		log.Info("skip create socket forward, because the podman socket is disabled")
+		return nil
+	}
+
 	g.Go(func() error {
 		select {
 		case <-ctx.Done():
-			log.Info("skip create ssh forward, because context done")
+			log.Info("skip create socket forward, because context done")
 			return nil
 		case <-channel.ReceiveVMReady():
-			log.Info("VM is ready, creating podman socket forward")
+			log.Info("VM is ready, creating socket forward")
 			break
 		}
 
+		socketForward(ctx, g, log, opt, vn, "podman", opt.ForwardSocketPath)
+		if opt.ExposeDockerSocket {
+			// podman serves the Docker compatible API on the same socket
+			socketForward(ctx, g, log, opt, vn, "docker", opt.DockerSocketPath)
+		}
+
+		probePodmanVersion(ctx, g, log, opt)
+
+		return nil
+	})
+
+	return nil
+}
+
+// exposeFilter applies -allow-from to the port forwards the guest requests, see cli.ExposeAddress.
+// It rewrites the unexpose requests the same way, so they still find the narrowed forward.
+func exposeFilter(log *logger.Context, opt *cli.Context, unexpose bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the fields of an unexpose request are a subset of it
+		var req types.ExposeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the local address of unix and npipe forwards is a path
+		if req.Protocol == "" || req.Protocol == types.TCP || req.Protocol == types.UDP {
+			local, err := opt.ExposeAddress(req.Local)
+			switch {
+			case err != nil && !unexpose:
+				log.Warnf("reject port forward of the guest: %v", err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			case err == nil && local != req.Local:
+				if !unexpose {
+					log.Infof("bind port forward %s of the guest to %s", req.Local, local)
+				}
+				req.Local = local
+			}
+		}
+
+		var body []byte
+		var err error
+		if unexpose {
+			body, err = json.Marshal(types.UnexposeRequest{Local: req.Local, Protocol: req.Protocol})
+		} else {
+			body, err = json.Marshal(req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// probePodmanVersion reports the podman version of the guest, so client/server mismatches can be diagnosed.
+// It retries until the podman socket answers, podman.socket may start after the VM is ready.
+// With -strict a podman outside the expected versions stops ovm instead of being reported as ready.
+func probePodmanVersion(ctx context.Context, g *errgroup.Group, log *logger.Context, opt *cli.Context) {
+	g.Go(func() error {
+		deadline := time.Now().Add(time.Minute)
+		for {
+			v, err := opt.ProbePodmanVersion(ctx)
+			if err == nil {
+				log.Infof("podman version in guest: %s, API version: %s", v.Version, v.APIVersion)
+				if !v.Compatible {
+					if err := opt.Warn(log, cli.WarnPodmanIncompatible, "podman %s in guest is not %s", v.Version, opt.PodmanVersionRange()); err != nil {
+						return err
+					}
+				}
+
+				if data, err := json.Marshal(v); err == nil {
+					event.NotifyWithMessage(event.PodmanReady, string(data))
+				}
+				return nil
+			}
+
+			if time.Now().After(deadline) {
+				return opt.Warn(log, cli.WarnPodmanProbeFailed, "probe podman version failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(2 * time.Second):
+			}
+		}
+	})
+}
+
+// socketForward forwards the podman socket in the guest to the unix socket p on the host.
+func socketForward(ctx context.Context, g *errgroup.Group, log *logger.Context, opt *cli.Context, vn *virtualnetwork.VirtualNetwork, name, p string) {
+	g.Go(func() error {
+		log.Infof("creating %s socket forward: %s", name, p)
+
 		src := &url.URL{
 			Scheme: "unix",
-			Path:   opt.ForwardSocketPath,
+			Path:   p,
 		}
 
 		dest := &url.URL{
@@ -139,7 +267,7 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 			Host:   sshHostPort,
 			Path:   "/run/podman/podman.sock",
 		}
-		defer os.RemoveAll(opt.ForwardSocketPath)
+		defer os.RemoveAll(p)
 
 		log.Infof("ssh private key path: %s", opt.SSHPrivateKeyPath)
 		forward, err := sshclient.CreateSSHForward(ctx, src, dest, opt.SSHPrivateKeyPath, vn)
@@ -160,21 +288,46 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 				// proceed
 			}
 			err := forward.AcceptAndTunnel(ctx)
+			log.Tracef(logger.NetworkForward, "%s socket forward connection closed, error: %v", name, err)
 			if err != nil {
-				log.Infof("Error occurred handling ssh forwarded connection: %q", err)
+				log.Infof("Error occurred handling ssh forwarded %s connection: %q", name, err)
 			}
 		}
 		return nil
 	})
+}
+
+// sshForward proxies the SSH port on the host to the sshd in the guest.
+// The listener was already bound during setup, reusing it here means the port is never released in between.
+func sshForward(ctx context.Context, g *errgroup.Group, log *logger.Context, ln net.Listener, vn *virtualnetwork.VirtualNetwork) error {
+	var p tcpproxy.Proxy
+	p.ListenFunc = func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	}
+	p.AddRoute(ln.Addr().String(), &tcpproxy.DialProxy{
+		Addr: sshHostPort,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			log.Tracef(logger.NetworkForward, "forward ssh connection to %s", addr)
+			return vn.DialContextTCP(ctx, addr)
+		},
+	})
+
+	if err := p.Start(); err != nil {
+		return err
+	}
+
+	g.Go(func() error {
+		<-ctx.Done()
+		return p.Close()
+	})
 
 	return nil
 }
 
-func searchDomains(log *logger.Context) []string {
+func searchDomains(opt *cli.Context, log *logger.Context) ([]string, error) {
 	f, err := os.Open("/etc/resolv.conf")
 	if err != nil {
-		log.Warnf("open /etc/resolv.conf file error: %v", err)
-		return nil
+		return nil, opt.Warn(log, cli.WarnResolvConf, "open /etc/resolv.conf file error: %v", err)
 	}
 	defer f.Close()
 
@@ -184,14 +337,13 @@ func searchDomains(log *logger.Context) []string {
 		if strings.HasPrefix(sc.Text(), searchPrefix) {
 			searchDomains := strings.Split(strings.TrimPrefix(sc.Text(), searchPrefix), " ")
 			log.Warnf("Using search domains: %v", searchDomains)
-			return searchDomains
+			return searchDomains, nil
 		}
 	}
 	if err := sc.Err(); err != nil {
-		log.Warnf("scan /etc/resolv.conf file error: %v", err)
-		return nil
+		return nil, opt.Warn(log, cli.WarnResolvConf, "scan /etc/resolv.conf file error: %v", err)
 	}
-	return nil
+	return nil, nil
 }
 
 func httpServe(ctx context.Context, g *errgroup.Group, ln net.Listener, mux http.Handler) {
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package gvproxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func TestExposeFilter(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ovm-gvproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := logger.New(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	opt := &cli.Context{AllowFrom: []*net.IPNet{loopback}}
+
+	tests := []struct {
+		unexpose bool
+		body     string
+		status   int
+		local    string
+	}{
+		{false, `{"local":"0.0.0.0:8080","remote":"192.168.127.2:80"}`, http.StatusOK, "127.0.0.1:8080"},
+		{false, `{"local":"127.0.0.1:8080","remote":"192.168.127.2:80","protocol":"udp"}`, http.StatusOK, "127.0.0.1:8080"},
+		{false, `{"local":"192.168.1.5:8080","remote":"192.168.127.2:80"}`, http.StatusForbidden, ""},
+		{false, `{"local":"/tmp/a.sock","remote":"ssh-tunnel://x","protocol":"unix"}`, http.StatusOK, "/tmp/a.sock"},
+		{true, `{"local":"0.0.0.0:8080"}`, http.StatusOK, "127.0.0.1:8080"},
+		{true, `{"local":"192.168.1.5:8080"}`, http.StatusOK, "192.168.1.5:8080"},
+	}
+
+	for _, tt := range tests {
+		var got types.ExposeRequest
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("decode forwarded request: %v", err)
+			}
+		})
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/services/forwarder/expose", strings.NewReader(tt.body))
+		exposeFilter(log, opt, tt.unexpose, next).ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.body, w.Code, tt.status)
+			continue
+		}
+		if got.Local != tt.local {
+			t.Errorf("%s: forwarded local %q, want %q", tt.body, got.Local, tt.local)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package handover passes listening sockets from a running ovm to the ovm replacing it (SCM_RIGHTS),
+// so connections of clients are queued by the kernel instead of refused while the instances switch.
+package handover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+// maxListeners bounds the control message of Receive.
+const maxListeners = 16
+
+// message lists the names of the listeners, in the order of the passed descriptors.
+type message struct {
+	Names []string `json:"names"`
+}
+
+// Serve hands duplicates of the listeners to every process connecting to the socket at p, until ctx is done.
+// The listeners keep accepting in this process, the connections are drained until it exits.
+// onHandover is called after the listeners were passed.
+func Serve(ctx context.Context, g *errgroup.Group, p string, listeners map[string]net.Listener, log *logger.Context, onHandover func(names []string)) error {
+	_ = os.Remove(p)
+	ln, err := net.Listen("unix", p)
+	if err != nil {
+		return fmt.Errorf("listen handover socket failed: %w", err)
+	}
+
+	g.Go(func() error {
+		<-ctx.Done()
+		return ln.Close()
+	})
+
+	g.Go(func() error {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warnf("accept handover connection failed: %v", err)
+				}
+				return nil
+			}
+
+			names, err := send(conn.(*net.UnixConn), listeners)
+			_ = conn.Close()
+			if err != nil {
+				log.Warnf("hand over listeners failed: %v", err)
+				continue
+			}
+
+			log.Infof("handed over listeners: %v", names)
+			if onHandover != nil {
+				onHandover(names)
+			}
+		}
+	})
+
+	return nil
+}
+
+func send(conn *net.UnixConn, listeners map[string]net.Listener) ([]string, error) {
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var fds []int
+	for _, name := range names {
+		ul, ok := listeners[name].(*net.UnixListener)
+		if !ok {
+			return nil, fmt.Errorf("listener %s is not a unix listener", name)
+		}
+
+		// File dups the descriptor, the listener of this process is not affected
+		f, err := ul.File()
+		if err != nil {
+			return nil, fmt.Errorf("get descriptor of %s failed: %w", name, err)
+		}
+		defer f.Close()
+
+		fds = append(fds, int(f.Fd()))
+	}
+
+	data, err := json.Marshal(&message{Names: names})
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.WriteMsgUnix(data, unix.UnixRights(fds...), nil); err != nil {
+		return nil, err
+	}
+
+	// the socket files belong to the receiver now, closing the listeners on exit must not unlink them
+	for _, name := range names {
+		listeners[name].(*net.UnixListener).SetUnlinkOnClose(false)
+	}
+
+	return names, nil
+}
+
+// Receive asks the ovm serving the handover socket at p for its listeners, by name.
+// It fails when no ovm serves the socket, the caller then creates its listeners as usual.
+func Receive(p string, timeout time.Duration) (map[string]net.Listener, error) {
+	c, err := net.DialTimeout("unix", p, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	conn := c.(*net.UnixConn)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(maxListeners*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("read handover message failed: %w", err)
+	}
+
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, 0, len(fds))
+	for _, fd := range fds {
+		unix.CloseOnExec(fd)
+		files = append(files, os.NewFile(uintptr(fd), "handover"))
+	}
+	// FileListener dups the descriptors again
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	var msg message
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		return nil, fmt.Errorf("decode handover message failed: %w", err)
+	}
+	if len(msg.Names) != len(files) {
+		return nil, fmt.Errorf("handover message names %d listeners, but %d were passed", len(msg.Names), len(files))
+	}
+
+	result := make(map[string]net.Listener, len(files))
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		if err != nil {
+			for _, l := range result {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("listener %s: %w", msg.Names[i], err)
+		}
+		result[msg.Names[i]] = l
+	}
+
+	return result, nil
+}
+
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("parse handover control message failed: %w", err)
+	}
+
+	var fds []int
+	for i := range msgs {
+		rights, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+
+	if len(fds) == 0 {
+		return nil, errors.New("no listeners were passed")
+	}
+
+	return fds, nil
+}
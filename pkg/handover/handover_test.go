@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package handover
+
+import (
+	"context"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+// socket paths are limited to about 100 bytes, t.TempDir may be too long
+func shortTempDir(t *testing.T) string {
+	d, err := os.MkdirTemp("", "ovm-handover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(d) })
+
+	return d
+}
+
+func TestReplace(t *testing.T) {
+	d := shortTempDir(t)
+	restful := path.Join(d, "restful.sock")
+
+	old, err := net.Listen("unix", restful)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := logger.NewWithoutManage(d, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := errgroup.Group{}
+	handed := make(chan []string, 1)
+	if err := Serve(ctx, &g, path.Join(d, "handover.sock"), map[string]net.Listener{"restful": old}, log, func(names []string) {
+		handed <- names
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	listeners, err := Receive(path.Join(d, "handover.sock"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := <-handed; len(names) != 1 || names[0] != "restful" {
+		t.Fatalf("handed over %v, want [restful]", names)
+	}
+
+	// the replaced ovm exits, its listener is closed
+	cancel()
+	_ = g.Wait()
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(restful); err != nil {
+		t.Fatalf("socket file removed by the replaced ovm: %v", err)
+	}
+
+	l := listeners["restful"]
+	defer l.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			_ = c.Close()
+		}
+		accepted <- err
+	}()
+
+	c, err := net.DialTimeout("unix", restful, time.Second)
+	if err != nil {
+		t.Fatalf("dial the socket after the replace: %v", err)
+	}
+	_ = c.Close()
+
+	if err := <-accepted; err != nil {
+		t.Fatalf("accept on the received listener: %v", err)
+	}
+}
+
+func TestReceiveWithoutServer(t *testing.T) {
+	if _, err := Receive(path.Join(shortTempDir(t), "handover.sock"), 100*time.Millisecond); err == nil {
+		t.Fatal("receive without a serving ovm succeeded")
+	}
+}
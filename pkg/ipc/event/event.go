@@ -20,15 +20,33 @@ import (
 type Name string
 
 var (
-	Initializing     Name = "Initializing"
-	GVProxyReady     Name = "GVProxyReady"
-	IgnitionProgress Name = "IgnitionProgress"
-	IgnitionDone     Name = "IgnitionDone"
-	VMReady          Name = "VMReady"
-	Exit             Name = "Exit"
-	Error            Name = "Error"
+	Initializing          Name = "Initializing"
+	GVProxyReady          Name = "GVProxyReady"
+	IgnitionProgress      Name = "IgnitionProgress"
+	IgnitionDone          Name = "IgnitionDone"
+	VMReady               Name = "VMReady"
+	PodmanReady           Name = "PodmanReady"
+	BootReport            Name = "BootReport"
+	AssetsPrepared        Name = "AssetsPrepared"
+	ArtifactCorrupt       Name = "ArtifactCorruptionDetected"
+	ClockDrift            Name = "ClockDrift"
+	ThermalThrottled      Name = "ThermalThrottled"
+	ConfigReloaded        Name = "ConfigReloaded"
+	UpdateAvailable       Name = "UpdateAvailable"
+	StorageMisconfigured  Name = "StorageMisconfigured"
+	StorageMigration      Name = "StorageMigration"
+	GuestServiceFailed    Name = "GuestServiceFailed"
+	GuestServiceRecovered Name = "GuestServiceRecovered"
+	TakeoverStarted       Name = "TakeoverStarted"
+	TakeoverDone          Name = "TakeoverDone"
+	AuditWriteFailed      Name = "AuditWriteFailed"
+	Exit                  Name = "Exit"
+	Error                 Name = "Error"
 )
 
+// maxMessageSize keeps the notify URL within what the receiver is expected to accept.
+const maxMessageSize = 4096
+
 type datum struct {
 	name    Name
 	message string
@@ -48,6 +66,18 @@ func Init(opt *cli.Context) error {
 		return err
 	}
 
+	opt.OnAuditFailed(func(e *cli.AuditEntry, err error) {
+		NotifyWithMessage(AuditWriteFailed, fmt.Sprintf("%s %s: %v", e.ID, e.Operation, err))
+	})
+
+	if !opt.SocketEnabled(cli.SocketEvents) {
+		log.Info("events socket disabled, events are neither sent nor streamed")
+		events.mu.Lock()
+		events.disabled = true
+		events.mu.Unlock()
+		return nil
+	}
+
 	if opt.EventSocketPath == "" {
 		log.Info("no socket path, event will not be sent")
 		return nil
@@ -85,6 +115,7 @@ func Subscribe(g *errgroup.Group) {
 			if resp, err := e.client.Get(uri); err != nil {
 				e.log.Warnf("notify %+v event failed: %v", *datum, err)
 			} else {
+				e.log.Tracef(logger.Events, "notify %s event response: %s, message: %s", datum.name, resp.Status, datum.message)
 				_ = resp.Body.Close()
 				if resp.StatusCode != http.StatusOK {
 					e.log.Warnf("notify %+v event failed, status code is: %d", *datum, resp.StatusCode)
@@ -103,6 +134,8 @@ func Subscribe(g *errgroup.Group) {
 }
 
 func Notify(name Name) {
+	events.publish(name, "")
+
 	if e == nil {
 		return
 	}
@@ -112,13 +145,34 @@ func Notify(name Name) {
 	}
 }
 
+// NotifyWithMessage sends an event with a message, e.g. the JSON encoded boot report.
+func NotifyWithMessage(name Name, message string) {
+	events.publish(name, message)
+
+	if e == nil {
+		return
+	}
+
+	e.channel.In() <- &datum{
+		name:    name,
+		message: message,
+	}
+}
+
 func NotifyError(err error) {
+	message := err.Error()
+	if len(message) > maxMessageSize {
+		message = message[:maxMessageSize] + "..."
+	}
+
+	events.publish(Error, message)
+
 	if e == nil {
 		return
 	}
 
 	e.channel.In() <- &datum{
 		name:    Error,
-		message: err.Error(),
+		message: message,
 	}
 }
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// historySize is how many recent events are replayed to reconnecting watchers
+	historySize = 256
+
+	// watcherQueue is how many events may be pending for a watcher before it is dropped
+	watcherQueue = 64
+
+	// maxWatchers limits the concurrent streams, every stream holds a connection open
+	maxWatchers = 8
+)
+
+// StreamIDHeader is the HTTP header of GET /events with the StreamID
+const StreamIDHeader = "Ovm-Event-Stream"
+
+// Event is a sent event, Seq increases by one for every event of this ovm process.
+type Event struct {
+	Seq     uint64    `json:"seq"`
+	Name    Name      `json:"name"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Decode decodes a JSON message, e.g. of BootReport, into v.
+func (e *Event) Decode(v any) error {
+	return json.Unmarshal([]byte(e.Message), v)
+}
+
+type watcher struct {
+	names []Name
+	ch    chan Event
+}
+
+type stream struct {
+	mu sync.Mutex
+	// disabled is set with the events socket component disabled, nothing is kept or streamed then
+	disabled bool
+	id       string
+	seq      uint64
+	history  []Event
+	watchers map[*watcher]struct{}
+}
+
+var events = newStream()
+
+func newStream() *stream {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return &stream{
+		id:       hex.EncodeToString(b),
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+// StreamID identifies this ovm process, sequence numbers of different processes must not be compared.
+func StreamID() string {
+	return events.id
+}
+
+func (s *stream) publish(name Name, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.disabled {
+		return
+	}
+
+	s.seq++
+	ev := Event{
+		Seq:     s.seq,
+		Name:    name,
+		Message: message,
+		Time:    time.Now(),
+	}
+
+	s.history = append(s.history, ev)
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+
+	for w := range s.watchers {
+		if !w.wants(name) {
+			continue
+		}
+
+		select {
+		case w.ch <- ev:
+		default:
+			// too slow, the client reconnects and continues from its last sequence number
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+func (w *watcher) wants(name Name) bool {
+	return len(w.names) == 0 || slices.Contains(w.names, name)
+}
+
+// Watch returns the recorded events after since and a channel of the following events, both filtered by names (all if empty).
+// ok is false when there are too many watchers. The channel is closed when the watcher is too slow or cancel is called.
+func Watch(since uint64, names []Name) (replay []Event, ch <-chan Event, cancel func(), ok bool) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	if len(events.watchers) >= maxWatchers {
+		return nil, nil, nil, false
+	}
+
+	w := &watcher{
+		names: names,
+		ch:    make(chan Event, watcherQueue),
+	}
+
+	for _, ev := range events.history {
+		if ev.Seq > since && w.wants(ev.Name) {
+			replay = append(replay, ev)
+		}
+	}
+
+	events.watchers[w] = struct{}{}
+
+	cancel = func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+
+		if _, ok := events.watchers[w]; ok {
+			delete(events.watchers, w)
+			close(w.ch)
+		}
+	}
+
+	return replay, w.ch, cancel, true
+}
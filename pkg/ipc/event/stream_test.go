@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import "testing"
+
+func TestStreamDisabled(t *testing.T) {
+	s := newStream()
+	s.publish(VMReady, "")
+	if len(s.history) != 1 || s.seq != 1 {
+		t.Fatalf("history %v, seq %d, want one event", s.history, s.seq)
+	}
+
+	s.disabled = true
+	s.publish(VMReady, "")
+	if len(s.history) != 1 || s.seq != 1 {
+		t.Fatalf("a disabled stream kept the event: history %v, seq %d", s.history, s.seq)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer func(s *stream) { events = s }(events)
+	events = newStream()
+
+	events.publish(Initializing, "")
+	events.publish(GVProxyReady, "")
+	events.publish(VMReady, "")
+
+	replay, ch, cancel, ok := Watch(1, []Name{VMReady, IgnitionDone})
+	if !ok {
+		t.Fatal("watch refused")
+	}
+	if len(replay) != 1 || replay[0].Seq != 3 || replay[0].Name != VMReady {
+		t.Errorf("replay %v, want only VMReady after seq 1", replay)
+	}
+
+	events.publish(IgnitionProgress, "50")
+	events.publish(IgnitionDone, "")
+	if ev := <-ch; ev.Name != IgnitionDone || ev.Seq != 5 {
+		t.Errorf("got %+v, want IgnitionDone with seq 5", ev)
+	}
+
+	cancel()
+	if _, open := <-ch; open {
+		t.Error("channel open after cancel")
+	}
+	// a second cancel does nothing
+	cancel()
+}
+
+func TestWatchLimits(t *testing.T) {
+	defer func(s *stream) { events = s }(events)
+	events = newStream()
+
+	// the slow watcher never reads, it is dropped once its queue is full
+	_, slow, cancelSlow, _ := Watch(0, nil)
+	defer cancelSlow()
+	for i := 0; i < watcherQueue+1; i++ {
+		events.publish(VMReady, "")
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != watcherQueue {
+		t.Errorf("slow watcher received %d events before it was dropped, want %d", n, watcherQueue)
+	}
+
+	for i := 0; i < maxWatchers; i++ {
+		_, _, cancel, ok := Watch(0, nil)
+		if !ok {
+			t.Fatalf("watcher %d refused", i)
+		}
+		defer cancel()
+	}
+	if _, _, _, ok := Watch(0, nil); ok {
+		t.Error("more than maxWatchers watchers accepted")
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	s := newStream()
+	for i := 0; i < historySize+10; i++ {
+		s.publish(VMReady, "")
+	}
+	if len(s.history) != historySize || s.history[0].Seq != 11 {
+		t.Errorf("history of %d events from seq %d, want the last %d", len(s.history), s.history[0].Seq, historySize)
+	}
+}
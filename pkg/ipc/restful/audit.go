@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const (
+	// maxAuditBody is how much of the request body is recorded as parameters
+	maxAuditBody = 4096
+	// maxAuditError is how much of the error answered by the handler is recorded
+	maxAuditError = 256
+)
+
+// pendingAuditPaths are recorded as pending before the handler runs as well, ovm may be gone before it answers
+var pendingAuditPaths = map[string]bool{
+	"/stop":            true,
+	"/requestStop":     true,
+	"/resize":          true,
+	"/storage/migrate": true,
+}
+
+// hashedAuditParams are recorded as a hash of their value, e.g. the command of POST /jobs may hold secrets in any form
+var hashedAuditParams = map[string]bool{
+	"command": true,
+}
+
+// auditWriter remembers the status and the error answered by the handler.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	err    bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && w.err.Len() < maxAuditError {
+		w.err.Write(p[:min(len(p), maxAuditError-w.err.Len())])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// audited records the requests changing something (all methods but GET and HEAD) in the audit log, after the handler answered.
+// The pendingAuditPaths are also recorded before, with the same ID and only the query as parameters.
+// The ID of the entry is answered in the X-Ovm-Operation-Id header.
+func (s *Restful) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		e := &cli.AuditEntry{
+			Time:      time.Now(),
+			ID:        cli.NewAuditID(),
+			Operation: r.Method + " " + r.URL.Path,
+			Params:    map[string]string{},
+			UID:       -1,
+		}
+		if p, ok := r.Context().Value(peerKey{}).(*peerInfo); ok {
+			e.PID, e.UID, e.Remote = p.pid, p.uid, p.remote
+		}
+		for k, v := range r.URL.Query() {
+			e.Params[k] = strings.Join(v, ",")
+		}
+		if pendingAuditPaths[r.URL.Path] {
+			pending := *e
+			pending.Outcome = cli.AuditPending
+			s.opt.AuditOrWarn(s.log, &pending)
+		}
+
+		var body bytes.Buffer
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, &limitedBuffer{&body, maxAuditBody}), r.Body}
+
+		w.Header().Set("X-Ovm-Operation-Id", e.ID)
+		aw := &auditWriter{ResponseWriter: w}
+		next(aw, r)
+
+		bodyParams(e.Params, body.Bytes())
+		e.Status = aw.status
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Outcome = cli.AuditOK
+		if e.Status >= http.StatusBadRequest {
+			e.Outcome = cli.AuditFailed
+			e.Error = strings.TrimSpace(aw.err.String())
+		}
+
+		s.opt.AuditOrWarn(s.log, e)
+	}
+}
+
+// bodyParams adds the fields of a JSON object body as parameters.
+// Other bodies, including a JSON body cut at maxAuditBody, are recorded as a hash, they may hold a hashed parameter.
+func bodyParams(params map[string]string, body []byte) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		params["body"] = auditHash(string(body))
+		return
+	}
+
+	for k, v := range fields {
+		var value string
+		if s, ok := v.(string); ok {
+			value = s
+		} else if data, err := json.Marshal(v); err == nil {
+			value = string(data)
+		} else {
+			continue
+		}
+
+		if hashedAuditParams[k] {
+			value = auditHash(value)
+		}
+		params[k] = value
+	}
+}
+
+// auditHash is recorded instead of a value, the same value can be found in the log without its content.
+func auditHash(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// limitedBuffer keeps the first n bytes written, the rest is dropped without failing the reader of the body.
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	n   int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.n - b.buf.Len(); rest > 0 {
+		b.buf.Write(p[:min(len(p), rest)])
+	}
+	return len(p), nil
+}
+
+// auditLog answers GET /audit?limit=N with the last entries of the audit log, latest last.
+func (s *Restful) auditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "get only", http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	s.log.Infof("request /audit, limit: %d", limit)
+	entries, err := s.opt.AuditEntries(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func testAuditRestful(t *testing.T) *Restful {
+	dir, err := os.MkdirTemp("", "ovm-restful")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	log, err := logger.New(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Restful{log: log, opt: &cli.Context{AuditPath: filepath.Join(dir, "test-audit.jsonl")}}
+}
+
+func TestBodyParams(t *testing.T) {
+	secret := `curl -H "X-Api: 12345" https://example.com`
+	quoted, _ := json.Marshal(secret)
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{"fields", `{"socketPath":"/tmp/a.sock","cpus":4}`, map[string]string{"socketPath": "/tmp/a.sock", "cpus": "4"}},
+		{"command is hashed", `{"command":` + string(quoted) + `}`, map[string]string{"command": auditHash(secret)}},
+		{"other bodies are hashed", `command=` + secret, map[string]string{"body": auditHash(`command=` + secret)}},
+		{"empty", "  ", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		params := map[string]string{}
+		bodyParams(params, []byte(tt.body))
+		if len(params) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, params, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if params[k] != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, params[k], v)
+			}
+			if strings.Contains(params[k], "12345") {
+				t.Errorf("%s: %s holds the command in clear: %q", tt.name, k, params[k])
+			}
+		}
+	}
+}
+
+func TestAuditedPending(t *testing.T) {
+	s := testAuditRestful(t)
+
+	tests := []struct {
+		path    string
+		pending bool
+	}{
+		{"/stop", true},
+		{"/resize?cpus=4", true},
+		{"/pause", false},
+	}
+
+	for _, tt := range tests {
+		var during []cli.AuditEntry
+		h := s.audited(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			if during, err = s.opt.AuditEntries(100); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		before, _ := s.opt.AuditEntries(100)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, tt.path, nil))
+		after, err := s.opt.AuditEntries(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id := rec.Header().Get("X-Ovm-Operation-Id")
+		if tt.pending {
+			if len(during) != len(before)+1 {
+				t.Fatalf("%s: no pending entry before the handler ran", tt.path)
+			}
+			if p := during[len(during)-1]; p.ID != id || p.Outcome != cli.AuditPending {
+				t.Fatalf("%s: pending entry %+v, want ID %s", tt.path, p, id)
+			}
+		} else if len(during) != len(before) {
+			t.Fatalf("%s: recorded before the handler ran", tt.path)
+		}
+
+		if last := after[len(after)-1]; last.ID != id || last.Outcome != cli.AuditOK {
+			t.Fatalf("%s: final entry %+v, want ID %s", tt.path, last, id)
+		}
+	}
+}
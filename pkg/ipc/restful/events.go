@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+)
+
+const eventsKeepAlive = 15 * time.Second
+
+// eventFields can be selected with ?fields=
+var eventFields = []string{"seq", "name", "message", "time"}
+
+// events streams the events as server-sent events, ?since=SEQ resumes after a sequence number and ?types=A,B filters them.
+// ?fields=A,B only sends these fields of the events.
+func (s *Restful) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "get only", http.StatusBadRequest)
+		return
+	}
+
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	// a client resuming a stream of another ovm process gets everything that is recorded
+	if id := r.Header.Get(event.StreamIDHeader); id != "" && id != event.StreamID() {
+		since = 0
+	}
+
+	var names []event.Name
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			names = append(names, event.Name(strings.TrimSpace(name)))
+		}
+	}
+
+	fields, err := parseFields(r, eventFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	replay, ch, cancel, ok := event.Watch(since, names)
+	if !ok {
+		http.Error(w, "too many event streams", http.StatusTooManyRequests)
+		return
+	}
+	defer cancel()
+
+	s.log.Infof("request /events from %s, since: %d, types: %v", peer(r), since, names)
+
+	// the stream lives longer than the write timeout of the server
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(event.StreamIDHeader, event.StreamID())
+	sw := newStreamWriter(w, r)
+	defer sw.Close()
+	w.WriteHeader(http.StatusOK)
+
+	write := func(ev event.Event) error {
+		data, err := project(&ev, fields)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(sw, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Name, data); err != nil {
+			return err
+		}
+		return sw.Flush()
+	}
+
+	for _, ev := range replay {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(sw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := sw.Flush(); err != nil {
+				return
+			}
+		case ev, ok := <-ch:
+			if !ok {
+				s.log.Infof("event stream of %s closed, it was too slow", peer(r))
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		}
+	}
+}
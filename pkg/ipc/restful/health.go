@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/Code-Hex/vz/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+func (s *Restful) healthMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		if state := s.vz.State(); state != vz.VirtualMachineStateRunning {
+			http.Error(w, state.String(), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writePrometheus(w, s.metrics(s.vz.State())); err != nil {
+			s.log.Warnf("write metrics failed: %v", err)
+		}
+	})
+
+	return mux
+}
+
+// StartHealth serves /healthz and /metrics on the health endpoint listener.
+func (s *Restful) StartHealth(ctx context.Context, g *errgroup.Group, nl net.Listener) {
+	g.Go(func() error {
+		<-ctx.Done()
+		return nl.Close()
+	})
+
+	g.Go(func() error {
+		return newLimits(s.opt, s.log).server(s.healthMux()).Serve(nl)
+	})
+}
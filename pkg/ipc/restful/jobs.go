@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// jobOutputInterval is how often the output of a followed job is read again.
+const jobOutputInterval = time.Second
+
+type startJob struct {
+	Command string `json:"command"`
+}
+
+// jobs lists the jobs (GET) or starts one (POST {"command":"..."}), the job runs in the guest until it exits.
+func (s *Restful) jobs(w http.ResponseWriter, r *http.Request) {
+	if !s.jobsReady(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.log.Info("request GET /jobs")
+		jobs, err := s.opt.Jobs()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if jobs == nil {
+			jobs = []*cli.Job{}
+		}
+		_ = json.NewEncoder(w).Encode(jobs)
+
+	case http.MethodPost:
+		var body startJob
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.log.Infof("request POST /jobs from %s: %q", peer(r), body.Command)
+		job, err := s.opt.StartJob(body.Command)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.log.Infof("started job %s", job.ID)
+
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(job)
+
+	default:
+		http.Error(w, "get or post only", http.StatusBadRequest)
+	}
+}
+
+// job serves /jobs/ID (GET, DELETE cancels it) and /jobs/ID/output.
+func (s *Restful) job(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if !cli.ValidJobID(id) || (sub != "" && sub != "output") {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.jobsReady(w) {
+		return
+	}
+
+	if sub == "output" {
+		s.jobOutput(w, r, id)
+		return
+	}
+
+	var job *cli.Job
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		s.log.Infof("request GET /jobs/%s", id)
+		job, err = s.opt.Job(id)
+	case http.MethodDelete:
+		s.log.Infof("request DELETE /jobs/%s from %s", id, peer(r))
+		job, err = s.opt.CancelJob(id)
+	default:
+		http.Error(w, "get or delete only", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), jobErrorCode(err))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// jobOutput streams the output from ?offset=N on, ?follow=true keeps streaming until the job finished.
+func (s *Restful) jobOutput(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "get only", http.StatusBadRequest)
+		return
+	}
+
+	var offset int64
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative number of bytes", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	s.log.Infof("request /jobs/%s/output, offset: %d, follow: %t", id, offset, follow)
+
+	job, err := s.opt.Job(id)
+	if err != nil {
+		http.Error(w, err.Error(), jobErrorCode(err))
+		return
+	}
+
+	if follow {
+		// the job may run much longer than the write timeout
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	sw := newStreamWriter(w, r)
+	defer sw.Close()
+
+	for {
+		out, err := s.opt.JobOutput(id, offset)
+		if err != nil {
+			s.log.Warnf("read output of job %s failed: %v", id, err)
+			return
+		}
+		if out != "" {
+			if _, err := io.WriteString(sw, out); err != nil {
+				return
+			}
+			if err := sw.Flush(); err != nil {
+				return
+			}
+			offset += int64(len(out))
+			continue
+		}
+
+		// everything written before the job finished was read
+		if !follow || job.State != cli.JobRunning {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(jobOutputInterval):
+		}
+
+		if job, err = s.opt.Job(id); err != nil {
+			s.log.Warnf("read state of job %s failed: %v", id, err)
+			return
+		}
+	}
+}
+
+func (s *Restful) jobsReady(w http.ResponseWriter) bool {
+	if s.opt.BootedAt().IsZero() {
+		http.Error(w, "the VM is not ready", http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
+func jobErrorCode(err error) int {
+	switch {
+	case errors.Is(err, cli.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cli.ErrJobNotRunning):
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,222 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+type peerKey struct{}
+
+// peerInfo is the other side of the connection, pid and uid are only known on the unix socket.
+type peerInfo struct {
+	pid    int
+	uid    int
+	remote string
+}
+
+func (p *peerInfo) String() string {
+	if p.remote != "" {
+		return p.remote
+	}
+	if p.pid == 0 {
+		return "unknown"
+	}
+
+	return "pid " + strconv.Itoa(p.pid)
+}
+
+// unixKey is true for connections of the unix socket.
+type unixKey struct{}
+
+// connContext records who is on the other side of the connection, so rejected requests can be traced back.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	_, local := c.(*net.UnixConn)
+	ctx = context.WithValue(ctx, unixKey{}, local)
+	return context.WithValue(ctx, peerKey{}, peerOf(c))
+}
+
+func peerOf(c net.Conn) *peerInfo {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return &peerInfo{uid: -1, remote: c.RemoteAddr().String()}
+	}
+
+	p := &peerInfo{uid: -1}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return p
+	}
+
+	_ = raw.Control(func(fd uintptr) {
+		if pid, err := unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID); err == nil {
+			p.pid = pid
+		}
+		if cred, err := unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED); err == nil {
+			p.uid = int(cred.Uid)
+		}
+	})
+
+	return p
+}
+
+func peer(r *http.Request) string {
+	if p, ok := r.Context().Value(peerKey{}).(*peerInfo); ok {
+		return p.String()
+	}
+
+	return r.RemoteAddr
+}
+
+// limits protects the server from misbehaving clients.
+type limits struct {
+	log *logger.Context
+
+	maxBodySize    int64
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	requestTimeout time.Duration
+	inFlight       chan struct{}
+}
+
+func newLimits(opt *cli.Context, log *logger.Context) *limits {
+	return &limits{
+		log:            log,
+		maxBodySize:    opt.RestfulMaxBodySize,
+		readTimeout:    opt.RestfulReadTimeout,
+		writeTimeout:   opt.RestfulWriteTimeout,
+		requestTimeout: opt.RestfulRequestTimeout,
+		inFlight:       make(chan struct{}, opt.RestfulMaxInFlight),
+	}
+}
+
+func (l *limits) server(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      l.handler(h),
+		ReadTimeout:  l.readTimeout,
+		WriteTimeout: l.writeTimeout,
+		ConnContext:  connContext,
+	}
+}
+
+// streamingPaths stay open for a long time, they are limited by their handlers instead of the in-flight cap and the request timeout.
+var streamingPaths = map[string]bool{
+	"/events": true,
+}
+
+// longRunningPaths are served without the request timeout and the write timeout.
+// /bench bounds how long it takes itself, /logs ends with the log files or when the client goes away.
+var longRunningPaths = map[string]bool{
+	"/bench": true,
+	"/logs":  true,
+}
+
+// routeBodySizes are the body limits of the routes reading a body, -restful-max-body-size caps them.
+var routeBodySizes = map[string]int64{
+	"/jobs":           64 << 10,
+	"/vm/socket-path": 4 << 10,
+	"/debug/trace":    4 << 10,
+}
+
+// defaultRouteBodySize is the body limit of the other routes, they read no body, an empty JSON object is tolerated
+const defaultRouteBodySize = 1 << 10
+
+// bodySize returns the body limit of the route.
+func (l *limits) bodySize(path string) int64 {
+	size, ok := routeBodySizes[path]
+	if !ok {
+		size = defaultRouteBodySize
+	}
+
+	return min(size, l.maxBodySize)
+}
+
+// streaming reports whether the request is served by a streaming handler, the output of a followed job streams as well.
+func streaming(r *http.Request) bool {
+	if streamingPaths[r.URL.Path] {
+		return true
+	}
+
+	return strings.HasPrefix(r.URL.Path, "/jobs/") && strings.HasSuffix(r.URL.Path, "/output") && r.URL.Query().Get("follow") == "true"
+}
+
+func (l *limits) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if streaming(r) {
+			l.log.Tracef(logger.Restful, "%s %s from %s, headers: %v", r.Method, r.URL, peer(r), r.Header)
+			r.Body = http.MaxBytesReader(w, r.Body, l.bodySize(r.URL.Path))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case l.inFlight <- struct{}{}:
+			defer func() { <-l.inFlight }()
+		default:
+			l.log.Warnf("reject %s from %s: too many requests in flight (max %d)", r.URL.Path, peer(r), cap(l.inFlight))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		l.log.Tracef(logger.Restful, "%s %s from %s, headers: %v", r.Method, r.URL, peer(r), r.Header)
+
+		maxBodySize := l.bodySize(r.URL.Path)
+		if r.ContentLength > maxBodySize {
+			l.log.Warnf("reject %s from %s: body size %d exceeds %d bytes", r.URL.Path, peer(r), r.ContentLength, maxBodySize)
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		// chunked bodies have no content length, MaxBytesReader enforces the limit while streaming
+		r.Body = &bodyReader{
+			ReadCloser: http.MaxBytesReader(w, r.Body, maxBodySize),
+			onLimit: func() {
+				l.log.Warnf("reject %s from %s: body exceeds %d bytes", r.URL.Path, peer(r), maxBodySize)
+			},
+		}
+
+		if longRunningPaths[r.URL.Path] {
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), l.requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			l.log.Warnf("request %s from %s exceeded the request timeout %s", r.URL.Path, peer(r), l.requestTimeout)
+		}
+	})
+}
+
+type bodyReader struct {
+	io.ReadCloser
+	onLimit func()
+	logged  bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if !b.logged && errors.As(err, &maxBytesErr) {
+		b.logged = true
+		b.onLimit()
+	}
+
+	return n, err
+}
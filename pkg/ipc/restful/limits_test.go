@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func testLimits(t *testing.T) *limits {
+	dir, err := os.MkdirTemp("", "ovm-restful")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	log, err := logger.New(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &limits{
+		log:            log,
+		maxBodySize:    1024,
+		readTimeout:    time.Second,
+		writeTimeout:   time.Second,
+		requestTimeout: 20 * time.Millisecond,
+		inFlight:       make(chan struct{}, 4),
+	}
+}
+
+func TestLimitsRequestTimeout(t *testing.T) {
+	l := testLimits(t)
+
+	tests := map[string]bool{
+		"/info":  true,
+		"/bench": false,
+		"/logs":  false,
+	}
+	for path, bounded := range tests {
+		var hasDeadline bool
+		h := l.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, hasDeadline = r.Context().Deadline()
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+		if hasDeadline != bounded {
+			t.Errorf("%s: request deadline %v, want %v", path, hasDeadline, bounded)
+		}
+	}
+}
+
+func TestLimitsBodySize(t *testing.T) {
+	l := testLimits(t)
+	l.maxBodySize = 16 << 10
+
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/jobs", 8 << 10, http.StatusOK},
+		{"/jobs", 32 << 10, http.StatusRequestEntityTooLarge},
+		{"/vm/socket-path", 4 << 10, http.StatusOK},
+		{"/vm/socket-path", 4<<10 + 1, http.StatusRequestEntityTooLarge},
+		{"/stop", 2, http.StatusOK},
+		{"/stop", 2 << 10, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		for _, chunked := range []bool{false, true} {
+			h := l.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			if chunked {
+				// MaxBytesReader cuts bodies without a content length
+				r.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("%s with %d bytes (chunked %v): status %d, want %d", tt.path, tt.size, chunked, rec.Code, tt.want)
+			}
+		}
+	}
+}
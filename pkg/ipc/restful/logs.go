@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// logFields can be selected with ?fields=
+var logFields = []string{"file", "time", "level", "message"}
+
+type logResponse struct {
+	File    string    `json:"file"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// logs exports the logs since ?since=RFC3339 as text, ?fields=A,B exports these fields of every entry as JSON lines instead.
+func (s *Restful) logs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "get only", http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be RFC 3339", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	fields, err := parseFields(r, logFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.log.Infof("request /logs from %s, since: %s, fields: %v", peer(r), since, fields)
+
+	if len(fields) == 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	sw := newStreamWriter(w, r)
+	defer sw.Close()
+
+	err = s.opt.WalkLogs(r.Context(), since, func(rec *cli.LogRecord) error {
+		if len(fields) == 0 {
+			for _, line := range rec.Lines {
+				if _, err := fmt.Fprintf(sw, "%s | %s\n", rec.File, line); err != nil {
+					return err
+				}
+			}
+			return sw.Flush()
+		}
+
+		// the continuation lines belong to the message
+		message := strings.Join(append([]string{rec.Entry.Message}, rec.Lines[1:]...), "\n")
+		data, err := project(&logResponse{
+			File:    rec.File,
+			Time:    rec.Entry.Time,
+			Level:   rec.Entry.Level,
+			Message: message,
+		}, fields)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(sw, "%s\n", data); err != nil {
+			return err
+		}
+		return sw.Flush()
+	})
+	if err != nil {
+		s.log.Warnf("export logs failed: %v", err)
+	}
+}
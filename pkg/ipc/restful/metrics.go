@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Code-Hex/vz/v3"
+	"github.com/oomol-lab/ovm/pkg/telemetry"
+	"golang.org/x/sync/errgroup"
+)
+
+type metricKind string
+
+const gauge metricKind = "gauge"
+
+type metric struct {
+	name   string
+	help   string
+	kind   metricKind
+	labels map[string]string
+	value  float64
+}
+
+var vmStates = []vz.VirtualMachineState{
+	vz.VirtualMachineStateStopped,
+	vz.VirtualMachineStateRunning,
+	vz.VirtualMachineStatePaused,
+	vz.VirtualMachineStateError,
+	vz.VirtualMachineStateStarting,
+	vz.VirtualMachineStatePausing,
+	vz.VirtualMachineStateResuming,
+	vz.VirtualMachineStateStopping,
+}
+
+// metrics returns all metrics of the current VM, they are shared by all exporters.
+func (s *Restful) metrics(state vz.VirtualMachineState) []metric {
+	name := s.opt.Name
+	ms := make([]metric, 0, len(vmStates)+3)
+
+	for _, st := range vmStates {
+		v := 0.0
+		if st == state {
+			v = 1
+		}
+
+		ms = append(ms, metric{
+			name:   "ovm_vm_state",
+			help:   "Current state of the virtual machine.",
+			kind:   gauge,
+			labels: map[string]string{"name": name, "state": st.String()},
+			value:  v,
+		})
+	}
+
+	ms = append(ms,
+		metric{
+			name:   "ovm_vm_cpus",
+			help:   "Number of CPUs allocated to the virtual machine.",
+			kind:   gauge,
+			labels: map[string]string{"name": name},
+			value:  float64(s.opt.CPUS),
+		},
+		metric{
+			name:   "ovm_vm_memory_bytes",
+			help:   "Amount of memory allocated to the virtual machine in bytes.",
+			kind:   gauge,
+			labels: map[string]string{"name": name},
+			value:  float64(s.opt.MemoryBytes),
+		},
+	)
+
+	if d, ok := s.opt.ClockDrift(); ok {
+		ms = append(ms, metric{
+			name:   "ovm_guest_clock_drift_seconds",
+			help:   "Last measured guest clock minus host clock in seconds.",
+			kind:   gauge,
+			labels: map[string]string{"name": name},
+			value:  d.Seconds(),
+		})
+	}
+
+	return ms
+}
+
+func (s *Restful) startTelemetry(ctx context.Context, g *errgroup.Group) {
+	collect := func() []telemetry.Gauge {
+		ms := s.metrics(s.vz.State())
+		gauges := make([]telemetry.Gauge, 0, len(ms))
+		for _, m := range ms {
+			gauges = append(gauges, telemetry.Gauge{
+				Name:   m.name,
+				Help:   m.help,
+				Labels: m.labels,
+				Value:  m.value,
+			})
+		}
+		return gauges
+	}
+
+	if err := telemetry.Start(ctx, g, s.opt.ObservabilityExport, collect, s.log); err != nil {
+		s.log.Warnf("start telemetry failed: %v", err)
+	}
+	if err := telemetry.StartStatsd(ctx, g, s.opt.ObservabilityExport, collect, s.log); err != nil {
+		s.log.Warnf("start statsd failed: %v", err)
+	}
+}
+
+// writePrometheus writes metrics in the Prometheus text exposition format.
+func writePrometheus(w io.Writer, ms []metric) error {
+	lastName := ""
+	for _, m := range ms {
+		if m.name != lastName {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+				return err
+			}
+			lastName = m.name
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s %g\n", m.name, formatLabels(m.labels), m.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// networkDiagnostics is the view of the userspace network stack (gvproxy), as returned by its own API.
+type networkDiagnostics struct {
+	// Leases are the DHCP leases, IP to MAC address
+	Leases json.RawMessage `json:"leases"`
+	// Switch is the MAC address table of the virtual switch
+	Switch json.RawMessage `json:"switch"`
+	// Counters are the packet, byte and error counters of the network stack
+	Counters json.RawMessage `json:"counters"`
+	// Anonymized is set with -network-diagnostics-anonymize, the leases are then a list with truncated IP addresses
+	Anonymized bool `json:"anonymized"`
+}
+
+type anonymizedLease struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+// anonymizeLeases turns the leases (IP to MAC address) into a list, the truncated addresses would collide as keys.
+// Leases in an unknown format are dropped rather than returned unmodified.
+func anonymizeLeases(data json.RawMessage) json.RawMessage {
+	var leases map[string]string
+	if err := json.Unmarshal(data, &leases); err != nil {
+		return json.RawMessage("null")
+	}
+
+	result := make([]anonymizedLease, 0, len(leases))
+	for ip, mac := range leases {
+		result = append(result, anonymizedLease{IP: cli.AnonymizeIP(ip), MAC: mac})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MAC < result[j].MAC
+	})
+
+	out, _ := json.Marshal(result)
+	return out
+}
+
+func (s *Restful) networkDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "get only", http.StatusBadRequest)
+		return
+	}
+
+	s.log.Info("request /network/diagnostics")
+
+	// gvproxy serves its API on the same socket as the VM network
+	c := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", s.opt.SocketNetworkPath)
+			},
+		},
+	}
+
+	d := &networkDiagnostics{Anonymized: s.opt.NetworkDiagnosticsAnonymized()}
+	for _, item := range []struct {
+		path string
+		dst  *json.RawMessage
+	}{
+		{"/leases", &d.Leases},
+		{"/cam", &d.Switch},
+		{"/stats", &d.Counters},
+	} {
+		data, err := gvproxyGet(r.Context(), c, item.path)
+		if err != nil {
+			s.log.Warnf("network diagnostics failed: %v", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		*item.dst = data
+	}
+
+	if d.Anonymized {
+		d.Leases = anonymizeLeases(d.Leases)
+	}
+
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+func gvproxyGet(ctx context.Context, c *http.Client, p string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://gvproxy"+p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get %s from gvproxy failed: %w", p, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read %s from gvproxy failed: %w", p, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s from gvproxy failed: %s", p, resp.Status)
+	}
+
+	return data, nil
+}
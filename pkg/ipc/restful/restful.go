@@ -9,6 +9,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Code-Hex/vz/v3"
 	"github.com/crc-org/vfkit/pkg/config"
@@ -24,10 +28,36 @@ type stateResponse struct {
 	CanStop        bool   `json:"canStop"`
 	CanPause       bool   `json:"canPause"`
 	CanResume      bool   `json:"canResume"`
+	// BootedAt and Uptime (in seconds) are only set after the VM is ready
+	BootedAt *time.Time `json:"bootedAt,omitempty"`
+	Uptime   int64      `json:"uptime,omitempty"`
+	// ClockDriftMs is guest time minus host time, only set after it was measured
+	ClockDriftMs *int64 `json:"clockDriftMs,omitempty"`
+}
+
+type warningsResponse struct {
+	// Strict are the categories of -strict, their warnings stop ovm
+	Strict   []string      `json:"strict"`
+	Warnings []cli.Warning `json:"warnings"`
 }
 
 type infoResponse struct {
-	PodmanSocketPath string `json:"podmanSocketPath"`
+	// PodmanSocketPath is not set with -disable-sockets podman
+	PodmanSocketPath string `json:"podmanSocketPath,omitempty"`
+	// Sockets are the components whose sockets ovm created
+	Sockets          []string `json:"sockets"`
+	DockerSocketPath string   `json:"dockerSocketPath,omitempty"`
+	RootfsOverlay    string   `json:"rootfsOverlay"`
+	AgentVsockPort   int      `json:"agentVsockPort"`
+	AgentSocketPath  string   `json:"agentSocketPath"`
+	// Podman is only set once the podman service in the guest answered
+	Podman *cli.PodmanVersion `json:"podman,omitempty"`
+	// Power is not set with -no-power-awareness
+	Power *cli.HostPower `json:"power,omitempty"`
+	// Routes are the -route added in the guest at boot
+	Routes []cli.GuestRoute `json:"routes,omitempty"`
+	// WatchArtifacts is the mode of the -watch-artifacts development feature, empty if off
+	WatchArtifacts string `json:"watchArtifacts,omitempty"`
 }
 
 type Restful struct {
@@ -48,23 +78,239 @@ func New(vz *vz.VirtualMachine, vmC *config.VirtualMachine, log *logger.Context,
 
 func (s *Restful) mux() *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+	// routes which are not enabled are not mounted, they answer 404 like unknown routes
+	handle := func(route string, h http.HandlerFunc) {
+		if s.opt.RestfulRouteEnabled(route) {
+			mux.HandleFunc(route, s.audited(h))
+		}
+	}
+
+	handle("/info", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "get only", http.StatusBadRequest)
 			return
 		}
 
+		s.log.Info("request /info")
 		_ = json.NewEncoder(w).Encode(s.info())
 	})
-	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+	handle("/state", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "get only", http.StatusBadRequest)
 			return
 		}
 
+		s.log.Info("request /state")
 		_ = json.NewEncoder(w).Encode(s.state())
 	})
-	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+	handle("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /status")
+		_ = json.NewEncoder(w).Encode(&statusSnapshot{
+			Info:      s.info(),
+			State:     s.state(),
+			Timestamp: time.Now().Unix(),
+		})
+	})
+	handle("/mounts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /mounts")
+		_ = json.NewEncoder(w).Encode(s.opt.Mounts)
+	})
+	handle("/guest/services", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /guest/services")
+		_ = json.NewEncoder(w).Encode(s.opt.GuestServices())
+	})
+	handle("/versions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /versions")
+		v, err := cli.ReadVersions(s.opt.VersionsPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(v)
+	})
+	handle("/events", s.events)
+	handle("/network/diagnostics", s.networkDiagnostics)
+	handle("/logs", s.logs)
+	handle("/bench", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "post only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /bench")
+		result, err := s.opt.Bench(r.Context())
+		if err != nil {
+			s.log.Warnf("bench failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.log.Infof("bench result: %+v", *result)
+		_ = json.NewEncoder(w).Encode(result)
+	})
+	handle("/shutdown-history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /shutdown-history")
+		history, err := cli.ReadShutdownHistory(s.opt.ShutdownHistoryPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(history)
+	})
+	handle("/warnings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /warnings")
+		resp := &warningsResponse{
+			Strict:   s.opt.Strict,
+			Warnings: s.opt.Warnings(),
+		}
+		if resp.Strict == nil {
+			resp.Strict = []string{}
+		}
+		if resp.Warnings == nil {
+			resp.Warnings = []cli.Warning{}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	handle("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /stats")
+		if s.opt.BootedAt().IsZero() {
+			http.Error(w, "the VM is not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		stats, err := s.opt.GuestStats()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(stats)
+	})
+	handle("/storage", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "get only", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("request /storage")
+		if s.opt.BootedAt().IsZero() {
+			http.Error(w, "the VM is not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		status, err := s.opt.CheckStorage()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(status)
+	})
+	handle("/audit", s.auditLog)
+	handle("/storage/migrate", s.migrateStorage)
+	handle("/jobs", s.jobs)
+	if s.opt.RestfulRouteEnabled("/jobs") {
+		mux.HandleFunc("/jobs/", s.audited(s.job))
+	}
+	handle("/vm/socket-path", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			http.Error(w, "patch only", http.StatusBadRequest)
+			return
+		}
+
+		var move cli.SocketMove
+		if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.log.Infof("request PATCH /vm/socket-path: %s", move.SocketPath)
+		sockets, err := s.opt.MoveSockets(move.SocketPath)
+		if err != nil {
+			s.log.Warnf("move sockets failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.log.Infof("moved sockets: %v", sockets)
+		move.Sockets = sockets
+		_ = json.NewEncoder(w).Encode(&move)
+	})
+	handle("/debug/trace", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			toggles := map[string]bool{}
+			if err := json.NewDecoder(r.Body).Decode(&toggles); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := logger.UpdateTraces(toggles); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.log.Infof("request PUT /debug/trace: %v", toggles)
+		default:
+			http.Error(w, "get or put only", http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(logger.Traces())
+	})
+	handle("/resize", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "post only", http.StatusBadRequest)
+			return
+		}
+
+		n, err := strconv.ParseUint(r.URL.Query().Get("cpus"), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid cpus", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Infof("request /resize, cpus: %d", n)
+		if err := s.opt.SetOnlineCPUs(uint(n)); err != nil {
+			s.log.Warnf("resize cpus failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+	handle("/pause", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "post only", http.StatusBadRequest)
 			return
@@ -74,7 +320,7 @@ func (s *Restful) mux() *http.ServeMux {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
-	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+	handle("/resume", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "post only", http.StatusBadRequest)
 			return
@@ -84,23 +330,23 @@ func (s *Restful) mux() *http.ServeMux {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
-	mux.HandleFunc("/requestStop", func(w http.ResponseWriter, r *http.Request) {
+	handle("/requestStop", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "post only", http.StatusBadRequest)
 			return
 		}
 
-		if err := s.requestStop(); err != nil {
+		if err := s.requestStop(peer(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
-	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
+	handle("/stop", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "post only", http.StatusBadRequest)
 			return
 		}
 
-		if err := s.stop(); err != nil {
+		if err := s.stop(peer(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
@@ -109,29 +355,61 @@ func (s *Restful) mux() *http.ServeMux {
 }
 
 func (s *Restful) Start(ctx context.Context, g *errgroup.Group, nl net.Listener) {
+	var disabled []string
+	for _, r := range append(slices.Clone(cli.RestfulReadOnlyRoutes), cli.RestfulControlRoutes...) {
+		if !s.opt.RestfulRouteEnabled(r) {
+			disabled = append(disabled, r)
+		}
+	}
+	if len(disabled) != 0 {
+		s.log.Infof("restful routes not served: %s", strings.Join(disabled, ","))
+	}
+
 	g.Go(func() error {
 		<-ctx.Done()
 		return nl.Close()
 	})
 
 	g.Go(func() error {
-		server := &http.Server{
-			Handler: s.mux(),
-		}
-		return server.Serve(nl)
+		return newLimits(s.opt, s.log).server(s.mux()).Serve(nl)
 	})
 }
 
+// StartExports starts the status snapshots and the metric exports, also without the restful socket.
+func (s *Restful) StartExports(ctx context.Context, g *errgroup.Group) {
+	s.startSnapshot(ctx, g)
+	s.startTelemetry(ctx, g)
+}
+
 func (s *Restful) info() *infoResponse {
-	s.log.Info("request /info")
+	var power *cli.HostPower
+	if p := s.opt.HostPower(); p.Source != "" {
+		power = &p
+	}
+
+	var sockets []string
+	for _, c := range cli.SocketComponents {
+		if s.opt.SocketEnabled(c) {
+			sockets = append(sockets, c)
+		}
+	}
+
 	return &infoResponse{
 		PodmanSocketPath: s.opt.ForwardSocketPath,
+		Sockets:          sockets,
+		DockerSocketPath: s.opt.DockerSocketPath,
+		RootfsOverlay:    s.opt.RootfsOverlay,
+		AgentVsockPort:   s.opt.AgentVsockPort,
+		AgentSocketPath:  s.opt.AgentSocketPath,
+		Podman:           s.opt.PodmanVersion(),
+		Power:            power,
+		Routes:           s.opt.GuestRoutes,
+		WatchArtifacts:   s.opt.WatchArtifacts,
 	}
 }
 
 func (s *Restful) state() *stateResponse {
-	s.log.Info("request /state")
-	return &stateResponse{
+	resp := &stateResponse{
 		State:          s.vz.State().String(),
 		CanStart:       s.vz.CanStart(),
 		CanRequestStop: s.vz.CanRequestStop(),
@@ -139,6 +417,18 @@ func (s *Restful) state() *stateResponse {
 		CanPause:       s.vz.CanPause(),
 		CanResume:      s.vz.CanResume(),
 	}
+
+	if t := s.opt.BootedAt(); !t.IsZero() {
+		resp.BootedAt = &t
+		resp.Uptime = int64(time.Since(t).Seconds())
+	}
+
+	if d, ok := s.opt.ClockDrift(); ok {
+		ms := d.Milliseconds()
+		resp.ClockDriftMs = &ms
+	}
+
+	return resp
 }
 
 func (s *Restful) pause() error {
@@ -161,25 +451,45 @@ func (s *Restful) resume() error {
 	return err
 }
 
-func (s *Restful) requestStop() error {
+func (s *Restful) requestStop(initiator string) error {
 	s.log.Info("request /requestStop")
+	if s.opt.ShutdownCommand != "" {
+		err := s.opt.RunShutdownCommand()
+		if err != nil {
+			s.log.Warnf("request requestStop VM failed: %v", err)
+		} else {
+			s.recordShutdown("requestStop", initiator)
+		}
+		return err
+	}
+
 	ok, err := s.vz.RequestStop()
 	if err != nil {
 		s.log.Warnf("request requestStop VM failed: %v", err)
 	} else if !ok {
 		err = fmt.Errorf("request requestStop VM failed, ok is false")
 		s.log.Warnf("request requestStop VM failed: %v", err)
+	} else {
+		s.recordShutdown("requestStop", initiator)
 	}
 
 	return err
 }
 
-func (s *Restful) stop() error {
+func (s *Restful) stop(initiator string) error {
 	s.log.Info("request /stop")
 	err := s.vz.Stop()
 	if err != nil {
 		s.log.Warnf("request stop VM failed: %v", err)
+	} else {
+		s.recordShutdown("stop", initiator)
 	}
 
 	return err
 }
+
+func (s *Restful) recordShutdown(endpoint, initiator string) {
+	if err := s.opt.RecordShutdown(cli.ShutdownUserAPI, initiator, "/"+endpoint); err != nil {
+		s.log.Warnf("record shutdown failed: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/Code-Hex/vz/v3"
+	"github.com/oomol-lab/ovm/pkg/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+type statusSnapshot struct {
+	Info      *infoResponse  `json:"info"`
+	State     *stateResponse `json:"state"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+// startSnapshot periodically writes status.json and metrics.prom into StatusSnapshotDir.
+// It is a no-op when StatusSnapshotDir is empty.
+func (s *Restful) startSnapshot(ctx context.Context, g *errgroup.Group) {
+	if s.opt.StatusSnapshotDir == "" {
+		return
+	}
+
+	s.log.Infof("status snapshot dir: %s, interval: %s", s.opt.StatusSnapshotDir, s.opt.StatusSnapshotInterval)
+
+	g.Go(func() error {
+		ticker := time.NewTicker(s.opt.StatusSnapshotInterval)
+		defer ticker.Stop()
+
+		stoppedWritten := false
+		for {
+			select {
+			case <-ctx.Done():
+				// ovm is exiting and the VM will be stopped, so the final snapshot always marks the stopped state
+				s.writeSnapshot(vz.VirtualMachineStateStopped)
+				return nil
+			case <-ticker.C:
+			}
+
+			state := s.vz.State()
+			if state == vz.VirtualMachineStateStopped || state == vz.VirtualMachineStateError {
+				if !stoppedWritten {
+					s.writeSnapshot(state)
+					stoppedWritten = true
+				}
+				continue
+			}
+
+			stoppedWritten = false
+			s.writeSnapshot(state)
+		}
+	})
+}
+
+func (s *Restful) writeSnapshot(state vz.VirtualMachineState) {
+	st := s.state()
+	st.State = state.String()
+
+	status, err := json.Marshal(&statusSnapshot{
+		Info:      s.info(),
+		State:     st,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		s.log.Warnf("marshal status snapshot failed: %v", err)
+		return
+	}
+
+	if err := utils.WriteFileAtomic(path.Join(s.opt.StatusSnapshotDir, "status.json"), status, 0644); err != nil {
+		s.log.Warnf("write status snapshot failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, s.metrics(state)); err != nil {
+		s.log.Warnf("format metrics snapshot failed: %v", err)
+		return
+	}
+
+	if err := utils.WriteFileAtomic(path.Join(s.opt.StatusSnapshotDir, "metrics.prom"), buf.Bytes(), 0644); err != nil {
+		s.log.Warnf("write metrics snapshot failed: %v", err)
+	}
+}
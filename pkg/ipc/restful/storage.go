@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+)
+
+// migrateStorage starts moving the container storage to the data disk, the progress is sent as StorageMigration events
+// and returned by GET /storage.
+func (s *Restful) migrateStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "post only", http.StatusBadRequest)
+		return
+	}
+
+	s.log.Info("request /storage/migrate")
+	if s.opt.BootedAt().IsZero() {
+		http.Error(w, "the VM is not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := s.opt.StartStorageMigration(func(m cli.StorageMigration) {
+		switch m.State {
+		case cli.StorageMigrationDone:
+			s.log.Infof("storage migration from %s done", m.Source)
+		case cli.StorageMigrationFailed:
+			s.log.Warnf("storage migration failed in step %s: %s", m.Step, m.Error)
+		}
+
+		if data, err := json.Marshal(m); err == nil {
+			event.NotifyWithMessage(event.StorageMigration, string(data))
+		}
+	})
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, cli.ErrStorageMigrationRunning):
+			code = http.StatusConflict
+		case errors.Is(err, cli.ErrInsufficientSpace):
+			code = http.StatusInsufficientStorage
+		case errors.Is(err, cli.ErrStorageOnDataDisk):
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
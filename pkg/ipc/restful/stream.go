@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// streamWriter writes the response of /logs and /events record by record, gzip compressed if wantGzip.
+type streamWriter struct {
+	w  io.Writer
+	gz *gzip.Writer
+	rc *http.ResponseController
+}
+
+// newStreamWriter must be called before the header is written.
+func newStreamWriter(w http.ResponseWriter, r *http.Request) *streamWriter {
+	s := &streamWriter{
+		w:  w,
+		rc: http.NewResponseController(w),
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if wantGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		s.gz = gzip.NewWriter(w)
+		s.w = s.gz
+	}
+
+	return s
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// Flush sends everything written so far to the client, it is called after every record to keep the latency low.
+func (s *streamWriter) Flush() error {
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return s.rc.Flush()
+}
+
+func (s *streamWriter) Close() error {
+	if s.gz == nil {
+		return nil
+	}
+
+	return s.gz.Close()
+}
+
+// wantGzip reports whether the response is compressed.
+// On the unix socket compressing only costs CPU, a proxy forwarding it over a slow link asks for it with ?compress=gzip.
+func wantGzip(r *http.Request) bool {
+	switch r.URL.Query().Get("compress") {
+	case "gzip":
+		return true
+	case "none":
+		return false
+	}
+
+	if local, _ := r.Context().Value(unixKey{}).(bool); local {
+		return false
+	}
+
+	return acceptsGzip(r.Header.Get("Accept-Encoding"))
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		k, v, found := strings.Cut(strings.TrimSpace(params), "=")
+		if !found || strings.TrimSpace(k) != "q" {
+			return true
+		}
+		if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil || q > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseFields parses ?fields=A,B, only the known fields can be selected. No fields selects all of them.
+func parseFields(r *http.Request, known []string) ([]string, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if !slices.Contains(known, f) {
+			return nil, fmt.Errorf("unknown field %q, known fields: %s", f, strings.Join(known, ","))
+		}
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// project marshals v with only the given fields of its JSON object.
+func project(v any, fields []string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(fields) == 0 {
+		return data, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			selected[f] = v
+		}
+	}
+
+	return json.Marshal(selected)
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"br, *", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0, identity", false},
+		{"*;q=0", false},
+		{"deflate", false},
+		{"xgzip", false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestWantGzip(t *testing.T) {
+	tests := []struct {
+		url   string
+		local bool
+		want  bool
+	}{
+		{"/logs", false, true},
+		{"/logs", true, false},
+		{"/logs?compress=gzip", true, true},
+		{"/logs?compress=none", false, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if tt.local {
+			r = r.WithContext(context.WithValue(r.Context(), unixKey{}, true))
+		}
+		if got := wantGzip(r); got != tt.want {
+			t.Errorf("%s, unix socket %v: wantGzip = %v, want %v", tt.url, tt.local, got, tt.want)
+		}
+	}
+}
+
+func TestStreamWriterGzip(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/logs?compress=gzip", nil)
+	w := httptest.NewRecorder()
+
+	s := newStreamWriter(w, r)
+	if _, err := s.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("headers = %v", w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gz); err != nil || string(data) != "line\n" {
+		t.Errorf("body %q, %v", data, err)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	known := []string{"time", "level", "message"}
+
+	fields, err := parseFields(httptest.NewRequest(http.MethodGet, "/logs?fields=message,+time", nil), known)
+	if err != nil || !slices.Equal(fields, []string{"message", "time"}) {
+		t.Errorf("fields %v, %v", fields, err)
+	}
+
+	if fields, err := parseFields(httptest.NewRequest(http.MethodGet, "/logs", nil), known); err != nil || fields != nil {
+		t.Errorf("no fields: %v, %v, want all", fields, err)
+	}
+
+	if _, err := parseFields(httptest.NewRequest(http.MethodGet, "/logs?fields=time,host", nil), known); err == nil {
+		t.Error("an unknown field was accepted")
+	}
+}
+
+func TestProject(t *testing.T) {
+	v := struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}{"10:00", "INFO", `say "hi"`}
+
+	data, err := project(v, []string{"message", "time", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"message":"say \"hi\"","time":"10:00"}`; string(data) != want {
+		t.Errorf("project = %s, want %s", data, want)
+	}
+
+	if data, err := project(v, nil); err != nil || string(data) != `{"time":"10:00","level":"INFO","message":"say \"hi\""}` {
+		t.Errorf("without fields: %s, %v, want the whole object", data, err)
+	}
+}
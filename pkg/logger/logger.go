@@ -14,6 +14,8 @@ import (
 
 var cs = make([]*Context, 0, 10)
 
+const timeFormat = "2006-01-02 15:04:05.000"
+
 func NewWithoutManage(p, n string) (*Context, error) {
 	c := &Context{
 		path: p,
@@ -120,7 +122,7 @@ func (c *Context) init() error {
 }
 
 func (c *Context) base(t, message string) {
-	d := time.Now().Format("2006-01-02 15:04:05.000")
+	d := time.Now().Format(timeFormat)
 	_, _ = c.write([]byte(fmt.Sprintf("%s [%s]: %s\n", d, t, message)))
 }
 
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Entry is a parsed log line.
+type Entry struct {
+	Time    time.Time
+	Level   string
+	Message string
+}
+
+var levels = map[string]int{
+	"DEBUG": 0,
+	"INFO":  1,
+	"WARN":  2,
+	"ERROR": 3,
+}
+
+// LevelAtLeast reports whether the entry level is greater than or equal to min (e.g. "warn").
+// Unknown levels are always shown.
+func (e *Entry) LevelAtLeast(min string) bool {
+	want, ok := levels[strings.ToUpper(min)]
+	if !ok {
+		return true
+	}
+
+	got, ok := levels[e.Level]
+	if !ok {
+		return true
+	}
+
+	return got >= want
+}
+
+type jsonEntry struct {
+	Time    string `json:"time"`
+	TS      string `json:"ts"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+// ParseLine parses a line written by the logger (text format) or a JSON log line.
+// ok is false when the line does not begin a new entry, e.g. the continuation of a multi-line message.
+func ParseLine(line string) (entry Entry, ok bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+
+	// 2006-01-02 15:04:05.000 [INFO]: message
+	if len(line) < len(timeFormat)+2 {
+		return entry, false
+	}
+
+	t, err := time.ParseInLocation(timeFormat, line[:len(timeFormat)], time.Local)
+	if err != nil {
+		return entry, false
+	}
+
+	rest := line[len(timeFormat)+1:]
+	if !strings.HasPrefix(rest, "[") {
+		return entry, false
+	}
+
+	level, message, found := strings.Cut(rest[1:], "]: ")
+	if !found {
+		return entry, false
+	}
+
+	return Entry{
+		Time:    t,
+		Level:   level,
+		Message: message,
+	}, true
+}
+
+func parseJSONLine(line string) (entry Entry, ok bool) {
+	var j jsonEntry
+	if err := json.Unmarshal([]byte(line), &j); err != nil {
+		return entry, false
+	}
+
+	ts := j.Time
+	if ts == "" {
+		ts = j.TS
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return entry, false
+	}
+
+	return Entry{
+		Time:    t,
+		Level:   strings.ToUpper(j.Level),
+		Message: j.Message,
+	}, true
+}
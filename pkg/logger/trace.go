@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Component is a subsystem whose debug tracing can be toggled at runtime.
+type Component string
+
+var traces = struct {
+	sync.RWMutex
+	enabled map[Component]bool
+}{
+	enabled: map[Component]bool{},
+}
+
+// adding a component only needs one line here
+var (
+	NetworkForward = registerComponent("network-forward")
+	VsockAgent     = registerComponent("vsock-agent")
+	SSH            = registerComponent("ssh")
+	Target         = registerComponent("target")
+	Restful        = registerComponent("restful")
+	Events         = registerComponent("events")
+	PowerSave      = registerComponent("powersave")
+	Setup          = registerComponent("setup")
+)
+
+func registerComponent(name string) Component {
+	traces.enabled[Component(name)] = false
+	return Component(name)
+}
+
+// SetTrace enables or disables tracing of the components.
+func SetTrace(components []string, enabled bool) error {
+	toggles := make(map[string]bool, len(components))
+	for _, c := range components {
+		toggles[strings.TrimSpace(c)] = enabled
+	}
+
+	return UpdateTraces(toggles)
+}
+
+// CheckTrace returns an error for the first unknown component, nothing is changed.
+func CheckTrace(components []string) error {
+	traces.RLock()
+	defer traces.RUnlock()
+
+	for _, c := range components {
+		if err := checkComponent(strings.TrimSpace(c)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkComponent(c string) error {
+	if _, ok := traces.enabled[Component(c)]; !ok {
+		return fmt.Errorf("unknown trace component %s, available: %s", c, strings.Join(traceNames(), ", "))
+	}
+
+	return nil
+}
+
+// UpdateTraces applies the toggles, nothing is changed if any component is unknown.
+func UpdateTraces(toggles map[string]bool) error {
+	traces.Lock()
+	defer traces.Unlock()
+
+	for c := range toggles {
+		if err := checkComponent(c); err != nil {
+			return err
+		}
+	}
+
+	for c, enabled := range toggles {
+		traces.enabled[Component(c)] = enabled
+	}
+
+	return nil
+}
+
+// Traces returns the current toggles of all components.
+func Traces() map[Component]bool {
+	traces.RLock()
+	defer traces.RUnlock()
+
+	result := make(map[Component]bool, len(traces.enabled))
+	for c, enabled := range traces.enabled {
+		result[c] = enabled
+	}
+
+	return result
+}
+
+func traceNames() []string {
+	names := make([]string, 0, len(traces.enabled))
+	for c := range traces.enabled {
+		names = append(names, string(c))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (c Component) Enabled() bool {
+	traces.RLock()
+	defer traces.RUnlock()
+
+	return traces.enabled[c]
+}
+
+// Tracef writes a DEBUG line when tracing of the component is enabled, secrets in the message are redacted.
+func (c *Context) Tracef(component Component, format string, args ...any) {
+	if !component.Enabled() {
+		return
+	}
+
+	c.base("DEBUG", "("+string(component)+") "+Redact(fmt.Sprintf(format, args...)))
+}
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)((?:authorization|x-api-key|token|password|secret)["']?\s*[:=]\s*["']?)(?:\[[^\]]*\]|(?:(?:bearer|basic)\s+)?[^\s"',&\]]+)`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// Redact replaces secrets (credentials in key=value or header form, private keys) with "***".
+func Redact(s string) string {
+	s = secretPatterns[0].ReplaceAllString(s, "${1}***")
+	return secretPatterns[1].ReplaceAllString(s, "***")
+}
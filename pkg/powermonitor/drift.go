@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package powermonitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Code-Hex/vz/v3"
+	"github.com/oomol-lab/ovm/pkg/channel"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+// monitorDrift periodically compares the guest clock with the host clock.
+// The time sync socket only sends commands to the guest, so the guest time is read via SSH.
+func monitorDrift(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.VirtualMachine, log *logger.Context) {
+	if opt.DriftCheckInterval == 0 {
+		return
+	}
+	if !opt.SocketEnabled(cli.SocketNetwork) {
+		log.Info("skip the clock drift check, the guest has no network for ssh")
+		return
+	}
+
+	g.Go(func() error {
+		ticker := time.NewTicker(opt.DriftCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			// a paused guest cannot answer, and its clock is synced on resume anyway
+			if opt.BootedAt().IsZero() || vm.State() != vz.VirtualMachineStateRunning {
+				continue
+			}
+
+			drift, err := measureDrift(opt)
+			if err != nil {
+				log.Warnf("measure clock drift failed: %v", err)
+				continue
+			}
+
+			opt.SetClockDrift(drift)
+			log.Tracef(logger.PowerSave, "guest clock drift: %s", drift)
+
+			if opt.MaxDrift == 0 || drift.Abs() <= opt.MaxDrift {
+				continue
+			}
+
+			if err := opt.Warn(log, cli.WarnClockDrift, "guest clock drift %s exceeds %s, sync time", drift, opt.MaxDrift); err != nil {
+				return err
+			}
+			event.NotifyWithMessage(event.ClockDrift, fmt.Sprintf(`{"driftMs":%d,"maxDriftMs":%d}`, drift.Milliseconds(), opt.MaxDrift.Milliseconds()))
+			channel.NotifySyncTime()
+		}
+	})
+}
+
+// measureDrift returns guest time minus host time, the host time is taken in the middle of the round trip.
+func measureDrift(opt *cli.Context) (time.Duration, error) {
+	before := time.Now()
+	out, err := opt.RunInGuest("date +%s.%N")
+	after := time.Now()
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse guest time %q failed: %w", out, err)
+	}
+
+	sec, frac := math.Modf(seconds)
+	guest := time.Unix(int64(sec), int64(frac*1e9))
+	host := before.Add(after.Sub(before) / 2)
+
+	return guest.Sub(host), nil
+}
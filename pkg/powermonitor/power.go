@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package powermonitor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+const powerCheckInterval = 10 * time.Second
+
+var cpuSpeedLimitRegexp = regexp.MustCompile(`CPU_Speed_Limit\s*=\s*(\d+)`)
+
+// OnBattery reports whether the host is drawing from the battery, it is false if unknown (e.g. desktops).
+func OnBattery() bool {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(out), "'Battery Power'")
+}
+
+// thermalLevel maps the CPU speed limit of the host to a thermal pressure level.
+func thermalLevel() string {
+	out, err := exec.Command("pmset", "-g", "therm").Output()
+	if err != nil {
+		return cli.ThermalUnknown
+	}
+
+	m := cpuSpeedLimitRegexp.FindSubmatch(out)
+	if m == nil {
+		// no limit has been recorded
+		return cli.ThermalNominal
+	}
+
+	limit, _ := strconv.Atoi(string(m[1]))
+	switch {
+	case limit >= 100:
+		return cli.ThermalNominal
+	case limit >= 80:
+		return cli.ThermalFair
+	case limit >= 50:
+		return cli.ThermalSerious
+	default:
+		return cli.ThermalCritical
+	}
+}
+
+func readHostPower() cli.HostPower {
+	p := cli.HostPower{
+		Source:  cli.PowerSourceAC,
+		Thermal: thermalLevel(),
+	}
+	if OnBattery() {
+		p.Source = cli.PowerSourceBattery
+	}
+
+	return p
+}
+
+// monitorPower follows the power source and the thermal pressure of the host.
+// Under critical thermal pressure half of the vCPUs are taken offline, and brought back once the pressure is gone.
+func monitorPower(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) {
+	if opt.NoPowerAwareness {
+		log.Info("power awareness is disabled")
+		return
+	}
+
+	opt.SetHostPower(readHostPower())
+
+	g.Go(func() error {
+		throttled := false
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(powerCheckInterval):
+			}
+
+			prev := opt.HostPower()
+			cur := readHostPower()
+			opt.SetHostPower(cur)
+
+			if cur != prev {
+				log.Infof("host power changed: source %s -> %s, thermal %s -> %s", prev.Source, cur.Source, prev.Thermal, cur.Thermal)
+			}
+
+			// the guest can only be throttled after it is ready to run commands
+			if opt.BootedAt().IsZero() {
+				continue
+			}
+
+			critical := cur.Thermal == cli.ThermalCritical
+			if critical == throttled {
+				continue
+			}
+
+			online := opt.CPUS
+			if opt.BootCPUs != 0 {
+				online = opt.BootCPUs
+			}
+			if critical {
+				online = max(1, opt.CPUS/2)
+			}
+
+			if err := opt.SetOnlineCPUs(online); err != nil {
+				log.Warnf("set online CPUs to %d failed: %v", online, err)
+				continue
+			}
+
+			throttled = critical
+			if throttled {
+				log.Warnf("critical thermal pressure, throttled the guest to %d CPUs", online)
+				event.NotifyWithMessage(event.ThermalThrottled, fmt.Sprintf(`{"cpus":%d}`, online))
+			} else {
+				log.Infof("thermal pressure is gone, restored the guest to %d CPUs", online)
+			}
+		}
+	})
+}
+
+// powerSave reports whether the VM is paused while the host sleeps, the power source is read again at the time of the decision.
+func powerSave(opt *cli.Context) bool {
+	if opt.PowerSaveMode {
+		return true
+	}
+
+	return opt.PowerSaveOnBattery && !opt.NoPowerAwareness && OnBattery()
+}
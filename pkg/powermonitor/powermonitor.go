@@ -15,10 +15,16 @@ import (
 )
 
 func Setup(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.VirtualMachine, log *logger.Context) error {
-	if err := initTimeSync(ctx, g, opt.TimeSyncSocketPath, log); err != nil {
-		return err
+	// with -disable-sockets timesync the requests to sync are dropped
+	if opt.TimeSyncSocketPath != "" {
+		if err := initTimeSync(ctx, g, opt.TimeSyncSocketPath, log); err != nil {
+			return err
+		}
 	}
 
+	monitorDrift(ctx, g, opt, vm, log)
+	monitorPower(ctx, g, opt, log)
+
 	ch := notifier.GetInstance().Start()
 
 	log.Info("power monitor started")
@@ -33,17 +39,21 @@ func Setup(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.Virt
 	})
 
 	g.Go(func() error {
+		pausedOnSleep := false
+
 		for activity := range ch {
 
 			log.Infof("os %s, power save mode: %v", activity.Type, opt.PowerSaveMode)
+			log.Tracef(logger.PowerSave, "VM state before handling %s: %s", activity.Type, vm.State())
 
 			switch activity.Type {
 			case notifier.Awake:
-				if !opt.PowerSaveMode {
-					log.Info("not power save mode, notify sync time")
+				if !pausedOnSleep {
+					log.Info("VM was not paused, notify sync time")
 					channel.NotifySyncTime()
 					continue
 				}
+				pausedOnSleep = false
 
 				if !vm.CanResume() {
 					log.Warnf("VM can not resume, current state: %s", vm.State())
@@ -57,7 +67,7 @@ func Setup(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.Virt
 				}
 
 			case notifier.Sleep:
-				if !opt.PowerSaveMode {
+				if !powerSave(opt) {
 					continue
 				}
 
@@ -70,6 +80,7 @@ func Setup(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.Virt
 					log.Warnf("pause VM failed: %v", err)
 				} else {
 					log.Infof("pause VM success")
+					pausedOnSleep = true
 				}
 			}
 		}
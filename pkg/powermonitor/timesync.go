@@ -62,6 +62,7 @@ func initTimeSync(ctx context.Context, g *errgroup.Group, socketPath string, log
 			log.Info("start sync time")
 
 			command := []byte(fmt.Sprintf("date -s @%d", time.Now().Unix()))
+			log.Tracef(logger.PowerSave, "send time sync command: %s", command)
 			length := len(command)
 			header := make([]byte, 2)
 			binary.LittleEndian.PutUint16(header, uint16(length))
@@ -68,6 +68,7 @@ func Start(sshAuthSocketPath string, log *logger.Context) (*sshagent.SSHAgent, e
 	}
 
 	keys := identity.FindAll(log)
+	log.Tracef(logger.SSH, "found %d identities for the ssh agent", len(keys))
 	if err := agent.AddIdentities(keys...); err != nil {
 		log.Errorf("add identities error: %v", err)
 		return nil, err
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+const exportInterval = 30 * time.Second
+
+// Gauge is a single data point, gauges with the same name are exported as one metric.
+type Gauge struct {
+	Name   string
+	Help   string
+	Labels map[string]string
+	Value  float64
+}
+
+type exporter struct {
+	client   *http.Client
+	endpoint string
+	cfg      cli.ObservabilityExport
+	collect  func() []Gauge
+	log      *logger.Context
+}
+
+// Start exports the collected gauges every 30s to the OTLP/HTTP endpoint, using the JSON encoding.
+// It is a no-op when OTLPEndpoint is empty.
+func Start(ctx context.Context, g *errgroup.Group, cfg cli.ObservabilityExport, collect func() []Gauge, log *logger.Context) error {
+	if cfg.OTLPEndpoint == "" {
+		return nil
+	}
+
+	endpoint, err := metricsEndpoint(cfg.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+
+	e := &exporter{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: endpoint,
+		cfg:      cfg,
+		collect:  collect,
+		log:      log,
+	}
+
+	log.Infof("export metrics to %s every %s", endpoint, exportInterval)
+
+	g.Go(func() error {
+		ticker := time.NewTicker(exportInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := e.export(ctx); err != nil {
+				e.log.Warnf("export metrics failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+
+	return nil
+}
+
+// metricsEndpoint appends the default OTLP/HTTP metrics path when the endpoint has none, e.g. "http://localhost:4318".
+func metricsEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parse otlp endpoint failed: %w", err)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+
+	return u.String(), nil
+}
+
+func (e *exporter) export(ctx context.Context) error {
+	body, err := json.Marshal(e.payload(e.collect(), time.Now()))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status code is %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type dataPoint struct {
+	Attributes   []attribute `json:"attributes"`
+	TimeUnixNano string      `json:"timeUnixNano"`
+	AsDouble     float64     `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Gauge       struct {
+		DataPoints []dataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type scopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type resourceMetrics struct {
+	Resource struct {
+		Attributes []attribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type payload struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+func (e *exporter) payload(gauges []Gauge, now time.Time) *payload {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	sm := scopeMetrics{}
+	sm.Scope.Name = "github.com/oomol-lab/ovm"
+
+	byName := map[string]*otlpMetric{}
+	for _, gauge := range gauges {
+		m, ok := byName[gauge.Name]
+		if !ok {
+			m = &otlpMetric{
+				Name:        gauge.Name,
+				Description: gauge.Help,
+			}
+			byName[gauge.Name] = m
+			sm.Metrics = append(sm.Metrics, m)
+		}
+
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, dataPoint{
+			Attributes:   attributes(gauge.Labels),
+			TimeUnixNano: ts,
+			AsDouble:     gauge.Value,
+		})
+	}
+
+	rm := resourceMetrics{
+		ScopeMetrics: []scopeMetrics{sm},
+	}
+	rm.Resource.Attributes = attributes(map[string]string{"service.name": e.cfg.ServiceName})
+
+	return &payload{
+		ResourceMetrics: []resourceMetrics{rm},
+	}
+}
+
+func attributes(labels map[string]string) []attribute {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]attribute, 0, len(keys))
+	for _, k := range keys {
+		a := attribute{Key: k}
+		a.Value.StringValue = labels[k]
+		result = append(result, a)
+	}
+
+	return result
+}
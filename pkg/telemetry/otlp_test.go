@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/metrics"},
+		{"http://localhost:4318/", "http://localhost:4318/v1/metrics"},
+		{"https://collector.example.com/otlp/v1/metrics", "https://collector.example.com/otlp/v1/metrics"},
+	}
+
+	for _, tt := range tests {
+		got, err := metricsEndpoint(tt.endpoint)
+		if err != nil || got != tt.want {
+			t.Errorf("metricsEndpoint(%q) = %q, %v, want %q", tt.endpoint, got, err, tt.want)
+		}
+	}
+
+	if _, err := metricsEndpoint("http://[::1"); err == nil {
+		t.Error("an invalid endpoint was accepted")
+	}
+}
+
+func TestExport(t *testing.T) {
+	var (
+		got    payload
+		header http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Errorf("invalid payload %s: %v", data, err)
+		}
+	}))
+	defer srv.Close()
+
+	e := &exporter{
+		client:   srv.Client(),
+		endpoint: srv.URL + "/v1/metrics",
+		cfg:      cli.ObservabilityExport{ServiceName: "ovm-vm", Headers: map[string]string{"Authorization": "Bearer token"}},
+		collect: func() []Gauge {
+			return []Gauge{
+				{Name: "vm_up", Help: "VM is running", Value: 1},
+				{Name: "disk_bytes", Labels: map[string]string{"name": "data.img", "kind": "disk"}, Value: 1024},
+				{Name: "disk_bytes", Labels: map[string]string{"name": "rootfs.img", "kind": "disk"}, Value: 2048},
+			}
+		},
+	}
+
+	if err := e.export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Get("Content-Type") != "application/json" || header.Get("Authorization") != "Bearer token" {
+		t.Errorf("headers = %v", header)
+	}
+	if len(got.ResourceMetrics) != 1 || len(got.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("payload = %+v", got)
+	}
+	rm := got.ResourceMetrics[0]
+	if a := rm.Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || a[0].Value.StringValue != "ovm-vm" {
+		t.Errorf("resource attributes = %+v", a)
+	}
+
+	metrics := rm.ScopeMetrics[0].Metrics
+	if len(metrics) != 2 || metrics[0].Name != "vm_up" || metrics[0].Description != "VM is running" || metrics[1].Name != "disk_bytes" {
+		t.Fatalf("metrics = %+v, want the gauges grouped by name", metrics)
+	}
+	points := metrics[1].Gauge.DataPoints
+	if len(points) != 2 || points[1].AsDouble != 2048 {
+		t.Fatalf("data points = %+v", points)
+	}
+	// the attributes are sorted by key
+	if a := points[0].Attributes; len(a) != 2 || a[0].Key != "kind" || a[1].Key != "name" || a[1].Value.StringValue != "data.img" {
+		t.Errorf("attributes = %+v", a)
+	}
+}
+
+func TestExportStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	e := &exporter{client: &http.Client{Timeout: time.Second}, endpoint: srv.URL, collect: func() []Gauge { return nil }}
+	if err := e.export(context.Background()); err == nil {
+		t.Fatal("a 401 response was accepted")
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxStatsdPacket keeps a datagram within the MTU of common networks, larger batches are split.
+const maxStatsdPacket = 1432
+
+var statsdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+
+// StartStatsd pushes the collected gauges every 30s to the statsd server over UDP, as PREFIX.NAME.LABEL_VALUES:VALUE|g.
+// The label values are appended sorted by label name, statsd has no labels. It is a no-op when StatsdAddress is empty.
+func StartStatsd(ctx context.Context, g *errgroup.Group, cfg cli.ObservabilityExport, collect func() []Gauge, log *logger.Context) error {
+	if cfg.StatsdAddress == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("udp", cfg.StatsdAddress)
+	if err != nil {
+		return fmt.Errorf("dial statsd failed: %w", err)
+	}
+
+	log.Infof("push metrics to statsd %s every %s", cfg.StatsdAddress, exportInterval)
+
+	g.Go(func() error {
+		<-ctx.Done()
+		return conn.Close()
+	})
+
+	g.Go(func() error {
+		ticker := time.NewTicker(exportInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, packet := range statsdPackets(cfg.StatsdPrefix, collect()) {
+				// nothing answers over UDP, an unreachable server is only noticed by a later write
+				if _, err := conn.Write(packet); err != nil && ctx.Err() == nil {
+					log.Warnf("push metrics to statsd failed: %v", err)
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+
+	return nil
+}
+
+func statsdPackets(prefix string, gauges []Gauge) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, gauge := range gauges {
+		name := statsdName(prefix, gauge)
+		line := name + ":" + strconv.FormatFloat(gauge.Value, 'f', -1, 64) + "|g"
+		// a signed gauge value changes the gauge by it, the gauge is set to 0 first, in the same packet
+		if gauge.Value < 0 {
+			line = name + ":0|g\n" + line
+		}
+
+		if len(packet) != 0 && len(packet)+1+len(line) > maxStatsdPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) != 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	if len(packet) != 0 {
+		packets = append(packets, packet)
+	}
+
+	return packets
+}
+
+func statsdName(prefix string, gauge Gauge) string {
+	keys := make([]string, 0, len(gauge.Labels))
+	for k := range gauge.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{gauge.Name}
+	if prefix != "" {
+		parts = []string{prefix, gauge.Name}
+	}
+	for _, k := range keys {
+		parts = append(parts, statsdUnsafe.ReplaceAllString(gauge.Labels[k], "_"))
+	}
+
+	return strings.Join(parts, ".")
+}
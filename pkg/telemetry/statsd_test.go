@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStatsdPackets(t *testing.T) {
+	gauges := []Gauge{
+		{Name: "vm_up", Value: 1},
+		{Name: "guest_clock_drift_seconds", Value: -0.25},
+		{Name: "disk_bytes", Labels: map[string]string{"name": "data.img", "kind": "disk"}, Value: 1024},
+	}
+
+	packets := statsdPackets("ovm", gauges)
+	if len(packets) != 1 {
+		t.Fatalf("%d packets, want 1", len(packets))
+	}
+
+	want := "ovm.vm_up:1|g\n" +
+		"ovm.guest_clock_drift_seconds:0|g\novm.guest_clock_drift_seconds:-0.25|g\n" +
+		"ovm.disk_bytes.disk.data_img:1024|g"
+	if got := string(packets[0]); got != want {
+		t.Errorf("packet:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStatsdPacketsSplit(t *testing.T) {
+	var gauges []Gauge
+	for i := 0; i < 200; i++ {
+		gauges = append(gauges, Gauge{Name: fmt.Sprintf("gauge_%d", i), Value: -float64(i + 1)})
+	}
+
+	packets := statsdPackets("ovm", gauges)
+	if len(packets) < 2 {
+		t.Fatalf("%d packets, want the batch split", len(packets))
+	}
+
+	lines := 0
+	for _, p := range packets {
+		if len(p) > maxStatsdPacket {
+			t.Errorf("packet of %d bytes exceeds %d", len(p), maxStatsdPacket)
+		}
+
+		// the reset to 0 is never split from the negative value
+		l := strings.Split(string(p), "\n")
+		if len(l)%2 != 0 {
+			t.Errorf("packet with %d lines splits a negative gauge", len(l))
+		}
+		for i := 0; i+1 < len(l); i += 2 {
+			name := strings.TrimSuffix(l[i], ":0|g")
+			if name == l[i] || !strings.HasPrefix(l[i+1], name+":-") {
+				t.Errorf("lines %q, %q are not a reset followed by the negative value", l[i], l[i+1])
+			}
+		}
+		lines += len(l)
+	}
+	if lines != 400 {
+		t.Errorf("%d lines, want 400", lines)
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultCopyBufferSize is the buffer size of CopyFile, io.Copy only uses 32 KiB on darwin, which is slow for disk images.
+const DefaultCopyBufferSize = 4 * 1024 * 1024
+
+// CopyOptions tunes CopyFile.
+type CopyOptions struct {
+	// BufferSize is the size of the read and write calls, 0 is DefaultCopyBufferSize
+	BufferSize int
+	// Digest hashes the data while it is copied, so the copy does not have to be read again by FileDigest
+	Digest bool
+}
+
+// copyBuffers reuses the buffers of CopyFile, the large allocations are page aligned by the Go allocator.
+var copyBuffers sync.Pool
+
+func getCopyBuffer(size int) *[]byte {
+	if b, ok := copyBuffers.Get().(*[]byte); ok && cap(*b) >= size {
+		*b = (*b)[:size]
+		return b
+	}
+
+	b := make([]byte, size)
+	return &b
+}
+
+// CopyFile copies src to dst through a temporary file in the same directory, which is preallocated,
+// synced and then renamed to dst, so dst is never a partial copy.
+// When opts.Digest is set, the sha256 digest of the data is returned in the format of FileDigest.
+func CopyFile(src, dst string, opts CopyOptions) (digest string, err error) {
+	p, err := filepath.Abs(src)
+	if err != nil {
+		return "", err
+	}
+
+	source, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	stat, err := source.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", p)
+	}
+
+	destination, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("create temp file failed: %w", err)
+	}
+	tmp := destination.Name()
+	defer func() {
+		if err != nil {
+			_ = destination.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if err := destination.Chmod(0644); err != nil {
+		return "", fmt.Errorf("chmod temp file failed: %w", err)
+	}
+
+	// preallocation only avoids fragmentation, the copy works without it
+	_ = preallocate(destination, stat.Size())
+
+	size := opts.BufferSize
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	buf := getCopyBuffer(size)
+	defer copyBuffers.Put(buf)
+
+	var h hash.Hash
+	if opts.Digest {
+		h = sha256.New()
+	}
+
+	if err := copyBuffer(destination, source, *buf, h); err != nil {
+		return "", fmt.Errorf("copy %s failed: %w", p, err)
+	}
+
+	if err := destination.Sync(); err != nil {
+		return "", fmt.Errorf("sync temp file failed: %w", err)
+	}
+
+	if err := destination.Close(); err != nil {
+		return "", fmt.Errorf("close temp file failed: %w", err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		return "", fmt.Errorf("rename temp file failed: %w", err)
+	}
+
+	// persist the rename itself
+	if dir, err := os.Open(filepath.Dir(dst)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+
+	if h != nil {
+		digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+
+	return digest, nil
+}
+
+// copyBuffer is io.CopyBuffer without ReadFrom, which falls back to a 32 KiB buffer on darwin, and feeds h if set.
+func copyBuffer(dst io.Writer, src io.Reader, buf []byte, h hash.Hash) error {
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if h != nil {
+				h.Write(buf[:n])
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// preallocate reserves size bytes for f with F_PREALLOCATE, contiguous if possible.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	fstore := &unix.Fstore_t{
+		Flags:   unix.F_ALLOCATECONTIG | unix.F_ALLOCATEALL,
+		Posmode: unix.F_PEOFPOSMODE,
+		Length:  size,
+	}
+	if err := unix.FcntlFstore(f.Fd(), unix.F_PREALLOCATE, fstore); err == nil {
+		return nil
+	}
+
+	fstore.Flags = unix.F_ALLOCATEALL
+	return unix.FcntlFstore(f.Fd(), unix.F_PREALLOCATE, fstore)
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyBenchSize is the size of the copied file, e.g. -copy-bench-size=4096 for a disk image of 4 GiB
+var copyBenchSize = flag.Int64("copy-bench-size", 256, "size of the file copied by BenchmarkCopyFile in MiB, at most 4096")
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.img")
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// buffer sizes which do not divide the size, and one larger than the file
+	for _, size := range []int{7, 4096, 0} {
+		dst := filepath.Join(dir, "copy.img")
+		digest, err := CopyFile(src, dst, CopyOptions{BufferSize: size, Digest: true})
+		if err != nil {
+			t.Fatalf("buffer %d: %v", size, err)
+		}
+
+		got, err := os.ReadFile(dst)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("buffer %d: the copy differs, %v", size, err)
+		}
+		if want, err := FileDigest(dst); err != nil || digest != want {
+			t.Errorf("buffer %d: digest %q, want %q of FileDigest, %v", size, digest, want, err)
+		}
+		if stat, err := os.Stat(dst); err != nil || stat.Mode().Perm() != 0644 {
+			t.Errorf("buffer %d: mode %v, %v, want 0644", size, stat.Mode().Perm(), err)
+		}
+	}
+
+	if digest, err := CopyFile(src, filepath.Join(dir, "nodigest.img"), CopyOptions{}); err != nil || digest != "" {
+		t.Errorf("without Digest: %q, %v, want no digest", digest, err)
+	}
+
+	if _, err := CopyFile(dir, filepath.Join(dir, "dir.img"), CopyOptions{}); err == nil {
+		t.Error("copied a directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file %s left", e.Name())
+		}
+	}
+}
+
+// ioCopyWithDigest is the copy used before CopyFile: io.Copy into dst, then FileDigest reads the copy a second time.
+func ioCopyWithDigest(src, dst string) (string, error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer destination.Close()
+
+	if _, err := io.Copy(destination, source); err != nil {
+		return "", err
+	}
+
+	return FileDigest(dst)
+}
+
+func BenchmarkCopyFile(b *testing.B) {
+	if testing.Short() {
+		b.Skip("copies a large file")
+	}
+	if *copyBenchSize <= 0 || *copyBenchSize > 4096 {
+		b.Fatalf("copy-bench-size %d must be between 1 and 4096", *copyBenchSize)
+	}
+	size := *copyBenchSize * 1024 * 1024
+
+	dir := b.TempDir()
+	src := filepath.Join(dir, "data.img")
+	f, err := os.Create(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// random data, a sparse file would only copy holes
+	if _, err := io.CopyN(f, rand.New(rand.NewSource(1)), size); err != nil {
+		b.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+	dst := filepath.Join(dir, "copy.img")
+
+	b.Run("io.Copy", func(b *testing.B) {
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			if _, err := ioCopyWithDigest(src, dst); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, bufferSize := range []int{32 * 1024, 1024 * 1024, DefaultCopyBufferSize, 16 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("CopyFile/%dKiB", bufferSize/1024), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := CopyFile(src, dst, CopyOptions{BufferSize: bufferSize, Digest: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
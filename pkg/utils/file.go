@@ -4,44 +4,21 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+
+	"golang.org/x/sys/unix"
 )
 
+// Copy copies src to dst, see CopyFile.
 func Copy(src, dst string) error {
-	p, err := filepath.Abs(src)
-	if err != nil {
-		return err
-	}
-
-	sourceFileStat, err := os.Stat(p)
-	if err != nil {
-		return err
-	}
-
-	if !sourceFileStat.Mode().IsRegular() {
-		return fmt.Errorf("%s is not a regular file", p)
-	}
-
-	source, err := os.Open(p)
-	if err != nil {
-		return err
-	}
-	defer source.Close()
-
-	destination, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destination.Close()
-
-	if _, err = io.Copy(destination, source); err != nil {
-		return err
-	}
-
-	return destination.Sync()
+	_, err := CopyFile(src, dst, CopyOptions{})
+	return err
 }
 
 func CreateSparseFile(p string, size int64) error {
@@ -70,3 +47,65 @@ func PathExists(p string) (bool, error) {
 
 	return false, err
 }
+
+// WriteFileAtomic writes data to a temporary file in the same directory and then renames it to p,
+// so readers never observe a partially written file.
+func WriteFileAtomic(p string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file failed: %w", err)
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write temp file failed: %w", err)
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("chmod temp file failed: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("close temp file failed: %w", err)
+	}
+
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename temp file failed: %w", err)
+	}
+
+	return nil
+}
+
+// FileDigest returns the sha256 digest of the file, in the format "sha256:HEX".
+func FileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Clone copies the file with clonefile(2), which shares the blocks on APFS.
+// It falls back to a full copy when cloning is not supported, e.g. across volumes.
+func Clone(src, dst string) (cloned bool, err error) {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err == nil {
+		return true, nil
+	} else if !errors.Is(err, unix.ENOTSUP) && !errors.Is(err, unix.EXDEV) {
+		return false, err
+	}
+
+	return false, Copy(src, dst)
+}
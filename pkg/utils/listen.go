@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListenUnix listens on the unix socket with the given backlog, net.Listen always uses kern.ipc.somaxconn.
+// The kernel still caps the backlog at kern.ipc.somaxconn.
+func ListenUnix(p string, backlog int) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("create socket failed: %w", err)
+	}
+	unix.CloseOnExec(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: p}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("bind %s failed: %w", p, err)
+	}
+
+	if err := unix.Listen(fd, backlog); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("listen %s failed: %w", p, err)
+	}
+
+	// FileListener dups the fd, the file can be closed right away
+	f := os.NewFile(uintptr(fd), p)
+	defer f.Close()
+
+	nl, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s failed: %w", p, err)
+	}
+
+	// like net.Listen, remove the socket file when the listener is closed
+	nl.(*net.UnixListener).SetUnlinkOnClose(true)
+
+	return nl, nil
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := ListenUnix(p, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			_, err = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		}
+		done <- err
+	}()
+
+	conn, err := net.Dial("unix", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ok" {
+		t.Errorf("read %q, %v", buf, err)
+	}
+	_ = conn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("socket file kept after close: %v", err)
+	}
+
+	// a socket file that exists is not replaced
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenUnix(p, 4); err == nil {
+		t.Error("listened on an existing file")
+	}
+}
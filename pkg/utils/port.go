@@ -9,29 +9,24 @@ import (
 	"strconv"
 )
 
-func portOccupied(port int) error {
-	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
-	if err != nil {
-		return fmt.Errorf("port %d is occupied, %v", port, err)
-	}
-	defer ln.Close()
-	return nil
-}
-
-func FindUsablePort(startPort int) (int, error) {
+// FindUsablePort finds a usable port on the loopback interface starting from startPort.
+// The returned listener keeps the port bound, the caller should hand it off to the final user
+// instead of closing it and binding again, otherwise another process may take the port in between.
+func FindUsablePort(startPort int) (net.Listener, error) {
 	port := startPort
 	maxPort := startPort + 100
 
 	var lastErr error
 
 	for port < maxPort {
-		if err := portOccupied(port); err != nil {
-			lastErr = err
-		} else {
-			return port, nil
+		ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+		if err == nil {
+			return ln, nil
 		}
+
+		lastErr = fmt.Errorf("port %d is occupied, %v", port, err)
 		port++
 	}
 
-	return 0, lastErr
+	return nil, lastErr
 }
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// TestFindUsablePortConcurrent starts VMs at the same time, the held listeners must never share a port.
+func TestFindUsablePortConcurrent(t *testing.T) {
+	const n = 20
+
+	listeners := make([]net.Listener, n)
+	var wg sync.WaitGroup
+	for i := range listeners {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ln, err := FindUsablePort(42233)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			listeners[i] = ln
+		}(i)
+	}
+	wg.Wait()
+
+	ports := map[int]bool{}
+	for _, ln := range listeners {
+		if ln == nil {
+			continue
+		}
+		defer ln.Close()
+
+		port := ln.Addr().(*net.TCPAddr).Port
+		if ports[port] {
+			t.Errorf("port %d was returned twice", port)
+		}
+		ports[port] = true
+	}
+
+	// a closed listener frees its port for the next caller
+	first := listeners[0]
+	if first == nil {
+		t.FailNow()
+	}
+	port := first.Addr().(*net.TCPAddr).Port
+	_ = first.Close()
+	ln, err := FindUsablePort(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; got != port {
+		t.Errorf("port %d, want the freed port %d", got, port)
+	}
+}
@@ -6,13 +6,35 @@ package utils
 import (
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path"
 )
 
+// GenerateSSHKey generates the key pair name and name.pub in p.
+// The keys are generated in a temporary directory and renamed into p, so a half-written key is never visible.
 func GenerateSSHKey(p, name string) error {
-	pn := path.Join(p, name)
+	tmp, err := os.MkdirTemp(p, ".keygen-*")
+	if err != nil {
+		return fmt.Errorf("create temp dir failed: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := keygen(path.Join(tmp, name)); err != nil {
+		return err
+	}
+
+	// the public key last, the private key is only used together with it
+	for _, n := range []string{name, name + ".pub"} {
+		if err := os.Rename(path.Join(tmp, n), path.Join(p, n)); err != nil {
+			return fmt.Errorf("rename %s failed: %w", n, err)
+		}
+	}
+
+	return nil
+}
 
+func keygen(pn string) error {
 	cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-f", pn, "-N", "")
 	stdErr, err := cmd.StderrPipe()
 	if err != nil {
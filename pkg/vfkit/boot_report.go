@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"encoding/json"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"github.com/oomol-lab/ovm/pkg/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+type bootArtifact struct {
+	Path string `json:"path"`
+	// Digest of the file opened at boot
+	Digest string `json:"digest"`
+	// Expected is the digest recorded when the file was copied, empty if unknown (e.g. copied by an older ovm)
+	Expected string `json:"expected,omitempty"`
+	Tampered bool   `json:"tampered"`
+}
+
+type bootReport struct {
+	Generation int                     `json:"generation"`
+	Artifacts  map[string]bootArtifact `json:"artifacts"`
+}
+
+// reportBoot re-hashes the artifacts after the VM started, so files changed between setup and boot are detected.
+// Hashing runs in the background and never blocks or fails the boot.
+func reportBoot(g *errgroup.Group, opt *cli.Context, log *logger.Context) {
+	g.Go(func() error {
+		report := &bootReport{
+			Artifacts: map[string]bootArtifact{},
+		}
+
+		versions, err := cli.ReadVersions(opt.VersionsPath)
+		if err != nil {
+			log.Warnf("read versions failed: %v", err)
+		} else {
+			report.Generation = versions.Generation
+		}
+
+		for key, p := range map[string]string{
+			"kernel": opt.KernelPath,
+			"initrd": opt.InitrdPath,
+			"rootfs": opt.GuestRootFS.Artifact(),
+		} {
+			if p == "" {
+				continue
+			}
+
+			digest, err := utils.FileDigest(p)
+			if err != nil {
+				log.Warnf("digest %s failed: %v", p, err)
+				continue
+			}
+
+			a := bootArtifact{
+				Path:   p,
+				Digest: digest,
+			}
+			if versions != nil {
+				if pv, ok := versions.Provenance[key]; ok {
+					a.Expected = pv.Digest
+				}
+			}
+			// a writable rootfs is expected to change after it was copied
+			if a.Expected != "" && a.Expected != a.Digest && !(key == "rootfs" && opt.GuestWritableRoot) {
+				a.Tampered = true
+				if err := opt.Warn(log, cli.WarnArtifactModified, "%s %s was modified after it was copied, expected digest %s, actual %s", key, p, a.Expected, a.Digest); err != nil {
+					return err
+				}
+			}
+
+			report.Artifacts[key] = a
+		}
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("boot report: %s", data)
+		event.NotifyWithMessage(event.BootReport, string(data))
+
+		return nil
+	})
+}
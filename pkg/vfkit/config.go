@@ -10,7 +10,39 @@ import (
 )
 
 func vmConfig(opt *cli.Context, log *logger.Context) (*config.VirtualMachine, error) {
-	bootloaderCMD := []string{"linux", "kernel=" + opt.KernelPath, "initrd=" + opt.InitrdPath, "cmdline=" + kernelCMD(opt)}
+	initrdPath := opt.InitrdPath
+	if opt.NoInitrd {
+		p, err := emptyInitramfs(opt)
+		if err != nil {
+			return nil, err
+		}
+		initrdPath = p
+	}
+
+	cmdline := kernelCMD(opt)
+	if opt.KernelCmdline == "" {
+		opt.KernelCmdline = cmdline
+		if err := opt.PersistentKernelCmdline(); err != nil {
+			log.Warnf("persist kernel cmdline failed: %v", err)
+		}
+	} else if opt.KernelCmdline != cmdline {
+		// the parameters pairing the guest with the devices and flags of this start always follow the current flags
+		if merged := mergeKernelCmdline(opt.KernelCmdline, cmdline); merged != opt.KernelCmdline {
+			log.Infof("kernel cmdline of %s follows the current flags: %q", opt.KernelCmdlinePath, merged)
+			opt.KernelCmdline = merged
+			if err := opt.PersistentKernelCmdline(); err != nil {
+				log.Warnf("persist kernel cmdline failed: %v", err)
+			}
+		}
+
+		if opt.KernelCmdline != cmdline {
+			if err := opt.Warn(log, cli.WarnKernelCmdlineDiffers, "using the kernel cmdline of %s, it differs from the current flags (%q), pass -reset-cmdline to assemble it again", opt.KernelCmdlinePath, cmdline); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bootloaderCMD := []string{"linux", "kernel=" + opt.KernelPath, "initrd=" + initrdPath, "cmdline=" + opt.KernelCmdline}
 	log.Infof("bootloader params: %+v", bootloaderCMD)
 
 	bootloader, err := config.BootloaderFromCmdLine(bootloaderCMD)
@@ -27,6 +59,8 @@ func vmConfig(opt *cli.Context, log *logger.Context) (*config.VirtualMachine, er
 		log.Infof("block devices: vda: '%s', vdb: '%s', vdc: '%s'", opt.RootfsPath, opt.DiskTmpPath, opt.DiskDataPath)
 
 		rootfs, _ := config.VirtioBlkNew(opt.RootfsPath)
+		// with an overlay the guest never writes into the shipped image
+		rootfs.ReadOnly = opt.RootfsOverlay != cli.RootfsOverlayOff
 		_ = vm.AddDevice(rootfs) // vda
 
 		tmp, _ := config.VirtioBlkNew(opt.DiskTmpPath)
@@ -34,25 +68,61 @@ func vmConfig(opt *cli.Context, log *logger.Context) (*config.VirtualMachine, er
 
 		data, _ := config.VirtioBlkNew(opt.DiskDataPath)
 		_ = vm.AddDevice(data) // vdc
+
+		if opt.DiskScratchPath != "" {
+			log.Infof("block device: vdd: '%s', mount on '%s'", opt.DiskScratchPath, opt.TmpMount)
+			scratch, _ := config.VirtioBlkNew(opt.DiskScratchPath)
+			_ = vm.AddDevice(scratch) // vdd
+		}
+
+		if opt.DiskRootfsOverlayPath != "" {
+			log.Infof("block device: %s: '%s', upper layer of the rootfs", rootfsOverlayDevice(opt), opt.DiskRootfsOverlayPath)
+			overlay, _ := config.VirtioBlkNew(opt.DiskRootfsOverlayPath)
+			_ = vm.AddDevice(overlay) // vdd or vde
+		}
 	}
 
 	{
-		log.Infof("vsock device: network: '%d-%s', initrd: '%d-%s', ready: '%d-%s'", 1024, opt.SocketNetworkPath, 1025, opt.SocketInitrdVSockPath, 1026, opt.SocketReadyPath)
+		log.Infof("vsock device: network: '%d-%s', ready: '%d-%s'", 1024, opt.SocketNetworkPath, 1026, opt.SocketReadyPath)
+
+		// the devices of the sockets disabled by -disable-sockets are not attached, the guest finds nothing on their ports
+		if opt.SocketNetworkPath != "" {
+			network, _ := config.VirtioVsockNew(1024, opt.SocketNetworkPath, false)
+			_ = vm.AddDevice(network) // vm network device
+		}
+
+		// the ignition runs in the initrd
+		if !opt.NoInitrd {
+			log.Infof("vsock device: initrd: '%d-%s'", 1025, opt.SocketInitrdVSockPath)
+			initrd, _ := config.VirtioVsockNew(1025, opt.SocketInitrdVSockPath, false)
+			_ = vm.AddDevice(initrd) // initrd vsock device (https://github.com/oomol-lab/vsock-guest-exec)
+		}
 
-		network, _ := config.VirtioVsockNew(1024, opt.SocketNetworkPath, false)
-		_ = vm.AddDevice(network) // vm network device
+		if opt.SocketReadyPath != "" {
+			ready, _ := config.VirtioVsockNew(1026, opt.SocketReadyPath, false)
+			_ = vm.AddDevice(ready) // vm is ready (https://github.com/oomol-lab/ovm-core/blob/7c85e7603da0873099c1a288be1f70e44e24c1f5/buildroot_external/board/ovm/ready/rootfs-overlay/etc/systemd/system/ready.service)
+		}
 
-		initrd, _ := config.VirtioVsockNew(1025, opt.SocketInitrdVSockPath, false)
-		_ = vm.AddDevice(initrd) // initrd vsock device (https://github.com/oomol-lab/vsock-guest-exec)
+		if opt.TimeSyncSocketPath != "" {
+			timeSync, _ := config.VirtioVsockNew(1027, opt.TimeSyncSocketPath, false)
+			_ = vm.AddDevice(timeSync) // sync vm time
+		}
 
-		ready, _ := config.VirtioVsockNew(1026, opt.SocketReadyPath, false)
-		_ = vm.AddDevice(ready) // vm is ready (https://github.com/oomol-lab/ovm-core/blob/7c85e7603da0873099c1a288be1f70e44e24c1f5/buildroot_external/board/ovm/ready/rootfs-overlay/etc/systemd/system/ready.service)
+		if opt.SSHAuthSocketPath != "" {
+			sshAuth, _ := config.VirtioVsockNew(1028, opt.SSHAuthSocketPath, false)
+			_ = vm.AddDevice(sshAuth)
+		}
 
-		timeSync, _ := config.VirtioVsockNew(1027, opt.TimeSyncSocketPath, false)
-		_ = vm.AddDevice(timeSync) // sync vm time
+		// connections of the guest agent are forwarded to the agent socket, they fail while nothing on the host listens on it
+		log.Infof("vsock device: agent: '%d-%s'", opt.AgentVsockPort, opt.AgentSocketPath)
+		agent, _ := config.VirtioVsockNew(uint(opt.AgentVsockPort), opt.AgentSocketPath, false)
+		_ = vm.AddDevice(agent)
 
-		sshAuth, _ := config.VirtioVsockNew(1028, opt.SSHAuthSocketPath, false)
-		_ = vm.AddDevice(sshAuth)
+		if opt.ForwardGuestLogs {
+			log.Infof("vsock device: guest logs: '%d-%s'", cli.GuestLogVsockPort, opt.GuestLogSocketPath)
+			guestLogs, _ := config.VirtioVsockNew(cli.GuestLogVsockPort, opt.GuestLogSocketPath, false)
+			_ = vm.AddDevice(guestLogs)
+		}
 	}
 
 	if opt.IsCliMode {
@@ -69,14 +139,16 @@ func vmConfig(opt *cli.Context, log *logger.Context) (*config.VirtualMachine, er
 	}
 
 	{
-		log.Infof("mount devices: %+v", mounts.list)
-		for _, dev := range mounts.toVFKit() {
+		log.Infof("mount devices: %+v", opt.Mounts)
+		for _, dev := range mountsToVFKit(opt.Mounts) {
 			_ = vm.AddDevice(dev)
 		}
 	}
 
-	rng, _ := config.VirtioRngNew()
-	_ = vm.AddDevice(rng) // rng device (https://github.com/oomol-lab/ovm-js/pull/36)
+	if opt.VirtioRNG {
+		rng, _ := config.VirtioRngNew()
+		_ = vm.AddDevice(rng) // rng device (https://github.com/oomol-lab/ovm-js/pull/36)
+	}
 
 	return vm, nil
 }
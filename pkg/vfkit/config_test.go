@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/crc-org/vfkit/pkg/config"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+)
+
+func TestVMConfigVirtioRNG(t *testing.T) {
+	dir := t.TempDir()
+	log, err := logger.NewWithoutManage(dir, "ovm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	for _, rng := range []bool{true, false} {
+		opt := &cli.Context{
+			Name:              "vm",
+			LogPath:           dir,
+			KernelPath:        filepath.Join(dir, "kernel"),
+			InitrdPath:        filepath.Join(dir, "initrd"),
+			KernelCmdlinePath: filepath.Join(dir, "cmdline"),
+			CPUS:              2,
+			MemoryBytes:       1024 * 1024 * 1024,
+			VirtioRNG:         rng,
+		}
+
+		vm, err := vmConfig(opt, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, dev := range vm.Devices {
+			if _, ok := dev.(*config.VirtioRng); ok {
+				found = true
+			}
+		}
+		if found != rng {
+			t.Errorf("-virtio-rng=%v: rng device attached %v", rng, found)
+		}
+	}
+}
+
+// TestVMConfigPersistedCmdline boots twice with one kernel-cmdline.txt, the flags changed in between must be followed.
+func TestVMConfigPersistedCmdline(t *testing.T) {
+	dir := t.TempDir()
+	log, err := logger.NewWithoutManage(dir, "ovm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	newOpt := func(debug bool, cmdline string) *cli.Context {
+		return &cli.Context{
+			Name:              "vm",
+			LogPath:           dir,
+			KernelPath:        filepath.Join(dir, "kernel"),
+			InitrdPath:        filepath.Join(dir, "initrd"),
+			KernelCmdlinePath: filepath.Join(dir, "kernel-cmdline.txt"),
+			KernelCmdline:     cmdline,
+			CPUS:              2,
+			MemoryBytes:       1024 * 1024 * 1024,
+			SerialConsoleBaud: cli.DefaultSerialConsoleBaud,
+			AgentVsockPort:    cli.DefaultAgentVsockPort,
+			KernelDebug:       debug,
+		}
+	}
+
+	first := newOpt(true, "")
+	if _, err := vmConfig(first, log); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(first.KernelCmdlinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(strings.Fields(string(data)), "debug") {
+		t.Fatalf("first start persisted %q, want debug", data)
+	}
+
+	// an edited parameter is kept, debug follows the dropped -kernel-debug
+	second := newOpt(false, strings.TrimSpace(string(data))+" systemd.log_level=debug")
+	if _, err := vmConfig(second, log); err != nil {
+		t.Fatal(err)
+	}
+	params := strings.Fields(second.KernelCmdline)
+	if slices.Contains(params, "debug") || !slices.Contains(params, "systemd.log_level=debug") {
+		t.Errorf("second start boots with %q", second.KernelCmdline)
+	}
+	if data, err := os.ReadFile(second.KernelCmdlinePath); err != nil || strings.TrimSpace(string(data)) != second.KernelCmdline {
+		t.Errorf("second start persisted %q, %v, want %q", data, err, second.KernelCmdline)
+	}
+}
+
+// TestVMConfigRootfsReadOnly checks vda, the guest only writes into the rootfs image with -guest-writable-root.
+func TestVMConfigRootfsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	log, err := logger.NewWithoutManage(dir, "ovm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	tests := []struct {
+		name     string
+		writable bool
+		overlay  string
+		readOnly bool
+	}{
+		{"default", false, cli.RootfsOverlayOff, false},
+		{"rootfs-overlay", false, cli.RootfsOverlayTmpfs, true},
+		{"guest-writable-root", true, cli.RootfsOverlayOff, false},
+	}
+
+	for _, tt := range tests {
+		opt := &cli.Context{
+			Name:              "vm",
+			LogPath:           dir,
+			KernelPath:        filepath.Join(dir, "kernel"),
+			InitrdPath:        filepath.Join(dir, "initrd"),
+			RootfsPath:        filepath.Join(dir, "rootfs.img"),
+			KernelCmdlinePath: filepath.Join(dir, "cmdline"),
+			CPUS:              2,
+			MemoryBytes:       1024 * 1024 * 1024,
+			GuestWritableRoot: tt.writable,
+			RootfsOverlay:     tt.overlay,
+		}
+
+		vm, err := vmConfig(opt, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rootfs, ok := vm.Devices[0].(*config.VirtioBlk)
+		if !ok || rootfs.ImagePath != opt.RootfsPath {
+			t.Fatalf("%s: vda is %+v, want the rootfs", tt.name, vm.Devices[0])
+		}
+		if rootfs.ReadOnly != tt.readOnly {
+			t.Errorf("%s: vda read-only %v, want %v", tt.name, rootfs.ReadOnly, tt.readOnly)
+		}
+	}
+}
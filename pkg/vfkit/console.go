@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+)
+
+// serveConsole streams the serial console to the clients of ConsoleSocketPath.
+// vz can only write the serial port into a file, so the log file of the serial port is followed.
+func serveConsole(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) error {
+	nl, err := net.Listen("unix", opt.ConsoleSocketPath)
+	if err != nil {
+		return err
+	}
+
+	serialLog := path.Join(opt.LogPath, opt.Name+"-vm.log")
+
+	g.Go(func() error {
+		<-ctx.Done()
+		_ = nl.Close()
+		return nil
+	})
+
+	g.Go(func() error {
+		for {
+			conn, err := nl.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Warnf("accept console connection failed: %v", err)
+				return nil
+			}
+
+			go func() {
+				defer conn.Close()
+				if err := followFile(ctx, serialLog, conn); err != nil {
+					log.Infof("console connection closed: %v", err)
+				}
+			}()
+		}
+	})
+
+	return nil
+}
+
+// followFile writes everything appended to p since the call into w.
+func followFile(ctx context.Context, p string, w io.Writer) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			offset += int64(n)
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// the file was truncated, start over
+		if stat, err := f.Stat(); err == nil && stat.Size() < offset {
+			if offset, err = f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
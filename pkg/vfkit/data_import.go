@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// containerStoragePath is where the guest keeps the podman storage on the data disk.
+const containerStoragePath = "/var/lib/containers/storage"
+
+// dataImportCommands check the container storage of an imported data disk and hand it over to root on the first boot.
+// Storage of another driver boots fine, but podman cannot use the images in it, so the start fails instead.
+func dataImportCommands(opt *cli.Context) []string {
+	if !opt.ProvisionDataImport {
+		return nil
+	}
+
+	fail := func(msg string) string {
+		return fmt.Sprintf(`{ echo "import-data: %s" | socat - VSOCK-CONNECT:2:1026; exit 1; }`, msg)
+	}
+
+	return []string{
+		fmt.Sprintf(`test ! -d %[1]s/btrfs -a ! -d %[1]s/vfs || %[2]s`, containerStoragePath, fail("the container storage uses the btrfs or vfs driver, export the images with podman save and load them into ovm instead")),
+		fmt.Sprintf(`test -d %[1]s/overlay || %[2]s`, containerStoragePath, fail("no overlay container storage in "+containerStoragePath+" of the imported disk")),
+		// rootless podman machine storage belongs to the machine user, the guest runs podman as root
+		fmt.Sprintf(`chown root:root %s %s`, "/var/lib/containers", containerStoragePath),
+		`command -v restorecon >/dev/null && restorecon -R /var/lib/containers; true`,
+		`podman system migrate >/dev/null 2>&1; true`,
+	}
+}
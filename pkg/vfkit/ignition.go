@@ -6,6 +6,7 @@ package vfkit
 import (
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/oomol-lab/ovm/pkg/cli"
@@ -16,6 +17,8 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+const mountCheckPath = "/mnt/overlay/opt/ovm-mount-check.sh"
+
 func cmd(opt *cli.Context) (string, error) {
 	localTZ, err := utils.LocalTZ()
 	if err != nil {
@@ -24,15 +27,32 @@ func cmd(opt *cli.Context) (string, error) {
 	tz := fmt.Sprintf("ln -sf /usr/share/zoneinfo/%s /mnt/overlay/etc/localtime; echo %s > /mnt/overlay/etc/timezone", localTZ, localTZ)
 
 	fstab := ""
-	for _, item := range mounts.toFSTAB() {
+	for _, item := range mountsToFSTAB(opt.Mounts) {
 		fstab += item + "\\\\n"
 	}
+	if opt.TmpMount != "" {
+		// the disk is empty on every start, x-systemd.makefs creates the filesystem before mounting
+		fstab += fmt.Sprintf("/dev/vdd %s ext4 defaults,x-systemd.makefs 0 0", opt.TmpMount) + "\\\\n"
+	}
 
 	mount := fmt.Sprintf("echo -e %s >> /mnt/overlay/etc/fstab", fstab)
 	authorizedKeys := fmt.Sprintf("mkdir -p /mnt/overlay/root/.ssh; echo %s >> /mnt/overlay/root/.ssh/authorized_keys", opt.SSHPublicKey)
-	ready := fmt.Sprintf("echo -e \"date -s @%d;\\\\necho Ready | socat - VSOCK-CONNECT:2:1026\" > /mnt/overlay/opt/ready.command", time.Now().Unix())
 
-	return fmt.Sprintf("%s; %s; %s; %s", mount, authorizedKeys, ready, tz), nil
+	readyCmd := "echo Ready | socat - VSOCK-CONNECT:2:1026"
+	mountCheck := ""
+	checks := append(idmapCheckCommands(opt.Mounts), rootfsOverlayCheckCommands(opt)...)
+	checks = append(checks, dataImportCommands(opt)...)
+	checks = append(checks, swapCommands(opt)...)
+	if len(checks) != 0 {
+		mountCheck = fmt.Sprintf("rm -f %s; ", mountCheckPath)
+		for _, item := range checks {
+			mountCheck += fmt.Sprintf("echo '%s' >> %s; ", item, mountCheckPath)
+		}
+		readyCmd = "sh " + strings.TrimPrefix(mountCheckPath, "/mnt/overlay") + " && " + readyCmd
+	}
+	ready := fmt.Sprintf("echo -e \"date -s @%d;\\\\n%s\" > /mnt/overlay/opt/ready.command", time.Now().Unix(), readyCmd)
+
+	return fmt.Sprintf("%s; %s; %s%s; %s; %s; %s; %s", mount, authorizedKeys, mountCheck, ready, tz, ulimitCommand(opt), storageCommand(opt), routeCommand(opt)), nil
 }
 
 func ignition(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) error {
@@ -53,6 +73,7 @@ func ignition(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *log
 			return err
 		}
 
+		log.Tracef(logger.VsockAgent, "ignition command: %s", cmdStr)
 		if _, werr := conn.Write([]byte(cmdStr)); werr != nil {
 			log.Errorf("write ignition command failed: %v", werr)
 			err = werr
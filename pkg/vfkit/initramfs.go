@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const cpioTrailer = "TRAILER!!!\x00"
+
+// emptyInitramfs writes a cpio archive with only the trailer entry into the target path.
+// vfkit always sets an initrd, the kernel finds no /init in it and mounts root= itself, as if booted without one.
+func emptyInitramfs(opt *cli.Context) (string, error) {
+	p := path.Join(opt.TargetPath, "empty-initramfs.cpio")
+
+	// newc header: ino, mode, uid, gid, nlink, mtime, filesize, devmajor, devminor, rdevmajor, rdevminor, namesize, check
+	header := "070701"
+	for _, f := range []int{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, len(cpioTrailer), 0} {
+		header += fmt.Sprintf("%08X", f)
+	}
+
+	// the kernel reads the archive in 512 byte blocks
+	data := make([]byte, 512)
+	copy(data, header+cpioTrailer)
+
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		return "", fmt.Errorf("write empty initramfs failed: %w", err)
+	}
+
+	return p, nil
+}
@@ -4,19 +4,58 @@
 package vfkit
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/oomol-lab/ovm/internal/consts"
 	"github.com/oomol-lab/ovm/pkg/cli"
 )
 
+// runParams are the kernel parameters assembled from the devices and flags of the current start, e.g. the vsock port of the agent.
+// A persisted cmdline with other values would boot a guest which does not match its devices, or ignore a changed flag.
+var runParams = []string{
+	"console", "maxcpus", "root", "rootwait", "rootfstype", "rw",
+	"ovm.agent_port", "ovm.guest_logs_port", "ovm.rootfs_overlay",
+	// -clock-source, -cli and -kernel-debug
+	"clocksource", "tsc", "systemd.log_color", "debug",
+}
+
+func paramKey(param string) string {
+	k, _, _ := strings.Cut(param, "=")
+	return k
+}
+
+// mergeKernelCmdline keeps the parameters of the persisted cmdline, except the runParams, which are taken from the assembled one.
+func mergeKernelCmdline(persisted, assembled string) string {
+	var params []string
+	for _, p := range strings.Fields(persisted) {
+		if !slices.Contains(runParams, paramKey(p)) {
+			params = append(params, p)
+		}
+	}
+	for _, p := range strings.Fields(assembled) {
+		if slices.Contains(runParams, paramKey(p)) {
+			params = append(params, p)
+		}
+	}
+
+	return strings.Join(params, " ")
+}
+
 func kernelCMD(opt *cli.Context) string {
 	sb := strings.Builder{}
 
 	sb.Grow(300)
 
 	// record Kernel and Systemd logs to console
-	sb.WriteString("console=hvc0 ")
+	// the default speed is not written, so the cmdline of existing installations stays the same.
+	// hvc0 has no line speed, the kernel ignores it, it is only there for guest tools reading it from the cmdline
+	if opt.SerialConsoleBaud != cli.DefaultSerialConsoleBaud {
+		sb.WriteString(fmt.Sprintf("console=hvc0,%d ", opt.SerialConsoleBaud))
+	} else {
+		sb.WriteString("console=hvc0 ")
+	}
 
 	// disable the creation of useless network interfaces.
 	// see: https://github.com/oomol-lab/ovm-js/pull/23
@@ -26,8 +65,14 @@ func kernelCMD(opt *cli.Context) string {
 	// However, the HPET is much slower than the TSC, causing any program involved with time-related code to experience a drop in performance.
 	// Don't worry about any side effects of this option. In PR #19, we forced an update of the system time and hardware time in the guest.
 	// In arm64, the clocksource is fixed as arch_sys_counter, so this issue does not exist.
+	// The user can pin another clock source (e.g. to avoid jitter in benchmarks), the TSC is only marked reliable when it is used.
 	if consts.IsAMD64 {
-		sb.WriteString("clocksource=tsc tsc=reliable ")
+		switch opt.ClockSource {
+		case "", "tsc":
+			sb.WriteString("clocksource=tsc tsc=reliable ")
+		default:
+			sb.WriteString("clocksource=" + opt.ClockSource + " ")
+		}
 	}
 
 	// systemd configuration
@@ -43,6 +88,35 @@ func kernelCMD(opt *cli.Context) string {
 		sb.WriteString("systemd.default_standard_error=journal+console ")
 	}
 
+	// all CPUS are attached to the VM, but only BootCPUs are brought online at boot
+	if opt.BootCPUs != 0 && opt.BootCPUs != opt.CPUS {
+		sb.WriteString(fmt.Sprintf("maxcpus=%d ", opt.BootCPUs))
+	}
+
+	// the initrd hands off to the rootfs, slow virtio block devices may not be there yet
+	// without an initrd the kernel mounts the rootfs itself, it is always vda
+	if opt.RootDevice != "" {
+		sb.WriteString("root=" + opt.RootDevice + " ")
+	} else if opt.NoInitrd {
+		sb.WriteString("root=/dev/vda ")
+	}
+	if opt.RootWait {
+		sb.WriteString("rootwait ")
+	}
+	if v := rootfsOverlayCmdline(opt); v != "" {
+		sb.WriteString(v + " ")
+	}
+
+	// the guest agent listens on the default port unless told otherwise
+	if opt.AgentVsockPort != cli.DefaultAgentVsockPort {
+		sb.WriteString(fmt.Sprintf("ovm.agent_port=%d ", opt.AgentVsockPort))
+	}
+
+	// the guest only streams its logs when told where to
+	if opt.ForwardGuestLogs {
+		sb.WriteString(fmt.Sprintf("ovm.guest_logs_port=%d ", cli.GuestLogVsockPort))
+	}
+
 	if opt.KernelDebug {
 		sb.WriteString("debug ")
 	}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm/internal/consts"
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+func TestMergeKernelCmdline(t *testing.T) {
+	tests := []struct {
+		name                 string
+		persisted, assembled string
+		want                 string
+	}{
+		{
+			name:      "changed agent port",
+			persisted: "console=hvc0 fb_tunnels=none ovm.agent_port=1025",
+			assembled: "console=hvc0 fb_tunnels=none ovm.agent_port=2000",
+			want:      "fb_tunnels=none console=hvc0 ovm.agent_port=2000",
+		},
+		{
+			name:      "dropped flag",
+			persisted: "console=hvc0 maxcpus=2 ovm.guest_logs_port=1030 debug",
+			assembled: "console=hvc0",
+			want:      "console=hvc0",
+		},
+		{
+			name:      "changed clock source and cli mode",
+			persisted: "console=hvc0 clocksource=tsc tsc=reliable systemd.log_color=false",
+			assembled: "console=hvc0 clocksource=hpet",
+			want:      "console=hvc0 clocksource=hpet",
+		},
+		{
+			name:      "added kernel debug",
+			persisted: "console=hvc0 systemd.log_level=debug",
+			assembled: "console=hvc0 debug",
+			want:      "systemd.log_level=debug console=hvc0 debug",
+		},
+		{
+			name:      "edited parameter kept",
+			persisted: "console=hvc0 systemd.log_level=debug",
+			assembled: "console=hvc0 fb_tunnels=none",
+			want:      "systemd.log_level=debug console=hvc0",
+		},
+		{
+			name:      "no-initrd",
+			persisted: "console=hvc0",
+			assembled: "console=hvc0 root=/dev/vda rootwait",
+			want:      "console=hvc0 root=/dev/vda rootwait",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeKernelCmdline(tt.persisted, tt.assembled); got != tt.want {
+				t.Errorf("mergeKernelCmdline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelCMDClockSource(t *testing.T) {
+	if !consts.IsAMD64 {
+		t.Skip("the clock source is only set on amd64")
+	}
+
+	tests := []struct {
+		source      string
+		want        []string
+		tscReliable bool
+	}{
+		{"", []string{"clocksource=tsc"}, true},
+		{"tsc", []string{"clocksource=tsc"}, true},
+		{"hpet", []string{"clocksource=hpet"}, false},
+	}
+
+	for _, tt := range tests {
+		opt := &cli.Context{ClockSource: tt.source, SerialConsoleBaud: cli.DefaultSerialConsoleBaud, AgentVsockPort: cli.DefaultAgentVsockPort}
+		params := strings.Fields(kernelCMD(opt))
+		for _, want := range tt.want {
+			if !slices.Contains(params, want) {
+				t.Errorf("clock source %q: cmdline %v misses %s", tt.source, params, want)
+			}
+		}
+		if got := slices.Contains(params, "tsc=reliable"); got != tt.tscReliable {
+			t.Errorf("clock source %q: tsc=reliable %v, want %v", tt.source, got, tt.tscReliable)
+		}
+	}
+}
+
+func TestKernelCMDGuestWritableRoot(t *testing.T) {
+	writable := []string{"ovm.rootfs_overlay=none", "rootfstype=ext4", "rw"}
+
+	tests := []struct {
+		name     string
+		writable bool
+		overlay  string
+		want     bool
+	}{
+		{"default", false, cli.RootfsOverlayOff, false},
+		{"rootfs-overlay", false, cli.RootfsOverlayTmpfs, false},
+		{"guest-writable-root", true, cli.RootfsOverlayOff, true},
+	}
+
+	for _, tt := range tests {
+		opt := &cli.Context{
+			GuestWritableRoot: tt.writable,
+			RootfsOverlay:     tt.overlay,
+			SerialConsoleBaud: cli.DefaultSerialConsoleBaud,
+			AgentVsockPort:    cli.DefaultAgentVsockPort,
+		}
+		params := strings.Fields(kernelCMD(opt))
+		for _, p := range writable {
+			if got := slices.Contains(params, p); got != tt.want {
+				t.Errorf("%s: %s in cmdline %v is %v, want %v", tt.name, p, params, got, tt.want)
+			}
+		}
+	}
+}
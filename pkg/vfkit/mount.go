@@ -5,49 +5,62 @@ package vfkit
 
 import (
 	"fmt"
+	"path"
 
 	"github.com/crc-org/vfkit/pkg/config"
+	"github.com/oomol-lab/ovm/pkg/cli"
 )
 
-type fs struct {
-	tag      string
-	shareDir string
-}
+// idmapDir is where virtiofs shares with uid mapping are mounted in the guest,
+// bindfs then exposes them at the guest path with the ownership mapped.
+const idmapDir = "/mnt/ovm-idmap"
 
-type _mounts struct {
-	list []fs
-}
+func mountsToVFKit(mounts []cli.Mount) (devices []config.VirtioDevice) {
+	for _, m := range mounts {
+		d, _ := config.VirtioFsNew(m.HostPath, m.Tag)
+		devices = append(devices, d)
+	}
 
-var mounts = &_mounts{
-	list: []fs{
-		{
-			tag:      "vfkit-share-user",
-			shareDir: "/Users",
-		},
-		{
-			tag:      "vfkit-share-var-folders",
-			shareDir: "/var/folders",
-		},
-		{
-			tag:      "vfkit-share-private",
-			shareDir: "/private",
-		},
-	},
+	return devices
 }
 
-func (m *_mounts) toVFKit() (devices []config.VirtioDevice) {
-	for _, fs := range m.list {
-		d, _ := config.VirtioFsNew(fs.shareDir, fs.tag)
-		devices = append(devices, d)
+func mountsToFSTAB(mounts []cli.Mount) (result []string) {
+	for _, m := range mounts {
+		options := "defaults"
+		if m.ReadOnly {
+			options += ",ro"
+		}
+
+		if m.UIDMapping == nil {
+			result = append(result, fmt.Sprintf("%s %s virtiofs %s 0 0", m.Tag, m.GuestPath, options))
+			continue
+		}
+
+		// files owned by the host user are shown as root in the guest, and files created by root are chowned to the host user
+		source := path.Join(idmapDir, m.Tag)
+		result = append(result,
+			fmt.Sprintf("%s %s virtiofs %s 0 0", m.Tag, source, options),
+			fmt.Sprintf("%s %s fuse.bindfs map=%d/0:@%d/@0,x-systemd.requires-mounts-for=%s 0 0", source, m.GuestPath, m.UIDMapping.UID, m.UIDMapping.GID, source),
+		)
 	}
 
-	return devices
+	return result
 }
 
-func (m *_mounts) toFSTAB() (result []string) {
-	for _, fs := range m.list {
-		fstab := fmt.Sprintf("%s %s virtiofs defaults 0 0", fs.tag, fs.shareDir)
-		result = append(result, fstab)
+// idmapCheckCommands returns shell commands that verify the uid mapping of the shares when the guest is ready.
+// A failed check is reported through the ready socket instead of "Ready", so shares never silently write root-owned files.
+func idmapCheckCommands(mounts []cli.Mount) (result []string) {
+	for _, m := range mounts {
+		if m.UIDMapping == nil {
+			continue
+		}
+
+		check := path.Join(m.GuestPath, ".ovm-uid-check")
+		source := path.Join(idmapDir, m.Tag, ".ovm-uid-check")
+		result = append(result,
+			fmt.Sprintf("touch %s; u=$(stat -c %%u %s); rm -f %s", check, source, check),
+			fmt.Sprintf(`[ "$u" = "%d" ] || { echo "mount %s: files created in the guest are not owned by uid %d on the host, is bindfs available in the guest?" | socat - VSOCK-CONNECT:2:1026; exit 1; }`, m.UIDMapping.UID, m.GuestPath, m.UIDMapping.UID),
+		)
 	}
 
 	return result
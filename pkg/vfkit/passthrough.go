@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Code-Hex/vz/v3"
+	"github.com/crc-org/vfkit/pkg/config"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+// addPassthroughDevices attaches the serial devices of -passthrough-device after the console, they are /dev/hvc1 and onwards in the guest.
+// The vfkit config only knows serial ports writing to a file or stdio, so the serial ports of vz are set again, with the console first.
+func addPassthroughDevices(vzVMConfig *vz.VirtualMachineConfiguration, vmC *config.VirtualMachine, opt *cli.Context, log *logger.Context) error {
+	if len(opt.PassthroughDevices) == 0 {
+		return nil
+	}
+
+	var ports []*vz.VirtioConsoleDeviceSerialPortConfiguration
+	for _, dev := range vmC.Devices {
+		serial, ok := dev.(*config.VirtioSerial)
+		if !ok {
+			continue
+		}
+
+		port, err := consolePort(serial)
+		if err != nil {
+			return fmt.Errorf("create console serial port failed: %w", err)
+		}
+		ports = append(ports, port)
+	}
+
+	for _, d := range opt.PassthroughDevices {
+		// kept open while the VM runs
+		f, err := openSerialDevice(d.Path)
+		if err != nil {
+			return fmt.Errorf("open passthrough device %s failed: %w", d.Path, err)
+		}
+
+		attachment, err := vz.NewFileHandleSerialPortAttachment(f, f)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("attach passthrough device %s failed: %w", d.Path, err)
+		}
+
+		port, err := vz.NewVirtioConsoleDeviceSerialPortConfiguration(attachment)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("attach passthrough device %s failed: %w", d.Path, err)
+		}
+
+		log.Infof("passthrough device: %s: %s as /dev/hvc%d", d.Class, d.Path, len(ports))
+		ports = append(ports, port)
+	}
+
+	vzVMConfig.SetSerialPortsVirtualMachineConfiguration(ports)
+
+	if valid, err := vzVMConfig.Validate(); err != nil {
+		return err
+	} else if !valid {
+		return fmt.Errorf("invalid virtual machine configuration with the passthrough devices")
+	}
+
+	return nil
+}
+
+// consolePort is the serial port vfkit creates for the console, stdin is in raw mode already.
+func consolePort(serial *config.VirtioSerial) (*vz.VirtioConsoleDeviceSerialPortConfiguration, error) {
+	var attachment vz.SerialPortAttachment
+	var err error
+	if serial.UsesStdio {
+		attachment, err = vz.NewFileHandleSerialPortAttachment(os.Stdin, os.Stdout)
+	} else {
+		attachment, err = vz.NewFileSerialPortAttachment(serial.LogFile, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return vz.NewVirtioConsoleDeviceSerialPortConfiguration(attachment)
+}
+
+// openSerialDevice opens the tty without waiting for the carrier and puts it into raw mode, the line speed is left as set by stty.
+func openSerialDevice(p string) (*os.File, error) {
+	f, err := os.OpenFile(p, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(f.Fd())
+	attr, err := unix.IoctlGetTermios(fd, unix.TIOCGETA)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	attr.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	attr.Oflag &^= unix.OPOST
+	attr.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	attr.Cflag &^= unix.CSIZE | unix.PARENB
+	attr.Cflag |= unix.CS8 | unix.CLOCAL | unix.CREAD
+	attr.Cc[unix.VMIN] = 1
+	attr.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TIOCSETA, attr); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// the carrier is ignored with CLOCAL now, vz expects blocking reads
+	if err := unix.SetNonblock(fd, false); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// rootfsOverlayDevice is the guest device of the upper layer disk, it follows the optional scratch disk.
+func rootfsOverlayDevice(opt *cli.Context) string {
+	if opt.DiskScratchPath != "" {
+		return "/dev/vde"
+	}
+
+	return "/dev/vdd"
+}
+
+// rootfsOverlayCmdline tells the initrd which upper layer to put over the read-only rootfs,
+// or to mount the rootfs itself writable.
+func rootfsOverlayCmdline(opt *cli.Context) string {
+	if opt.GuestWritableRoot {
+		return "ovm.rootfs_overlay=none rootfstype=ext4 rw"
+	}
+
+	switch opt.RootfsOverlay {
+	case cli.RootfsOverlayTmpfs:
+		return "ovm.rootfs_overlay=tmpfs"
+	case cli.RootfsOverlayDisk:
+		return "ovm.rootfs_overlay=disk:" + rootfsOverlayDevice(opt)
+	default:
+		return ""
+	}
+}
+
+// rootfsOverlayCheckCommands verify at boot that the initrd mounted / as overlay, the rootfs device itself is read-only.
+func rootfsOverlayCheckCommands(opt *cli.Context) []string {
+	if opt.RootfsOverlay == cli.RootfsOverlayOff {
+		return nil
+	}
+
+	return []string{
+		fmt.Sprintf(`cut -d" " -f2,3 /proc/mounts | grep -qx "/ overlay" || { echo "rootfs-overlay %s: / is not mounted as overlay, does the initrd support ovm.rootfs_overlay?" | socat - VSOCK-CONNECT:2:1026; exit 1; }`, opt.RootfsOverlay),
+	}
+}
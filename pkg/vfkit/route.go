@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const (
+	routeUnitPath = "/mnt/overlay/etc/systemd/system/ovm-routes.service"
+	routeWantPath = "/mnt/overlay/etc/systemd/system/multi-user.target.wants/ovm-routes.service"
+)
+
+// routeCommand writes a service which adds the -route once the guest network is up, the DHCP lease of gvproxy only has the default route.
+// Without -route the service of an earlier start is removed, the rootfs may be kept between starts.
+func routeCommand(opt *cli.Context) string {
+	if len(opt.GuestRoutes) == 0 {
+		return fmt.Sprintf("rm -f %s %s", routeWantPath, routeUnitPath)
+	}
+
+	lines := []string{
+		"[Unit]",
+		"Description=Routes of ovm",
+		"Wants=network-online.target",
+		"After=network-online.target",
+		"[Service]",
+		"Type=oneshot",
+		"RemainAfterExit=yes",
+		// eth0 may get its address after network-online.target
+		"Restart=on-failure",
+		"RestartSec=1",
+	}
+	for _, r := range opt.GuestRoutes {
+		lines = append(lines, fmt.Sprintf(`ExecStart=/bin/sh -c "ip route replace %s via %s"`, r.CIDR, r.Gateway))
+	}
+	lines = append(lines, "[Install]", "WantedBy=multi-user.target")
+
+	commands := []string{
+		"mkdir -p " + path.Dir(routeWantPath),
+		fmt.Sprintf(`echo '%s' > %s`, lines[0], routeUnitPath),
+	}
+	for _, l := range lines[1:] {
+		commands = append(commands, fmt.Sprintf(`echo '%s' >> %s`, l, routeUnitPath))
+	}
+	commands = append(commands, fmt.Sprintf("ln -sf %s %s", strings.TrimPrefix(routeUnitPath, "/mnt/overlay"), routeWantPath))
+
+	return strings.Join(commands, "; ")
+}
@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const storageConfPath = "/mnt/overlay/etc/containers/storage.conf"
+
+// storageCommand keeps storage.conf pointed at the data disk after POST /storage/migrate moved the container storage,
+// the rootfs may bring back its own storage.conf on every start.
+func storageCommand(opt *cli.Context) string {
+	if !opt.StorageMigrated {
+		return "true"
+	}
+
+	return fmt.Sprintf(`test -f %[1]s && sed -i -E 's|^graphroot *=.*|graphroot = "%[2]s"|' %[1]s; true`, storageConfPath, containerStoragePath)
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Code-Hex/vz/v3"
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+// terminal keeps the original mode of stdin, the serial console in CLI mode puts it into raw mode.
+type terminal struct {
+	fd     int
+	cooked *unix.Termios
+	// raw is the mode set by the serial console, it is set back when ovm is continued
+	raw *unix.Termios
+}
+
+// saveTerminal must be called before the serial console is created.
+func saveTerminal() *terminal {
+	fd := int(os.Stdin.Fd())
+	cooked, err := unix.IoctlGetTermios(fd, unix.TIOCGETA)
+	if err != nil {
+		return nil
+	}
+
+	return &terminal{
+		fd:     fd,
+		cooked: cooked,
+	}
+}
+
+func (t *terminal) isForeground() bool {
+	pgrp, err := unix.IoctlGetInt(t.fd, unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
+
+// handleSuspend makes Ctrl-Z (SIGTSTP) and fg/bg (SIGCONT) work in CLI mode:
+// the terminal is restored to cooked mode before ovm is stopped, and set back to raw mode when it is continued in the foreground.
+// With PauseOnSuspend the VM is paused while ovm is stopped, otherwise it keeps running.
+func handleSuspend(ctx context.Context, g *errgroup.Group, opt *cli.Context, vm *vz.VirtualMachine, t *terminal, log *logger.Context) {
+	if t == nil {
+		log.Info("stdin is not a terminal, skip handling suspend")
+		return
+	}
+
+	// the terminal is in the raw mode of the serial console here, the config was converted already
+	if raw, err := unix.IoctlGetTermios(t.fd, unix.TIOCGETA); err == nil {
+		t.raw = raw
+	} else {
+		log.Warnf("get terminal mode failed: %v", err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTSTP, syscall.SIGCONT)
+
+	g.Go(func() error {
+		defer signal.Stop(sigs)
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := unix.IoctlSetTermios(t.fd, unix.TIOCSETA, t.cooked); err != nil {
+					log.Warnf("restore terminal failed: %v", err)
+				}
+				return nil
+			case sig := <-sigs:
+				if sig == syscall.SIGTSTP {
+					suspend(opt, vm, t, log)
+				} else {
+					// stopped by SIGSTOP from outside, the terminal mode may have been changed by the shell
+					resumeTerminal(t, log)
+				}
+			}
+		}
+	})
+}
+
+func suspend(opt *cli.Context, vm *vz.VirtualMachine, t *terminal, log *logger.Context) {
+	log.Info("received SIGTSTP, suspending")
+
+	if raw, err := unix.IoctlGetTermios(t.fd, unix.TIOCGETA); err == nil {
+		t.raw = raw
+	} else {
+		log.Warnf("get terminal mode failed: %v", err)
+	}
+	if err := unix.IoctlSetTermios(t.fd, unix.TIOCSETA, t.cooked); err != nil {
+		log.Warnf("restore terminal failed: %v", err)
+	}
+
+	paused := false
+	if opt.PauseOnSuspend {
+		if !vm.CanPause() {
+			log.Warnf("VM can not pause, current state: %s", vm.State())
+		} else if err := vm.Pause(); err != nil {
+			log.Warnf("pause VM failed: %v", err)
+			opt.AuditCLI(log, "suspend: pause", err)
+		} else {
+			log.Info("pause VM success")
+			opt.AuditCLI(log, "suspend: pause", nil)
+			paused = true
+		}
+	}
+
+	// SIGSTOP cannot be caught, the process stops here until SIGCONT
+	_ = syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+
+	log.Info("continued after suspend")
+	resumeTerminal(t, log)
+
+	if paused {
+		if !vm.CanResume() {
+			log.Warnf("VM can not resume, current state: %s", vm.State())
+		} else if err := vm.Resume(); err != nil {
+			log.Warnf("resume VM failed: %v", err)
+			opt.AuditCLI(log, "continue: resume", err)
+		} else {
+			log.Info("resume VM success")
+			opt.AuditCLI(log, "continue: resume", nil)
+		}
+	}
+}
+
+// resumeTerminal sets the raw mode again, but only in the foreground: changing the terminal from the background would stop ovm with SIGTTOU.
+func resumeTerminal(t *terminal, log *logger.Context) {
+	if !t.isForeground() {
+		log.Info("continued in background, keep terminal mode")
+		return
+	}
+
+	if err := unix.IoctlSetTermios(t.fd, unix.TIOCSETA, t.rawMode()); err != nil {
+		log.Warnf("set terminal raw mode failed: %v", err)
+	}
+}
+
+// rawMode returns the saved raw mode, or without one the raw mode derived from the cooked one.
+func (t *terminal) rawMode() *unix.Termios {
+	if t.raw != nil {
+		return t.raw
+	}
+
+	r := *t.cooked
+	r.Iflag &^= unix.ICRNL
+	r.Lflag &^= unix.ICANON | unix.ECHO
+	r.Cc[unix.VMIN] = 1
+	r.Cc[unix.VTIME] = 0
+	return &r
+}
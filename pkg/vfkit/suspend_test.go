@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTerminalRawMode(t *testing.T) {
+	cooked := &unix.Termios{Iflag: unix.ICRNL | unix.IXON, Lflag: unix.ICANON | unix.ECHO | unix.ISIG}
+	cooked.Cc[unix.VMIN] = 0
+	cooked.Cc[unix.VTIME] = 5
+
+	term := &terminal{cooked: cooked}
+	raw := term.rawMode()
+	if raw.Iflag != unix.IXON || raw.Lflag != unix.ISIG || raw.Cc[unix.VMIN] != 1 || raw.Cc[unix.VTIME] != 0 {
+		t.Errorf("derived raw mode = %+v", raw)
+	}
+	if cooked.Lflag != unix.ICANON|unix.ECHO|unix.ISIG || cooked.Cc[unix.VTIME] != 5 {
+		t.Errorf("the cooked mode was changed: %+v", cooked)
+	}
+
+	// the mode of the serial console is kept as is, e.g. it also clears ISIG
+	saved := &unix.Termios{Lflag: 0}
+	term.raw = saved
+	if term.rawMode() != saved {
+		t.Error("the saved raw mode is not used")
+	}
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+// swapFile is the name of the swap file on the tmp disk (vdb), wherever the guest mounted it.
+const swapFile = "ovm.swap"
+
+// swapCommands set up the swap file of -guest-swap when the guest is ready.
+// Without -guest-swap a swap file of an earlier start is removed. A failed swap only logs to the console, the guest still starts.
+func swapCommands(opt *cli.Context) []string {
+	locate := fmt.Sprintf(`m=$(grep "^/dev/vdb " /proc/mounts | cut -d" " -f2); f="$m/%s"`, swapFile)
+
+	if opt.GuestSwapBytes == 0 {
+		return []string{
+			locate,
+			`[ -n "$m" ] && [ -e "$f" ] && { swapoff "$f" 2>/dev/null; rm -f "$f"; }; true`,
+		}
+	}
+
+	// the file is kept between starts, it is only created again when the size changed
+	return []string{
+		locate,
+		fmt.Sprintf(`[ -n "$m" ] && { [ "$(stat -c %%s "$f" 2>/dev/null)" = "%[1]d" ] || { rm -f "$f"; fallocate -l %[1]d "$f"; }; chmod 600 "$f" && mkswap "$f" >/dev/null && swapon "$f"; } || echo "ovm: enabling swap on the tmp disk failed" > /dev/console; true`, opt.GuestSwapBytes),
+	}
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+)
+
+const ulimitConfPath = "/mnt/overlay/etc/systemd/system.conf.d/ovm-ulimit.conf"
+
+// ulimitCommand writes the -guest-ulimit as the default limits of systemd, before it starts any service (sshd, podman, ...).
+// Without -guest-ulimit the file of an earlier start is removed, the rootfs may be kept between starts.
+func ulimitCommand(opt *cli.Context) string {
+	if len(opt.GuestUlimits) == 0 {
+		return "rm -f " + ulimitConfPath
+	}
+
+	commands := []string{
+		"mkdir -p " + path.Dir(ulimitConfPath),
+		fmt.Sprintf(`echo "[Manager]" > %s`, ulimitConfPath),
+	}
+	for _, u := range opt.GuestUlimits {
+		commands = append(commands, fmt.Sprintf("echo DefaultLimit%s=%s:%s >> %s", u.SystemdKey(), u.Soft, u.Hard, ulimitConfPath))
+	}
+
+	return strings.Join(commands, "; ")
+}
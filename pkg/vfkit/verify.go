@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package vfkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/ipc/event"
+	"github.com/oomol-lab/ovm/pkg/logger"
+	"github.com/oomol-lab/ovm/pkg/powermonitor"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+const (
+	verifyChunkSize = 1 << 20
+
+	// the verification pauses while the guest reads or writes its disks faster than this
+	heavyGuestIO = 50 << 20
+
+	verifyCheckInterval = 5 * time.Second
+	verifyBusyRetry     = time.Minute
+)
+
+type corruptArtifact struct {
+	Artifact string `json:"artifact"`
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// verifyArtifacts re-hashes the installed artifacts in the background, a while after the VM is ready.
+// Corrupted artifacts are reported and marked dirty in versions.json, so they are copied again on the next start.
+func verifyArtifacts(ctx context.Context, g *errgroup.Group, opt *cli.Context, log *logger.Context) {
+	if opt.VerifyArtifactsDelay == 0 {
+		return
+	}
+
+	if opt.PowerSaveMode {
+		log.Info("skip background artifact verification in power save mode")
+		return
+	}
+
+	g.Go(func() error {
+		for opt.BootedAt().IsZero() {
+			if !sleepCtx(ctx, time.Second) {
+				return nil
+			}
+		}
+
+		if !sleepCtx(ctx, opt.VerifyArtifactsDelay) {
+			return nil
+		}
+
+		versions, err := cli.ReadVersions(opt.VersionsPath)
+		if err != nil {
+			log.Warnf("skip background artifact verification, read versions failed: %v", err)
+			return nil
+		}
+
+		v := &verifier{
+			opt:     opt,
+			log:     log,
+			limiter: rate.NewLimiter(rate.Limit(opt.VerifyArtifactsRate<<20), verifyChunkSize),
+		}
+
+		for _, a := range []struct{ key, path string }{
+			{"kernel", opt.KernelPath},
+			{"initrd", opt.InitrdPath},
+			{"rootfs", opt.GuestRootFS.Artifact()},
+		} {
+			// the guest writes to the rootfs, re-copying it would throw the changes away
+			if a.key == "rootfs" && opt.GuestWritableRoot {
+				continue
+			}
+
+			pv, ok := versions.Provenance[a.key]
+			if a.path == "" || !ok || pv.Digest == "" {
+				continue
+			}
+
+			digest, err := v.digest(ctx, a.path)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warnf("background verification of %s failed: %v", a.path, err)
+				}
+				return nil
+			}
+
+			if digest == pv.Digest {
+				log.Infof("background verification of %s passed", a.key)
+				continue
+			}
+
+			log.Errorf("%s %s is corrupted, expected digest %s, actual %s, it is copied again on the next start", a.key, a.path, pv.Digest, digest)
+
+			if err := cli.MarkArtifactDirty(opt.VersionsPath, a.key); err != nil {
+				log.Warnf("mark %s dirty failed: %v", a.key, err)
+			}
+
+			data, _ := json.Marshal(&corruptArtifact{
+				Artifact: a.key,
+				Path:     a.path,
+				Expected: pv.Digest,
+				Actual:   digest,
+			})
+			event.NotifyWithMessage(event.ArtifactCorrupt, string(data))
+		}
+
+		return nil
+	})
+}
+
+type verifier struct {
+	opt     *cli.Context
+	log     *logger.Context
+	limiter *rate.Limiter
+
+	lastIO     uint64
+	lastIOTime time.Time
+}
+
+// digest hashes the file at the throttled rate, pausing while the host or the guest is busy.
+func (v *verifier) digest(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, verifyChunkSize)
+	lastCheck := time.Time{}
+
+	for {
+		if time.Since(lastCheck) >= verifyCheckInterval {
+			if err := v.waitIdle(ctx); err != nil {
+				return "", err
+			}
+			lastCheck = time.Now()
+		}
+
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := v.limiter.WaitN(ctx, n); err != nil {
+				return "", err
+			}
+			h.Write(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// waitIdle returns once the host is on AC power and the guest is not doing heavy IO.
+func (v *verifier) waitIdle(ctx context.Context) error {
+	paused := false
+
+	for {
+		reason := v.busy()
+		if reason == "" {
+			if paused {
+				v.log.Info("resume background artifact verification")
+			}
+			return nil
+		}
+
+		if !paused {
+			v.log.Infof("pause background artifact verification: %s", reason)
+			paused = true
+		}
+
+		if !sleepCtx(ctx, verifyBusyRetry) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (v *verifier) busy() string {
+	if powermonitor.OnBattery() {
+		return "host is on battery"
+	}
+
+	total, err := v.guestDiskIO()
+	if err != nil {
+		v.log.Tracef(logger.Target, "read guest disk stats failed: %v", err)
+		return ""
+	}
+
+	now := time.Now()
+	lastIO, lastTime := v.lastIO, v.lastIOTime
+	v.lastIO, v.lastIOTime = total, now
+
+	if lastTime.IsZero() || total < lastIO {
+		return ""
+	}
+
+	if perSecond := float64(total-lastIO) / now.Sub(lastTime).Seconds(); perSecond > heavyGuestIO {
+		return fmt.Sprintf("guest disk IO at %.0f MiB/s", perSecond/(1<<20))
+	}
+
+	return ""
+}
+
+// guestDiskIO returns the bytes read and written by the virtio block devices of the guest since boot.
+func (v *verifier) guestDiskIO() (uint64, error) {
+	out, err := v.opt.RunInGuest("cat /proc/diskstats")
+	if err != nil {
+		return 0, err
+	}
+
+	var sectors uint64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// whole disks only, partitions are counted in their disk
+		if len(fields) < 10 || len(fields[2]) != 3 || !strings.HasPrefix(fields[2], "vd") {
+			continue
+		}
+
+		read, err1 := strconv.ParseUint(fields[5], 10, 64)
+		written, err2 := strconv.ParseUint(fields[9], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		sectors += read + written
+	}
+
+	return sectors * 512, nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
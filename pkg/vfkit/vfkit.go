@@ -9,23 +9,33 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/Code-Hex/vz/v3"
 	"github.com/crc-org/vfkit/pkg/vf"
 	"github.com/oomol-lab/ovm/pkg/channel"
 	"github.com/oomol-lab/ovm/pkg/cli"
+	"github.com/oomol-lab/ovm/pkg/handover"
 	"github.com/oomol-lab/ovm/pkg/ipc/event"
 	"github.com/oomol-lab/ovm/pkg/ipc/restful"
 	"github.com/oomol-lab/ovm/pkg/logger"
 	"github.com/oomol-lab/ovm/pkg/powermonitor"
+	"github.com/oomol-lab/ovm/pkg/utils"
 	"golang.org/x/sync/errgroup"
 )
 
-func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
+func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) (err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
+	// the VM was not started, nothing has to reach it while ovm stops
+	defer func() {
+		if err != nil {
+			opt.MarkVMStopped()
+		}
+	}()
+
 	log, err := logger.New(opt.LogPath, opt.Name+"-vfkit")
 	if err != nil {
 		return fmt.Errorf("create vfkit logger error: %v", err)
@@ -37,12 +47,23 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		return err
 	}
 
+	// the serial console puts the terminal into raw mode when the config is converted
+	var term *terminal
+	if opt.IsCliMode {
+		term = saveTerminal()
+	}
+
 	vzVMConfig, err := vf.ToVzVirtualMachineConfig(vmC)
 	if err != nil {
 		log.Errorf("converting virtual machine config to vz failed: %v", err)
 		return err
 	}
 
+	if err := addPassthroughDevices(vzVMConfig, vmC, opt, log); err != nil {
+		log.Errorf("adding passthrough devices failed: %v", err)
+		return err
+	}
+
 	vm, err := vz.NewVirtualMachine(vzVMConfig)
 	if err != nil {
 		log.Errorf("creating vz virtual machine failed: %v", err)
@@ -50,12 +71,43 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 	}
 
 	{
-		nl, err := net.Listen("unix", opt.RestfulSocketPath)
-		if err != nil {
-			log.Errorf("create server failed: %v", err)
+		r := restful.New(vm, vmC, log, opt)
+		r.StartExports(ctx, g)
+
+		// without the restful socket (-disable-sockets restful) only the health endpoint and the exports are served
+		if opt.RestfulSocketPath != "" {
+			nl := opt.InheritedListener(cli.HandoverRestful)
+			if nl == nil {
+				nl, err = utils.ListenUnix(opt.RestfulSocketPath, opt.SocketBacklog)
+				if err != nil {
+					log.Errorf("create server failed: %v", err)
+					return err
+				}
+			}
+			r.Start(ctx, g, nl)
+
+			// the ovm replacing this one takes the listener, clients then wait in the backlog instead of being refused
+			if err := handover.Serve(ctx, g, opt.HandoverSocketPath, map[string]net.Listener{cli.HandoverRestful: nl}, log, nil); err != nil {
+				log.Warnf("serve handover failed, the ovm replacing this one stops it first: %v", err)
+			}
+		}
+
+		if opt.HealthEndpointPort != 0 {
+			hl, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", opt.HealthEndpointPort))
+			if err != nil {
+				log.Errorf("create health endpoint failed: %v", err)
+				return err
+			}
+			r.StartHealth(ctx, g, hl)
+		}
+	}
+
+	// in CLI mode the serial console is on stdio
+	if !opt.IsCliMode {
+		if err := serveConsole(ctx, g, opt, log); err != nil {
+			log.Errorf("create console socket failed: %v", err)
 			return err
 		}
-		restful.New(vm, vmC, log, opt).Start(ctx, g, nl)
 	}
 
 	select {
@@ -76,6 +128,10 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		return err
 	}
 
+	if opt.IsCliMode {
+		handleSuspend(ctx, g, opt, vm, term, log)
+	}
+
 	vmState := make(chan vz.VirtualMachineState, 1)
 
 	g.Go(func() error {
@@ -100,11 +156,16 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		return err
 	}
 
-	event.Notify(event.IgnitionProgress)
+	// without an initrd nothing receives the ignition, the image has to report ready by itself
+	if opt.NoInitrd {
+		log.Info("skip ignition, because booted without initrd")
+	} else {
+		event.Notify(event.IgnitionProgress)
 
-	if err := ignition(ctx, g, opt, log); err != nil {
-		log.Errorf("ignition failed: %v", err)
-		return err
+		if err := ignition(ctx, g, opt, log); err != nil {
+			log.Errorf("ignition failed: %v", err)
+			return err
+		}
 	}
 
 	if err := waitForVMState(vmState, vz.VirtualMachineStateRunning, time.After(5*time.Second)); err != nil {
@@ -114,6 +175,9 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 
 	log.Infof("virtual machine is running")
 
+	reportBoot(g, opt, log)
+	verifyArtifacts(ctx, g, opt, log)
+
 	g.Go(func() error {
 		devs := vmC.VirtioVsockDevices()
 		release, err := connectVsocks(vm, devs, log)
@@ -131,10 +195,13 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 	})
 
 	g.Go(func() error {
+		// a stop requested by ovm is recorded before, this records the guest powering off or crashing itself
 		if err := waitForVMState(vmState, vz.VirtualMachineStateStopped, nil); err != nil {
 			log.Errorf("waiting for VM to stop failed: %v", err)
+			recordShutdown(opt, log, cli.ShutdownCrashPrefix+"vm-error", err.Error())
 			return err
 		}
+		recordShutdown(opt, log, cli.ShutdownGuest, "")
 
 		msg := "VM is stopped in waitForVMState"
 		log.Warn(msg)
@@ -145,11 +212,12 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 		<-ctx.Done()
 		log.Infof("stop VM, because context done")
 
-		if err := stopVM(vm, log); err != nil {
+		if err := stopVM(vm, opt, log); err != nil {
 			log.Errorf("error stopping VM: %v", err)
 		} else {
 			log.Infof("VM is stopped in stopVM")
 		}
+		opt.MarkVMStopped()
 
 		return nil
 	})
@@ -157,6 +225,12 @@ func Run(ctx context.Context, g *errgroup.Group, opt *cli.Context) error {
 	return nil
 }
 
+func recordShutdown(opt *cli.Context, log *logger.Context, reason, detail string) {
+	if err := opt.RecordShutdown(reason, "", detail); err != nil {
+		log.Warnf("record shutdown failed: %v", err)
+	}
+}
+
 func waitForVMState(chState <-chan vz.VirtualMachineState, state vz.VirtualMachineState, timeout <-chan time.Time) error {
 	for {
 		select {
@@ -173,8 +247,8 @@ func waitForVMState(chState <-chan vz.VirtualMachineState, state vz.VirtualMachi
 	}
 }
 
-func stopVM(vm *vz.VirtualMachine, log *logger.Context) error {
-	err := requestStopVM(vm, log)
+func stopVM(vm *vz.VirtualMachine, opt *cli.Context, log *logger.Context) error {
+	err := requestStopVM(vm, opt, log)
 	if err == nil {
 		return nil
 	}
@@ -198,8 +272,11 @@ func stopVM(vm *vz.VirtualMachine, log *logger.Context) error {
 	return nil
 }
 
-func requestStopVM(vm *vz.VirtualMachine, log *logger.Context) error {
+// requestStopVM asks the guest to stop, with -shutdown-command or the ACPI power button, and fails when it did not stop within the grace period.
+func requestStopVM(vm *vz.VirtualMachine, opt *cli.Context, log *logger.Context) error {
 	stateAlreadyStopping := false
+	shutdownCommandSent := false
+	var shutdownCommandFailed atomic.Bool
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -225,7 +302,19 @@ func requestStopVM(vm *vz.VirtualMachine, log *logger.Context) error {
 			return nil
 
 		default:
-			if vm.CanRequestStop() {
+			if opt.ShutdownCommand != "" && !shutdownCommandFailed.Load() {
+				if !shutdownCommandSent {
+					shutdownCommandSent = true
+					log.Infof("requesting VM to stop with: %s", opt.ShutdownCommand)
+					// the command may hang with the guest, the state is still polled until the grace period ends
+					go func() {
+						if err := opt.RunShutdownCommand(); err != nil {
+							log.Errorf("shutdown command failed: %v. Requesting VM to stop", err)
+							shutdownCommandFailed.Store(true)
+						}
+					}()
+				}
+			} else if vm.CanRequestStop() {
 				log.Infof("requesting VM to stop")
 				if ok, err := vm.RequestStop(); err != nil || !ok {
 					if err != nil {